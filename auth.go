@@ -2,8 +2,46 @@
 
 package ssb
 
-import refs "go.mindeco.de/ssb-refs"
+import (
+	"errors"
+	"fmt"
+
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+)
 
 type Authorizer interface {
 	Authorize(remote *refs.FeedRef) error
 }
+
+// OnlySelf returns an Authorizer that only lets self through, like the local user of a bot
+func OnlySelf(self *refs.FeedRef) Authorizer {
+	return selfChecker{self}
+}
+
+type selfChecker struct {
+	me *refs.FeedRef
+}
+
+func (sc selfChecker) Authorize(remote *refs.FeedRef) error {
+	if sc.me.Equal(remote) {
+		return nil
+	}
+	return fmt.Errorf("not authorized")
+}
+
+// ErrPrivateNotAllowed is returned by AuthorizePrivate if the remote may not read private messages
+var ErrPrivateNotAllowed = errors.New("private messages are only available to the local user")
+
+// AuthorizePrivate checks that the remote of req may get private messages decrypted, which isSelf decides.
+// The handlers call it for requests that ask for private messages.
+func AuthorizePrivate(req *muxrpc.Request, isSelf Authorizer) error {
+	remote, err := GetFeedRefFromAddr(req.RemoteAddr())
+	if err != nil {
+		return fmt.Errorf("failed to establish remote: %w", err)
+	}
+	if err := isSelf.Authorize(remote); err != nil {
+		return ErrPrivateNotAllowed
+	}
+	return nil
+}
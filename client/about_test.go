@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/client"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+	"go.cryptoscope.co/ssb/sbot"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestAboutHistory(t *testing.T) {
+	r := require.New(t)
+
+	srvRepo := filepath.Join("testrun", t.Name(), "serv")
+	os.RemoveAll(srvRepo)
+
+	kpArny, err := repo.NewKeyPair(repo.New(srvRepo), "arny", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	srv, err := sbot.New(
+		sbot.WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		sbot.WithRepoPath(srvRepo),
+		sbot.WithListenAddr(":0"))
+	r.NoError(err, "sbot srv init failed")
+
+	var srvErrc = make(chan error, 1)
+	go func() {
+		err := srv.Network.Serve(context.TODO())
+		if err != nil {
+			srvErrc <- errors.Wrap(err, "ali serve exited")
+		}
+		close(srvErrc)
+	}()
+
+	kp, err := ssb.LoadKeyPair(filepath.Join(srvRepo, "secret"))
+	r.NoError(err, "failed to load servers keypair")
+
+	c, err := client.NewTCP(kp, srv.Network.GetListenAddr())
+	r.NoError(err, "failed to make client connection")
+
+	publishAs := func(as string, content map[string]interface{}) *refs.MessageRef {
+		var ref *refs.MessageRef
+		var err error
+		if as == "" {
+			ref, err = c.Publish(content)
+		} else {
+			ref, err = srv.PublishAs(as, content)
+		}
+		r.NoError(err)
+		time.Sleep(5 * time.Millisecond)
+		return ref
+	}
+
+	publishAs("", map[string]interface{}{"type": "about", "about": kp.Id.Ref(), "name": "srv"})
+	publishAs("arny", map[string]interface{}{"type": "about", "about": kp.Id.Ref(), "name": "server"})
+	publishAs("", map[string]interface{}{"type": "about", "about": kp.Id.Ref(), "name": "the-server", "description": "hello"})
+
+	// a gathering by arny, with fields the old index dropped
+	gathering := publishAs("arny", map[string]interface{}{"type": "gathering"})
+	publishAs("arny", map[string]interface{}{"type": "about", "about": gathering.Ref(), "title": "party", "startDateTime": map[string]interface{}{"epoch": 1600000000000}})
+	publishAs("", map[string]interface{}{"type": "about", "about": gathering.Ref(), "title": "better party", "location": "here"})
+	srv.WaitUntilIndexesAreSynced()
+
+	hist, err := c.NamesHistory(message.AboutHistoryArgs{About: kp.Id.Ref()})
+	r.NoError(err)
+	r.Len(hist, 3)
+	r.Equal(`"srv"`, string(hist[0].Value))
+	r.True(hist[0].Self)
+	r.Equal(`"server"`, string(hist[1].Value))
+	r.False(hist[1].Self)
+	r.True(hist[1].Author.Equal(kpArny.Id))
+	r.Equal(`"the-server"`, string(hist[2].Value))
+
+	// the old api still works
+	name, err := c.NamesSignifier(*kp.Id)
+	r.NoError(err)
+	r.Equal("the-server", name)
+
+	latest, err := c.AboutLatestValues(message.AboutLatestArgs{About: kp.Id.Ref(), Keys: []string{"name"}})
+	r.NoError(err)
+	r.Len(latest, 1)
+	r.Equal(`"the-server"`, string(latest["name"].Value))
+	r.NotNil(latest["name"].Self)
+	r.Len(latest["name"].Others, 1)
+	r.Equal(`"server"`, string(latest["name"].Others[0].Value))
+
+	// all fields of the gathering, arny is the author and so self
+	latest, err = c.AboutLatestValues(message.AboutLatestArgs{About: gathering.Ref()})
+	r.NoError(err)
+	r.Len(latest, 3)
+	r.Equal(`"party"`, string(latest["title"].Value))
+	r.True(latest["title"].Self.Author.Equal(kpArny.Id))
+	r.Len(latest["title"].Others, 1)
+	r.Equal(`"better party"`, string(latest["title"].Others[0].Value))
+	r.Nil(latest["location"].Self)
+	r.Equal(`"here"`, string(latest["location"].Value))
+	r.JSONEq(`{"epoch": 1600000000000}`, string(latest["startDateTime"].Value))
+
+	r.NoError(c.Close())
+	srv.Shutdown()
+	r.NoError(srv.Close())
+	r.NoError(<-srvErrc)
+}
@@ -22,6 +22,8 @@ import (
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/blobstore"
 	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/metafeeds"
+	"go.cryptoscope.co/ssb/plugins/feeds"
 	"go.cryptoscope.co/ssb/plugins/whoami"
 	refs "go.mindeco.de/ssb-refs"
 )
@@ -281,6 +283,26 @@ func (c Client) NamesImageFor(ref refs.FeedRef) (*refs.BlobRef, error) {
 	return refs.ParseBlobRef(blobRef)
 }
 
+// NamesHistory returns all the values that were assigned to a field of a feed or message, oldest first
+func (c Client) NamesHistory(o message.AboutHistoryArgs) ([]message.AboutValue, error) {
+	var hist []message.AboutValue
+	err := c.Async(c.rootCtx, &hist, muxrpc.TypeJSON, muxrpc.Method{"names", "history"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: names.history failed: %w", err)
+	}
+	return hist, nil
+}
+
+// AboutLatestValues returns the current values of the fields of a feed or message
+func (c Client) AboutLatestValues(o message.AboutLatestArgs) (map[string]message.AboutLatest, error) {
+	var latest map[string]message.AboutLatest
+	err := c.Async(c.rootCtx, &latest, muxrpc.TypeJSON, muxrpc.Method{"about", "latestValues"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: about.latestValues failed: %w", err)
+	}
+	return latest, nil
+}
+
 func (c Client) Publish(v interface{}) (*refs.MessageRef, error) {
 	var resp string
 	err := c.Async(c.rootCtx, &resp, muxrpc.TypeString, muxrpc.Method{"publish"}, v)
@@ -331,6 +353,15 @@ func (c Client) CreateLogStream(o message.CreateLogArgs) (*muxrpc.ByteSource, er
 	return src, nil
 }
 
+// CreateFeedStream returns the messages sorted by their claimed timestamps
+func (c Client) CreateFeedStream(o message.CreateLogArgs) (*muxrpc.ByteSource, error) {
+	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"createFeedStream"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: failed to create stream: %w", err)
+	}
+	return src, nil
+}
+
 func (c Client) CreateHistoryStream(o message.CreateHistArgs) (*muxrpc.ByteSource, error) {
 	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"createHistoryStream"}, o)
 	if err != nil {
@@ -347,6 +378,192 @@ func (c Client) MessagesByType(o message.MessagesByTypeArgs) (*muxrpc.ByteSource
 	return src, nil
 }
 
+// Query returns the messages matching the filter, each wrapped in a message.QueryReply
+func (c Client) Query(o message.QueryArgs) (*muxrpc.ByteSource, error) {
+	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"query", "read"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient/query: failed to create stream: %w", err)
+	}
+	return src, nil
+}
+
+// Links returns one message.LinkReply for each message that links to o.Dest
+func (c Client) Links(o message.LinksArgs) (*muxrpc.ByteSource, error) {
+	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"links"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient/links: failed to create stream: %w", err)
+	}
+	return src, nil
+}
+
+// Backlinks returns the messages that link to o.Dest, sorted by their claimed timestamp
+func (c Client) Backlinks(o message.BacklinksArgs) (*muxrpc.ByteSource, error) {
+	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"backlinks", "read"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient/backlinks: failed to create stream: %w", err)
+	}
+	return src, nil
+}
+
+// Search returns one message.SearchReply per match, ranked by relevance
+func (c Client) Search(o message.SearchArgs) (*muxrpc.ByteSource, error) {
+	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"search", "query"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient/search: failed to create stream: %w", err)
+	}
+	return src, nil
+}
+
+// Thread returns the root and the replies of a thread in causal order
+func (c Client) Thread(o message.ThreadArgs) (*message.ThreadReply, error) {
+	var reply message.ThreadReply
+	err := c.Async(c.rootCtx, &reply, muxrpc.TypeJSON, muxrpc.Method{"threads", "get"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: threads.get failed: %w", err)
+	}
+	return &reply, nil
+}
+
+// RecentThreads returns one message.ThreadSummary per thread, the most recently active first
+func (c Client) RecentThreads(o message.RecentThreadsArgs) (*muxrpc.ByteSource, error) {
+	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"threads", "recent"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient/threads: failed to create stream: %w", err)
+	}
+	return src, nil
+}
+
+// ChannelsList returns one message.ChannelSummary per channel
+func (c Client) ChannelsList(o message.ChannelsListArgs) (*muxrpc.ByteSource, error) {
+	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"channels", "list"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient/channels: failed to create stream: %w", err)
+	}
+	return src, nil
+}
+
+// ChannelRead returns the posts of a channel
+func (c Client) ChannelRead(o message.ChannelReadArgs) (*muxrpc.ByteSource, error) {
+	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"channels", "read"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient/channels: failed to create stream: %w", err)
+	}
+	return src, nil
+}
+
+// VotesGet returns the current votes on a message
+func (c Client) VotesGet(ref *refs.MessageRef) (*message.VoteTotals, error) {
+	var totals message.VoteTotals
+	err := c.Async(c.rootCtx, &totals, muxrpc.TypeJSON, muxrpc.Method{"votes", "get"}, ref.Ref())
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: votes.get failed: %w", err)
+	}
+	return &totals, nil
+}
+
+// VotesStream returns the current message.VoteTotals of a message and then again whenever they change
+func (c Client) VotesStream(ref *refs.MessageRef) (*muxrpc.ByteSource, error) {
+	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"votes", "stream"}, ref.Ref())
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient/votes: failed to create stream: %w", err)
+	}
+	return src, nil
+}
+
+// GatheringsList returns a source of message.Gathering, upcoming ones by default
+func (c Client) GatheringsList(o message.GatheringsListArgs) (*muxrpc.ByteSource, error) {
+	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"gatherings", "list"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient/gatherings: failed to create stream: %w", err)
+	}
+	return src, nil
+}
+
+// GatheringsGet returns the current state of a gathering
+func (c Client) GatheringsGet(ref *refs.MessageRef) (*message.Gathering, error) {
+	var g message.Gathering
+	err := c.Async(c.rootCtx, &g, muxrpc.TypeJSON, muxrpc.Method{"gatherings", "get"}, ref.Ref())
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: gatherings.get failed: %w", err)
+	}
+	return &g, nil
+}
+
+// GatheringsAttend publishes that the bot attends a gathering (or no longer does) and returns the key of that message
+func (c Client) GatheringsAttend(o message.GatheringsAttendArgs) (*refs.MessageRef, error) {
+	var v string
+	err := c.Async(c.rootCtx, &v, muxrpc.TypeString, muxrpc.Method{"gatherings", "attend"}, o)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: gatherings.attend failed: %w", err)
+	}
+	return refs.ParseMessageRef(v)
+}
+
+// FeedsForked returns the evidence of all feeds that are quarantined because they forked
+func (c Client) FeedsForked() ([]message.ForkEvidence, error) {
+	var lst []message.ForkEvidence
+	err := c.Async(c.rootCtx, &lst, muxrpc.TypeJSON, muxrpc.Method{"feeds", "forked"})
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: feeds.forked failed: %w", err)
+	}
+	return lst, nil
+}
+
+// FeedsClearForked lifts the quarantine of a forked feed so that it's replicated again.
+// With drop the stored messages of the feed are removed first, so that it is fetched again from the start.
+func (c Client) FeedsClearForked(ref *refs.FeedRef, drop bool) error {
+	var v string
+	err := c.Async(c.rootCtx, &v, muxrpc.TypeString, muxrpc.Method{"feeds", "clearForked"}, ref.Ref(), feeds.ClearForkedArgs{Drop: drop})
+	if err != nil {
+		return fmt.Errorf("ssbClient: feeds.clearForked failed: %w", err)
+	}
+	return nil
+}
+
+// FeedsCreate makes a new feed that the bot owns, format is a feed reference suffix like refs.RefAlgoFeedGabby
+func (c Client) FeedsCreate(name, format string) (*refs.FeedRef, error) {
+	var owned feeds.OwnedFeed
+	err := c.Async(c.rootCtx, &owned, muxrpc.TypeJSON, muxrpc.Method{"feeds", "create"}, feeds.CreateArgs{Name: name, Format: format})
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: feeds.create failed: %w", err)
+	}
+	return owned.ID, nil
+}
+
+// FeedsPublishAs publishes v on the feed with the name that the bot owns
+func (c Client) FeedsPublishAs(name string, v interface{}) (*refs.MessageRef, error) {
+	var resp string
+	err := c.Async(c.rootCtx, &resp, muxrpc.TypeString, muxrpc.Method{"feeds", "publishAs"}, name, v)
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: feeds.publishAs failed: %w", err)
+	}
+	msgRef, err := refs.ParseMessageRef(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new message reference: %w", err)
+	}
+	return msgRef, nil
+}
+
+// FeedsOwned lists the additional feeds the bot owns
+func (c Client) FeedsOwned() ([]feeds.OwnedFeed, error) {
+	var lst []feeds.OwnedFeed
+	err := c.Async(c.rootCtx, &lst, muxrpc.TypeJSON, muxrpc.Method{"feeds", "owned"})
+	if err != nil {
+		return nil, fmt.Errorf("ssbClient: feeds.owned failed: %w", err)
+	}
+	return lst, nil
+}
+
+// MetafeedsTree returns root with all the subfeeds it announced, recursively
+func (c Client) MetafeedsTree(root *refs.FeedRef) (metafeeds.Node, error) {
+	var tree metafeeds.Node
+	err := c.Async(c.rootCtx, &tree, muxrpc.TypeJSON, muxrpc.Method{"metafeeds", "tree"}, root.Ref())
+	if err != nil {
+		return metafeeds.Node{}, fmt.Errorf("ssbClient: metafeeds.tree failed: %w", err)
+	}
+	return tree, nil
+}
+
 func (c Client) Tangles(o message.TanglesArgs) (*muxrpc.ByteSource, error) {
 	src, err := c.Source(c.rootCtx, muxrpc.TypeJSON, muxrpc.Method{"tangles", "replies"}, o)
 	if err != nil {
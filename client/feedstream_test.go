@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/client"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/sbot"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestCreateFeedStream(t *testing.T) {
+	r := require.New(t)
+
+	srvRepo := filepath.Join("testrun", t.Name(), "serv")
+	os.RemoveAll(srvRepo)
+
+	srv, err := sbot.New(
+		sbot.WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		sbot.WithRepoPath(srvRepo),
+		sbot.WithListenAddr(":0"))
+	r.NoError(err, "sbot srv init failed")
+
+	var srvErrc = make(chan error, 1)
+	go func() {
+		err := srv.Network.Serve(context.TODO())
+		if err != nil {
+			srvErrc <- errors.Wrap(err, "ali serve exited")
+		}
+		close(srvErrc)
+	}()
+
+	kp, err := ssb.LoadKeyPair(filepath.Join(srvRepo, "secret"))
+	r.NoError(err, "failed to load servers keypair")
+
+	c, err := client.NewTCP(kp, srv.Network.GetListenAddr())
+	r.NoError(err, "failed to make client connection")
+
+	var published []string
+	for i := 0; i < 5; i++ {
+		ref, err := c.Publish(testMsg{"test", "sorted", i})
+		r.NoError(err)
+		published = append(published, ref.Ref())
+		time.Sleep(5 * time.Millisecond) // make sure the timestamps differ
+	}
+	srv.WaitUntilIndexesAreSynced()
+
+	readAll := func(src *muxrpc.ByteSource) []refs.KeyValueRaw {
+		var msgs []refs.KeyValueRaw
+		for src.Next(context.TODO()) {
+			var msg refs.KeyValueRaw
+			err := src.Reader(func(rd io.Reader) error {
+				return json.NewDecoder(rd).Decode(&msg)
+			})
+			r.NoError(err)
+			msgs = append(msgs, msg)
+		}
+		r.NoError(src.Err())
+		return msgs
+	}
+	keysOf := func(msgs []refs.KeyValueRaw) []string {
+		var lst []string
+		for _, m := range msgs {
+			lst = append(lst, m.Key().Ref())
+		}
+		return lst
+	}
+
+	var args message.CreateLogArgs
+	args.Keys = true
+	args.Limit = -1
+
+	// oldest first
+	src, err := c.CreateFeedStream(args)
+	r.NoError(err)
+	all := readAll(src)
+	r.Equal(published, keysOf(all))
+
+	// newest first
+	args.Reverse = true
+	src, err = c.CreateFeedStream(args)
+	r.NoError(err)
+	var reversed []string
+	for i := len(published) - 1; i >= 0; i-- {
+		reversed = append(reversed, published[i])
+	}
+	r.Equal(reversed, keysOf(readAll(src)))
+
+	// limit
+	args.Limit = 2
+	src, err = c.CreateFeedStream(args)
+	r.NoError(err)
+	r.Equal(reversed[:2], keysOf(readAll(src)))
+
+	// range on the claimed timestamps
+	args.Reverse = false
+	args.Limit = -1
+	args.Gt = all[1].Claimed().UnixNano() / int64(time.Millisecond)
+	args.Lt = all[4].Claimed().UnixNano() / int64(time.Millisecond)
+	src, err = c.CreateFeedStream(args)
+	r.NoError(err)
+	r.Equal(published[2:4], keysOf(readAll(src)))
+
+	// live, only newer than the last one
+	args.Gt = all[4].Claimed().UnixNano() / int64(time.Millisecond)
+	args.Lt = 0
+	args.Live = true
+	src, err = c.CreateFeedStream(args)
+	r.NoError(err)
+
+	newRef, err := c.Publish(testMsg{"test", "sorted", 5})
+	r.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+	r.True(src.Next(ctx), "expected live message")
+	var liveMsg refs.KeyValueRaw
+	err = src.Reader(func(rd io.Reader) error {
+		return json.NewDecoder(rd).Decode(&liveMsg)
+	})
+	r.NoError(err)
+	r.Equal(newRef.Ref(), liveMsg.Key().Ref())
+
+	r.NoError(c.Close())
+	srv.Shutdown()
+	r.NoError(srv.Close())
+	r.NoError(<-srvErrc)
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/client"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+	"go.cryptoscope.co/ssb/sbot"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestGatherings(t *testing.T) {
+	r := require.New(t)
+
+	srvRepo := filepath.Join("testrun", t.Name(), "serv")
+	os.RemoveAll(srvRepo)
+
+	// another identity to update and attend with
+	tRepo := repo.New(srvRepo)
+	kpArny, err := repo.NewKeyPair(tRepo, "arny", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	srv, err := sbot.New(
+		sbot.WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		sbot.WithRepoPath(srvRepo),
+		sbot.WithListenAddr(":0"))
+	r.NoError(err, "sbot srv init failed")
+
+	var srvErrc = make(chan error, 1)
+	go func() {
+		err := srv.Network.Serve(context.TODO())
+		if err != nil {
+			srvErrc <- errors.Wrap(err, "ali serve exited")
+		}
+		close(srvErrc)
+	}()
+
+	kp, err := ssb.LoadKeyPair(filepath.Join(srvRepo, "secret"))
+	r.NoError(err, "failed to load servers keypair")
+
+	c, err := client.NewTCP(kp, srv.Network.GetListenAddr())
+	r.NoError(err, "failed to make client connection")
+
+	now := time.Now().UnixNano() / 1e6
+	day := int64(24 * 60 * 60 * 1000)
+
+	newGathering := func(title string, start int64) *refs.MessageRef {
+		ref, err := c.Publish(map[string]interface{}{"type": "gathering"})
+		r.NoError(err)
+		_, err = c.Publish(map[string]interface{}{
+			"type":          "about",
+			"about":         ref.Ref(),
+			"title":         title,
+			"startDateTime": map[string]interface{}{"epoch": start, "tz": "Europe/Berlin"},
+		})
+		r.NoError(err)
+		time.Sleep(5 * time.Millisecond)
+		return ref
+	}
+
+	soon := newGathering("soon", now+day)
+	later := newGathering("later", now+7*day)
+	over := newGathering("over", now-day)
+
+	// someone else moves it and attends
+	_, err = srv.PublishAs("arny", map[string]interface{}{
+		"type":     "about",
+		"about":    later.Ref(),
+		"location": "the park",
+	})
+	r.NoError(err)
+	_, err = srv.PublishAs("arny", map[string]interface{}{
+		"type":     "about",
+		"about":    later.Ref(),
+		"attendee": map[string]interface{}{"link": kpArny.Id.Ref()},
+	})
+	r.NoError(err)
+
+	// attending for someone else doesn't count
+	_, err = srv.PublishAs("arny", map[string]interface{}{
+		"type":     "about",
+		"about":    later.Ref(),
+		"attendee": map[string]interface{}{"link": kp.Id.Ref()},
+	})
+	r.NoError(err)
+
+	_, err = c.GatheringsAttend(message.GatheringsAttendArgs{Gathering: later})
+	r.NoError(err)
+	_, err = c.GatheringsAttend(message.GatheringsAttendArgs{Gathering: over})
+	r.NoError(err)
+	_, err = c.GatheringsAttend(message.GatheringsAttendArgs{Gathering: over, Remove: true})
+	r.NoError(err)
+
+	// only gatherings can be attended
+	post, err := c.Publish(map[string]interface{}{"type": "post", "text": "no event"})
+	r.NoError(err)
+	_, err = c.GatheringsAttend(message.GatheringsAttendArgs{Gathering: post})
+	r.Error(err)
+
+	srv.WaitUntilIndexesAreSynced()
+
+	g, err := c.GatheringsGet(later)
+	r.NoError(err)
+	r.Equal(later.Ref(), g.Key.Ref())
+	r.True(g.Author.Equal(kp.Id))
+	r.Equal("later", g.Title)
+	r.Equal("the park", g.Location)
+	r.NotNil(g.StartDateTime)
+	r.Equal(now+7*day, g.StartDateTime.Epoch)
+	r.Equal("Europe/Berlin", g.StartDateTime.TZ)
+	r.Len(g.Attendees, 2)
+	r.True(g.Attendees[0].Equal(kpArny.Id))
+	r.True(g.Attendees[1].Equal(kp.Id))
+
+	g, err = c.GatheringsGet(soon)
+	r.NoError(err)
+	r.Equal("soon", g.Title)
+	r.Equal("", g.Location)
+	r.Len(g.Attendees, 0)
+
+	g, err = c.GatheringsGet(over)
+	r.NoError(err)
+	r.Len(g.Attendees, 0)
+
+	list := func(mode string) []string {
+		src, err := c.GatheringsList(message.GatheringsListArgs{Mode: mode})
+		r.NoError(err)
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+		defer cancel()
+
+		var titles []string
+		for src.Next(ctx) {
+			var g message.Gathering
+			err := src.Reader(func(rd io.Reader) error {
+				return json.NewDecoder(rd).Decode(&g)
+			})
+			r.NoError(err)
+			titles = append(titles, g.Title)
+		}
+		r.NoError(src.Err())
+		return titles
+	}
+
+	r.Equal([]string{"soon", "later"}, list(""))
+	r.Equal([]string{"over"}, list("past"))
+	r.Equal([]string{"over", "later", "soon"}, list("all"))
+
+	r.NoError(c.Close())
+	srv.Shutdown()
+	r.NoError(srv.Close())
+	r.NoError(<-srvErrc)
+}
@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/client"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/sbot"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestLinks(t *testing.T) {
+	r := require.New(t)
+
+	srvRepo := filepath.Join("testrun", t.Name(), "serv")
+	os.RemoveAll(srvRepo)
+
+	srv, err := sbot.New(
+		sbot.WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		sbot.WithRepoPath(srvRepo),
+		sbot.WithListenAddr(":0"))
+	r.NoError(err, "sbot srv init failed")
+
+	var srvErrc = make(chan error, 1)
+	go func() {
+		err := srv.Network.Serve(context.TODO())
+		if err != nil {
+			srvErrc <- errors.Wrap(err, "ali serve exited")
+		}
+		close(srvErrc)
+	}()
+
+	kp, err := ssb.LoadKeyPair(filepath.Join(srvRepo, "secret"))
+	r.NoError(err, "failed to load servers keypair")
+
+	c, err := client.NewTCP(kp, srv.Network.GetListenAddr())
+	r.NoError(err, "failed to make client connection")
+
+	h := sha256.Sum256([]byte("a picture"))
+	blob := refs.BlobRef{Hash: h[:], Algo: refs.RefAlgoBlobSSB1}
+
+	mention, err := c.Publish(map[string]interface{}{
+		"type":     "post",
+		"text":     "look at this",
+		"mentions": []map[string]string{{"link": blob.Ref()}},
+	})
+	r.NoError(err)
+	time.Sleep(5 * time.Millisecond)
+
+	// nested deeper and linking to the feed, too
+	about, err := c.Publish(map[string]interface{}{
+		"type":  "about",
+		"about": kp.Id.Ref(),
+		"image": map[string]interface{}{"link": blob.Ref(), "size": 42},
+	})
+	r.NoError(err)
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = c.Publish(map[string]interface{}{"type": "post", "text": "no links"})
+	r.NoError(err)
+	time.Sleep(5 * time.Millisecond)
+
+	// only readable by the server
+	boxed, err := srv.Groups.EncryptBox1([]byte(`{"type":"post","text":"psst `+blob.Ref()+`", "img":"`+blob.Ref()+`"}`), kp.Id)
+	r.NoError(err)
+	private, err := srv.PublishLog.Publish(boxed)
+	r.NoError(err)
+
+	srv.WaitUntilIndexesAreSynced()
+
+	readLinks := func(src *muxrpc.ByteSource) []string {
+		var keys []string
+		for src.Next(context.TODO()) {
+			var reply message.LinkReply
+			err := src.Reader(func(rd io.Reader) error {
+				return json.NewDecoder(rd).Decode(&reply)
+			})
+			r.NoError(err)
+			r.True(reply.Source.Equal(kp.Id))
+			keys = append(keys, reply.Key.Ref())
+		}
+		r.NoError(src.Err())
+		return keys
+	}
+
+	var largs message.LinksArgs
+	largs.Dest = blob.Ref()
+	src, err := c.Links(largs)
+	r.NoError(err)
+	r.Equal([]string{mention.Ref(), about.Ref()}, readLinks(src))
+
+	largs.Type = "about"
+	src, err = c.Links(largs)
+	r.NoError(err)
+	r.Equal([]string{about.Ref()}, readLinks(src))
+
+	largs.Type = ""
+	largs.Private = true
+	src, err = c.Links(largs)
+	r.NoError(err)
+	r.Equal([]string{mention.Ref(), about.Ref(), private.Ref()}, readLinks(src))
+
+	largs = message.LinksArgs{Dest: kp.Id.Ref()}
+	src, err = c.Links(largs)
+	r.NoError(err)
+	r.Equal([]string{about.Ref()}, readLinks(src))
+
+	readMsgs := func(src *muxrpc.ByteSource) []string {
+		var keys []string
+		for src.Next(context.TODO()) {
+			var msg refs.KeyValueRaw
+			err := src.Reader(func(rd io.Reader) error {
+				return json.NewDecoder(rd).Decode(&msg)
+			})
+			r.NoError(err)
+			keys = append(keys, msg.Key().Ref())
+		}
+		r.NoError(src.Err())
+		return keys
+	}
+
+	var bargs message.BacklinksArgs
+	bargs.Keys = true
+	bargs.Dest = blob.Ref()
+	src, err = c.Backlinks(bargs)
+	r.NoError(err)
+	r.Equal([]string{mention.Ref(), about.Ref()}, readMsgs(src))
+
+	bargs.Reverse = true
+	bargs.Limit = 1
+	bargs.Private = true
+	src, err = c.Backlinks(bargs)
+	r.NoError(err)
+	r.Equal([]string{private.Ref()}, readMsgs(src))
+
+	bargs = message.BacklinksArgs{Dest: "not a ref"}
+	src, err = c.Backlinks(bargs)
+	r.NoError(err)
+	for src.Next(context.TODO()) {
+	}
+	r.Error(src.Err(), "expected invalid dest error")
+
+	r.NoError(c.Close())
+	srv.Shutdown()
+	r.NoError(srv.Close())
+	r.NoError(<-srvErrc)
+}
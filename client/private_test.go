@@ -2,9 +2,12 @@ package client_test
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"go.cryptoscope.co/muxrpc/v2"
 
@@ -14,6 +17,7 @@ import (
 	"go.cryptoscope.co/ssb/internal/testutils"
 	"go.cryptoscope.co/ssb/message"
 	"go.cryptoscope.co/ssb/sbot"
+	refs "go.mindeco.de/ssb-refs"
 )
 
 func TestAutomaticUnboxing(t *testing.T) {
@@ -83,6 +87,99 @@ func TestAutomaticUnboxing(t *testing.T) {
 	testElementsInSource(t, src, 3) // add-member + the two posts
 }
 
+func TestPrivateHistoryStream(t *testing.T) {
+	r := require.New(t)
+
+	srvRepo := filepath.Join("testrun", t.Name(), "serv")
+	os.RemoveAll(srvRepo)
+	srvLog := testutils.NewRelativeTimeLogger(nil)
+
+	srv, err := sbot.New(
+		sbot.WithInfo(srvLog),
+		sbot.WithRepoPath(srvRepo),
+		sbot.WithListenAddr(":0"),
+		sbot.LateOption(sbot.WithUNIXSocket()),
+	)
+	r.NoError(err, "sbot srv init failed")
+
+	c, err := client.NewUnix(filepath.Join(srvRepo, "socket"))
+	r.NoError(err, "failed to make client connection")
+
+	_, err = c.Publish(map[string]interface{}{"type": "test", "text": "public"})
+	r.NoError(err)
+
+	_, err = c.PrivatePublish(map[string]interface{}{"type": "test", "text": "box1"}, srv.KeyPair.Id)
+	r.NoError(err)
+
+	groupID, _, err := srv.Groups.Create("history test group")
+	r.NoError(err, "failed to create group")
+	_, err = srv.Groups.PublishPostTo(groupID, "box2")
+	r.NoError(err)
+
+	var args message.CreateHistArgs
+	args.ID = srv.KeyPair.Id
+	args.Keys = true
+	args.Limit = -1
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+
+	readText := func(src *muxrpc.ByteSource) (string, bool) {
+		var msg refs.KeyValueRaw
+		err := src.Reader(func(rd io.Reader) error {
+			return json.NewDecoder(rd).Decode(&msg)
+		})
+		r.NoError(err)
+
+		var content struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(msg.Value.Content, &content); err != nil {
+			return "", false
+		}
+		return content.Text, true
+	}
+
+	// without private the boxed ones stay strings
+	src, err := c.CreateHistoryStream(args)
+	r.NoError(err)
+	var texts []string
+	for src.Next(ctx) {
+		if txt, ok := readText(src); ok {
+			texts = append(texts, txt)
+		}
+	}
+	r.NoError(src.Err())
+	r.Equal([]string{"public"}, texts)
+
+	// decrypted, including the group messages and the live ones
+	args.Private = true
+	args.Live = true
+	src, err = c.CreateHistoryStream(args)
+	r.NoError(err)
+
+	texts = nil
+	for len(texts) < 3 && src.Next(ctx) {
+		if txt, ok := readText(src); ok && txt != "" {
+			texts = append(texts, txt)
+		}
+	}
+	r.Equal([]string{"public", "box1", "box2"}, texts)
+
+	_, err = c.PrivatePublish(map[string]interface{}{"type": "test", "text": "live"}, srv.KeyPair.Id)
+	r.NoError(err)
+
+	r.True(src.Next(ctx), "expected the live message: %v", src.Err())
+	txt, ok := readText(src)
+	r.True(ok)
+	r.Equal("live", txt)
+
+	cancel()
+	r.NoError(c.Close())
+	srv.Shutdown()
+	r.NoError(srv.Close())
+}
+
 func testElementsInSource(t *testing.T, src *muxrpc.ByteSource, cnt int) {
 	ctx := context.Background()
 	r, a := require.New(t), assert.New(t)
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/client"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/sbot"
+)
+
+func TestQueryRead(t *testing.T) {
+	r := require.New(t)
+
+	srvRepo := filepath.Join("testrun", t.Name(), "serv")
+	os.RemoveAll(srvRepo)
+
+	srv, err := sbot.New(
+		sbot.WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		sbot.WithRepoPath(srvRepo),
+		sbot.WithListenAddr(":0"))
+	r.NoError(err, "sbot srv init failed")
+
+	var srvErrc = make(chan error, 1)
+	go func() {
+		err := srv.Network.Serve(context.TODO())
+		if err != nil {
+			srvErrc <- errors.Wrap(err, "ali serve exited")
+		}
+		close(srvErrc)
+	}()
+
+	kp, err := ssb.LoadKeyPair(filepath.Join(srvRepo, "secret"))
+	r.NoError(err, "failed to load servers keypair")
+
+	c, err := client.NewTCP(kp, srv.Network.GetListenAddr())
+	r.NoError(err, "failed to make client connection")
+
+	var inChannel []string
+	for i := 0; i < 5; i++ {
+		post := map[string]interface{}{
+			"type":    "post",
+			"text":    "hello",
+			"channel": "go-ssb",
+		}
+		if i%2 == 0 {
+			post["mentions"] = []map[string]string{{"link": kp.Id.Ref()}}
+		}
+		ref, err := c.Publish(post)
+		r.NoError(err)
+		inChannel = append(inChannel, ref.Ref())
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	_, err = c.Publish(map[string]interface{}{"type": "post", "text": "elsewhere", "channel": "other"})
+	r.NoError(err)
+	_, err = c.Publish(map[string]interface{}{"type": "vote", "channel": "go-ssb"})
+	r.NoError(err)
+	srv.WaitUntilIndexesAreSynced()
+
+	readAll := func(src *muxrpc.ByteSource) []message.QueryReply {
+		var replies []message.QueryReply
+		for src.Next(context.TODO()) {
+			var reply message.QueryReply
+			err := src.Reader(func(rd io.Reader) error {
+				return json.NewDecoder(rd).Decode(&reply)
+			})
+			r.NoError(err)
+			replies = append(replies, reply)
+		}
+		r.NoError(src.Err())
+		return replies
+	}
+	keysOf := func(replies []message.QueryReply) []string {
+		var lst []string
+		for _, rep := range replies {
+			lst = append(lst, rep.Message.Key().Ref())
+		}
+		return lst
+	}
+
+	var args message.QueryArgs
+	args.Type = "post"
+	args.Channel = "#go-ssb"
+	args.Authors = append(args.Authors, kp.Id)
+	src, err := c.Query(args)
+	r.NoError(err)
+	r.Equal(inChannel, keysOf(readAll(src)))
+
+	// mentions
+	args.Mentions = []string{kp.Id.Ref()}
+	src, err = c.Query(args)
+	r.NoError(err)
+	r.Equal([]string{inChannel[0], inChannel[2], inChannel[4]}, keysOf(readAll(src)))
+
+	// paging
+	args.Mentions = nil
+	args.Limit = 2
+	var paged []string
+	for page := 0; page < 4; page++ {
+		src, err = c.Query(args)
+		r.NoError(err)
+		replies := readAll(src)
+		if len(replies) == 0 {
+			break
+		}
+		paged = append(paged, keysOf(replies)...)
+		args.Cursor = replies[len(replies)-1].Cursor
+	}
+	r.Equal(inChannel, paged)
+
+	args.Cursor = "not a cursor"
+	src, err = c.Query(args)
+	r.NoError(err)
+	for src.Next(context.TODO()) {
+	}
+	r.Error(src.Err(), "expected invalid cursor error")
+
+	r.NoError(c.Close())
+	srv.Shutdown()
+	r.NoError(srv.Close())
+	r.NoError(<-srvErrc)
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/client"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/sbot"
+)
+
+func TestSearch(t *testing.T) {
+	r := require.New(t)
+
+	srvRepo := filepath.Join("testrun", t.Name(), "serv")
+	os.RemoveAll(srvRepo)
+
+	srv, err := sbot.New(
+		sbot.WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		sbot.WithRepoPath(srvRepo),
+		sbot.WithListenAddr(":0"))
+	r.NoError(err, "sbot srv init failed")
+
+	var srvErrc = make(chan error, 1)
+	go func() {
+		err := srv.Network.Serve(context.TODO())
+		if err != nil {
+			srvErrc <- errors.Wrap(err, "ali serve exited")
+		}
+		close(srvErrc)
+	}()
+
+	kp, err := ssb.LoadKeyPair(filepath.Join(srvRepo, "secret"))
+	r.NoError(err, "failed to load servers keypair")
+
+	c, err := client.NewTCP(kp, srv.Network.GetListenAddr())
+	r.NoError(err, "failed to make client connection")
+
+	var posts []string
+	for _, txt := range []string{"hello world", "Hello there!", "goodbye world", "héllo café"} {
+		ref, err := c.Publish(map[string]interface{}{"type": "post", "text": txt})
+		r.NoError(err)
+		posts = append(posts, ref.Ref())
+	}
+
+	about, err := c.Publish(map[string]interface{}{"type": "about", "about": kp.Id.Ref(), "name": "Wörld Traveller"})
+	r.NoError(err)
+
+	// not indexed
+	_, err = c.Publish(map[string]interface{}{"type": "contact", "text": "hello"})
+	r.NoError(err)
+
+	boxed, err := srv.Groups.EncryptBox1([]byte(`{"type":"post","text":"a secret hello"}`), kp.Id)
+	r.NoError(err)
+	private, err := srv.PublishLog.Publish(boxed)
+	r.NoError(err)
+
+	srv.WaitUntilIndexesAreSynced()
+
+	readAll := func(src *muxrpc.ByteSource) []string {
+		var keys []string
+		for src.Next(context.TODO()) {
+			var reply message.SearchReply
+			err := src.Reader(func(rd io.Reader) error {
+				return json.NewDecoder(rd).Decode(&reply)
+			})
+			r.NoError(err)
+			r.True(reply.Score > 0)
+			keys = append(keys, reply.Key.Ref())
+		}
+		r.NoError(src.Err())
+		return keys
+	}
+	search := func(args message.SearchArgs) []string {
+		src, err := c.Search(args)
+		r.NoError(err)
+		return readAll(src)
+	}
+
+	// same score, newest first
+	r.Equal([]string{posts[3], posts[1], posts[0]}, search(message.SearchArgs{Query: "HELLO"}))
+
+	// matching both terms ranks higher, then the rarer term
+	r.Equal([]string{posts[0], about, posts[2], posts[3], posts[1]}, search(message.SearchArgs{Query: "hello world"}))
+	r.Len(search(message.SearchArgs{Query: "hello world", Limit: 2}), 2)
+
+	r.Equal([]string{posts[3]}, search(message.SearchArgs{Query: "cafe"}))
+	r.Equal([]string{about}, search(message.SearchArgs{Query: "traveller"}))
+
+	r.Len(search(message.SearchArgs{Query: "secret"}), 0)
+	r.Equal([]string{private.Ref()}, search(message.SearchArgs{Query: "secret", Private: true}))
+
+	r.NoError(c.Close())
+	srv.Shutdown()
+	r.NoError(srv.Close())
+	r.NoError(<-srvErrc)
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/client"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/sbot"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestThreadsAndChannels(t *testing.T) {
+	r := require.New(t)
+
+	srvRepo := filepath.Join("testrun", t.Name(), "serv")
+	os.RemoveAll(srvRepo)
+
+	srv, err := sbot.New(
+		sbot.WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		sbot.WithRepoPath(srvRepo),
+		sbot.WithListenAddr(":0"))
+	r.NoError(err, "sbot srv init failed")
+
+	var srvErrc = make(chan error, 1)
+	go func() {
+		err := srv.Network.Serve(context.TODO())
+		if err != nil {
+			srvErrc <- errors.Wrap(err, "ali serve exited")
+		}
+		close(srvErrc)
+	}()
+
+	kp, err := ssb.LoadKeyPair(filepath.Join(srvRepo, "secret"))
+	r.NoError(err, "failed to load servers keypair")
+
+	c, err := client.NewTCP(kp, srv.Network.GetListenAddr())
+	r.NoError(err, "failed to make client connection")
+
+	publish := func(content map[string]interface{}) *refs.MessageRef {
+		ref, err := c.Publish(content)
+		r.NoError(err)
+		time.Sleep(5 * time.Millisecond)
+		return ref
+	}
+
+	first := publish(map[string]interface{}{"type": "post", "text": "first thread", "channel": "go-ssb"})
+	second := publish(map[string]interface{}{"type": "post", "text": "second thread", "channel": "#random"})
+	reply1 := publish(map[string]interface{}{"type": "post", "text": "re", "root": first.Ref(), "branch": first.Ref()})
+	reply2 := publish(map[string]interface{}{"type": "post", "text": "re re", "root": first.Ref(), "branch": reply1.Ref(), "channel": "go-ssb"})
+	third := publish(map[string]interface{}{"type": "post", "text": "third thread", "channel": "go-ssb"})
+	publish(map[string]interface{}{"type": "vote", "channel": "go-ssb"})
+	srv.WaitUntilIndexesAreSynced()
+
+	// threads.get
+	thread, err := c.Thread(message.ThreadArgs{Root: first})
+	r.NoError(err)
+	r.Equal(2, thread.ReplyCount)
+	var keys []string
+	for _, m := range thread.Messages {
+		keys = append(keys, m.Key().Ref())
+	}
+	r.Equal([]string{first.Ref(), reply1.Ref(), reply2.Ref()}, keys)
+	r.Equal(thread.Messages[2].Claimed().UnixNano()/1e6, thread.LatestActivity)
+
+	// threads.recent
+	src, err := c.RecentThreads(message.RecentThreadsArgs{})
+	r.NoError(err)
+	var summaries []message.ThreadSummary
+	for src.Next(context.TODO()) {
+		var s message.ThreadSummary
+		err := src.Reader(func(rd io.Reader) error {
+			return json.NewDecoder(rd).Decode(&s)
+		})
+		r.NoError(err)
+		summaries = append(summaries, s)
+	}
+	r.NoError(src.Err())
+	r.Len(summaries, 3)
+	r.Equal(third.Ref(), summaries[0].Root.Ref())
+	r.Equal(0, summaries[0].ReplyCount)
+	r.Equal(first.Ref(), summaries[1].Root.Ref())
+	r.Equal(reply2.Ref(), summaries[1].Latest.Ref())
+	r.Equal(2, summaries[1].ReplyCount)
+	r.Equal(second.Ref(), summaries[2].Root.Ref())
+
+	src, err = c.RecentThreads(message.RecentThreadsArgs{Limit: 1})
+	r.NoError(err)
+	var n int
+	for src.Next(context.TODO()) {
+		n++
+	}
+	r.NoError(src.Err())
+	r.Equal(1, n)
+
+	// channels.list
+	src, err = c.ChannelsList(message.ChannelsListArgs{})
+	r.NoError(err)
+	var channels []message.ChannelSummary
+	for src.Next(context.TODO()) {
+		var ch message.ChannelSummary
+		err := src.Reader(func(rd io.Reader) error {
+			return json.NewDecoder(rd).Decode(&ch)
+		})
+		r.NoError(err)
+		channels = append(channels, ch)
+	}
+	r.NoError(src.Err())
+	r.Len(channels, 2)
+	r.Equal("go-ssb", channels[0].Channel)
+	r.Equal(3, channels[0].Count)
+	r.Equal("random", channels[1].Channel)
+	r.Equal(1, channels[1].Count)
+
+	// channels.read
+	readKeys := func(src *muxrpc.ByteSource) []string {
+		var keys []string
+		for src.Next(context.TODO()) {
+			var msg refs.KeyValueRaw
+			err := src.Reader(func(rd io.Reader) error {
+				return json.NewDecoder(rd).Decode(&msg)
+			})
+			r.NoError(err)
+			keys = append(keys, msg.Key().Ref())
+		}
+		r.NoError(src.Err())
+		return keys
+	}
+	var rargs message.ChannelReadArgs
+	rargs.Keys = true
+	rargs.Channel = "#go-ssb"
+	src, err = c.ChannelRead(rargs)
+	r.NoError(err)
+	r.Equal([]string{first.Ref(), reply2.Ref(), third.Ref()}, readKeys(src))
+
+	r.NoError(c.Close())
+	srv.Shutdown()
+	r.NoError(srv.Close())
+	r.NoError(<-srvErrc)
+}
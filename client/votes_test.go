@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/client"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+	"go.cryptoscope.co/ssb/sbot"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestVotes(t *testing.T) {
+	r := require.New(t)
+
+	srvRepo := filepath.Join("testrun", t.Name(), "serv")
+	os.RemoveAll(srvRepo)
+
+	// two more identities to vote with
+	tRepo := repo.New(srvRepo)
+	kpArny, err := repo.NewKeyPair(tRepo, "arny", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	kpBert, err := repo.NewKeyPair(tRepo, "bert", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	srv, err := sbot.New(
+		sbot.WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		sbot.WithRepoPath(srvRepo),
+		sbot.WithListenAddr(":0"))
+	r.NoError(err, "sbot srv init failed")
+
+	var srvErrc = make(chan error, 1)
+	go func() {
+		err := srv.Network.Serve(context.TODO())
+		if err != nil {
+			srvErrc <- errors.Wrap(err, "ali serve exited")
+		}
+		close(srvErrc)
+	}()
+
+	kp, err := ssb.LoadKeyPair(filepath.Join(srvRepo, "secret"))
+	r.NoError(err, "failed to load servers keypair")
+
+	c, err := client.NewTCP(kp, srv.Network.GetListenAddr())
+	r.NoError(err, "failed to make client connection")
+
+	post, err := c.Publish(map[string]interface{}{"type": "post", "text": "vote for me"})
+	r.NoError(err)
+
+	vote := func(as string, value int, expression string) {
+		content := map[string]interface{}{
+			"type": "vote",
+			"vote": map[string]interface{}{
+				"link":       post.Ref(),
+				"value":      value,
+				"expression": expression,
+			},
+		}
+		_, err := srv.PublishAs(as, content)
+		r.NoError(err)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	vote("arny", 1, "Like")
+	vote("bert", 1, "Dig")
+	vote("bert", 0, "Unlike") // takes it back
+	vote("arny", 1, "Yup")    // changes the expression
+	srv.WaitUntilIndexesAreSynced()
+
+	totals, err := c.VotesGet(post)
+	r.NoError(err)
+	r.Equal(post.Ref(), totals.Link.Ref())
+	r.Equal(1, totals.Total)
+	r.Len(totals.Voters, 1)
+	r.True(totals.Voters[0].Author.Equal(kpArny.Id))
+	r.Equal("Yup", totals.Voters[0].Expression)
+	r.Equal(map[string]int{"Yup": 1}, totals.Expressions)
+
+	// live
+	src, err := c.VotesStream(post)
+	r.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+	next := func() message.VoteTotals {
+		r.True(src.Next(ctx), "expected totals: %v", src.Err())
+		var totals message.VoteTotals
+		err := src.Reader(func(rd io.Reader) error {
+			return json.NewDecoder(rd).Decode(&totals)
+		})
+		r.NoError(err)
+		return totals
+	}
+
+	r.Equal(1, next().Total)
+
+	vote("bert", 1, "Like")
+	updated := next()
+	r.Equal(2, updated.Total)
+	r.Len(updated.Voters, 2)
+	r.True(updated.Voters[1].Author.Equal(kpBert.Id))
+	r.Equal(map[string]int{"Yup": 1, "Like": 1}, updated.Expressions)
+
+	r.NoError(c.Close())
+	srv.Shutdown()
+	r.NoError(srv.Close())
+	r.NoError(<-srvErrc)
+}
@@ -34,6 +34,9 @@ import (
 	"go.cryptoscope.co/ssb/internal/storedrefs"
 	"go.cryptoscope.co/ssb/internal/testutils"
 	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/network"
+	"go.cryptoscope.co/ssb/network/msaddr"
+	"go.cryptoscope.co/ssb/plugins/rooms/roomsrv"
 	mksbot "go.cryptoscope.co/ssb/sbot"
 )
 
@@ -52,10 +55,16 @@ var (
 	flagEnableEBT bool
 
 	flagDisableUNIXSock bool
+	flagWSNoAuth        bool
+
+	flagRoom     bool
+	flagRoomMode string
 
 	repoDir     string
 	listenAddr  string
 	wsLisAddr   string
+	torSocks    string
+	joinRooms   string
 	debugAddr   string
 	debugLogDir string
 
@@ -95,11 +104,16 @@ func initFlags() {
 	flag.StringVar(&appKey, "shscap", "1KHLiKZvAvjbY1ziZEHMXawbCEIM6qwjCDm3VYRan/s=", "secret-handshake app-key (or capability)")
 	flag.StringVar(&hmacSec, "hmac", "", "if set, sign with hmac hash of msg, instead of plain message object, using this key")
 
-	flag.StringVar(&listenAddr, "lis", ":8008", "address to listen on")
+	flag.StringVar(&listenAddr, "lis", ":8008", "address to listen on (comma separated for multiple listeners, only the first one is advertised)")
 	flag.BoolVar(&flagEnAdv, "localadv", false, "enable sending local UDP brodcasts")
 	flag.BoolVar(&flagEnDiscov, "localdiscov", false, "enable connecting to incomming UDP brodcasts")
 
 	flag.StringVar(&wsLisAddr, "wslis", ":8989", "address to listen on for ssb-ws connections")
+	flag.BoolVar(&flagWSNoAuth, "wsnoauth", false, "allow local apps to connect over websocket without secret-handshake (token is written to $repo/ws-noauth-token)")
+	flag.BoolVar(&flagRoom, "room", false, "run as a room server that only relays connections between it's members (disables replication and indexing)")
+	flag.StringVar(&flagRoomMode, "roommode", "restricted", "who can use the room (restricted: only members of the allow-list, open: everyone)")
+	flag.StringVar(&joinRooms, "rooms", "", "multiserver addresses of rooms to join (separated by ;)")
+	flag.StringVar(&torSocks, "torsocks", "", "address of a tor SOCKS5 proxy, enables connecting to onion addresses (i.e. localhost:9050)")
 
 	flag.BoolVar(&flagEnableEBT, "enable-ebt", false, "enable syncing by using epidemic-broadcast-trees (new code, test with caution)")
 
@@ -167,16 +181,32 @@ func runSbot() error {
 		mksbot.WithInfo(log),
 		mksbot.WithAppKey(ak),
 		mksbot.WithRepoPath(repoDir),
-		mksbot.WithListenAddr(listenAddr),
 		mksbot.EnableAdvertismentBroadcasts(flagEnAdv),
 		mksbot.EnableAdvertismentDialing(flagEnDiscov),
 		mksbot.WithWebsocketAddress(wsLisAddr),
+		mksbot.EnableWebsocketNoAuth(flagWSNoAuth),
 		// enabling this might consume a lot of resources
 		mksbot.DisableLegacyLiveReplication(true),
 		// new code, test with caution
 		mksbot.DisableEBT(!flagEnableEBT),
 	}
 
+	for i, addr := range strings.Split(listenAddr, ",") {
+		if i == 0 {
+			opts = append(opts, mksbot.WithListenAddr(addr))
+			continue
+		}
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse listen address #%d", i)
+		}
+		opts = append(opts, mksbot.WithListener(network.ListenerOptions{Addr: tcpAddr}))
+	}
+
+	if torSocks != "" {
+		opts = append(opts, mksbot.WithTransportDialer(msaddr.TransportOnion, network.OnionDialer(torSocks)))
+	}
+
 	if !flagDisableUNIXSock {
 		opts = append(opts, mksbot.LateOption(mksbot.WithUNIXSocket()))
 	}
@@ -207,6 +237,17 @@ func runSbot() error {
 		)
 	}
 
+	if flagRoom {
+		mode, err := roomsrv.ParseMode(flagRoomMode)
+		if err != nil {
+			return err
+		}
+		if joinRooms != "" {
+			return fmt.Errorf("can't join other rooms in room server mode")
+		}
+		opts = append(opts, mksbot.EnableRoomServer(mode))
+	}
+
 	if hmacSec != "" {
 		hcbytes, err := base64.StdEncoding.DecodeString(hmacSec)
 		if err != nil {
@@ -238,6 +279,12 @@ func runSbot() error {
 	logging.SetCloseChan(c)
 
 	id := sbot.KeyPair.Id
+
+	if flagRoom {
+		level.Info(log).Log("event", "serving room", "ID", id.Ref(), "addr", listenAddr, "mode", sbot.Room.Mode(), "version", Version, "build", Build)
+		return serve(ctx, sbot)
+	}
+
 	uf, ok := sbot.GetMultiLog(multilogs.IndexNameFeeds)
 	if !ok {
 		checkAndLog(fmt.Errorf("missing userFeeds"))
@@ -375,10 +422,29 @@ func runSbot() error {
 		return sbot.Close()
 	}
 
+	if joinRooms != "" {
+		addrs, err := msaddr.ParseList(joinRooms)
+		if err != nil {
+			return fmt.Errorf("failed to parse room addresses: %w", err)
+		}
+		for _, addr := range addrs {
+			go func(addr msaddr.Address) {
+				if err := sbot.Rooms.Join(ctx, addr); err != nil {
+					level.Warn(log).Log("event", "failed to join room", "addr", addr.String(), "err", err)
+				}
+			}(addr)
+		}
+	}
+
 	level.Info(log).Log("event", "serving", "ID", id.Ref(), "addr", listenAddr, "version", Version, "build", Build)
+	return serve(ctx, sbot)
+}
+
+// serve runs the network node until ctx is canceled
+func serve(ctx context.Context, sbot *mksbot.Sbot) error {
 	for {
 		// Note: This is where the serving starts ;)
-		err = sbot.Network.Serve(ctx)
+		err := sbot.Network.Serve(ctx)
 		if err != nil {
 			level.Warn(log).Log("event", "sbot node.Serve returned", "err", err)
 		}
@@ -93,6 +93,7 @@ var app = cli.App{
 		partialStreamCmd,
 		replicateUptoCmd,
 		repliesStreamCmd,
+		queryCmd,
 		callCmd,
 		sourceCmd,
 		connectCmd,
@@ -402,11 +403,6 @@ var blockCmd = &cli.Command{
 	},
 }
 
-var queryCmd = &cli.Command{
-	Name:   "qry",
-	Action: todo, //query,
-}
-
 /*
 var getCmd = &cli.Command{
 	Name:  "create",
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.cryptoscope.co/muxrpc/v2"
@@ -22,6 +23,7 @@ var publishCmd = &cli.Command{
 		publishAboutCmd,
 		publishContactCmd,
 		publishVoteCmd,
+		publishGatheringCmd,
 	},
 }
 
@@ -268,3 +270,77 @@ var publishContactCmd = &cli.Command{
 		return nil
 	},
 }
+
+var publishGatheringCmd = &cli.Command{
+	Name:      "gathering",
+	UsageText: "publishes a new gathering and an about message that describes it",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "title", Usage: "what the gathering is called"},
+		&cli.StringFlag{Name: "description", Usage: "what happens there"},
+		&cli.StringFlag{Name: "location", Usage: "where it takes place"},
+		&cli.StringFlag{Name: "image", Usage: "image blob ref"},
+		&cli.StringFlag{Name: "start", Usage: "when it starts (RFC3339, like 2006-01-02T15:04:05+02:00)"},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.String("title") == "" {
+			return fmt.Errorf("publish/gathering: needs a title")
+		}
+		about := map[string]interface{}{
+			"type":  "about",
+			"title": ctx.String("title"),
+		}
+		if d := ctx.String("description"); d != "" {
+			about["description"] = d
+		}
+		if l := ctx.String("location"); l != "" {
+			about["location"] = l
+		}
+		if img := ctx.String("image"); img != "" {
+			blobRef, err := refs.ParseBlobRef(img)
+			if err != nil {
+				return errors.Wrapf(err, "publish/gathering: invalid blob ref")
+			}
+			about["image"] = blobRef
+		}
+		if st := ctx.String("start"); st != "" {
+			start, err := time.Parse(time.RFC3339, st)
+			if err != nil {
+				return errors.Wrapf(err, "publish/gathering: invalid start time")
+			}
+			zone, _ := start.Zone()
+			about["startDateTime"] = map[string]interface{}{
+				"epoch": start.UnixNano() / 1e6,
+				"tz":    zone,
+			}
+		}
+
+		client, err := newClient(ctx)
+		if err != nil {
+			return err
+		}
+
+		var v string
+		err = client.Async(longctx, &v, muxrpc.TypeString, muxrpc.Method{"publish"}, map[string]interface{}{"type": "gathering"})
+		if err != nil {
+			return errors.Wrapf(err, "publish call failed.")
+		}
+		gathering, err := refs.ParseMessageRef(v)
+		if err != nil {
+			return err
+		}
+		log.Log("event", "published", "type", "gathering", "ref", gathering.Ref())
+
+		about["about"] = gathering.Ref()
+		err = client.Async(longctx, &v, muxrpc.TypeString, muxrpc.Method{"publish"}, about)
+		if err != nil {
+			return errors.Wrapf(err, "publish/gathering: about call failed.")
+		}
+		aboutMsg, err := refs.ParseMessageRef(v)
+		if err != nil {
+			return err
+		}
+		log.Log("event", "published", "type", "about", "ref", aboutMsg.Ref())
+		fmt.Fprintln(os.Stdout, gathering.Ref())
+		return nil
+	},
+}
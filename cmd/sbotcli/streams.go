@@ -226,6 +226,77 @@ var repliesStreamCmd = &cli.Command{
 	},
 }
 
+var queryCmd = &cli.Command{
+	Name:  "qry",
+	Usage: "query messages by author, type, thread, mentions and channel (sorted by claimed timestamp)",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{Name: "author", Usage: "feed ref, can be passed multiple times"},
+		&cli.StringFlag{Name: "type"},
+		&cli.StringFlag{Name: "root", Usage: "message ref of the thread"},
+		&cli.StringFlag{Name: "tname", Usage: "tangle name (v2)"},
+		&cli.StringSliceFlag{Name: "mention", Usage: "ref that should be mentioned, can be passed multiple times"},
+		&cli.StringFlag{Name: "channel"},
+		&cli.StringFlag{Name: "boxed", Usage: "true for only private messages, false for only public ones"},
+		&cli.StringFlag{Name: "cursor", Usage: "continue after the result with this cursor"},
+		&cli.IntFlag{Name: "limit", Value: -1},
+		&cli.IntFlag{Name: "gt"},
+		&cli.IntFlag{Name: "lt"},
+		&cli.BoolFlag{Name: "reverse"},
+		&cli.BoolFlag{Name: "live"},
+		&cli.BoolFlag{Name: "private"},
+	},
+	Action: func(ctx *cli.Context) error {
+		client, err := newClient(ctx)
+		if err != nil {
+			return err
+		}
+
+		var args message.QueryArgs
+		for _, a := range ctx.StringSlice("author") {
+			ref, err := refs.ParseFeedRef(a)
+			if err != nil {
+				return err
+			}
+			args.Authors = append(args.Authors, ref)
+		}
+		args.Type = ctx.String("type")
+		if root := ctx.String("root"); root != "" {
+			args.Root, err = refs.ParseMessageRef(root)
+			if err != nil {
+				return err
+			}
+		}
+		args.TangleName = ctx.String("tname")
+		args.Mentions = ctx.StringSlice("mention")
+		args.Channel = ctx.String("channel")
+		switch b := ctx.String("boxed"); b {
+		case "":
+		case "true", "false":
+			boxed := b == "true"
+			args.Boxed = &boxed
+		default:
+			return fmt.Errorf("boxed needs to be true or false")
+		}
+		args.Cursor = ctx.String("cursor")
+		args.Limit = ctx.Int64("limit")
+		args.Gt = ctx.Int64("gt")
+		args.Lt = ctx.Int64("lt")
+		args.Reverse = ctx.Bool("reverse")
+		args.Live = ctx.Bool("live")
+		args.Private = ctx.Bool("private")
+
+		src, err := client.Source(longctx, muxrpc.TypeJSON, muxrpc.Method{"query", "read"}, args)
+		if err != nil {
+			return fmt.Errorf("source stream call failed: %w", err)
+		}
+		err = jsonDrain(os.Stdout, src)
+		if err != nil {
+			err = fmt.Errorf("query pump failed: %w", err)
+		}
+		return err
+	},
+}
+
 var replicateUptoCmd = &cli.Command{
 	Name:  "upto",
 	Flags: streamFlags,
@@ -271,19 +342,3 @@ func jsonDrain(w io.Writer, r *muxrpc.ByteSource) error {
 	}
 	return r.Err()
 }
-
-/*
-
-func query(ctx *cli.Context) error {
-	reply := make(chan map[string]interface{})
-	go func() {
-		for r := range reply {
-			goon.Dump(r)
-		}
-	}()
-	if err := client.Source("query.read", reply, ctx.Args().Get(0)); err != nil {
-		return fmt.Errorf("source stream call failed",err)
-	}
-	return client.Close()
-}
-*/
@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: MIT
+
+// ssb-compact-log removes the nulled entries from the receive log of a repo and rebuilds the indexes
+// the bot must not be running
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"go.cryptoscope.co/ssb/sbot"
+)
+
+func check(err error, msg string, args ...interface{}) {
+	if err != nil {
+		fmt.Printf(msg+"\n", args...)
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	fmt.Fprintln(os.Stderr, "occurred at")
+	debug.PrintStack()
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <repo>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	n, err := sbot.CompactReceiveLog(os.Args[1])
+	check(err, "failed to compact the receive log")
+	log.Printf("%d nulled entries removed (took %v)", n, time.Since(start))
+	if n == 0 {
+		return
+	}
+
+	start = time.Now()
+	err = sbot.RebuildIndicies(os.Args[1])
+	check(err, "failed to rebuild indexes")
+	log.Println("indexes rebuilt", time.Since(start))
+}
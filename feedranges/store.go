@@ -0,0 +1,321 @@
+// SPDX-License-Identifier: MIT
+
+// Package feedranges keeps track of which parts of a feed are stored, for feeds that weren't replicated from the first message on
+// or whose older messages were dropped.
+// Feeds that are replicated the usual way, contiguously from the start, don't show up here.
+package feedranges
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// Range is a part of a feed that is stored without gaps, both ends included
+type Range struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// Contains returns true if seq is part of the range
+func (r Range) Contains(seq int64) bool {
+	return r.From <= seq && seq <= r.To
+}
+
+// feedState is what is known about a partial feed
+type feedState struct {
+	// Horizon is the last message that was dropped on purpose, the ones before it are gone as well
+	Horizon int64 `json:"horizon,omitempty"`
+
+	Ranges []Range `json:"ranges"`
+}
+
+// Store implements message.RangeRegistry.
+// Like the fork registry it's written to disk as a whole, it's meant for a moderate number of feeds.
+type Store struct {
+	path string
+
+	mu    sync.Mutex
+	feeds map[string]*feedState
+}
+
+var _ message.RangeRegistry = (*Store)(nil)
+
+// Open loads the stored ranges of the repo
+func Open(r repo.Interface) (*Store, error) {
+	s := &Store{
+		path:  r.GetPath("partial-feeds.json"),
+		feeds: make(map[string]*feedState),
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("feedranges: failed to open store: %w", err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&s.feeds); err != nil {
+		return nil, fmt.Errorf("feedranges: failed to decode store: %w", err)
+	}
+	return s, nil
+}
+
+// IsPartial returns true if the ranges of the feed are tracked
+func (s *Store) IsPartial(feed *refs.FeedRef) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, has := s.feeds[feed.Ref()]
+	return has
+}
+
+// Ranges returns the stored ranges of feed in ascending order or nil if it isn't partial
+func (s *Store) Ranges(feed *refs.FeedRef) []Range {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, has := s.feeds[feed.Ref()]
+	if !has {
+		return nil
+	}
+	cpy := make([]Range, len(st.Ranges))
+	copy(cpy, st.Ranges)
+	return cpy
+}
+
+// Has returns true if the message with sequence seq of feed is stored.
+// Messages up to the horizon count as stored, so that they aren't fetched again.
+// Always false for feeds that aren't partial.
+func (s *Store) Has(feed *refs.FeedRef, seq int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, has := s.feeds[feed.Ref()]
+	if !has {
+		return false
+	}
+	if seq <= st.Horizon {
+		return true
+	}
+	_, ok := st.rangeOf(seq)
+	return ok
+}
+
+// RangeOf returns the range of feed that contains seq
+func (s *Store) RangeOf(feed *refs.FeedRef, seq int64) (Range, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, has := s.feeds[feed.Ref()]
+	if !has {
+		return Range{}, false
+	}
+	return st.rangeOf(seq)
+}
+
+func (st *feedState) rangeOf(seq int64) (Range, bool) {
+	for _, r := range st.Ranges {
+		if r.Contains(seq) {
+			return r, true
+		}
+	}
+	return Range{}, false
+}
+
+// Prefix returns up to which sequence the feed is stored without gaps from the first message on, zero if the first message is missing.
+// The messages up to the horizon count as stored.
+// ok is false for feeds that aren't partial.
+func (s *Store) Prefix(feed *refs.FeedRef) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, has := s.feeds[feed.Ref()]
+	if !has {
+		return 0, false
+	}
+	if len(st.Ranges) > 0 && st.Ranges[0].From == st.Horizon+1 {
+		return st.Ranges[0].To, true
+	}
+	return st.Horizon, true
+}
+
+// Add marks the messages from through to of feed as stored, which also makes the feed partial.
+// The part of the range up to the horizon is ignored.
+func (s *Store) Add(feed *refs.FeedRef, from, to int64) error {
+	if from < 1 || to < from {
+		return fmt.Errorf("feedranges: invalid range %d-%d", from, to)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, has := s.feeds[feed.Ref()]
+	if !has {
+		st = &feedState{}
+		s.feeds[feed.Ref()] = st
+	}
+	if to <= st.Horizon {
+		return nil
+	}
+	if from <= st.Horizon {
+		from = st.Horizon + 1
+	}
+
+	st.Ranges = merge(append(st.Ranges, Range{From: from, To: to}))
+	return s.save()
+}
+
+// AddSeqs marks the messages of feed with the sequences as stored, the store is only written once for all of them.
+// Like with Add, the ones up to the horizon are ignored.
+func (s *Store) AddSeqs(feed *refs.FeedRef, seqs []int64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+	for _, seq := range seqs {
+		if seq < 1 {
+			return fmt.Errorf("feedranges: invalid sequence %d", seq)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, has := s.feeds[feed.Ref()]
+	if !has {
+		st = &feedState{}
+		s.feeds[feed.Ref()] = st
+	}
+	for _, seq := range seqs {
+		if seq > st.Horizon {
+			st.Ranges = append(st.Ranges, Range{From: seq, To: seq})
+		}
+	}
+	if len(st.Ranges) == 0 {
+		return nil
+	}
+
+	st.Ranges = merge(st.Ranges)
+	return s.save()
+}
+
+// Horizon returns the last message of feed that was dropped on purpose, zero if there is none
+func (s *Store) Horizon(feed *refs.FeedRef) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, has := s.feeds[feed.Ref()]
+	if !has {
+		return 0
+	}
+	return st.Horizon
+}
+
+// Truncate moves the horizon of the partial feed up to seq and forgets the ranges before it.
+// If seq falls into a gap, the horizon moves further up to the next stored message.
+// It returns the new horizon, the caller is responsible for dropping the messages up to it.
+func (s *Store) Truncate(feed *refs.FeedRef, seq int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, has := s.feeds[feed.Ref()]
+	if !has {
+		return 0, fmt.Errorf("feedranges: %s is not partial", feed.ShortRef())
+	}
+	if seq <= st.Horizon {
+		return st.Horizon, nil
+	}
+
+	var kept []Range
+	for _, r := range st.Ranges {
+		if r.To <= seq {
+			continue
+		}
+		if r.From <= seq {
+			r.From = seq + 1
+		}
+		kept = append(kept, r)
+	}
+	if len(kept) == 0 {
+		return st.Horizon, fmt.Errorf("feedranges: truncating %s at %d would drop all of it", feed.ShortRef(), seq)
+	}
+
+	st.Horizon = kept[0].From - 1
+	st.Ranges = kept
+	return st.Horizon, s.save()
+}
+
+// Lift resets the horizon of feed, so that the dropped messages are fetched again
+func (s *Store) Lift(feed *refs.FeedRef) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, has := s.feeds[feed.Ref()]
+	if !has || st.Horizon == 0 {
+		return nil
+	}
+	st.Horizon = 0
+	return s.save()
+}
+
+// Forget stops tracking feed, for instance after its messages were deleted
+func (s *Store) Forget(feed *refs.FeedRef) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, has := s.feeds[feed.Ref()]; !has {
+		return nil
+	}
+	delete(s.feeds, feed.Ref())
+	return s.save()
+}
+
+// merge sorts the ranges and joins the ones that overlap or touch
+func merge(rs []Range) []Range {
+	sort.Slice(rs, func(i, j int) bool { return rs[i].From < rs[j].From })
+
+	merged := rs[:1]
+	for _, r := range rs[1:] {
+		last := &merged[len(merged)-1]
+		if r.From <= last.To+1 {
+			if r.To > last.To {
+				last.To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// save writes the store to a temporary file first, so that it's never left half written
+func (s *Store) save() error {
+	b, err := json.Marshal(s.feeds)
+	if err != nil {
+		return fmt.Errorf("feedranges: failed to encode store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("feedranges: failed to create store folder: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("feedranges: failed to write store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("feedranges: failed to replace store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: MIT
+
+package feedranges
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func testFeed(name string) *refs.FeedRef {
+	h := sha256.Sum256([]byte(name))
+	return &refs.FeedRef{ID: h[:], Algo: refs.RefAlgoFeedSSB1}
+}
+
+func TestStore(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	s, err := Open(testRepo)
+	r.NoError(err)
+
+	alice, bob := testFeed("alice"), testFeed("bob")
+	r.False(s.IsPartial(alice))
+	r.Nil(s.Ranges(alice))
+	_, partial := s.Prefix(alice)
+	r.False(partial)
+
+	// the latest messages only
+	r.NoError(s.Add(alice, 90, 100))
+	r.True(s.IsPartial(alice))
+	end, partial := s.Prefix(alice)
+	r.True(partial)
+	r.EqualValues(0, end)
+	r.True(s.Has(alice, 90))
+	r.False(s.Has(alice, 89))
+	r.False(s.Has(bob, 90))
+
+	// touching and overlapping ranges are joined
+	r.NoError(s.Add(alice, 1, 10))
+	r.NoError(s.Add(alice, 11, 20))
+	r.NoError(s.Add(alice, 85, 95))
+	r.NoError(s.Add(alice, 50, 60))
+	r.Equal([]Range{{1, 20}, {50, 60}, {85, 100}}, s.Ranges(alice))
+
+	end, _ = s.Prefix(alice)
+	r.EqualValues(20, end)
+
+	rng, ok := s.RangeOf(alice, 55)
+	r.True(ok)
+	r.Equal(Range{50, 60}, rng)
+	_, ok = s.RangeOf(alice, 40)
+	r.False(ok)
+
+	r.Error(s.Add(bob, 0, 3))
+	r.Error(s.Add(bob, 5, 4))
+	r.False(s.IsPartial(bob))
+	r.NoError(s.Add(bob, 3, 3))
+	r.Error(s.AddSeqs(bob, []int64{7, 0}))
+	r.NoError(s.AddSeqs(bob, []int64{9, 5, 4, 7}))
+
+	// survives a restart
+	s, err = Open(testRepo)
+	r.NoError(err)
+	r.Equal([]Range{{1, 20}, {50, 60}, {85, 100}}, s.Ranges(alice))
+	r.Equal([]Range{{3, 5}, {7, 7}, {9, 9}}, s.Ranges(bob))
+
+	r.NoError(s.Forget(bob))
+	r.False(s.IsPartial(bob))
+
+	s, err = Open(testRepo)
+	r.NoError(err)
+	r.False(s.IsPartial(bob))
+	r.True(s.IsPartial(alice))
+}
+
+func TestStoreHorizon(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	s, err := Open(testRepo)
+	r.NoError(err)
+
+	alice := testFeed("alice")
+	_, err = s.Truncate(alice, 10)
+	r.Error(err, "not partial")
+
+	r.NoError(s.Add(alice, 1, 20))
+	r.NoError(s.Add(alice, 50, 60))
+
+	h, err := s.Truncate(alice, 15)
+	r.NoError(err)
+	r.EqualValues(15, h)
+	r.Equal([]Range{{16, 20}, {50, 60}}, s.Ranges(alice))
+
+	// dropped messages count as stored
+	r.True(s.Has(alice, 3))
+	r.False(s.Has(alice, 30))
+	end, partial := s.Prefix(alice)
+	r.True(partial)
+	r.EqualValues(20, end)
+
+	// a horizon in a gap moves up to the next stored message
+	h, err = s.Truncate(alice, 30)
+	r.NoError(err)
+	r.EqualValues(49, h)
+	r.Equal([]Range{{50, 60}}, s.Ranges(alice))
+	end, _ = s.Prefix(alice)
+	r.EqualValues(60, end)
+
+	// it doesn't move back and nothing is added behind it
+	h, err = s.Truncate(alice, 20)
+	r.NoError(err)
+	r.EqualValues(49, h)
+	r.NoError(s.Add(alice, 40, 45))
+	r.NoError(s.Add(alice, 45, 52))
+	r.Equal([]Range{{50, 60}}, s.Ranges(alice))
+
+	_, err = s.Truncate(alice, 60)
+	r.Error(err, "would drop everything")
+
+	s, err = Open(testRepo)
+	r.NoError(err)
+	r.EqualValues(49, s.Horizon(alice))
+
+	r.NoError(s.Lift(alice))
+	r.EqualValues(0, s.Horizon(alice))
+	r.False(s.Has(alice, 3))
+	end, _ = s.Prefix(alice)
+	r.EqualValues(0, end)
+}
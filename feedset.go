@@ -10,7 +10,6 @@ import (
 
 	"go.cryptoscope.co/ssb/internal/storedrefs"
 	refs "go.mindeco.de/ssb-refs"
-	"go.mindeco.de/ssb-refs/tfk"
 )
 
 type strFeedMap map[librarian.Addr]struct{}
@@ -58,13 +57,12 @@ func (fs StrFeedSet) List() ([]*refs.FeedRef, error) {
 	i := 0
 
 	for feed := range fs.set {
-		var sr tfk.Feed
-		err := sr.UnmarshalBinary([]byte(feed))
+		ref, err := storedrefs.ParseFeed([]byte(feed))
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode map entry: %w", err)
 		}
 		// log.Printf("dbg List(%d) %s", i, ref.Ref())
-		lst[i] = sr.Feed().Copy()
+		lst[i] = ref
 		i++
 	}
 	return lst, nil
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: MIT
+
+// Package forks keeps the persistent list of feeds that forked, together with the evidence for each of them.
+// Forked feeds are quarantined: their messages are refused and they aren't replicated until they are cleared.
+package forks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// Registry implements message.ForkRegistry.
+// It's a small map that is written to disk as a whole, forks should be rare.
+type Registry struct {
+	path string
+
+	mu     sync.Mutex
+	forked map[string]message.ForkEvidence
+
+	notify []func(feed *refs.FeedRef, forked bool)
+}
+
+var _ message.ForkRegistry = (*Registry)(nil)
+
+// Open loads the registry of the repo
+func Open(r repo.Interface) (*Registry, error) {
+	reg := &Registry{
+		path:   r.GetPath("forks.json"),
+		forked: make(map[string]message.ForkEvidence),
+	}
+
+	f, err := os.Open(reg.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return reg, nil
+		}
+		return nil, fmt.Errorf("forks: failed to open registry: %w", err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&reg.forked); err != nil {
+		return nil, fmt.Errorf("forks: failed to decode registry: %w", err)
+	}
+	return reg, nil
+}
+
+// Notify registers fn to be called after a feed was marked as forked or cleared
+func (reg *Registry) Notify(fn func(feed *refs.FeedRef, forked bool)) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.notify = append(reg.notify, fn)
+}
+
+// IsForked returns true if the feed is quarantined
+func (reg *Registry) IsForked(feed *refs.FeedRef) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	_, has := reg.forked[feed.Ref()]
+	return has
+}
+
+// MarkForked quarantines the feed of the evidence. Only the first evidence of a feed is kept.
+func (reg *Registry) MarkForked(ev message.ForkEvidence) error {
+	reg.mu.Lock()
+	if _, has := reg.forked[ev.Feed.Ref()]; has {
+		reg.mu.Unlock()
+		return nil
+	}
+	reg.forked[ev.Feed.Ref()] = ev
+	err := reg.save()
+	notify := reg.notify
+	reg.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	for _, fn := range notify {
+		fn(ev.Feed, true)
+	}
+	return nil
+}
+
+// Clear lifts the quarantine of a feed and forgets its evidence
+func (reg *Registry) Clear(feed *refs.FeedRef) error {
+	reg.mu.Lock()
+	if _, has := reg.forked[feed.Ref()]; !has {
+		reg.mu.Unlock()
+		return fmt.Errorf("forks: %s is not marked as forked", feed.Ref())
+	}
+	delete(reg.forked, feed.Ref())
+	err := reg.save()
+	notify := reg.notify
+	reg.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	for _, fn := range notify {
+		fn(feed, false)
+	}
+	return nil
+}
+
+// List returns the evidence of all forked feeds, in the order they were detected
+func (reg *Registry) List() []message.ForkEvidence {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	lst := make([]message.ForkEvidence, 0, len(reg.forked))
+	for _, ev := range reg.forked {
+		lst = append(lst, ev)
+	}
+	sort.Slice(lst, func(i, j int) bool {
+		if lst[i].Detected == lst[j].Detected {
+			return lst[i].Feed.Ref() < lst[j].Feed.Ref()
+		}
+		return lst[i].Detected < lst[j].Detected
+	})
+	return lst
+}
+
+// save writes the registry to a temporary file first, so that it's never left half written
+func (reg *Registry) save() error {
+	b, err := json.Marshal(reg.forked)
+	if err != nil {
+		return fmt.Errorf("forks: failed to encode registry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(reg.path), 0700); err != nil {
+		return fmt.Errorf("forks: failed to create registry folder: %w", err)
+	}
+
+	tmp := reg.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("forks: failed to write registry: %w", err)
+	}
+	if err := os.Rename(tmp, reg.path); err != nil {
+		return fmt.Errorf("forks: failed to replace registry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: MIT
+
+package forks
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func testFeed(name string) *refs.FeedRef {
+	h := sha256.Sum256([]byte(name))
+	return &refs.FeedRef{ID: h[:], Algo: refs.RefAlgoFeedSSB1}
+}
+
+func TestRegistry(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	reg, err := Open(testRepo)
+	r.NoError(err)
+	r.Len(reg.List(), 0)
+
+	type change struct {
+		feed   string
+		forked bool
+	}
+	var changes []change
+	reg.Notify(func(feed *refs.FeedRef, forked bool) {
+		changes = append(changes, change{feed.Ref(), forked})
+	})
+
+	alice, bob := testFeed("alice"), testFeed("bob")
+	r.False(reg.IsForked(alice))
+
+	r.NoError(reg.MarkForked(message.ForkEvidence{Feed: alice, Sequence: 3, Detected: 2}))
+	r.NoError(reg.MarkForked(message.ForkEvidence{Feed: bob, Sequence: 7, Detected: 1}))
+
+	// only the first evidence is kept
+	r.NoError(reg.MarkForked(message.ForkEvidence{Feed: alice, Sequence: 4, Detected: 3}))
+
+	r.True(reg.IsForked(alice))
+	r.True(reg.IsForked(bob))
+	r.Equal([]change{{alice.Ref(), true}, {bob.Ref(), true}}, changes)
+
+	lst := reg.List()
+	r.Len(lst, 2)
+	r.True(lst[0].Feed.Equal(bob), "ordered by detection")
+	r.True(lst[1].Feed.Equal(alice))
+	r.EqualValues(3, lst[1].Sequence)
+
+	// survives a restart
+	reg, err = Open(testRepo)
+	r.NoError(err)
+	r.True(reg.IsForked(alice))
+	r.True(reg.IsForked(bob))
+
+	changes = nil
+	reg.Notify(func(feed *refs.FeedRef, forked bool) {
+		changes = append(changes, change{feed.Ref(), forked})
+	})
+
+	r.NoError(reg.Clear(alice))
+	r.Error(reg.Clear(alice), "not forked anymore")
+	r.False(reg.IsForked(alice))
+	r.Equal([]change{{alice.Ref(), false}}, changes)
+
+	reg, err = Open(testRepo)
+	r.NoError(err)
+	r.False(reg.IsForked(alice))
+	r.Len(reg.List(), 1)
+}
@@ -20,6 +20,7 @@ import (
 
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/repo"
 	refs "go.mindeco.de/ssb-refs"
 	"go.mindeco.de/ssb-refs/tfk"
 )
@@ -35,6 +36,9 @@ type Builder interface {
 
 	Hops(*refs.FeedRef, int) *ssb.StrFeedSet
 
+	// Distances returns the same feeds as Hops, mapped to the number of hops they are away (0 for direct follows)
+	Distances(*refs.FeedRef, int) map[string]int
+
 	Authorizer(from *refs.FeedRef, maxHops int) ssb.Authorizer
 
 	DeleteAuthor(who *refs.FeedRef) error
@@ -119,11 +123,30 @@ func (b *builder) indexUpdateFunc(ctx context.Context, seq margaret.Seq, val int
 
 func (b *builder) OpenIndex() (librarian.SeqSetterIndex, librarian.SinkIndex) {
 	if b.idxSink == nil {
-		b.idxSink = librarian.NewSinkIndex(b.indexUpdateFunc, b.idx)
+		b.idxSink = batchSink{
+			BatchSinkIndex: repo.NewBadgerSinkIndex(b.kv, b.indexUpdateFunc, b.idx),
+			b:              b,
+		}
 	}
 	return b.idx, b.idxSink
 }
 
+// batchSink drops the cached graph again after a batch was committed,
+// a Build while the batch was processed might have cached the old state.
+type batchSink struct {
+	repo.BatchSinkIndex
+
+	b *builder
+}
+
+func (bs batchSink) PourBatch(ctx context.Context, vals []interface{}) error {
+	err := bs.BatchSinkIndex.PourBatch(ctx, vals)
+	bs.b.cacheLock.Lock()
+	bs.b.cachedGraph = nil
+	bs.b.cacheLock.Unlock()
+	return err
+}
+
 func (b *builder) DeleteAuthor(who *refs.FeedRef) error {
 	b.cacheLock.Lock()
 	defer b.cacheLock.Unlock()
@@ -319,6 +342,61 @@ func (b *builder) Hops(from *refs.FeedRef, max int) *ssb.StrFeedSet {
 	return walked
 }
 
+// Distances walks the follows breadth-first, so each feed gets the shortest number of hops to it.
+// Like Hops it only continues through friends (mutual follows).
+func (b *builder) Distances(from *refs.FeedRef, max int) map[string]int {
+	dist, err := b.distances(from, max)
+	if err != nil {
+		b.log.Log("event", "error", "msg", "distance walk failed", "err", err)
+		return nil
+	}
+	return dist
+}
+
+func (b *builder) distances(from *refs.FeedRef, max int) (map[string]int, error) {
+	dist := make(map[string]int)
+	walked := map[string]struct{}{from.Ref(): {}}
+	frontier := []*refs.FeedRef{from}
+	for h := 0; h <= max && len(frontier) > 0; h++ {
+		var next []*refs.FeedRef
+		for _, f := range frontier {
+			follows, err := b.Follows(f)
+			if err != nil {
+				return nil, fmt.Errorf("distances(%d): follow listing failed: %w", h, err)
+			}
+			lst, err := follows.List()
+			if err != nil {
+				return nil, fmt.Errorf("distances(%d): invalid entry in feed set: %w", h, err)
+			}
+			for _, followed := range lst {
+				if followed.Equal(from) {
+					continue
+				}
+				if _, has := dist[followed.Ref()]; !has {
+					dist[followed.Ref()] = h
+				}
+
+				if h == max {
+					continue
+				}
+				if _, has := walked[followed.Ref()]; has {
+					continue
+				}
+				theirs, err := b.Follows(followed)
+				if err != nil {
+					return nil, fmt.Errorf("distances(%d): follows of %s failed: %w", h, followed.ShortRef(), err)
+				}
+				if theirs.Has(f) { // found a friend, continue from there
+					walked[followed.Ref()] = struct{}{}
+					next = append(next, followed)
+				}
+			}
+		}
+		frontier = next
+	}
+	return dist, nil
+}
+
 func (b *builder) recurseHops(walked *ssb.StrFeedSet, vis map[string]struct{}, from *refs.FeedRef, depth int) error {
 	if depth == 0 {
 		return nil
@@ -91,6 +91,15 @@ var hopsScenarios = []PeopleTestCase{
 			PeopleAssertHops("alice", 0, "bob", "claire"),
 			PeopleAssertHops("alice", 1, "bob", "claire", "bobf1", "bobf2"),
 			PeopleAssertHops("alice", 2, "bob", "claire", "bobf1", "bobf2", "bobfam1", "bobfam2", "bobfam3"),
+			PeopleAssertDistances("alice", 2, map[string]int{
+				"bob": 0, "claire": 0,
+				"bobf1": 1, "bobf2": 1,
+				"bobfam1": 2, "bobfam2": 2, "bobfam3": 2,
+			}),
+			PeopleAssertDistances("alice", 1, map[string]int{
+				"bob": 0, "claire": 0,
+				"bobf1": 1, "bobf2": 1,
+			}),
 		},
 	},
 }
@@ -150,6 +159,24 @@ func PeopleAssertHops(from string, hops int, tos ...string) PeopleAssertMaker {
 	}
 }
 
+func PeopleAssertDistances(from string, hops int, want map[string]int) PeopleAssertMaker {
+	return func(state *testState) PeopleAssert {
+		return func(bld Builder) error {
+			alice, ok := state.peers[from]
+			if !ok {
+				return fmt.Errorf("no such from peer")
+			}
+
+			got := make(map[string]int)
+			for ref, d := range bld.Distances(alice.key.Id, hops) {
+				got[state.refToName[ref]] = d
+			}
+			assert.Equal(state.t, want, got, "wrong distances")
+			return nil
+		}
+	}
+}
+
 func dumpMap(m map[string]bool, s *testState) {
 	for k, v := range m {
 		s.t.Logf("%v:%v", s.refToName[k], v)
@@ -245,6 +245,41 @@ func (b *logBuilder) Hops(from *refs.FeedRef, max int) *ssb.StrFeedSet {
 	return fs
 }
 
+func (b *logBuilder) Distances(from *refs.FeedRef, max int) map[string]int {
+	g, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	b.current.Lock()
+	defer b.current.Unlock()
+	dist := make(map[string]int)
+	nFrom, has := g.lookup[storedrefs.Feed(from)]
+	if !has {
+		return dist
+	}
+	w := traverse.BreadthFirst{
+		// only traverse friend edges, like Hops
+		Traverse: func(e graph.Edge) bool {
+			ce := e.(contactEdge)
+			rev := g.Edge(ce.To().ID(), ce.From().ID())
+			if rev == nil {
+				return true
+			}
+			return ce.Weight() == 1 && rev.(contactEdge).Weight() == 1
+		},
+	}
+	w.Walk(g, nFrom, func(n graph.Node, d int) bool {
+		if d > max+1 {
+			return true
+		}
+		if d > 0 {
+			dist[n.(*contactNode).feed.Ref()] = d - 1
+		}
+		return false
+	})
+	return dist
+}
+
 func (bld *logBuilder) State(a, b *refs.FeedRef) int {
 	g, err := bld.Build()
 	if err != nil {
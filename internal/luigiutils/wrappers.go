@@ -57,6 +57,44 @@ func NewGabbyStreamSink(w *muxrpc.ByteSink) luigi.Sink {
 	})
 }
 
+// NewBendyButtStreamSink is like NewGabbyStreamSink but for bendy-butt messages, which are sent as they were signed
+func NewBendyButtStreamSink(w *muxrpc.ByteSink) luigi.Sink {
+	w.SetEncoding(muxrpc.TypeBinary)
+	return luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+		var mm *multimsg.MultiMessage
+		switch tv := v.(type) {
+		case *multimsg.MultiMessage:
+			mm = tv
+		case multimsg.MultiMessage:
+			mm = &tv
+		case margaret.SeqWrapper:
+			boxedV := tv.Value()
+			theMsg, ok := boxedV.(multimsg.MultiMessage)
+			if !ok {
+				return fmt.Errorf("bendyButtStream: expected MultiMessage in sequence wrapper - got %T", boxedV)
+			}
+			mm = &theMsg
+
+		default:
+			return fmt.Errorf("bendyButtStream: expected MultiMessage - got %T", v)
+		}
+
+		bb, ok := mm.AsBendyButt()
+		if !ok {
+			return fmt.Errorf("bendyButtStream: wrong format type")
+		}
+
+		_, err = w.Write(bb.Raw())
+		return err
+	})
+}
+
 // NewSinkCounter returns a new Sink which increases the given counter when poured to.
 // warning: also counts errored pour calls on the wrapped sink
 func NewSinkCounter(counter *int, sink luigi.Sink) luigi.FuncSink {
@@ -7,10 +7,20 @@ import (
 	"go.cryptoscope.co/librarian"
 	refs "go.mindeco.de/ssb-refs"
 	"go.mindeco.de/ssb-refs/tfk"
+
+	"go.cryptoscope.co/ssb/message/bendybutt"
 )
 
+// typeFeed is the type byte of stored feed references
+const typeFeed byte = 0x00
+
 // Feed returns the key under which this ref is stored in the indexing system
 func Feed(r *refs.FeedRef) librarian.Addr {
+	// the tfk package doesn't know bendy-butt feeds (yet)
+	if r.Algo == bendybutt.RefAlgoFeedBendyButt {
+		return librarian.Addr(append([]byte{typeFeed, bendybutt.FeedFormatCode}, r.ID...))
+	}
+
 	sr, err := tfk.FeedFromRef(r)
 	if err != nil {
 		panic(fmt.Errorf("failed to make stored ref: %w", err))
@@ -22,3 +32,18 @@ func Feed(r *refs.FeedRef) librarian.Addr {
 	}
 	return librarian.Addr(b)
 }
+
+// ParseFeed is the reverse of Feed
+func ParseFeed(b []byte) (*refs.FeedRef, error) {
+	if len(b) == 34 && b[0] == typeFeed && b[1] == bendybutt.FeedFormatCode {
+		id := make([]byte, 32)
+		copy(id, b[2:])
+		return &refs.FeedRef{ID: id, Algo: bendybutt.RefAlgoFeedBendyButt}, nil
+	}
+
+	var sr tfk.Feed
+	if err := sr.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return sr.Feed().Copy(), nil
+}
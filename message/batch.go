@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// BatchSink is implemented by the verify sinks that can check the signatures of several messages of a feed at once.
+type BatchSink interface {
+	SequencedSink
+
+	// VerifyBatch checks the signatures of all messages in parallel and then appends them in order, like Verify would.
+	// It stops at the first invalid message, the ones before it are stored.
+	VerifyBatch([][]byte) error
+}
+
+// VerifyBatch passes msgs to snk as one batch if it supports that or one by one if not.
+func VerifyBatch(snk SequencedSink, msgs [][]byte) error {
+	if bs, ok := snk.(BatchSink); ok {
+		return bs.VerifyBatch(msgs)
+	}
+	for _, msg := range msgs {
+		if err := snk.Verify(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	_ BatchSink = (*streamDrain)(nil)
+	_ BatchSink = forkGuard{}
+)
+
+// VerifyBatch decodes and checks the signatures of msgs on the shared verification pool.
+// The checks against the previous message still happen one after the other,
+// the valid messages are then saved together if the storage supports it.
+func (ld *streamDrain) VerifyBatch(msgs [][]byte) error {
+	results := defaultVerifyPool.verify(ld.verify, msgs)
+
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+
+	bs, ok := ld.storage.(BatchSaveMessager)
+	if !ok {
+		for _, res := range results {
+			if res.err != nil {
+				return fmt.Errorf("message(%s:%d) verify failed: %w", ld.who.ShortRef(), ld.latestSeq.Seq(), res.err)
+			}
+			if err := ld.appendNext(res.msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		current    = ld.latestMsg
+		currentSeq = ld.latestSeq.Seq()
+		valid      = make([]refs.Message, 0, len(results))
+		checkErr   error
+	)
+	for _, res := range results {
+		if res.err != nil {
+			checkErr = fmt.Errorf("message(%s:%d) verify failed: %w", ld.who.ShortRef(), currentSeq, res.err)
+			break
+		}
+		skip, err := checkNext(current, res.msg)
+		if err != nil {
+			checkErr = err
+			break
+		}
+		if skip {
+			continue
+		}
+		valid = append(valid, res.msg)
+		current = res.msg
+		currentSeq = current.Seq()
+	}
+
+	// store what is valid, even if the batch broke off
+	saved, err := bs.SaveBatch(valid)
+	if saved > 0 {
+		ld.latestMsg = valid[saved-1]
+		ld.latestSeq = margaret.BaseSeq(ld.latestMsg.Seq())
+	}
+	if err != nil {
+		return fmt.Errorf("message(%s): failed to save batch: %w", ld.who.ShortRef(), err)
+	}
+	return checkErr
+}
+
+// VerifyBatch refuses batches of forked feeds and marks the feed if the batch shows a new fork
+func (fg forkGuard) VerifyBatch(msgs [][]byte) error {
+	if fg.forks.IsForked(fg.who) {
+		return ErrQuarantined
+	}
+
+	err := VerifyBatch(fg.SequencedSink, msgs)
+
+	var forked ErrForked
+	if errors.As(err, &forked) {
+		if mErr := fg.forks.MarkForked(forked.Evidence); mErr != nil {
+			return fmt.Errorf("message(%s): failed to mark forked feed: %w", fg.who.ShortRef(), mErr)
+		}
+	}
+	return err
+}
+
+// defaultVerifyPool is shared by all feeds, so that concurrent streams don't start more workers than there are cores
+var defaultVerifyPool = newVerifyPool(runtime.NumCPU())
+
+type verifyResult struct {
+	msg refs.Message
+	err error
+}
+
+type verifyJob struct {
+	verify verifier
+	raw    []byte
+
+	res *verifyResult
+	wg  *sync.WaitGroup
+}
+
+// verifyPool checks message signatures on a fixed number of workers
+type verifyPool struct {
+	jobs chan verifyJob
+}
+
+func newVerifyPool(workers int) *verifyPool {
+	if workers < 1 {
+		workers = 1
+	}
+	vp := &verifyPool{
+		jobs: make(chan verifyJob, workers),
+	}
+	for i := 0; i < workers; i++ {
+		go vp.work()
+	}
+	return vp
+}
+
+func (vp *verifyPool) work() {
+	for job := range vp.jobs {
+		job.res.msg, job.res.err = job.verify.Verify(job.raw)
+		job.wg.Done()
+	}
+}
+
+// verify returns the decoded messages in the order of msgs, once all of them are checked
+func (vp *verifyPool) verify(v verifier, msgs [][]byte) []verifyResult {
+	results := make([]verifyResult, len(msgs))
+
+	// not worth the hand over
+	if len(msgs) == 1 {
+		results[0].msg, results[0].err = v.Verify(msgs[0])
+		return results
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(msgs))
+	for i, raw := range msgs {
+		vp.jobs <- verifyJob{
+			verify: v,
+			raw:    raw,
+			res:    &results[i],
+			wg:     &wg,
+		}
+	}
+	wg.Wait()
+	return results
+}
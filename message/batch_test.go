@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestVerifyBatch(t *testing.T) {
+	r := require.New(t)
+
+	alice := newTestAuthor(t)
+
+	var (
+		msgs [][]byte
+		prev *refs.MessageRef
+	)
+	for seq := int64(1); seq <= 20; seq++ {
+		ref, raw := alice.sign(seq, prev, "hello")
+		msgs = append(msgs, raw)
+		prev = ref
+	}
+
+	var saved memSaver
+	snk := NewVerifySink(alice.ref, margaret.BaseSeq(0), nil, &saved, nil)
+	r.NoError(VerifyBatch(snk, msgs[:10]))
+	r.EqualValues(10, snk.Seq())
+
+	// overlapping batches are fine
+	r.NoError(VerifyBatch(snk, msgs[5:15]))
+	r.EqualValues(15, snk.Seq())
+	r.Len(saved, 15)
+	for i, msg := range saved {
+		r.EqualValues(i+1, msg.Seq(), "out of order")
+	}
+
+	// a broken signature stops the batch, the messages before it are kept
+	broken := make([][]byte, 5)
+	copy(broken, msgs[15:])
+	broken[2] = bytes.Replace(broken[2], []byte("hello"), []byte("hallo"), 1)
+	r.Error(VerifyBatch(snk, broken))
+	r.EqualValues(17, snk.Seq())
+
+	// so does a gap
+	r.Error(VerifyBatch(snk, msgs[18:]))
+	r.EqualValues(17, snk.Seq())
+
+	r.NoError(VerifyBatch(snk, msgs[17:]))
+	r.EqualValues(20, snk.Seq())
+}
+
+func TestVerifyBatchForkGuard(t *testing.T) {
+	r := require.New(t)
+
+	alice := newTestAuthor(t)
+	ref1, msg1 := alice.sign(1, nil, "one")
+	ref2, msg2 := alice.sign(2, ref1, "two")
+	_, fork2 := alice.sign(2, ref1, "other two")
+	_, msg3 := alice.sign(3, ref2, "three")
+
+	forks := make(memForks)
+	var saved memSaver
+	snk := forkGuard{
+		SequencedSink: NewVerifySink(alice.ref, margaret.BaseSeq(0), nil, &saved, nil),
+		who:           alice.ref,
+		forks:         forks,
+	}
+
+	var forked ErrForked
+	err := VerifyBatch(snk, [][]byte{msg1, msg2, fork2, msg3})
+	r.True(errors.As(err, &forked), "expected fork error, got %v", err)
+	r.True(forks.IsForked(alice.ref))
+	r.Len(saved, 2)
+
+	r.Equal(ErrQuarantined, VerifyBatch(snk, [][]byte{msg3}))
+}
@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: MIT
+
+package bendybutt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// encodeValue appends the bencoding of v to buf.
+// Supported are byte strings, integers, lists and dictionaries (with their keys sorted).
+func encodeValue(buf *bytes.Buffer, v interface{}) error {
+	switch tv := v.(type) {
+	case []byte:
+		buf.WriteString(strconv.Itoa(len(tv)))
+		buf.WriteByte(':')
+		buf.Write(tv)
+
+	case int64:
+		buf.WriteByte('i')
+		buf.WriteString(strconv.FormatInt(tv, 10))
+		buf.WriteByte('e')
+
+	case []interface{}:
+		buf.WriteByte('l')
+		for i, elem := range tv {
+			if err := encodeValue(buf, elem); err != nil {
+				return fmt.Errorf("list element %d: %w", i, err)
+			}
+		}
+		buf.WriteByte('e')
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(tv))
+		for k := range tv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('d')
+		for _, k := range keys {
+			encodeValue(buf, []byte(k))
+			if err := encodeValue(buf, tv[k]); err != nil {
+				return fmt.Errorf("dictionary value %q: %w", k, err)
+			}
+		}
+		buf.WriteByte('e')
+
+	default:
+		return fmt.Errorf("bencode: unsupported type %T", v)
+	}
+	return nil
+}
+
+func encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// maxDepth limits how deeply lists and dictionaries can be nested
+const maxDepth = 32
+
+var errUnexpectedEnd = errors.New("bencode: unexpected end of data")
+
+// decode decodes a single value that has to span all of data.
+// The values are returned as the types that encodeValue supports.
+func decode(data []byte) (interface{}, error) {
+	v, rest, err := decodeValue(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("bencode: %d trailing bytes", len(rest))
+	}
+	return v, nil
+}
+
+func decodeValue(data []byte, depth int) (interface{}, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errUnexpectedEnd
+	}
+	if depth > maxDepth {
+		return nil, nil, errors.New("bencode: nested too deeply")
+	}
+
+	switch c := data[0]; {
+	case c == 'i':
+		end := bytes.IndexByte(data, 'e')
+		if end < 0 {
+			return nil, nil, errUnexpectedEnd
+		}
+		num := string(data[1:end])
+		i, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bencode: invalid integer: %w", err)
+		}
+		// only the shortest form is valid, so that every value has exactly one encoding
+		if strconv.FormatInt(i, 10) != num {
+			return nil, nil, fmt.Errorf("bencode: non-canonical integer %q", num)
+		}
+		return i, data[end+1:], nil
+
+	case c >= '0' && c <= '9':
+		colon := bytes.IndexByte(data, ':')
+		if colon < 0 {
+			return nil, nil, errUnexpectedEnd
+		}
+		num := string(data[:colon])
+		n, err := strconv.Atoi(num)
+		if err != nil || n < 0 || strconv.Itoa(n) != num {
+			return nil, nil, fmt.Errorf("bencode: invalid string length %q", num)
+		}
+		data = data[colon+1:]
+		if len(data) < n {
+			return nil, nil, errUnexpectedEnd
+		}
+		return data[:n:n], data[n:], nil
+
+	case c == 'l':
+		lst := []interface{}{}
+		data = data[1:]
+		for {
+			if len(data) == 0 {
+				return nil, nil, errUnexpectedEnd
+			}
+			if data[0] == 'e' {
+				return lst, data[1:], nil
+			}
+			var (
+				elem interface{}
+				err  error
+			)
+			elem, data, err = decodeValue(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			lst = append(lst, elem)
+		}
+
+	case c == 'd':
+		dict := make(map[string]interface{})
+		var lastKey string
+		data = data[1:]
+		for {
+			if len(data) == 0 {
+				return nil, nil, errUnexpectedEnd
+			}
+			if data[0] == 'e' {
+				return dict, data[1:], nil
+			}
+
+			var (
+				key, val interface{}
+				err      error
+			)
+			key, data, err = decodeValue(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			k, ok := key.([]byte)
+			if !ok {
+				return nil, nil, fmt.Errorf("bencode: dictionary key is not a string but %T", key)
+			}
+			if len(dict) > 0 && string(k) <= lastKey {
+				return nil, nil, fmt.Errorf("bencode: dictionary keys not sorted or duplicated at %q", k)
+			}
+			lastKey = string(k)
+
+			val, data, err = decodeValue(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			dict[lastKey] = val
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("bencode: invalid value prefix %q", c)
+	}
+}
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: MIT
+
+package bendybutt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	refs "go.mindeco.de/ssb-refs"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestBencode(t *testing.T) {
+	r := require.New(t)
+
+	v := map[string]interface{}{
+		"b": []interface{}{int64(-3), []byte("spam")},
+		"a": int64(42),
+	}
+	enc, err := encode(v)
+	r.NoError(err)
+	r.Equal("d1:ai42e1:bli-3e4:spamee", string(enc))
+
+	dec, err := decode(enc)
+	r.NoError(err)
+	r.Equal(v, dec)
+
+	for _, invalid := range []string{
+		"i03e",           // leading zero
+		"i-0e",           // negative zero
+		"02:ab",          // leading zero in length
+		"d1:bi1e1:ai2ee", // unsorted keys
+		"d1:ai1e1:ai2ee", // duplicated key
+		"l",              // unterminated
+		"5:abc",          // too short
+		"i1ei2e",         // trailing data
+	} {
+		_, err := decode([]byte(invalid))
+		r.Error(err, "%q", invalid)
+	}
+}
+
+func TestEncodeVerify(t *testing.T) {
+	r := require.New(t)
+
+	metaPub, metaKey, err := ed25519.GenerateKey(nil)
+	r.NoError(err)
+	subPub, subKey, err := ed25519.GenerateKey(nil)
+	r.NoError(err)
+
+	metaRef := &refs.FeedRef{ID: metaPub, Algo: RefAlgoFeedBendyButt}
+	subRef := &refs.FeedRef{ID: subPub, Algo: refs.RefAlgoFeedSSB1}
+
+	content := map[string]interface{}{
+		"type":        "metafeed/add",
+		"feedpurpose": "main",
+		"subfeed":     subRef.Ref(),
+		"metafeed":    metaRef.Ref(),
+		"tangled":     true,
+		"count":       3,
+	}
+
+	enc := NewEncoder(metaKey)
+	enc.overwriteTime = func() time.Time { return time.Unix(1500000000, 123000000) }
+
+	first, err := enc.Encode(1, nil, content, subKey)
+	r.NoError(err)
+	r.True(first.Author().Equal(metaRef))
+	r.EqualValues(1, first.Seq())
+	r.Nil(first.Previous())
+	r.Equal(RefAlgoMessageBendyButt, first.Key().Algo)
+	r.Equal(time.Unix(1500000000, 123000000), first.Claimed())
+
+	verified, err := Verify(first.Raw(), nil)
+	r.NoError(err)
+	r.True(verified.Key().Equal(first.Key()))
+
+	// the content can be read as JSON
+	var got map[string]interface{}
+	r.NoError(json.Unmarshal(verified.ContentBytes(), &got))
+	r.Equal("metafeed/add", got["type"])
+	r.Equal(subRef.Ref(), got["subfeed"])
+	r.Equal(metaRef.Ref(), got["metafeed"])
+	r.Equal(true, got["tangled"])
+	r.EqualValues(3, got["count"])
+
+	second, err := enc.Encode(2, first.Key(), content, subKey)
+	r.NoError(err)
+	verified, err = Verify(second.Raw(), nil)
+	r.NoError(err)
+	r.True(verified.Previous().Equal(first.Key()))
+
+	// only the subfeed can sign the content
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	r.NoError(err)
+	_, err = enc.Encode(1, nil, content, otherKey)
+	r.Error(err)
+
+	// the first message has no previous and the others need one
+	_, err = enc.Encode(2, nil, content, subKey)
+	r.Error(err)
+
+	// content without subfeed
+	_, err = enc.Encode(1, nil, map[string]interface{}{"type": "test"}, subKey)
+	r.Error(err)
+
+	// tampering breaks the signatures
+	tampered := bytes.Replace(first.Raw(), []byte("main"), []byte("mein"), 1)
+	_, err = Verify(tampered, nil)
+	r.Error(err)
+
+	// hmac
+	var hmacKey [32]byte
+	copy(hmacKey[:], bytes.Repeat([]byte("hmac"), 8))
+	_, err = Verify(first.Raw(), &hmacKey)
+	r.Error(err)
+
+	enc.WithHMAC(&hmacKey)
+	withHMAC, err := enc.Encode(1, nil, content, subKey)
+	r.NoError(err)
+	_, err = Verify(withHMAC.Raw(), &hmacKey)
+	r.NoError(err)
+	_, err = Verify(withHMAC.Raw(), nil)
+	r.Error(err)
+}
+
+// TestSpecLayout assembles a message byte by byte as laid out in the bendy-butt and BFE specs,
+// without the encoder of this package, and checks that both sides agree on it.
+func TestSpecLayout(t *testing.T) {
+	r := require.New(t)
+
+	metaKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, 32))
+	subKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, 32))
+	metaPub := metaKey.Public().(ed25519.PublicKey)
+	subPub := subKey.Public().(ed25519.PublicKey)
+
+	cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	// content: {"active": true, "subfeed": <classic feed>, "type": "metafeed/add"}
+	content := cat(
+		[]byte("d"),
+		[]byte("6:active"), []byte("3:\x06\x01\x01"), // BFE boolean true
+		[]byte("7:subfeed"), []byte("34:\x00\x00"), subPub, // BFE classic feed
+		[]byte("4:type"), []byte("14:\x06\x00metafeed/add"), // BFE string
+		[]byte("e"),
+	)
+	contentSig := ed25519.Sign(subKey, cat([]byte("bendybutt"), content))
+
+	// payload: [author, sequence, previous, timestamp, [content, contentSignature]]
+	payload := cat(
+		[]byte("l"),
+		[]byte("34:\x00\x03"), metaPub, // BFE bendy-butt feed
+		[]byte("i1e"),
+		[]byte("2:\x06\x02"), // BFE nil, the first message has no previous
+		[]byte("i1500000000123e"),
+		[]byte("l"), content, []byte("66:\x04\x00"), contentSig, []byte("e"), // BFE ed25519 signature
+		[]byte("e"),
+	)
+	sig := ed25519.Sign(metaKey, payload)
+	raw := cat([]byte("l"), payload, []byte("66:\x04\x00"), sig, []byte("e"))
+
+	msg, err := Verify(raw, nil)
+	r.NoError(err)
+	wantKey := sha256.Sum256(raw)
+	r.Equal(wantKey[:], msg.Key().Hash)
+	r.True(msg.Author().Equal(&refs.FeedRef{ID: metaPub, Algo: RefAlgoFeedBendyButt}))
+	r.EqualValues(1, msg.Seq())
+	r.Nil(msg.Previous())
+	r.Equal(time.Unix(1500000000, 123000000), msg.Claimed())
+
+	subRef := &refs.FeedRef{ID: subPub, Algo: refs.RefAlgoFeedSSB1}
+	r.JSONEq(`{"active":true,"subfeed":"`+subRef.Ref()+`","type":"metafeed/add"}`, string(msg.ContentBytes()))
+
+	// the encoder produces the same bytes
+	enc := NewEncoder(metaKey)
+	enc.overwriteTime = func() time.Time { return time.Unix(1500000000, 123000000) }
+	encoded, err := enc.Encode(1, nil, map[string]interface{}{
+		"type":    "metafeed/add",
+		"subfeed": subRef.Ref(),
+		"active":  true,
+	}, subKey)
+	r.NoError(err)
+	r.Equal(raw, encoded.Raw())
+}
+
+func TestParseRefs(t *testing.T) {
+	r := require.New(t)
+
+	ref := &refs.FeedRef{ID: bytes.Repeat([]byte{1}, 32), Algo: RefAlgoFeedBendyButt}
+	parsed, err := ParseFeedRef(ref.Ref())
+	r.NoError(err)
+	r.True(parsed.Equal(ref))
+
+	classic := &refs.FeedRef{ID: bytes.Repeat([]byte{2}, 32), Algo: refs.RefAlgoFeedSSB1}
+	parsed, err = ParseFeedRef(classic.Ref())
+	r.NoError(err)
+	r.True(parsed.Equal(classic))
+
+	msgRef := &refs.MessageRef{Hash: bytes.Repeat([]byte{3}, 32), Algo: RefAlgoMessageBendyButt}
+	parsedMsg, err := ParseMessageRef(msgRef.Ref())
+	r.NoError(err)
+	r.True(parsedMsg.Equal(msgRef))
+
+	_, err = ParseFeedRef("@short.bbfeed-v1")
+	r.Error(err)
+}
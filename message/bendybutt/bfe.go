@@ -0,0 +1,322 @@
+// SPDX-License-Identifier: MIT
+
+package bendybutt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	refs "go.mindeco.de/ssb-refs"
+)
+
+const (
+	// RefAlgoFeedBendyButt is the suffix of bendy-butt feed references
+	RefAlgoFeedBendyButt = "bbfeed-v1"
+
+	// RefAlgoMessageBendyButt is the suffix of bendy-butt message references
+	RefAlgoMessageBendyButt = "bbmsg-v1"
+)
+
+// The binary field encoding (BFE) prefixes a value with its type and format.
+// See https://github.com/ssb-ngi-pointer/ssb-bfe-spec
+const (
+	bfeTypeFeed      byte = 0x00
+	bfeTypeMessage   byte = 0x01
+	bfeTypeSignature byte = 0x04
+	bfeTypeGeneric   byte = 0x06
+
+	bfeFeedClassic   byte = 0x00
+	bfeFeedGabby     byte = 0x01
+	bfeFeedBendyButt byte = 0x03
+
+	bfeMessageClassic   byte = 0x00
+	bfeMessageGabby     byte = 0x01
+	bfeMessageBendyButt byte = 0x04
+
+	bfeSignatureEd25519 byte = 0x00
+
+	bfeGenericString byte = 0x00
+	bfeGenericBool   byte = 0x01
+	bfeGenericNil    byte = 0x02
+	bfeGenericBytes  byte = 0x03
+)
+
+// FeedFormatCode is the format byte with which bendy-butt feeds are stored, like the ones of the type-format-key package
+const FeedFormatCode = bfeFeedBendyButt
+
+var feedFormats = map[string]byte{
+	refs.RefAlgoFeedSSB1:  bfeFeedClassic,
+	refs.RefAlgoFeedGabby: bfeFeedGabby,
+	RefAlgoFeedBendyButt:  bfeFeedBendyButt,
+}
+
+var messageFormats = map[string]byte{
+	refs.RefAlgoMessageSSB1:  bfeMessageClassic,
+	refs.RefAlgoMessageGabby: bfeMessageGabby,
+	RefAlgoMessageBendyButt:  bfeMessageBendyButt,
+}
+
+func encodeFeed(ref *refs.FeedRef) ([]byte, error) {
+	format, ok := feedFormats[ref.Algo]
+	if !ok {
+		return nil, fmt.Errorf("bfe: unsupported feed format %q", ref.Algo)
+	}
+	if len(ref.ID) != 32 {
+		return nil, fmt.Errorf("bfe: invalid feed key length %d", len(ref.ID))
+	}
+	return append([]byte{bfeTypeFeed, format}, ref.ID...), nil
+}
+
+func encodeMessage(ref *refs.MessageRef) ([]byte, error) {
+	if ref == nil {
+		return []byte{bfeTypeGeneric, bfeGenericNil}, nil
+	}
+	format, ok := messageFormats[ref.Algo]
+	if !ok {
+		return nil, fmt.Errorf("bfe: unsupported message format %q", ref.Algo)
+	}
+	if len(ref.Hash) != 32 {
+		return nil, fmt.Errorf("bfe: invalid message hash length %d", len(ref.Hash))
+	}
+	return append([]byte{bfeTypeMessage, format}, ref.Hash...), nil
+}
+
+func encodeSignature(sig []byte) []byte {
+	return append([]byte{bfeTypeSignature, bfeSignatureEd25519}, sig...)
+}
+
+func decodeFeed(v interface{}) (*refs.FeedRef, error) {
+	b, ok := v.([]byte)
+	if !ok || len(b) != 34 || b[0] != bfeTypeFeed {
+		return nil, errors.New("bfe: not a feed reference")
+	}
+	for algo, format := range feedFormats {
+		if b[1] == format {
+			return &refs.FeedRef{ID: b[2:], Algo: algo}, nil
+		}
+	}
+	return nil, fmt.Errorf("bfe: unsupported feed format %x", b[1])
+}
+
+// decodeMessage returns nil if v is the nil value
+func decodeMessage(v interface{}) (*refs.MessageRef, error) {
+	b, ok := v.([]byte)
+	if ok && len(b) == 2 && b[0] == bfeTypeGeneric && b[1] == bfeGenericNil {
+		return nil, nil
+	}
+	if !ok || len(b) != 34 || b[0] != bfeTypeMessage {
+		return nil, errors.New("bfe: not a message reference")
+	}
+	for algo, format := range messageFormats {
+		if b[1] == format {
+			return &refs.MessageRef{Hash: b[2:], Algo: algo}, nil
+		}
+	}
+	return nil, fmt.Errorf("bfe: unsupported message format %x", b[1])
+}
+
+func decodeSignature(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok || len(b) != 66 || b[0] != bfeTypeSignature || b[1] != bfeSignatureEd25519 {
+		return nil, errors.New("bfe: not an ed25519 signature")
+	}
+	return b[2:], nil
+}
+
+// toBFE converts JSON-like content (as it comes out of a json.Decoder with UseNumber) into the values that are bencoded.
+// Strings that are feed or message references are encoded as such, numbers have to be integers.
+func toBFE(v interface{}) (interface{}, error) {
+	switch tv := v.(type) {
+	case nil:
+		return []byte{bfeTypeGeneric, bfeGenericNil}, nil
+
+	case bool:
+		b := byte(0)
+		if tv {
+			b = 1
+		}
+		return []byte{bfeTypeGeneric, bfeGenericBool, b}, nil
+
+	case json.Number:
+		i, err := tv.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("bfe: only integers are supported, got %s", tv)
+		}
+		return i, nil
+
+	case string:
+		if ref, err := ParseFeedRef(tv); err == nil {
+			return encodeFeed(ref)
+		}
+		if ref, err := ParseMessageRef(tv); err == nil {
+			return encodeMessage(ref)
+		}
+		return append([]byte{bfeTypeGeneric, bfeGenericString}, tv...), nil
+
+	case []interface{}:
+		lst := make([]interface{}, len(tv))
+		for i, elem := range tv {
+			var err error
+			if lst[i], err = toBFE(elem); err != nil {
+				return nil, err
+			}
+		}
+		return lst, nil
+
+	case map[string]interface{}:
+		dict := make(map[string]interface{}, len(tv))
+		for k, elem := range tv {
+			var err error
+			if dict[k], err = toBFE(elem); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("bfe: unsupported type %T", v)
+}
+
+// fromBFE is the reverse of toBFE, references are returned in their string form
+func fromBFE(v interface{}) (interface{}, error) {
+	switch tv := v.(type) {
+	case int64:
+		return tv, nil
+
+	case []byte:
+		if len(tv) < 2 {
+			return nil, fmt.Errorf("bfe: value too short (%d bytes)", len(tv))
+		}
+		switch tv[0] {
+		case bfeTypeFeed:
+			ref, err := decodeFeed(tv)
+			if err != nil {
+				return nil, err
+			}
+			return ref.Ref(), nil
+		case bfeTypeMessage:
+			ref, err := decodeMessage(tv)
+			if err != nil {
+				return nil, err
+			}
+			return ref.Ref(), nil
+		case bfeTypeSignature:
+			sig, err := decodeSignature(tv)
+			if err != nil {
+				return nil, err
+			}
+			return base64.StdEncoding.EncodeToString(sig) + ".sig.ed25519", nil
+		case bfeTypeGeneric:
+			switch tv[1] {
+			case bfeGenericString:
+				return string(tv[2:]), nil
+			case bfeGenericBool:
+				if len(tv) != 3 || tv[2] > 1 {
+					return nil, errors.New("bfe: invalid boolean")
+				}
+				return tv[2] == 1, nil
+			case bfeGenericNil:
+				return nil, nil
+			case bfeGenericBytes:
+				return base64.StdEncoding.EncodeToString(tv[2:]), nil
+			}
+		}
+		return nil, fmt.Errorf("bfe: unsupported type %x and format %x", tv[0], tv[1])
+
+	case []interface{}:
+		lst := make([]interface{}, len(tv))
+		for i, elem := range tv {
+			var err error
+			if lst[i], err = fromBFE(elem); err != nil {
+				return nil, err
+			}
+		}
+		return lst, nil
+
+	case map[string]interface{}:
+		dict := make(map[string]interface{}, len(tv))
+		for k, elem := range tv {
+			var err error
+			if dict[k], err = fromBFE(elem); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("bfe: unsupported type %T", v)
+}
+
+// contentToJSON returns the JSON form of bencoded content, with sorted keys
+func contentToJSON(content map[string]interface{}) ([]byte, error) {
+	v, err := fromBFE(content)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// contentFromValue converts v into bencodable content, via its JSON encoding
+func contentFromValue(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("bendybutt: failed to encode content: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, fmt.Errorf("bendybutt: failed to decode content: %w", err)
+	}
+	if _, ok := generic.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("bendybutt: content has to be an object, not %T", generic)
+	}
+
+	converted, err := toBFE(generic)
+	if err != nil {
+		return nil, err
+	}
+	return converted.(map[string]interface{}), nil
+}
+
+// ParseFeedRef parses bendy-butt feed references and everything refs.ParseFeedRef knows
+func ParseFeedRef(s string) (*refs.FeedRef, error) {
+	if strings.HasSuffix(s, "."+RefAlgoFeedBendyButt) {
+		key, err := parseSigil(s, "@", RefAlgoFeedBendyButt)
+		if err != nil {
+			return nil, err
+		}
+		return &refs.FeedRef{ID: key, Algo: RefAlgoFeedBendyButt}, nil
+	}
+	return refs.ParseFeedRef(s)
+}
+
+// ParseMessageRef parses bendy-butt message references and everything refs.ParseMessageRef knows
+func ParseMessageRef(s string) (*refs.MessageRef, error) {
+	if strings.HasSuffix(s, "."+RefAlgoMessageBendyButt) {
+		hash, err := parseSigil(s, "%", RefAlgoMessageBendyButt)
+		if err != nil {
+			return nil, err
+		}
+		return &refs.MessageRef{Hash: hash, Algo: RefAlgoMessageBendyButt}, nil
+	}
+	return refs.ParseMessageRef(s)
+}
+
+func parseSigil(s, sigil, algo string) ([]byte, error) {
+	if !strings.HasPrefix(s, sigil) {
+		return nil, fmt.Errorf("bendybutt: reference without %s sigil", sigil)
+	}
+	b64 := strings.TrimSuffix(strings.TrimPrefix(s, sigil), "."+algo)
+	b, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("bendybutt: invalid reference encoding: %w", err)
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("bendybutt: invalid reference length %d", len(b))
+	}
+	return b, nil
+}
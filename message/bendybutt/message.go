@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: MIT
+
+// Package bendybutt implements the bendy-butt feed format, which is used by metafeeds.
+//
+// A message is the bencoded list [payload, signature] with the payload being [author, sequence, previous, timestamp, [content, contentSignature]].
+// References, signatures and the values of the content dictionary are in the binary field encoding (BFE).
+// The payload is signed by the author and the content by the subfeed it talks about, so that a metafeed can't announce feeds that aren't its own.
+// The key of a message is the SHA256 hash of its complete encoding.
+//
+// See https://github.com/ssb-ngi-pointer/bendy-butt-spec for the details.
+package bendybutt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cryptix/go/encodedTime"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// Message is a verified bendy-butt message
+type Message struct {
+	author    *refs.FeedRef
+	sequence  int64
+	previous  *refs.MessageRef
+	timestamp time.Time
+	content   map[string]interface{}
+	signature []byte
+
+	key *refs.MessageRef
+	raw []byte
+}
+
+var _ refs.Message = (*Message)(nil)
+
+// Raw returns the encoded message, as it is sent over the network
+func (msg Message) Raw() []byte { return msg.raw }
+
+func (msg Message) Key() *refs.MessageRef      { return msg.key }
+func (msg Message) Previous() *refs.MessageRef { return msg.previous }
+func (msg Message) Seq() int64                 { return msg.sequence }
+func (msg Message) Claimed() time.Time         { return msg.timestamp }
+func (msg Message) Author() *refs.FeedRef      { return msg.author }
+
+// Received isn't known to the message itself, see multimsg
+func (msg Message) Received() time.Time { return time.Time{} }
+
+// ContentBytes returns the content as JSON, so that the indexes can work with it like with the other formats
+func (msg Message) ContentBytes() []byte {
+	b, err := contentToJSON(msg.content)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (msg Message) ValueContent() *refs.Value {
+	var val refs.Value
+	val.Previous = msg.previous
+	val.Author = *msg.author
+	val.Sequence = margaret.BaseSeq(msg.sequence)
+	val.Timestamp = encodedTime.Millisecs(msg.timestamp)
+	val.Hash = "bendybutt"
+	val.Content = msg.ContentBytes()
+	val.Signature = base64.StdEncoding.EncodeToString(msg.signature) + ".sig.ed25519"
+	return &val
+}
+
+func (msg Message) ValueContentJSON() json.RawMessage {
+	b, err := json.Marshal(msg.ValueContent())
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// Decode parses an encoded message without checking its signatures.
+// Use Verify for messages from the network.
+func Decode(raw []byte) (*Message, error) {
+	msg, _, _, err := decodeMessageParts(raw)
+	return msg, err
+}
+
+// decodeMessageParts also returns what the author and the subfeed signed
+func decodeMessageParts(raw []byte) (*Message, []byte, []byte, error) {
+	v, err := decode(raw)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	outer, ok := v.([]interface{})
+	if !ok || len(outer) != 2 {
+		return nil, nil, nil, errors.New("bendybutt: message is not a list of payload and signature")
+	}
+	payload, ok := outer[0].([]interface{})
+	if !ok || len(payload) != 5 {
+		return nil, nil, nil, errors.New("bendybutt: payload is not a list of five elements")
+	}
+
+	var msg Message
+	msg.raw = raw
+
+	if msg.signature, err = decodeSignature(outer[1]); err != nil {
+		return nil, nil, nil, fmt.Errorf("bendybutt: invalid signature: %w", err)
+	}
+
+	if msg.author, err = decodeFeed(payload[0]); err != nil {
+		return nil, nil, nil, fmt.Errorf("bendybutt: invalid author: %w", err)
+	}
+	if msg.author.Algo != RefAlgoFeedBendyButt {
+		return nil, nil, nil, fmt.Errorf("bendybutt: author is not a bendy-butt feed: %s", msg.author.Algo)
+	}
+
+	seq, ok := payload[1].(int64)
+	if !ok || seq < 1 {
+		return nil, nil, nil, errors.New("bendybutt: invalid sequence")
+	}
+	msg.sequence = seq
+
+	if msg.previous, err = decodeMessage(payload[2]); err != nil {
+		return nil, nil, nil, fmt.Errorf("bendybutt: invalid previous: %w", err)
+	}
+	if (seq == 1) != (msg.previous == nil) {
+		return nil, nil, nil, fmt.Errorf("bendybutt: message %d with previous %v", seq, msg.previous)
+	}
+
+	ts, ok := payload[3].(int64)
+	if !ok {
+		return nil, nil, nil, errors.New("bendybutt: invalid timestamp")
+	}
+	msg.timestamp = time.Unix(ts/1000, (ts%1000)*int64(time.Millisecond))
+
+	section, ok := payload[4].([]interface{})
+	if !ok || len(section) != 2 {
+		return nil, nil, nil, errors.New("bendybutt: content section is not a list of content and signature")
+	}
+	if msg.content, ok = section[0].(map[string]interface{}); !ok {
+		return nil, nil, nil, errors.New("bendybutt: content is not a dictionary")
+	}
+	contentSig, err := decodeSignature(section[1])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("bendybutt: invalid content signature: %w", err)
+	}
+
+	// the values have to be valid BFE, too
+	if _, err := fromBFE(msg.content); err != nil {
+		return nil, nil, nil, fmt.Errorf("bendybutt: invalid content: %w", err)
+	}
+
+	// the encoding is canonical if it survives a round trip, which also gives the signed payload
+	reencoded, err := encode(outer)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !bytes.Equal(reencoded, raw) {
+		return nil, nil, nil, errors.New("bendybutt: message is not canonically encoded")
+	}
+	payloadBytes, err := encode(outer[0])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	h := sha256.Sum256(raw)
+	msg.key = &refs.MessageRef{Hash: h[:], Algo: RefAlgoMessageBendyButt}
+
+	return &msg, payloadBytes, contentSig, nil
+}
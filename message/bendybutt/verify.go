@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: MIT
+
+package bendybutt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	refs "go.mindeco.de/ssb-refs"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/nacl/auth"
+)
+
+// contentSignaturePrefix is prepended to the encoded content before it is signed by the subfeed
+var contentSignaturePrefix = []byte("bendybutt")
+
+// subFeedField is the field of the content that names the feed which signs the content
+const subFeedField = "subfeed"
+
+// Verify decodes raw and checks both of its signatures.
+// If hmacSecret is non nil, the author signed the HMAC of the payload, like with the other formats.
+func Verify(raw []byte, hmacSecret *[32]byte) (*Message, error) {
+	msg, payload, contentSig, err := decodeMessageParts(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if hmacSecret != nil {
+		mac := auth.Sum(payload, hmacSecret)
+		payload = mac[:]
+	}
+	if !ed25519.Verify(msg.author.PubKey(), payload, msg.signature) {
+		return nil, fmt.Errorf("bendybutt(%s:%d): invalid signature", msg.author.ShortRef(), msg.sequence)
+	}
+
+	sub, err := subFeedOf(msg.content)
+	if err != nil {
+		return nil, fmt.Errorf("bendybutt(%s:%d): %w", msg.author.ShortRef(), msg.sequence, err)
+	}
+	signed, err := signedContent(msg.content)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(sub.PubKey(), signed, contentSig) {
+		return nil, fmt.Errorf("bendybutt(%s:%d): invalid content signature by %s", msg.author.ShortRef(), msg.sequence, sub.ShortRef())
+	}
+
+	return msg, nil
+}
+
+func subFeedOf(content map[string]interface{}) (*refs.FeedRef, error) {
+	v, has := content[subFeedField]
+	if !has {
+		return nil, errors.New("content without subfeed")
+	}
+	sub, err := decodeFeed(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subfeed: %w", err)
+	}
+	return sub, nil
+}
+
+func signedContent(content map[string]interface{}) ([]byte, error) {
+	encoded, err := encode(content)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, contentSignaturePrefix...), encoded...), nil
+}
+
+// Encoder creates the messages of a bendy-butt feed
+type Encoder struct {
+	author ed25519.PrivateKey
+
+	hmacSecret    *[32]byte
+	setTimestamp  bool
+	overwriteTime func() time.Time
+}
+
+// NewEncoder returns an encoder for the messages of the feed of author
+func NewEncoder(author ed25519.PrivateKey) *Encoder {
+	return &Encoder{
+		author:        author,
+		setTimestamp:  true,
+		overwriteTime: time.Now,
+	}
+}
+
+// WithHMAC makes the encoder sign the HMAC of the payload, see Verify
+func (e *Encoder) WithHMAC(secret *[32]byte) { e.hmacSecret = secret }
+
+// WithNowTimestamps decides if the messages get the current time or zero as their timestamp
+func (e *Encoder) WithNowTimestamps(yes bool) { e.setTimestamp = yes }
+
+// Encode creates message seq of the feed after prev, which is nil for the first one.
+// The content has to encode to a JSON object with a subfeed field, subKey is the key of that subfeed.
+func (e *Encoder) Encode(seq int64, prev *refs.MessageRef, content interface{}, subKey ed25519.PrivateKey) (*Message, error) {
+	if seq < 1 {
+		return nil, fmt.Errorf("bendybutt: invalid sequence %d", seq)
+	}
+	if (seq == 1) != (prev == nil) {
+		return nil, fmt.Errorf("bendybutt: message %d with previous %v", seq, prev)
+	}
+
+	contentDict, err := contentFromValue(content)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := subFeedOf(contentDict)
+	if err != nil {
+		return nil, fmt.Errorf("bendybutt: %w", err)
+	}
+	if !sub.Equal(&refs.FeedRef{ID: subKey.Public().(ed25519.PublicKey), Algo: sub.Algo}) {
+		return nil, fmt.Errorf("bendybutt: content names subfeed %s but was given another key", sub.ShortRef())
+	}
+	signed, err := signedContent(contentDict)
+	if err != nil {
+		return nil, err
+	}
+	contentSig := ed25519.Sign(subKey, signed)
+
+	authorRef := &refs.FeedRef{ID: e.author.Public().(ed25519.PublicKey), Algo: RefAlgoFeedBendyButt}
+	authorBFE, err := encodeFeed(authorRef)
+	if err != nil {
+		return nil, err
+	}
+	prevBFE, err := encodeMessage(prev)
+	if err != nil {
+		return nil, err
+	}
+
+	var ts int64
+	if e.setTimestamp {
+		ts = e.overwriteTime().UnixNano() / int64(time.Millisecond)
+	}
+
+	payload := []interface{}{
+		authorBFE,
+		seq,
+		prevBFE,
+		ts,
+		[]interface{}{contentDict, encodeSignature(contentSig)},
+	}
+	payloadBytes, err := encode(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	toSign := payloadBytes
+	if e.hmacSecret != nil {
+		mac := auth.Sum(payloadBytes, e.hmacSecret)
+		toSign = mac[:]
+	}
+	sig := ed25519.Sign(e.author, toSign)
+
+	raw, err := encode([]interface{}{payload, encodeSignature(sig)})
+	if err != nil {
+		return nil, err
+	}
+	return Decode(raw)
+}
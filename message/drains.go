@@ -11,6 +11,7 @@ import (
 
 	"go.cryptoscope.co/margaret"
 
+	"go.cryptoscope.co/ssb/message/bendybutt"
 	"go.cryptoscope.co/ssb/message/legacy"
 	gabbygrove "go.mindeco.de/ssb-gabbygrove"
 	refs "go.mindeco.de/ssb-refs"
@@ -37,14 +38,22 @@ func NewVerifySink(who *refs.FeedRef, start margaret.Seq, abs refs.Message, save
 		latestSeq: margaret.BaseSeq(start.Seq()),
 		latestMsg: abs,
 		storage:   saver,
+		verify:    newVerifier(who, hmacKey),
 	}
+	return sd
+}
+
+// newVerifier returns the signature check for the format of the feed, nil if it's not supported
+func newVerifier(who *refs.FeedRef, hmacKey *[32]byte) verifier {
 	switch who.Algo {
 	case refs.RefAlgoFeedSSB1:
-		sd.verify = legacyVerify{hmacKey: hmacKey}
+		return legacyVerify{hmacKey: hmacKey}
 	case refs.RefAlgoFeedGabby:
-		sd.verify = gabbyVerify{hmacKey: hmacKey}
+		return gabbyVerify{hmacKey: hmacKey}
+	case bendybutt.RefAlgoFeedBendyButt:
+		return bendyButtVerify{hmacKey: hmacKey}
 	}
-	return sd
+	return nil
 }
 
 type verifier interface {
@@ -99,6 +108,18 @@ func (gv gabbyVerify) Verify(trBytes []byte) (msg refs.Message, err error) {
 	return
 }
 
+type bendyButtVerify struct {
+	hmacKey *[32]byte
+}
+
+func (bv bendyButtVerify) Verify(raw []byte) (refs.Message, error) {
+	msg, err := bendybutt.Verify(raw, bv.hmacKey)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
 type streamDrain struct {
 	// gets the input from the screen and returns the next decoded message, if it is valid
 	verify verifier
@@ -119,7 +140,7 @@ func (ld *streamDrain) Seq() int64 {
 	return int64(ld.latestSeq)
 }
 
-// Verify passes the raw message bytes to the verifaction function for the message format (legacy or gabby grove).
+// Verify passes the raw message bytes to the verifaction function for the message format (legacy, gabby grove or bendy-butt).
 // If it passes the message is checked with the current message using ValidateNext().
 // If that also passes it is saved to the storage system.
 func (ld *streamDrain) Verify(msg []byte) error {
@@ -131,11 +152,14 @@ func (ld *streamDrain) Verify(msg []byte) error {
 		return fmt.Errorf("message(%s:%d) verify failed: %w", ld.who.ShortRef(), ld.latestSeq.Seq(), err)
 	}
 
-	err = ValidateNext(ld.latestMsg, next)
-	if err != nil {
-		if err == errSkip {
-			return nil
-		}
+	return ld.appendNext(next)
+}
+
+// appendNext checks a message with a valid signature against the current one and saves it.
+// ld.mu has to be held.
+func (ld *streamDrain) appendNext(next refs.Message) error {
+	skip, err := checkNext(ld.latestMsg, next)
+	if err != nil || skip {
 		return err
 	}
 
@@ -149,6 +173,20 @@ func (ld *streamDrain) Verify(msg []byte) error {
 	return nil
 }
 
+// checkNext returns ErrForked if next shows a fork and otherwise the result of ValidateNext.
+// Messages that are already stored are skipped.
+func checkNext(current, next refs.Message) (bool, error) {
+	if ev, forked := forkEvidence(current, next); forked {
+		return false, ErrForked{Evidence: ev}
+	}
+
+	err := ValidateNext(current, next)
+	if err == errSkip {
+		return true, nil
+	}
+	return false, err
+}
+
 var errSkip = errors.New("ValidateNext: already got message")
 
 // ValidateNext checks the author stays the same across the feed,
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// ForkEvidence are two validly signed messages of a feed that can't both be part of it.
+// Incoming either has the same sequence as Stored or comes right after it but doesn't point to it as previous.
+type ForkEvidence struct {
+	Feed *refs.FeedRef `json:"feed"`
+
+	// Sequence of the stored message
+	Sequence int64 `json:"sequence"`
+
+	Stored   json.RawMessage `json:"stored"`
+	Incoming json.RawMessage `json:"incoming"`
+
+	// Detected is when the fork was noticed, in milliseconds
+	Detected int64 `json:"detected"`
+}
+
+// ErrForked is returned by the verify sinks when an incoming message shows that the feed forked
+type ErrForked struct {
+	Evidence ForkEvidence
+}
+
+func (e ErrForked) Error() string {
+	return fmt.Sprintf("message(%s:%d): feed forked", e.Evidence.Feed.ShortRef(), e.Evidence.Sequence)
+}
+
+// ErrQuarantined is returned for messages of feeds that were marked as forked
+var ErrQuarantined = errors.New("message: feed is quarantined because it forked")
+
+// ForkRegistry keeps track of forked feeds.
+// The verify sinks mark new forks and refuse messages of known ones.
+type ForkRegistry interface {
+	IsForked(*refs.FeedRef) bool
+	MarkForked(ForkEvidence) error
+}
+
+// forkEvidence checks if next shows that the feed forked at current.
+// Other problems, like gaps or wrong authors are left to ValidateNext.
+func forkEvidence(current, next refs.Message) (ForkEvidence, bool) {
+	var ev ForkEvidence
+	if current == nil || current.Seq() == 0 {
+		return ev, false
+	}
+	if !current.Author().Equal(next.Author()) {
+		return ev, false
+	}
+
+	switch next.Seq() {
+	case current.Seq():
+		if current.Key().Equal(next.Key()) {
+			return ev, false
+		}
+	case current.Seq() + 1:
+		if current.Key().Equal(next.Previous()) {
+			return ev, false
+		}
+	default:
+		return ev, false
+	}
+
+	ev.Feed = current.Author()
+	ev.Sequence = current.Seq()
+	ev.Stored = current.ValueContentJSON()
+	ev.Incoming = next.ValueContentJSON()
+	ev.Detected = time.Now().UnixNano() / 1e6
+	return ev, true
+}
+
+// forkGuard wraps the verify sink of a feed with a ForkRegistry
+type forkGuard struct {
+	SequencedSink
+
+	who   *refs.FeedRef
+	forks ForkRegistry
+}
+
+// Verify refuses messages of forked feeds and marks the feed if this message shows a new fork
+func (fg forkGuard) Verify(msg []byte) error {
+	if fg.forks.IsForked(fg.who) {
+		return ErrQuarantined
+	}
+
+	err := fg.SequencedSink.Verify(msg)
+
+	var forked ErrForked
+	if errors.As(err, &forked) {
+		if mErr := fg.forks.MarkForked(forked.Evidence); mErr != nil {
+			return fmt.Errorf("message(%s): failed to mark forked feed: %w", fg.who.ShortRef(), mErr)
+		}
+	}
+	return err
+}
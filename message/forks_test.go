@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	"golang.org/x/crypto/ed25519"
+
+	"go.cryptoscope.co/ssb/message/legacy"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+type memSaver []refs.Message
+
+func (ms *memSaver) Save(msg refs.Message) error {
+	*ms = append(*ms, msg)
+	return nil
+}
+
+type memForks map[string]ForkEvidence
+
+func (mf memForks) IsForked(ref *refs.FeedRef) bool {
+	_, has := mf[ref.Ref()]
+	return has
+}
+
+func (mf memForks) MarkForked(ev ForkEvidence) error {
+	mf[ev.Feed.Ref()] = ev
+	return nil
+}
+
+type testAuthor struct {
+	t    *testing.T
+	priv ed25519.PrivateKey
+	ref  *refs.FeedRef
+}
+
+func newTestAuthor(t *testing.T) testAuthor {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return testAuthor{t, priv, &refs.FeedRef{ID: pub, Algo: refs.RefAlgoFeedSSB1}}
+}
+
+func (ta testAuthor) sign(seq int64, prev *refs.MessageRef, text string) (*refs.MessageRef, []byte) {
+	ref, raw, err := legacy.LegacyMessage{
+		Previous:  prev,
+		Author:    ta.ref.Ref(),
+		Sequence:  margaret.BaseSeq(seq),
+		Timestamp: seq,
+		Hash:      "sha256",
+		Content:   map[string]interface{}{"type": "test", "text": text},
+	}.Sign(ta.priv, nil)
+	require.NoError(ta.t, err)
+	return ref, raw
+}
+
+func TestForkDetection(t *testing.T) {
+	r := require.New(t)
+
+	alice := newTestAuthor(t)
+	ref1, msg1 := alice.sign(1, nil, "one")
+	ref2, msg2 := alice.sign(2, ref1, "two")
+	fork2Ref, fork2 := alice.sign(2, ref1, "other two")
+	_, msg3 := alice.sign(3, ref2, "three")
+	_, fork3 := alice.sign(3, fork2Ref, "three on the other branch")
+
+	var saved memSaver
+	snk := NewVerifySink(alice.ref, margaret.BaseSeq(0), nil, &saved, nil)
+	r.NoError(snk.Verify(msg1))
+	r.NoError(snk.Verify(msg2))
+	r.NoError(snk.Verify(msg2), "same message again is skipped")
+	r.Len(saved, 2)
+
+	// same sequence, different message
+	err := snk.Verify(fork2)
+	var forked ErrForked
+	r.True(errors.As(err, &forked), "expected fork error, got %v", err)
+	r.True(forked.Evidence.Feed.Equal(alice.ref))
+	r.EqualValues(2, forked.Evidence.Sequence)
+	r.Contains(string(forked.Evidence.Stored), `"two"`)
+	r.Contains(string(forked.Evidence.Incoming), `"other two"`)
+
+	// next sequence that doesn't point to the stored message
+	err = snk.Verify(fork3)
+	r.True(errors.As(err, &forked), "expected fork error, got %v", err)
+	r.EqualValues(2, forked.Evidence.Sequence)
+
+	r.NoError(snk.Verify(msg3))
+	r.Len(saved, 3)
+}
+
+func TestForkGuard(t *testing.T) {
+	r := require.New(t)
+
+	alice := newTestAuthor(t)
+	ref1, msg1 := alice.sign(1, nil, "one")
+	ref2, msg2 := alice.sign(2, ref1, "two")
+	_, fork2 := alice.sign(2, ref1, "other two")
+	_, msg3 := alice.sign(3, ref2, "three")
+
+	bob := newTestAuthor(t)
+	_, bobMsg1 := bob.sign(1, nil, "hi")
+
+	forks := make(memForks)
+	var saved memSaver
+	guard := func(who *refs.FeedRef) SequencedSink {
+		return forkGuard{
+			SequencedSink: NewVerifySink(who, margaret.BaseSeq(0), nil, &saved, nil),
+			who:           who,
+			forks:         forks,
+		}
+	}
+
+	snk := guard(alice.ref)
+	r.NoError(snk.Verify(msg1))
+	r.NoError(snk.Verify(msg2))
+
+	var forked ErrForked
+	r.True(errors.As(snk.Verify(fork2), &forked))
+	r.True(forks.IsForked(alice.ref))
+
+	// valid messages of the feed are refused from now on
+	r.Equal(ErrQuarantined, snk.Verify(msg3))
+	r.Len(saved, 2)
+
+	// other feeds aren't affected
+	r.NoError(guard(bob.ref).Verify(bobMsg1))
+	r.Len(saved, 3)
+}
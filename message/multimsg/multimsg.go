@@ -1,7 +1,7 @@
 // SPDX-License-Identifier: MIT
 
 // Package multimsg implements a margaret codec to encode multiple kinds of messages to disk.
-// Currently _legacy_ and _gabbygrove_ but should be easily extendable.
+// Currently _legacy_, _gabbygrove_ and _bendybutt_ but should be easily extendable.
 package multimsg
 
 import (
@@ -13,6 +13,7 @@ import (
 	gabbygrove "go.mindeco.de/ssb-gabbygrove"
 	refs "go.mindeco.de/ssb-refs"
 
+	"go.cryptoscope.co/ssb/message/bendybutt"
 	"go.cryptoscope.co/ssb/message/legacy"
 )
 
@@ -22,6 +23,7 @@ const (
 	Unknown MessageType = iota
 	Legacy
 	Gabby
+	BendyButt
 )
 
 // MultiMessage attempts to support multiple message formats in the same storage layer
@@ -40,6 +42,12 @@ type ggWithMetadata struct {
 	ReceivedTime time.Time
 }
 
+// bbWithMetadata stores the encoded message, which is decoded again without checking its signatures
+type bbWithMetadata struct {
+	Raw          []byte
+	ReceivedTime time.Time
+}
+
 func (mm MultiMessage) MarshalBinary() ([]byte, error) {
 	var buf bytes.Buffer
 	var mh codec.CborHandle
@@ -63,6 +71,15 @@ func (mm MultiMessage) MarshalBinary() ([]byte, error) {
 		}
 		meta.Transfer = *gabby
 		err = enc.Encode(meta)
+	case BendyButt:
+		bb, ok := mm.AsBendyButt()
+		if !ok {
+			return nil, fmt.Errorf("multiMessage: wrong type of message: %T", mm.Message)
+		}
+		err = enc.Encode(bbWithMetadata{
+			Raw:          bb.Raw(),
+			ReceivedTime: mm.Received(),
+		})
 	default:
 		return nil, fmt.Errorf("multiMessage: unsupported message type: %x", mm.tipe)
 	}
@@ -100,6 +117,19 @@ func (mm *MultiMessage) UnmarshalBinary(data []byte) error {
 		mm.received = msg.ReceivedTime
 		mm.Message = &msg.Transfer
 		mm.key = msg.Key()
+	case BendyButt:
+		var stored bbWithMetadata
+		err := dec.Decode(&stored)
+		if err != nil {
+			return fmt.Errorf("multiMessage: bendybutt decoding failed: %w", err)
+		}
+		msg, err := bendybutt.Decode(stored.Raw)
+		if err != nil {
+			return fmt.Errorf("multiMessage: invalid bendybutt message: %w", err)
+		}
+		mm.received = stored.ReceivedTime
+		mm.Message = msg
+		mm.key = msg.Key()
 	default:
 		return fmt.Errorf("multiMessage: unsupported message type: %x", mm.tipe)
 	}
@@ -132,6 +162,17 @@ func (mm MultiMessage) AsGabby() (*gabbygrove.Transfer, bool) {
 	return gabby, true
 }
 
+func (mm MultiMessage) AsBendyButt() (*bendybutt.Message, bool) {
+	if mm.tipe != BendyButt {
+		return nil, false
+	}
+	bb, ok := mm.Message.(*bendybutt.Message)
+	if !ok {
+		return nil, false
+	}
+	return bb, true
+}
+
 func NewMultiMessageFromLegacy(msg *legacy.StoredMessage) *MultiMessage {
 	var mm MultiMessage
 	mm.tipe = Legacy
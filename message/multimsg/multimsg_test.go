@@ -5,6 +5,7 @@ package multimsg
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.cryptoscope.co/margaret"
@@ -12,6 +13,7 @@ import (
 	refs "go.mindeco.de/ssb-refs"
 
 	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message/bendybutt"
 	"go.cryptoscope.co/ssb/message/legacy"
 )
 
@@ -106,3 +108,38 @@ func TestMultiMsgGabby(t *testing.T) {
 	r.NoError(err)
 	r.Equal(uint64(123), evt2.Sequence)
 }
+
+func TestMultiMsgBendyButt(t *testing.T) {
+	r := require.New(t)
+
+	metaKP, err := ssb.NewKeyPair(bytes.NewReader(bytes.Repeat([]byte("meta"), 8)))
+	r.NoError(err)
+	subKP, err := ssb.NewKeyPair(bytes.NewReader(bytes.Repeat([]byte("subf"), 8)))
+	r.NoError(err)
+
+	enc := bendybutt.NewEncoder(metaKP.Pair.Secret)
+	msg, err := enc.Encode(1, nil, map[string]interface{}{
+		"type":    "metafeed/add",
+		"subfeed": subKP.Id.Ref(),
+	}, subKP.Pair.Secret)
+	r.NoError(err)
+
+	var mm MultiMessage
+	mm.tipe = BendyButt
+	mm.Message = msg
+	mm.received = time.Unix(23, 0)
+
+	b, err := mm.MarshalBinary()
+	r.NoError(err)
+	r.Equal(BendyButt, MessageType(b[0]))
+
+	var mm2 MultiMessage
+	err = mm2.UnmarshalBinary(b)
+	r.NoError(err)
+	r.Equal(BendyButt, mm2.tipe)
+	bb, ok := mm2.AsBendyButt()
+	r.True(ok)
+	r.Equal(msg.Raw(), bb.Raw())
+	r.True(mm2.Key().Equal(msg.Key()))
+	r.True(mm2.Received().Equal(time.Unix(23, 0)))
+}
@@ -11,6 +11,7 @@ import (
 	gabbygrove "go.mindeco.de/ssb-gabbygrove"
 	refs "go.mindeco.de/ssb-refs"
 
+	"go.cryptoscope.co/ssb/message/bendybutt"
 	"go.cryptoscope.co/ssb/message/legacy"
 )
 
@@ -57,6 +58,10 @@ func (wl WrappedLog) Append(val interface{}) (margaret.Seq, error) {
 		mm.tipe = Gabby
 		mm.Message = tv
 		mm.received = wl.receivedNow()
+	case *bendybutt.Message:
+		mm.tipe = BendyButt
+		mm.Message = tv
+		mm.received = wl.receivedNow()
 	default:
 		return margaret.SeqEmpty, fmt.Errorf("wrappedLog: unsupported message type: %T", val)
 	}
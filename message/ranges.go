@@ -0,0 +1,422 @@
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/mutil"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+)
+
+// RangeRegistry keeps track of which messages of a feed are stored, for feeds that are stored without the part that comes before them.
+// Those feeds are called partial, the verify sinks don't store their messages twice and VerifyRange adds to them.
+type RangeRegistry interface {
+	IsPartial(*refs.FeedRef) bool
+
+	// Has returns true if the message with the sequence is stored, always false for feeds that aren't partial
+	Has(*refs.FeedRef, int64) bool
+
+	// Prefix returns up to which sequence the feed is stored without gaps from the first message on.
+	// partial is false for feeds that aren't partial.
+	Prefix(*refs.FeedRef) (end int64, partial bool)
+
+	// Add marks the messages from through to as stored, it makes the feed partial
+	Add(feed *refs.FeedRef, from, to int64) error
+
+	// AddSeqs marks the messages with the sequences as stored, all in one go. It makes the feed partial.
+	AddSeqs(feed *refs.FeedRef, seqs []int64) error
+}
+
+// rangeSaver skips the messages of a partial feed that are already stored and records the ones it saves.
+// Messages of feeds that aren't partial are passed on as they are.
+type rangeSaver struct {
+	saver SaveMessager
+
+	feed   *refs.FeedRef
+	ranges RangeRegistry
+
+	// lock is the range lock of feed (see lockRanges), so that looking up what is stored and saving happen in one go.
+	// It's nil for the saver of storePartial, which holds the lock already.
+	lock func() func()
+}
+
+var _ BatchSaveMessager = rangeSaver{}
+
+func (rs rangeSaver) Save(msg refs.Message) error {
+	_, err := rs.SaveBatch([]refs.Message{msg})
+	return err
+}
+
+// SaveBatch saves msgs, sorted by sequence, in runs that are split by the ones that are already stored.
+// The saved ones are recorded all at once afterwards.
+func (rs rangeSaver) SaveBatch(msgs []refs.Message) (int, error) {
+	if rs.lock != nil {
+		unlock := rs.lock()
+		defer unlock()
+	}
+
+	var saved []int64
+	record := func(err error) error {
+		if len(saved) == 0 || !rs.ranges.IsPartial(rs.feed) {
+			return err
+		}
+		if rErr := rs.ranges.AddSeqs(rs.feed, saved); rErr != nil && err == nil {
+			err = fmt.Errorf("message(%s): failed to record stored messages: %w", rs.feed.ShortRef(), rErr)
+		}
+		return err
+	}
+
+	start := 0
+	for i := 0; i <= len(msgs); i++ {
+		if i < len(msgs) && !rs.ranges.Has(rs.feed, msgs[i].Seq()) {
+			continue
+		}
+
+		if run := msgs[start:i]; len(run) > 0 {
+			n, err := saveBatch(rs.saver, run)
+			saved = append(saved, seqsOf(run[:n])...)
+			if err != nil {
+				return start + n, record(err)
+			}
+		}
+		start = i + 1
+	}
+	return len(msgs), record(nil)
+}
+
+// saveBatch uses SaveBatch if the saver supports it
+func saveBatch(saver SaveMessager, msgs []refs.Message) (int, error) {
+	if bs, ok := saver.(BatchSaveMessager); ok {
+		return bs.SaveBatch(msgs)
+	}
+	for i, msg := range msgs {
+		if err := saver.Save(msg); err != nil {
+			return i, err
+		}
+	}
+	return len(msgs), nil
+}
+
+// VerifyRange stores msgs, consecutive messages of ref, without the part of the feed that comes before them.
+// Afterwards the feed is partial, what was stored of it before becomes its first range.
+// Nothing is stored if one of msgs is invalid or doesn't fit to the messages that are already stored.
+func (vs *VerifySink) VerifyRange(ref *refs.FeedRef, msgs [][]byte) error {
+	valid, err := vs.verifyPartial(ref, msgs)
+	if err != nil || len(valid) == 0 {
+		return err
+	}
+	for i := 1; i < len(valid); i++ {
+		if err := ValidateNext(valid[i-1], valid[i]); err != nil {
+			return fmt.Errorf("message(%s): range is not consecutive: %w", ref.ShortRef(), err)
+		}
+	}
+	return vs.storePartial(ref, valid)
+}
+
+// VerifyMessages is VerifyRange for messages of ref that don't have to be consecutive, like the ones of one type.
+// The ones that are next to each other still have to fit together. Either all of msgs are stored or none.
+func (vs *VerifySink) VerifyMessages(ref *refs.FeedRef, msgs [][]byte) error {
+	valid, err := vs.verifyPartial(ref, msgs)
+	if err != nil || len(valid) == 0 {
+		return err
+	}
+	sort.Slice(valid, func(i, j int) bool { return valid[i].Seq() < valid[j].Seq() })
+	for i := 1; i < len(valid); i++ {
+		switch valid[i].Seq() - valid[i-1].Seq() {
+		case 0:
+			return fmt.Errorf("message(%s): got sequence %d twice", ref.ShortRef(), valid[i].Seq())
+		case 1:
+			if err := ValidateNext(valid[i-1], valid[i]); err != nil {
+				return fmt.Errorf("message(%s): messages don't fit together: %w", ref.ShortRef(), err)
+			}
+		}
+	}
+	return vs.storePartial(ref, valid)
+}
+
+// verifyPartial checks the signatures and the author of msgs
+func (vs *VerifySink) verifyPartial(ref *refs.FeedRef, msgs [][]byte) ([]refs.Message, error) {
+	if vs.ranges == nil {
+		return nil, fmt.Errorf("message(%s): storing partial feeds is not supported", ref.ShortRef())
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	if vs.forks != nil && vs.forks.IsForked(ref) {
+		return nil, ErrQuarantined
+	}
+
+	verify := newVerifier(ref, vs.hmacSec)
+	if verify == nil {
+		return nil, fmt.Errorf("message(%s): unsupported feed format", ref.ShortRef())
+	}
+
+	results := defaultVerifyPool.verify(verify, msgs)
+	valid := make([]refs.Message, len(results))
+	for i, res := range results {
+		if res.err != nil {
+			return nil, fmt.Errorf("message(%s) range verify failed: %w", ref.ShortRef(), res.err)
+		}
+		if !ref.Equal(res.msg.Author()) {
+			return nil, fmt.Errorf("message(%s): range contains a message of %s", ref.ShortRef(), res.msg.Author().ShortRef())
+		}
+		valid[i] = res.msg
+	}
+	return valid, nil
+}
+
+// storePartial stores the verified msgs of ref, sorted by sequence, and records them as stored.
+// It only holds the range lock of ref, so the other feeds aren't held up while the stored messages are looked at.
+func (vs *VerifySink) storePartial(ref *refs.FeedRef, msgs []refs.Message) error {
+	unlock := vs.lockRanges(ref)
+	defer unlock()
+
+	if err := vs.checkRangeFork(ref, msgs); err != nil {
+		return err
+	}
+
+	partial := vs.ranges.IsPartial(ref)
+	if !partial {
+		latest, err := vs.getLatestMsg(ref)
+		if err != nil {
+			return err
+		}
+		if latest.Seq() > 0 {
+			if err := vs.ranges.Add(ref, 1, latest.Seq()); err != nil {
+				return fmt.Errorf("message(%s): failed to record stored prefix: %w", ref.ShortRef(), err)
+			}
+			partial = true
+		}
+	}
+
+	first, last := msgs[0].Seq(), msgs[len(msgs)-1].Seq()
+	rs := rangeSaver{saver: vs.saver, feed: ref, ranges: vs.ranges}
+	if _, err := rs.SaveBatch(msgs); err != nil {
+		return fmt.Errorf("message(%s): failed to save messages %d-%d: %w", ref.ShortRef(), first, last, err)
+	}
+
+	// nothing was stored before, msgs are all there is
+	if !partial {
+		if err := vs.ranges.AddSeqs(ref, seqsOf(msgs)); err != nil {
+			return fmt.Errorf("message(%s): failed to record stored messages: %w", ref.ShortRef(), err)
+		}
+	}
+	return nil
+}
+
+// lockRanges makes the calls of VerifyRange and VerifyMessages for ref wait for each other and for the saves of the sink of ref.
+// vs.mu is only held to look up the lock.
+func (vs *VerifySink) lockRanges(ref *refs.FeedRef) func() {
+	vs.mu.Lock()
+	mu, has := vs.rangeLocks[ref.Ref()]
+	if !has {
+		mu = new(sync.Mutex)
+		vs.rangeLocks[ref.Ref()] = mu
+	}
+	vs.mu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// checkRangeFork compares msgs, sorted by sequence, with the stored messages of the same sequences and the ones right before and after them
+func (vs *VerifySink) checkRangeFork(ref *refs.FeedRef, msgs []refs.Message) error {
+	incoming := make(map[int64]bool, len(msgs))
+	around := make(map[int64]bool, len(msgs)+2)
+	for _, msg := range msgs {
+		seq := msg.Seq()
+		incoming[seq] = true
+		for _, s := range []int64{seq - 1, seq, seq + 1} {
+			if s > 0 {
+				around[s] = true
+			}
+		}
+	}
+
+	stored, err := vs.storedAt(ref, around)
+	if err != nil {
+		return err
+	}
+
+	var (
+		ev     ForkEvidence
+		forked bool
+	)
+	for _, msg := range msgs {
+		seq := msg.Seq()
+		if before, has := stored[seq-1]; has && !incoming[seq-1] {
+			if ev, forked = forkEvidence(before, msg); forked {
+				break
+			}
+		}
+		if held, has := stored[seq]; has {
+			if ev, forked = forkEvidence(held, msg); forked {
+				break
+			}
+		}
+		if after, has := stored[seq+1]; has && !incoming[seq+1] {
+			if ev, forked = forkEvidence(msg, after); forked {
+				// the stored message is the one that doesn't fit
+				ev.Sequence = after.Seq()
+				ev.Stored, ev.Incoming = ev.Incoming, ev.Stored
+				break
+			}
+		}
+	}
+	if !forked {
+		return nil
+	}
+
+	if vs.forks != nil {
+		if err := vs.forks.MarkForked(ev); err != nil {
+			return fmt.Errorf("message(%s): failed to mark forked feed: %w", ref.ShortRef(), err)
+		}
+	}
+	return ErrForked{Evidence: ev}
+}
+
+// storedAt returns the stored messages of ref with the sequences in seqs.
+// The sublog of a feed that isn't partial is in feed order, so they are looked up by their position.
+// The one of a partial feed is only scanned if the ranges have some of them and only until they were found.
+func (vs VerifySink) storedAt(ref *refs.FeedRef, seqs map[int64]bool) (map[int64]refs.Message, error) {
+	stored := make(map[int64]refs.Message)
+	if vs.ranges.IsPartial(ref) {
+		held := 0
+		for seq := range seqs {
+			if vs.ranges.Has(ref, seq) {
+				held++
+			}
+		}
+		if held == 0 {
+			return stored, nil
+		}
+		err := vs.scanFeed(ref, func(msg refs.Message) bool {
+			if seqs[msg.Seq()] {
+				stored[msg.Seq()] = msg
+			}
+			return len(stored) < held
+		})
+		return stored, err
+	}
+
+	userLog, err := vs.feeds.Get(storedrefs.Feed(ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sublog for user: %w", err)
+	}
+	latest, err := userLog.Seq().Value()
+	if err != nil {
+		return nil, fmt.Errorf("failed to observe latest: %w", err)
+	}
+	end, ok := latest.(margaret.BaseSeq)
+	if !ok {
+		// nothing stored
+		return stored, nil
+	}
+
+	for seq := range seqs {
+		if seq-1 > end.Seq() {
+			continue
+		}
+		rxSeq, err := userLog.Get(margaret.BaseSeq(seq - 1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up message %d in the sublog: %w", seq, err)
+		}
+		v, err := vs.rxlog.Get(rxSeq.(margaret.Seq))
+		if margaret.IsErrNulled(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get stored message %d: %w", seq, err)
+		}
+		if err, ok := v.(error); ok {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, err
+		}
+		msg, ok := v.(refs.Message)
+		if !ok {
+			return nil, fmt.Errorf("storedAt: wrong message type. expected refs.Message - got %T", v)
+		}
+		if msg.Seq() != seq {
+			return nil, fmt.Errorf("message(%s): sublog out of order, found %d at %d", ref.ShortRef(), msg.Seq(), seq)
+		}
+		stored[seq] = msg
+	}
+	return stored, nil
+}
+
+// seqsOf returns the sequences of msgs
+func seqsOf(msgs []refs.Message) []int64 {
+	seqs := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		seqs[i] = msg.Seq()
+	}
+	return seqs
+}
+
+// findInFeed returns the stored message of ref with the sequence seq
+func (vs VerifySink) findInFeed(ref *refs.FeedRef, seq int64) (refs.Message, error) {
+	var found refs.Message
+	err := vs.scanFeed(ref, func(msg refs.Message) bool {
+		if msg.Seq() == seq {
+			found = msg
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("message(%s:%d): not stored", ref.ShortRef(), seq)
+	}
+	return found, nil
+}
+
+// scanFeed passes the stored messages of ref to fn, in the order they were received, until it returns false.
+// The sublogs of partial feeds aren't sorted so finding a message means looking at all of them.
+func (vs VerifySink) scanFeed(ref *refs.FeedRef, fn func(refs.Message) bool) error {
+	userLog, err := vs.feeds.Get(storedrefs.Feed(ref))
+	if err != nil {
+		return fmt.Errorf("failed to open sublog for user: %w", err)
+	}
+
+	src, err := mutil.Indirect(vs.rxlog, userLog).Query()
+	if err != nil {
+		return fmt.Errorf("failed to query sublog for user: %w", err)
+	}
+
+	ctx := context.TODO()
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to read sublog for user: %w", err)
+		}
+
+		if err, ok := v.(error); ok {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return err
+		}
+		msg, ok := v.(refs.Message)
+		if !ok {
+			return fmt.Errorf("scan: wrong message type. expected refs.Message - got %T", v)
+		}
+		if !fn(msg) {
+			return nil
+		}
+	}
+}
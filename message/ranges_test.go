@@ -0,0 +1,241 @@
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// memRanges records every stored sequence of the partial feeds
+type memRanges map[string]map[int64]bool
+
+func (mr memRanges) IsPartial(ref *refs.FeedRef) bool {
+	_, has := mr[ref.Ref()]
+	return has
+}
+
+func (mr memRanges) Has(ref *refs.FeedRef, seq int64) bool {
+	return mr[ref.Ref()][seq]
+}
+
+func (mr memRanges) Prefix(ref *refs.FeedRef) (int64, bool) {
+	seqs, has := mr[ref.Ref()]
+	var end int64
+	for seqs[end+1] {
+		end++
+	}
+	return end, has
+}
+
+func (mr memRanges) Add(ref *refs.FeedRef, from, to int64) error {
+	seqs, has := mr[ref.Ref()]
+	if !has {
+		seqs = make(map[int64]bool)
+		mr[ref.Ref()] = seqs
+	}
+	for seq := from; seq <= to; seq++ {
+		seqs[seq] = true
+	}
+	return nil
+}
+
+func (mr memRanges) AddSeqs(ref *refs.FeedRef, seqs []int64) error {
+	for _, seq := range seqs {
+		mr.Add(ref, seq, seq)
+	}
+	return nil
+}
+
+func TestRangeSaver(t *testing.T) {
+	r := require.New(t)
+
+	alice, bob := newTestAuthor(t), newTestAuthor(t)
+	sign := func(a testAuthor) [][]byte {
+		var (
+			msgs [][]byte
+			prev *refs.MessageRef
+		)
+		for seq := int64(1); seq <= 10; seq++ {
+			ref, raw := a.sign(seq, prev, "hello")
+			msgs = append(msgs, raw)
+			prev = ref
+		}
+		return msgs
+	}
+
+	ranges := make(memRanges)
+	r.NoError(ranges.Add(alice.ref, 5, 7))
+
+	var saved memSaver
+	saver := rangeSaver{saver: &saved, feed: alice.ref, ranges: ranges}
+	snk := NewVerifySink(alice.ref, margaret.BaseSeq(0), nil, saver, nil)
+
+	// the held messages are checked but not stored again
+	aliceMsgs := sign(alice)
+	r.NoError(VerifyBatch(snk, aliceMsgs[:6]))
+	r.NoError(snk.Verify(aliceMsgs[6]))
+	r.NoError(VerifyBatch(snk, aliceMsgs[7:]))
+	r.EqualValues(10, snk.Seq())
+
+	var seqs []int64
+	for _, msg := range saved {
+		seqs = append(seqs, msg.Seq())
+	}
+	r.Equal([]int64{1, 2, 3, 4, 8, 9, 10}, seqs)
+
+	end, partial := ranges.Prefix(alice.ref)
+	r.True(partial)
+	r.EqualValues(10, end)
+
+	// feeds that aren't partial don't get recorded
+	saved = nil
+	bobSnk := NewVerifySink(bob.ref, margaret.BaseSeq(0), nil, rangeSaver{saver: &saved, feed: bob.ref, ranges: ranges}, nil)
+	r.NoError(VerifyBatch(bobSnk, sign(bob)))
+	r.Len(saved, 10)
+	r.False(ranges.IsPartial(bob.ref))
+}
+
+// lockedRanges makes memRanges safe to use from several goroutines
+type lockedRanges struct {
+	mu sync.Mutex
+	mr memRanges
+}
+
+func (lr *lockedRanges) IsPartial(ref *refs.FeedRef) bool {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.mr.IsPartial(ref)
+}
+
+func (lr *lockedRanges) Has(ref *refs.FeedRef, seq int64) bool {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.mr.Has(ref, seq)
+}
+
+func (lr *lockedRanges) Prefix(ref *refs.FeedRef) (int64, bool) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.mr.Prefix(ref)
+}
+
+func (lr *lockedRanges) Add(ref *refs.FeedRef, from, to int64) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.mr.Add(ref, from, to)
+}
+
+func (lr *lockedRanges) AddSeqs(ref *refs.FeedRef, seqs []int64) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.mr.AddSeqs(ref, seqs)
+}
+
+// indexingSaver appends to the receive log and adds the message to the sublog of its author right away,
+// so that the stored messages can be looked up without waiting for an index.
+type indexingSaver struct {
+	rxlog margaret.Log
+	feeds multilog.MultiLog
+}
+
+func (is indexingSaver) Save(msg refs.Message) error {
+	seq, err := is.rxlog.Append(msg)
+	if err != nil {
+		return err
+	}
+	sublog, err := is.feeds.Get(storedrefs.Feed(msg.Author()))
+	if err != nil {
+		return err
+	}
+	_, err = sublog.Append(seq)
+	return err
+}
+
+func TestRangeSaverConcurrent(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	rxlog, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	feeds, _, err := repo.OpenFileSystemMultiLog(testRepo, "testfeeds", func(context.Context, margaret.Seq, interface{}, multilog.MultiLog) error {
+		return nil
+	})
+	r.NoError(err)
+
+	ranges := &lockedRanges{mr: make(memRanges)}
+	vs, err := NewVerificationSinker(rxlog, feeds, nil, nil, ranges, indexingSaver{rxlog, feeds})
+	r.NoError(err)
+
+	const rounds = 10
+	var authors []testAuthor
+	for i := 0; i < rounds; i++ {
+		a := newTestAuthor(t)
+		authors = append(authors, a)
+
+		var (
+			msgs [][]byte
+			prev *refs.MessageRef
+		)
+		for seq := int64(1); seq <= 30; seq++ {
+			ref, raw := a.sign(seq, prev, "hello")
+			msgs = append(msgs, raw)
+			prev = ref
+		}
+
+		snk, err := vs.GetSink(a.ref)
+		r.NoError(err)
+		r.NoError(VerifyBatch(snk, msgs[:10]))
+
+		// gossip continues the feed while the same messages are stored as a partial range
+		var wg sync.WaitGroup
+		wg.Add(2)
+		var gossipErr, rangeErr error
+		go func() {
+			defer wg.Done()
+			gossipErr = VerifyBatch(snk, msgs[10:])
+		}()
+		go func() {
+			defer wg.Done()
+			rangeErr = vs.VerifyMessages(a.ref, msgs[15:25])
+		}()
+		wg.Wait()
+		r.NoError(gossipErr)
+		r.NoError(rangeErr)
+		r.EqualValues(30, snk.Seq())
+	}
+
+	// every message is stored exactly once
+	counts := make(map[string]int)
+	sv, err := rxlog.Seq().Value()
+	r.NoError(err)
+	for seq := int64(0); seq <= sv.(margaret.Seq).Seq(); seq++ {
+		v, err := rxlog.Get(margaret.BaseSeq(seq))
+		r.NoError(err)
+		msg := v.(refs.Message)
+		counts[msg.Key().Ref()]++
+	}
+	r.Len(counts, rounds*30)
+	for key, n := range counts {
+		r.Equal(1, n, "%s stored %d times", key, n)
+	}
+	for _, a := range authors {
+		end, partial := ranges.Prefix(a.ref)
+		r.True(partial)
+		r.EqualValues(30, end)
+	}
+}
@@ -3,10 +3,13 @@
 package message
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
 	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/message/bendybutt"
 )
 
 type WhoamiReply struct {
@@ -47,7 +50,7 @@ func NewCreateHistArgsFromMap(argMap map[string]interface{}) (*CreateHistArgs, e
 			switch k {
 			case "id":
 				var err error
-				qry.ID, err = refs.ParseFeedRef(val)
+				qry.ID, err = bendybutt.ParseFeedRef(val)
 				if err != nil {
 					return nil, fmt.Errorf("ssb/message: not a feed ref: %w", err)
 				}
@@ -105,6 +108,29 @@ type CreateHistArgs struct {
 	AsJSON bool `json:"asJSON,omitempty"`
 }
 
+// UnmarshalJSON also accepts bendy-butt feeds as ID, which refs.FeedRef doesn't know
+func (args *CreateHistArgs) UnmarshalJSON(b []byte) error {
+	type plain CreateHistArgs
+	var withID struct {
+		plain
+		ID string `json:"id,omitempty"`
+	}
+	if err := json.Unmarshal(b, &withID); err != nil {
+		return err
+	}
+	*args = CreateHistArgs(withID.plain)
+	if withID.ID == "" {
+		return nil
+	}
+
+	var err error
+	args.ID, err = bendybutt.ParseFeedRef(withID.ID)
+	if err != nil {
+		return fmt.Errorf("ssb/message: not a feed ref: %w", err)
+	}
+	return nil
+}
+
 // CreateLogArgs defines the query parameters for the createLogStream rpc call
 type CreateLogArgs struct {
 	CommonArgs
@@ -130,3 +156,253 @@ type TanglesArgs struct {
 	// empty string for v1 tangle
 	Name string `json:"name"`
 }
+
+// QueryArgs defines the filter of the query.read rpc call.
+// All set fields have to match. Gt and Lt are bounds on the claimed timestamp in milliseconds.
+type QueryArgs struct {
+	StreamArgs
+
+	Live    bool `json:"live,omitempty"`
+	Private bool `json:"private,omitempty"`
+
+	Authors []*refs.FeedRef `json:"authors,omitempty"`
+	Type    string          `json:"type,omitempty"`
+
+	// Root selects the messages of a thread, TangleName a v2 tangle (like group) with that root
+	Root       *refs.MessageRef `json:"root,omitempty"`
+	TangleName string           `json:"tangle,omitempty"`
+
+	// Mentions matches messages that link to any of these refs
+	Mentions []string `json:"mentions,omitempty"`
+	Channel  string   `json:"channel,omitempty"`
+
+	// Boxed selects only decrypted (true) or only public (false) messages.
+	// If it's not set, private decides if decrypted messages are included.
+	Boxed *bool `json:"boxed,omitempty"`
+
+	// Cursor continues a previous query after the result it was returned with
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// QueryReply is one element of the query.read stream
+type QueryReply struct {
+	// Cursor can be passed as QueryArgs.Cursor to get the results after this one
+	Cursor string `json:"cursor"`
+
+	Message refs.KeyValueRaw `json:"message"`
+}
+
+// LinksArgs defines the query parameters for the links rpc call.
+// Dest is required, Source and Type narrow down the messages that link to it.
+type LinksArgs struct {
+	CommonArgs
+
+	Limit   int64 `json:"limit,omitempty"`
+	Reverse bool  `json:"reverse,omitempty"`
+
+	Dest   string        `json:"dest"`
+	Source *refs.FeedRef `json:"source,omitempty"`
+	Type   string        `json:"type,omitempty"`
+}
+
+// LinkReply is one element of the links stream. Value is only set if LinksArgs.Values was.
+type LinkReply struct {
+	Key    *refs.MessageRef `json:"key"`
+	Source *refs.FeedRef    `json:"source"`
+	Dest   string           `json:"dest"`
+
+	Value *refs.Value `json:"value,omitempty"`
+}
+
+// BacklinksArgs defines the query parameters for the backlinks.read rpc call.
+// Gt and Lt are bounds on the claimed timestamp in milliseconds.
+type BacklinksArgs struct {
+	CommonArgs
+	StreamArgs
+
+	Dest    string          `json:"dest"`
+	Authors []*refs.FeedRef `json:"authors,omitempty"`
+	Type    string          `json:"type,omitempty"`
+}
+
+// SearchArgs defines the query parameters for the search.query rpc call
+type SearchArgs struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit,omitempty"`
+
+	Private bool `json:"private,omitempty"`
+}
+
+// SearchReply is one element of the search.query stream, the best matches come first
+type SearchReply struct {
+	Key   *refs.MessageRef `json:"key"`
+	Score float64          `json:"score"`
+}
+
+// ThreadArgs defines the query parameters for the threads.get rpc call
+type ThreadArgs struct {
+	Root *refs.MessageRef `json:"root"`
+
+	// Name selects a v2 tangle (like group), empty for v1 threads (content.root)
+	Name string `json:"name,omitempty"`
+
+	Private bool `json:"private,omitempty"`
+}
+
+// ThreadReply is the result of threads.get.
+// Messages starts with the root, if it's known, followed by the replies in causal order.
+type ThreadReply struct {
+	Root     *refs.MessageRef   `json:"root"`
+	Messages []refs.KeyValueRaw `json:"messages"`
+
+	ReplyCount int `json:"replyCount"`
+
+	// LatestActivity is the newest claimed timestamp in the thread, in milliseconds
+	LatestActivity int64 `json:"latestActivity"`
+}
+
+// RecentThreadsArgs defines the query parameters for the threads.recent rpc call
+type RecentThreadsArgs struct {
+	Limit   int64 `json:"limit,omitempty"`
+	Private bool  `json:"private,omitempty"`
+}
+
+// ThreadSummary is one element of the threads.recent stream, the most recently active threads come first
+type ThreadSummary struct {
+	Root *refs.MessageRef `json:"root"`
+
+	// Latest is the newest post of the thread, which might be the root itself
+	Latest         *refs.MessageRef `json:"latest"`
+	LatestActivity int64            `json:"latestActivity"`
+
+	ReplyCount int `json:"replyCount"`
+}
+
+// ChannelsListArgs defines the query parameters for the channels.list rpc call
+type ChannelsListArgs struct {
+	Private bool `json:"private,omitempty"`
+}
+
+// ChannelSummary is one element of the channels.list stream, the most recently active channels come first
+type ChannelSummary struct {
+	Channel string `json:"channel"`
+
+	Count          int   `json:"count"`
+	LatestActivity int64 `json:"latestActivity"`
+}
+
+// ChannelReadArgs defines the query parameters for the channels.read rpc call.
+// Gt and Lt are bounds on the claimed timestamp in milliseconds.
+type ChannelReadArgs struct {
+	CommonArgs
+	StreamArgs
+
+	Channel string `json:"channel"`
+}
+
+// VoteTotals is the result of votes.get and the elements of the votes.stream source
+type VoteTotals struct {
+	Link *refs.MessageRef `json:"link"`
+
+	// Total is the sum of the current vote values
+	Total int `json:"total"`
+
+	// Voters has the latest vote of each author that didn't take it back, oldest first
+	Voters []Voter `json:"voters"`
+
+	// Expressions counts the voters per expression (like Like or Dig)
+	Expressions map[string]int `json:"expressions"`
+}
+
+// Voter is the latest vote of an author on a message
+type Voter struct {
+	Author     *refs.FeedRef `json:"author"`
+	Value      int           `json:"value"`
+	Expression string        `json:"expression,omitempty"`
+
+	// Timestamp is the claimed timestamp of the vote in milliseconds
+	Timestamp int64 `json:"timestamp"`
+}
+
+// AboutHistoryArgs defines the query parameters for the names.history rpc call
+type AboutHistoryArgs struct {
+	// About is the feed or message the values were assigned to
+	About string `json:"about"`
+
+	// Field defaults to name
+	Field string `json:"field,omitempty"`
+}
+
+// AboutValue is a value an author assigned to a field of an about target
+type AboutValue struct {
+	Author *refs.FeedRef    `json:"author"`
+	Key    *refs.MessageRef `json:"key"`
+	Value  json.RawMessage  `json:"value"`
+
+	// Timestamp is the claimed timestamp of the about message in milliseconds
+	Timestamp int64 `json:"timestamp"`
+
+	// Self is true if the value was assigned by the target itself or, for messages, by their author
+	Self bool `json:"self"`
+}
+
+// AboutLatestArgs defines the query parameters for the about.latestValues rpc call
+type AboutLatestArgs struct {
+	About string `json:"about"`
+
+	// Keys are the fields to return, all of them if it's empty
+	Keys []string `json:"keys,omitempty"`
+}
+
+// AboutLatest is the current state of one field of an about target
+type AboutLatest struct {
+	// Value is the one the target assigned itself or, if there is none, the most recent one by someone else
+	Value json.RawMessage `json:"value"`
+
+	Self *AboutValue `json:"self,omitempty"`
+
+	// Others has the latest value of each other author, oldest first
+	Others []AboutValue `json:"others"`
+}
+
+// GatheringsListArgs defines the query parameters for the gatherings.list rpc call
+type GatheringsListArgs struct {
+	// Mode is upcoming (the default, soonest first), past (most recent first) or all (newest gathering first)
+	Mode string `json:"mode,omitempty"`
+
+	Limit int64 `json:"limit,omitempty"`
+}
+
+// GatheringsAttendArgs defines the parameters for the gatherings.attend rpc call
+type GatheringsAttendArgs struct {
+	Gathering *refs.MessageRef `json:"gathering"`
+
+	// Remove takes back a previous attendance
+	Remove bool `json:"remove,omitempty"`
+}
+
+// GatheringTime is the startDateTime of a gathering
+type GatheringTime struct {
+	// Epoch is in milliseconds
+	Epoch int64  `json:"epoch"`
+	TZ    string `json:"tz,omitempty"`
+}
+
+// Gathering is the current state of an event, as returned by gatherings.get and gatherings.list.
+// The fields are the most recent ones set by about messages, by anyone.
+type Gathering struct {
+	Key    *refs.MessageRef `json:"key"`
+	Author *refs.FeedRef    `json:"author"`
+
+	// Timestamp is the claimed timestamp of the gathering message in milliseconds
+	Timestamp int64 `json:"timestamp"`
+
+	Title         string         `json:"title,omitempty"`
+	Description   string         `json:"description,omitempty"`
+	Location      string         `json:"location,omitempty"`
+	Image         string         `json:"image,omitempty"`
+	StartDateTime *GatheringTime `json:"startDateTime,omitempty"`
+
+	// Attendees are the feeds that currently attend, in the order they joined
+	Attendees []*refs.FeedRef `json:"attendees"`
+}
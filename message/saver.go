@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// BatchSaveMessager is implemented by savers that can store several messages at once.
+// SaveBatch returns how many of the messages were stored, in order, before an error occurred.
+type BatchSaveMessager interface {
+	SaveMessager
+	SaveBatch([]refs.Message) (int, error)
+}
+
+var (
+	_ BatchSaveMessager = MargaretSaver{}
+	_ BatchSaveMessager = (*BatchedSaver)(nil)
+)
+
+// SaveBatch appends msgs one after the other and stops at the first error
+func (ms MargaretSaver) SaveBatch(msgs []refs.Message) (int, error) {
+	for i, msg := range msgs {
+		if _, err := ms.Log.Append(msg); err != nil {
+			return i, err
+		}
+	}
+	return len(msgs), nil
+}
+
+// DefaultSaveBatchSize is the number of messages after which a BatchedSaver writes without waiting for the window to pass
+const DefaultSaveBatchSize = 256
+
+// BatchedSaver groups the messages that are saved concurrently, by all the feeds that are fetched at once, and appends them to the log in one go.
+// The log has no batch append, the messages of a batch are still appended one by one.
+// Batching only serialises the appends and lets the savers share one turn at the log instead of contending for it message by message.
+//
+// The first caller of an empty batch waits for the window to pass or the batch to fill up and then writes it.
+// Everyone who joins the batch meanwhile, or while the previous batch is still being written, just waits for that write.
+// With a window of zero nobody waits on purpose, the messages only pile up while a write is in progress.
+//
+// Save and SaveBatch only return after the messages were appended to the log, they don't sync it to disk.
+// After a crash the log might be missing messages that were reported as saved,
+// the verify sinks then resume from the last message that made it and fetch the rest again.
+type BatchedSaver struct {
+	log margaret.Log
+
+	size   int
+	window time.Duration
+
+	mu      sync.Mutex
+	pending *saveBatch
+
+	// held while a batch is written, so that the next one can fill up meanwhile
+	writing sync.Mutex
+}
+
+type saveBatch struct {
+	msgs []refs.Message
+
+	full     chan struct{} // closed when it reached the size
+	detached bool          // doesn't take new messages anymore
+
+	done  chan struct{} // closed after it was written
+	saved int
+	err   error
+}
+
+// NewBatchedSaver returns a saver that appends to log in batches of up to size messages that are collected for at most window.
+func NewBatchedSaver(log margaret.Log, size int, window time.Duration) *BatchedSaver {
+	if size < 1 {
+		size = 1
+	}
+	return &BatchedSaver{
+		log:    log,
+		size:   size,
+		window: window,
+	}
+}
+
+// Save appends a single message with the next batch
+func (bs *BatchedSaver) Save(msg refs.Message) error {
+	_, err := bs.SaveBatch([]refs.Message{msg})
+	return err
+}
+
+// SaveBatch appends msgs with the next batch.
+// They stay in order and are not interleaved with messages of other callers.
+func (bs *BatchedSaver) SaveBatch(msgs []refs.Message) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	bs.mu.Lock()
+	b := bs.pending
+	leader := b == nil
+	if leader {
+		b = &saveBatch{
+			full: make(chan struct{}),
+			done: make(chan struct{}),
+		}
+		bs.pending = b
+	}
+	offset := len(b.msgs)
+	b.msgs = append(b.msgs, msgs...)
+	if len(b.msgs) >= bs.size {
+		bs.detach(b)
+	}
+	bs.mu.Unlock()
+
+	if leader {
+		if bs.window > 0 {
+			t := time.NewTimer(bs.window)
+			select {
+			case <-t.C:
+			case <-b.full:
+				t.Stop()
+			}
+		}
+		bs.write(b)
+	} else {
+		<-b.done
+	}
+
+	// everything before the error was stored, including the messages of other callers
+	saved := b.saved - offset
+	switch {
+	case saved >= len(msgs):
+		return len(msgs), nil
+	case saved < 0:
+		saved = 0
+	}
+	return saved, b.err
+}
+
+// detach closes b for new messages, bs.mu has to be held
+func (bs *BatchedSaver) detach(b *saveBatch) {
+	if b.detached {
+		return
+	}
+	b.detached = true
+	close(b.full)
+	if bs.pending == b {
+		bs.pending = nil
+	}
+}
+
+// write waits for the previous batch to be written, takes everything that joined b until then and appends it message by message
+func (bs *BatchedSaver) write(b *saveBatch) {
+	bs.writing.Lock()
+	defer bs.writing.Unlock()
+
+	bs.mu.Lock()
+	bs.detach(b)
+	bs.mu.Unlock()
+
+	for _, msg := range b.msgs {
+		if _, err := bs.log.Append(msg); err != nil {
+			b.err = fmt.Errorf("message(%s:%d): failed to append to log: %w", msg.Author().ShortRef(), msg.Seq(), err)
+			break
+		}
+		b.saved++
+	}
+	close(b.done)
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/mem"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// failingLog stops accepting appends after a number of them, like a disk that filled up or a process that is going down
+type failingLog struct {
+	margaret.Log
+
+	mu        sync.Mutex
+	remaining int
+}
+
+var errLogBroke = errors.New("test log broke")
+
+func (fl *failingLog) Append(v interface{}) (margaret.Seq, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	if fl.remaining <= 0 {
+		return nil, errLogBroke
+	}
+	fl.remaining--
+	return fl.Log.Append(v)
+}
+
+func (fl *failingLog) allow(n int) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fl.remaining = n
+}
+
+func logAuthorSeqs(t *testing.T, log margaret.Log) map[string][]int64 {
+	r := require.New(t)
+
+	seqs := make(map[string][]int64)
+	v, err := log.Seq().Value()
+	r.NoError(err)
+	for i := int64(0); i <= v.(margaret.Seq).Seq(); i++ {
+		mv, err := log.Get(margaret.BaseSeq(i))
+		r.NoError(err)
+		msg := mv.(refs.Message)
+		seqs[msg.Author().Ref()] = append(seqs[msg.Author().Ref()], msg.Seq())
+	}
+	return seqs
+}
+
+func TestBatchedSaverConcurrent(t *testing.T) {
+	r := require.New(t)
+
+	log := mem.New()
+	bs := NewBatchedSaver(log, 8, time.Millisecond)
+
+	var authors []testAuthor
+	for i := 0; i < 5; i++ {
+		authors = append(authors, newTestAuthor(t))
+	}
+
+	// every author verifies their feed in batches of varying size, all at the same time
+	var wg sync.WaitGroup
+	errc := make(chan error, len(authors))
+	for _, a := range authors {
+		var (
+			msgs [][]byte
+			prev *refs.MessageRef
+		)
+		for seq := int64(1); seq <= 30; seq++ {
+			ref, raw := a.sign(seq, prev, fmt.Sprint("msg", seq))
+			msgs = append(msgs, raw)
+			prev = ref
+		}
+
+		wg.Add(1)
+		go func(who *refs.FeedRef) {
+			defer wg.Done()
+			snk := NewVerifySink(who, margaret.BaseSeq(0), nil, bs, nil)
+			for i, n := 0, 1; i < len(msgs); n++ {
+				end := i + n
+				if end > len(msgs) {
+					end = len(msgs)
+				}
+				if err := VerifyBatch(snk, msgs[i:end]); err != nil {
+					errc <- err
+					return
+				}
+				i = end
+			}
+		}(a.ref)
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		r.NoError(err)
+	}
+
+	seqs := logAuthorSeqs(t, log)
+	r.Len(seqs, len(authors))
+	for _, a := range authors {
+		got := seqs[a.ref.Ref()]
+		r.Len(got, 30)
+		for i, seq := range got {
+			r.EqualValues(i+1, seq, "feed out of order")
+		}
+	}
+}
+
+func TestBatchedSaverBrokenAppend(t *testing.T) {
+	r := require.New(t)
+
+	fl := &failingLog{Log: mem.New(), remaining: 7}
+	bs := NewBatchedSaver(fl, 256, 0)
+
+	alice := newTestAuthor(t)
+	var (
+		msgs [][]byte
+		prev *refs.MessageRef
+	)
+	for seq := int64(1); seq <= 20; seq++ {
+		ref, raw := alice.sign(seq, prev, "hello")
+		msgs = append(msgs, raw)
+		prev = ref
+	}
+
+	snk := NewVerifySink(alice.ref, margaret.BaseSeq(0), nil, bs, nil)
+	r.NoError(VerifyBatch(snk, msgs[:5]))
+
+	// the log breaks in the middle of the next batch
+	err := VerifyBatch(snk, msgs[5:15])
+	r.True(errors.Is(err, errLogBroke), "unexpected error: %v", err)
+	r.EqualValues(7, snk.Seq(), "should know what made it")
+
+	// after recovering it goes on from there, sending the whole batch again is fine
+	fl.allow(1 << 30)
+	r.NoError(VerifyBatch(snk, msgs[5:15]))
+	r.NoError(VerifyBatch(snk, msgs[15:]))
+	r.EqualValues(20, snk.Seq())
+
+	got := logAuthorSeqs(t, fl)[alice.ref.Ref()]
+	r.Len(got, 20)
+	for i, seq := range got {
+		r.EqualValues(i+1, seq)
+	}
+
+	// single saves are reported the same way
+	fl.allow(0)
+	bob := newTestAuthor(t)
+	_, bobMsg := bob.sign(1, nil, "hi")
+	bobSnk := NewVerifySink(bob.ref, margaret.BaseSeq(0), nil, bs, nil)
+	r.Error(bobSnk.Verify(bobMsg))
+	r.EqualValues(0, bobSnk.Seq())
+}
@@ -12,15 +12,26 @@ import (
 )
 
 // NewVerificationSinker supplies a sink per author that skip duplicate messages.
-func NewVerificationSinker(rxlog margaret.Log, feeds multilog.MultiLog, hmacSec *[32]byte) (*VerifySink, error) {
+// If forks isn't nil, forks are recorded in it and the messages of forked feeds are refused.
+// If ranges isn't nil, feeds can also be stored partially with VerifyRange.
+// Valid messages are stored with saver, if it's nil they are appended to rxlog one by one.
+func NewVerificationSinker(rxlog margaret.Log, feeds multilog.MultiLog, hmacSec *[32]byte, forks ForkRegistry, ranges RangeRegistry, saver SaveMessager) (*VerifySink, error) {
+	if saver == nil {
+		saver = MargaretSaver{rxlog}
+	}
 	return &VerifySink{
 		hmacSec: hmacSec,
 
 		rxlog: rxlog,
 		feeds: feeds,
+		saver: saver,
+
+		forks:  forks,
+		ranges: ranges,
 
-		mu:    new(sync.Mutex),
-		sinks: make(verifyFanIn),
+		mu:         new(sync.Mutex),
+		sinks:      make(verifyFanIn),
+		rangeLocks: make(map[string]*sync.Mutex),
 	}, nil
 }
 
@@ -29,11 +40,18 @@ type verifyFanIn map[string]SequencedSink
 type VerifySink struct {
 	rxlog margaret.Log
 	feeds multilog.MultiLog
+	saver SaveMessager
 
 	hmacSec *[32]byte
 
+	forks  ForkRegistry
+	ranges RangeRegistry
+
 	mu    *sync.Mutex
 	sinks verifyFanIn
+
+	// rangeLocks has a lock per feed for VerifyRange, see lockRanges
+	rangeLocks map[string]*sync.Mutex
 }
 
 func (vs *VerifySink) GetSink(ref *refs.FeedRef) (SequencedSink, error) {
@@ -51,12 +69,32 @@ func (vs *VerifySink) GetSink(ref *refs.FeedRef) (SequencedSink, error) {
 		return nil, err
 	}
 
-	var ms = MargaretSaver{vs.rxlog}
-	snk = NewVerifySink(ref, msg, msg, ms, vs.hmacSec)
+	saver := vs.saver
+	if vs.ranges != nil {
+		saver = rangeSaver{
+			saver:  saver,
+			feed:   ref,
+			ranges: vs.ranges,
+			lock:   func() func() { return vs.lockRanges(ref) },
+		}
+	}
+
+	snk = NewVerifySink(ref, msg, msg, saver, vs.hmacSec)
+	if vs.forks != nil {
+		snk = forkGuard{SequencedSink: snk, who: ref, forks: vs.forks}
+	}
 	vs.sinks[ref.Ref()] = snk
 	return snk, nil
 }
 
+// Reset drops the open sink of ref, the next one starts again from what is stored.
+// Sinks that are still in use keep working but go on from where they were.
+func (vs *VerifySink) Reset(ref *refs.FeedRef) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	delete(vs.sinks, ref.Ref())
+}
+
 type MargaretSaver struct {
 	margaret.Log
 }
@@ -78,6 +116,16 @@ func firstMessage(r *refs.FeedRef) refs.KeyValueRaw {
 }
 
 func (vs VerifySink) getLatestMsg(ref *refs.FeedRef) (refs.Message, error) {
+	// the sublog of a partial feed isn't in feed order, continue after the part that has no gaps
+	if vs.ranges != nil {
+		if end, partial := vs.ranges.Prefix(ref); partial {
+			if end == 0 {
+				return firstMessage(ref), nil
+			}
+			return vs.findInFeed(ref, end)
+		}
+	}
+
 	frAddr := storedrefs.Feed(ref)
 	userLog, err := vs.feeds.Get(frAddr)
 	if err != nil {
@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: MIT
+
+// Package metafeeds understands the announcements with which a metafeed adds subfeeds to its tree and removes them again.
+// See https://github.com/ssb-ngi-pointer/ssb-meta-feeds-spec for the idea.
+//
+// Every announcement is published by the metafeed and additionally signed by the key of the subfeed,
+// so that a metafeed can't claim feeds that aren't its own.
+package metafeeds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	refs "go.mindeco.de/ssb-refs"
+	"golang.org/x/crypto/ed25519"
+
+	"go.cryptoscope.co/ssb/message/bendybutt"
+	"go.cryptoscope.co/ssb/message/legacy"
+)
+
+const (
+	// TypeAdd is the content type of the announcement of a new subfeed
+	TypeAdd = "metafeed/add"
+
+	// TypeTombstone is the content type of the announcement that a subfeed is no longer used
+	TypeTombstone = "metafeed/tombstone"
+)
+
+// Add announces that SubFeed belongs to MetaFeed, for the given purpose (like "main" or "index")
+type Add struct {
+	Type        string        `json:"type"`
+	FeedPurpose string        `json:"feedpurpose"`
+	SubFeed     *refs.FeedRef `json:"subfeed"`
+	MetaFeed    *refs.FeedRef `json:"metafeed"`
+	Nonce       []byte        `json:"nonce"`
+
+	// Metadata describes the subfeed further, like the query of index feeds
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	ContentSignature legacy.Signature `json:"contentSignature,omitempty"`
+}
+
+// Tombstone announces that SubFeed of MetaFeed isn't used any more
+type Tombstone struct {
+	Type     string        `json:"type"`
+	SubFeed  *refs.FeedRef `json:"subfeed"`
+	MetaFeed *refs.FeedRef `json:"metafeed"`
+	Reason   string        `json:"reason,omitempty"`
+
+	ContentSignature legacy.Signature `json:"contentSignature,omitempty"`
+}
+
+// UnmarshalJSON also accepts bendy-butt feeds, which refs.FeedRef doesn't know
+func (a *Add) UnmarshalJSON(b []byte) error {
+	type plain Add
+	var v struct {
+		plain
+		SubFeed  string `json:"subfeed"`
+		MetaFeed string `json:"metafeed"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*a = Add(v.plain)
+
+	var err error
+	a.SubFeed, a.MetaFeed, err = parseFeeds(v.SubFeed, v.MetaFeed)
+	return err
+}
+
+// UnmarshalJSON also accepts bendy-butt feeds, like Add.UnmarshalJSON
+func (ts *Tombstone) UnmarshalJSON(b []byte) error {
+	type plain Tombstone
+	var v struct {
+		plain
+		SubFeed  string `json:"subfeed"`
+		MetaFeed string `json:"metafeed"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*ts = Tombstone(v.plain)
+
+	var err error
+	ts.SubFeed, ts.MetaFeed, err = parseFeeds(v.SubFeed, v.MetaFeed)
+	return err
+}
+
+func parseFeeds(sub, meta string) (*refs.FeedRef, *refs.FeedRef, error) {
+	subRef, err := bendybutt.ParseFeedRef(sub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("metafeeds: invalid subfeed: %w", err)
+	}
+	metaRef, err := bendybutt.ParseFeedRef(meta)
+	if err != nil {
+		return nil, nil, fmt.Errorf("metafeeds: invalid metafeed: %w", err)
+	}
+	return subRef, metaRef, nil
+}
+
+// NewAdd returns a signed announcement of sub as a subfeed of meta
+func NewAdd(meta *refs.FeedRef, sub ed25519.PrivateKey, subRef *refs.FeedRef, purpose string, nonce []byte) (Add, error) {
+	a := Add{
+		Type:        TypeAdd,
+		FeedPurpose: purpose,
+		SubFeed:     subRef,
+		MetaFeed:    meta,
+		Nonce:       nonce,
+	}
+	sig, err := sign(a, sub)
+	if err != nil {
+		return Add{}, err
+	}
+	a.ContentSignature = sig
+	return a, nil
+}
+
+// NewTombstone returns a signed announcement that sub is no longer a used subfeed of meta
+func NewTombstone(meta *refs.FeedRef, sub ed25519.PrivateKey, subRef *refs.FeedRef, reason string) (Tombstone, error) {
+	ts := Tombstone{
+		Type:     TypeTombstone,
+		SubFeed:  subRef,
+		MetaFeed: meta,
+		Reason:   reason,
+	}
+	sig, err := sign(ts, sub)
+	if err != nil {
+		return Tombstone{}, err
+	}
+	ts.ContentSignature = sig
+	return ts, nil
+}
+
+// Verify checks that the announcement was published by its metafeed and signed by the subfeed.
+// In bendy-butt feeds the content signature is part of the message and was checked with it, see bendybutt.Verify.
+func (a Add) Verify(author *refs.FeedRef) error {
+	if a.Type != TypeAdd {
+		return fmt.Errorf("metafeeds: not an add announcement: %q", a.Type)
+	}
+	if a.FeedPurpose == "" {
+		return errors.New("metafeeds: add without feed purpose")
+	}
+	if err := checkFeeds(author, a.MetaFeed, a.SubFeed); err != nil {
+		return err
+	}
+	if author.Algo == bendybutt.RefAlgoFeedBendyButt {
+		return nil
+	}
+
+	sig := a.ContentSignature
+	a.ContentSignature = ""
+	return verify(a, sig, a.SubFeed)
+}
+
+// Verify checks that the announcement was published by its metafeed and signed by the subfeed, like Add.Verify
+func (ts Tombstone) Verify(author *refs.FeedRef) error {
+	if ts.Type != TypeTombstone {
+		return fmt.Errorf("metafeeds: not a tombstone announcement: %q", ts.Type)
+	}
+	if err := checkFeeds(author, ts.MetaFeed, ts.SubFeed); err != nil {
+		return err
+	}
+	if author.Algo == bendybutt.RefAlgoFeedBendyButt {
+		return nil
+	}
+
+	sig := ts.ContentSignature
+	ts.ContentSignature = ""
+	return verify(ts, sig, ts.SubFeed)
+}
+
+func checkFeeds(author, meta, sub *refs.FeedRef) error {
+	if meta == nil || sub == nil {
+		return errors.New("metafeeds: announcement without metafeed or subfeed")
+	}
+	if !meta.Equal(author) {
+		return fmt.Errorf("metafeeds: announcement for %s published by %s", meta.ShortRef(), author.ShortRef())
+	}
+	if sub.Equal(meta) {
+		return errors.New("metafeeds: a feed can't be its own subfeed")
+	}
+	return nil
+}
+
+// signedContent is what the content signature covers: the pretty-printed content without the signature, in the order of the struct fields
+func signedContent(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("metafeeds: failed to encode content: %w", err)
+	}
+	return legacy.EncodePreserveOrder(b)
+}
+
+func sign(v interface{}, key ed25519.PrivateKey) (legacy.Signature, error) {
+	content, err := signedContent(v)
+	if err != nil {
+		return "", err
+	}
+	return legacy.EncodeSignature(ed25519.Sign(key, content)), nil
+}
+
+func verify(v interface{}, sig legacy.Signature, sub *refs.FeedRef) error {
+	if sig == "" {
+		return errors.New("metafeeds: announcement without content signature")
+	}
+	content, err := signedContent(v)
+	if err != nil {
+		return err
+	}
+
+	// all supported feed formats use ed25519 keys
+	key := *sub
+	key.Algo = refs.RefAlgoFeedSSB1
+	if err := sig.Verify(content, &key); err != nil {
+		return fmt.Errorf("metafeeds: content signature of %s: %w", sub.ShortRef(), err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MIT
+
+package metafeeds_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/metafeeds"
+)
+
+func TestAnnouncementSignature(t *testing.T) {
+	r := require.New(t)
+
+	meta, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+	sub, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+	other, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+
+	add, err := metafeeds.NewAdd(meta.Id, sub.Pair.Secret, sub.Id, "main", []byte("nonce"))
+	r.NoError(err)
+	r.NoError(add.Verify(meta.Id))
+
+	// the signature survives a round trip through json
+	b, err := json.Marshal(add)
+	r.NoError(err)
+	var decoded metafeeds.Add
+	r.NoError(json.Unmarshal(b, &decoded))
+	r.NoError(decoded.Verify(meta.Id))
+
+	// only the metafeed may publish it
+	r.Error(add.Verify(other.Id))
+
+	// changed content
+	changed := add
+	changed.FeedPurpose = "index"
+	r.Error(changed.Verify(meta.Id))
+
+	// signed by a key that isn't the subfeed
+	forged, err := metafeeds.NewAdd(meta.Id, other.Pair.Secret, sub.Id, "main", []byte("nonce"))
+	r.NoError(err)
+	r.Error(forged.Verify(meta.Id))
+
+	unsigned := add
+	unsigned.ContentSignature = ""
+	r.Error(unsigned.Verify(meta.Id))
+
+	ts, err := metafeeds.NewTombstone(meta.Id, sub.Pair.Secret, sub.Id, "done")
+	r.NoError(err)
+	r.NoError(ts.Verify(meta.Id))
+	r.Error(ts.Verify(other.Id))
+	ts.Reason = "changed"
+	r.Error(ts.Verify(meta.Id))
+}
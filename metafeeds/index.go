@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: MIT
+
+package metafeeds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// FolderName is the name of the index in the repo
+const FolderName = "metafeeds"
+
+// storedAddrLen is the length of a stored feed reference, see storedrefs.Feed
+const storedAddrLen = 34
+
+// subFeedState is the value stored per metafeed and subfeed
+type subFeedState struct {
+	Purpose    string      `json:"purpose,omitempty"`
+	Query      *IndexQuery `json:"query,omitempty"`
+	Tombstoned bool        `json:"tombstoned,omitempty"`
+}
+
+// Node is a feed in the tree of a metafeed
+type Node struct {
+	Feed       *refs.FeedRef `json:"feed"`
+	Purpose    string        `json:"purpose,omitempty"`
+	Tombstoned bool          `json:"tombstoned,omitempty"`
+
+	// Query is set for index feeds
+	Query *IndexQuery `json:"query,omitempty"`
+
+	// SubFeeds are set if the feed is a metafeed itself
+	SubFeeds []Node `json:"subfeeds,omitempty"`
+}
+
+// Index keeps the subfeeds that metafeeds announced.
+// Announcements that don't verify are ignored.
+type Index struct {
+	kv  *badger.DB
+	log kitlog.Logger
+}
+
+// OpenIndex opens the index of the repo, the sink needs to be served with all messages of the receive log
+func OpenIndex(log kitlog.Logger, r repo.Interface) (*Index, librarian.SeqSetterIndex, librarian.SinkIndex, error) {
+	var mi = &Index{log: log}
+	f := func(db *badger.DB) (librarian.SeqSetterIndex, librarian.SinkIndex) {
+		mi.kv = db
+		idx := libbadger.NewIndex(db, 0)
+		return idx, librarian.NewSinkIndex(mi.update, idx)
+	}
+
+	_, idx, snk, err := repo.OpenBadgerIndex(r, FolderName, f)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error getting metafeeds index: %w", err)
+	}
+	return mi, idx, snk, nil
+}
+
+var announcementType = []byte(`"metafeed/`)
+
+func (mi *Index) update(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
+	if nulled, ok := val.(error); ok {
+		if margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return nulled
+	}
+
+	msg, ok := val.(refs.Message)
+	if !ok {
+		return fmt.Errorf("metafeeds/idx: invalid msg value %T", val)
+	}
+
+	content := msg.ContentBytes()
+	if !bytes.Contains(content, announcementType) {
+		return nil
+	}
+
+	var typed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(content, &typed); err != nil {
+		return nil
+	}
+
+	switch typed.Type {
+	case TypeAdd:
+		var a Add
+		if err := json.Unmarshal(content, &a); err != nil {
+			return nil
+		}
+		if err := a.Verify(msg.Author()); err != nil {
+			level.Debug(mi.log).Log("msg", "skipped invalid announcement", "err", err)
+			return nil
+		}
+		q, err := a.Query()
+		if err != nil {
+			level.Debug(mi.log).Log("msg", "skipped invalid index feed", "err", err)
+			return nil
+		}
+
+		addr := storedrefs.Feed(a.MetaFeed) + storedrefs.Feed(a.SubFeed)
+		current, err := mi.get(addr)
+		if err != nil {
+			return err
+		}
+		// tombstones are final
+		if current != nil && current.Tombstoned {
+			return nil
+		}
+		return idx.Set(ctx, addr, subFeedState{Purpose: a.FeedPurpose, Query: q})
+
+	case TypeTombstone:
+		var ts Tombstone
+		if err := json.Unmarshal(content, &ts); err != nil {
+			return nil
+		}
+		if err := ts.Verify(msg.Author()); err != nil {
+			level.Debug(mi.log).Log("msg", "skipped invalid announcement", "err", err)
+			return nil
+		}
+
+		addr := storedrefs.Feed(ts.MetaFeed) + storedrefs.Feed(ts.SubFeed)
+		current, err := mi.get(addr)
+		if err != nil {
+			return err
+		}
+		state := subFeedState{Tombstoned: true}
+		if current != nil {
+			state.Purpose = current.Purpose
+			state.Query = current.Query
+		}
+		return idx.Set(ctx, addr, state)
+	}
+	return nil
+}
+
+// get returns the stored state of addr or nil
+func (mi *Index) get(addr librarian.Addr) (*subFeedState, error) {
+	var state *subFeedState
+	err := mi.kv.View(func(txn *badger.Txn) error {
+		it, err := txn.Get([]byte(addr))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return nil
+			}
+			return err
+		}
+		return it.Value(func(v []byte) error {
+			state = new(subFeedState)
+			return json.Unmarshal(v, state)
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("metafeeds/idx: failed to get state: %w", err)
+	}
+	return state, nil
+}
+
+// SubFeeds returns the subfeeds that meta announced directly, tombstoned ones included
+func (mi *Index) SubFeeds(meta *refs.FeedRef) ([]Node, error) {
+	var nodes []Node
+	err := mi.kv.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		prefix := []byte(storedrefs.Feed(meta))
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			it := iter.Item()
+			k := it.Key()
+			if len(k) != 2*storedAddrLen {
+				continue
+			}
+
+			sub, err := storedrefs.ParseFeed(k[storedAddrLen:])
+			if err != nil {
+				return fmt.Errorf("metafeeds: invalid subfeed key: %w", err)
+			}
+
+			var state subFeedState
+			err = it.Value(func(v []byte) error {
+				return json.Unmarshal(v, &state)
+			})
+			if err != nil {
+				return fmt.Errorf("metafeeds: invalid state of %s: %w", sub.ShortRef(), err)
+			}
+
+			nodes = append(nodes, Node{
+				Feed:       sub,
+				Purpose:    state.Purpose,
+				Tombstoned: state.Tombstoned,
+				Query:      state.Query,
+			})
+		}
+		return nil
+	})
+	return nodes, err
+}
+
+// Tree returns root with all the subfeeds below it
+func (mi *Index) Tree(root *refs.FeedRef) (Node, error) {
+	visited := map[string]bool{root.Ref(): true}
+	node := Node{Feed: root}
+	err := mi.fillTree(&node, visited)
+	return node, err
+}
+
+func (mi *Index) fillTree(node *Node, visited map[string]bool) error {
+	subs, err := mi.SubFeeds(node.Feed)
+	if err != nil {
+		return err
+	}
+	for i := range subs {
+		// a subfeed might be announced by more than one metafeed
+		if visited[subs[i].Feed.Ref()] {
+			continue
+		}
+		visited[subs[i].Feed.Ref()] = true
+		if err := mi.fillTree(&subs[i], visited); err != nil {
+			return err
+		}
+		node.SubFeeds = append(node.SubFeeds, subs[i])
+	}
+	return nil
+}
+
+// Active returns all the subfeeds below root that aren't tombstoned, nor below a tombstoned one
+func (mi *Index) Active(root *refs.FeedRef) ([]*refs.FeedRef, error) {
+	var active []*refs.FeedRef
+	err := mi.walkActive(root, func(n Node) {
+		active = append(active, n.Feed)
+	})
+	return active, err
+}
+
+// IndexFeeds returns the active index feeds below root for the messages of author with the type
+func (mi *Index) IndexFeeds(root, author *refs.FeedRef, tipe string) ([]*refs.FeedRef, error) {
+	var feeds []*refs.FeedRef
+	err := mi.walkActive(root, func(n Node) {
+		if q := n.Query; q != nil && q.Type == tipe && q.Author.Equal(author) {
+			feeds = append(feeds, n.Feed)
+		}
+	})
+	return feeds, err
+}
+
+// walkActive calls fn for the subfeeds that Active returns
+func (mi *Index) walkActive(root *refs.FeedRef, fn func(Node)) error {
+	tree, err := mi.Tree(root)
+	if err != nil {
+		return err
+	}
+
+	var walk func(Node)
+	walk = func(n Node) {
+		for _, sub := range n.SubFeeds {
+			if sub.Tombstoned {
+				continue
+			}
+			fn(sub)
+			walk(sub)
+		}
+	}
+	walk(tree)
+	return nil
+}
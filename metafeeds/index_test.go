@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MIT
+
+package metafeeds_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message/legacy"
+	"go.cryptoscope.co/ssb/metafeeds"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestIndexTree(t *testing.T) {
+	r := require.New(t)
+	ctx := context.TODO()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	idx, seqSetter, snk, err := metafeeds.OpenIndex(kitlog.NewNopLogger(), repo.New(rpath))
+	r.NoError(err)
+	defer seqSetter.Close()
+
+	newKey := func() *ssb.KeyPair {
+		kp, err := ssb.NewKeyPair(nil)
+		r.NoError(err)
+		return kp
+	}
+	root, main, index, nested, other := newKey(), newKey(), newKey(), newKey(), newKey()
+
+	var seq int64
+	publish := func(author *refs.FeedRef, content interface{}) {
+		c, err := json.Marshal(content)
+		r.NoError(err)
+		msg := legacy.StoredMessage{
+			Author_:   author,
+			Sequence_: margaret.BaseSeq(seq + 1),
+			Raw_:      []byte(`{"content":` + string(c) + `}`),
+		}
+		r.NoError(snk.Pour(ctx, margaret.WrapWithSeq(msg, margaret.BaseSeq(seq))))
+		seq++
+	}
+	add := func(meta, sub *ssb.KeyPair, purpose string) metafeeds.Add {
+		a, err := metafeeds.NewAdd(meta.Id, sub.Pair.Secret, sub.Id, purpose, []byte(purpose))
+		r.NoError(err)
+		return a
+	}
+
+	publish(root.Id, add(root, main, "main"))
+	publish(root.Id, add(root, index, "index"))
+	publish(index.Id, add(index, nested, "about"))
+	publish(root.Id, map[string]interface{}{"type": "post", "text": "metafeed/add"})
+
+	// not published by the metafeed
+	publish(other.Id, add(root, other, "main"))
+
+	tree, err := idx.Tree(root.Id)
+	r.NoError(err)
+	r.True(tree.Feed.Equal(root.Id))
+	r.Len(tree.SubFeeds, 2)
+
+	purposes := make(map[string]metafeeds.Node)
+	for _, n := range tree.SubFeeds {
+		purposes[n.Purpose] = n
+	}
+	r.True(purposes["main"].Feed.Equal(main.Id))
+	r.True(purposes["index"].Feed.Equal(index.Id))
+	r.Len(purposes["index"].SubFeeds, 1)
+	r.True(purposes["index"].SubFeeds[0].Feed.Equal(nested.Id))
+
+	active, err := idx.Active(root.Id)
+	r.NoError(err)
+	r.Len(active, 3)
+
+	// a tombstone removes the subfeed and everything below it
+	ts, err := metafeeds.NewTombstone(root.Id, index.Pair.Secret, index.Id, "replaced")
+	r.NoError(err)
+	publish(root.Id, ts)
+
+	active, err = idx.Active(root.Id)
+	r.NoError(err)
+	r.Len(active, 1)
+	r.True(active[0].Equal(main.Id))
+
+	// and it can't be added again
+	publish(root.Id, add(root, index, "index"))
+	tree, err = idx.Tree(root.Id)
+	r.NoError(err)
+	for _, n := range tree.SubFeeds {
+		if n.Feed.Equal(index.Id) {
+			r.True(n.Tombstoned)
+			r.Equal("index", n.Purpose)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: MIT
+
+package metafeeds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	refs "go.mindeco.de/ssb-refs"
+	"golang.org/x/crypto/ed25519"
+)
+
+// Index feeds point at the messages of a certain type on another feed, so that peers can fetch just those.
+// They are announced with an Add of PurposeIndex that has the IndexQuery as metadata.
+const (
+	// TypeIndex is the content type of the entries of an index feed
+	TypeIndex = "metafeed/index"
+
+	// PurposeIndex is the feed purpose of index feeds
+	PurposeIndex = "index"
+
+	// QueryLanguage is the language of the queries of index feeds, only the author and the type of messages are supported
+	QueryLanguage = "ssb-ql-0"
+)
+
+// IndexQuery selects the messages an index feed points at
+type IndexQuery struct {
+	Author *refs.FeedRef `json:"author"`
+	Type   string        `json:"type"`
+}
+
+// IndexedMessage is the message an index entry points at
+type IndexedMessage struct {
+	Key      *refs.MessageRef `json:"key"`
+	Sequence int64            `json:"sequence"`
+}
+
+// IndexEntry is the content of the messages of index feeds
+type IndexEntry struct {
+	Type    string         `json:"type"`
+	Indexed IndexedMessage `json:"indexed"`
+}
+
+// NewIndexEntry returns the entry that points at msg
+func NewIndexEntry(msg refs.Message) IndexEntry {
+	return IndexEntry{
+		Type: TypeIndex,
+		Indexed: IndexedMessage{
+			Key:      msg.Key(),
+			Sequence: msg.Seq(),
+		},
+	}
+}
+
+// ParseIndexEntry decodes the content of a message of an index feed
+func ParseIndexEntry(content []byte) (IndexEntry, error) {
+	var entry IndexEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return IndexEntry{}, fmt.Errorf("metafeeds: invalid index entry: %w", err)
+	}
+	if entry.Type != TypeIndex {
+		return IndexEntry{}, fmt.Errorf("metafeeds: not an index entry: %q", entry.Type)
+	}
+	if entry.Indexed.Key == nil || entry.Indexed.Sequence < 1 {
+		return IndexEntry{}, errors.New("metafeeds: index entry without message")
+	}
+	return entry, nil
+}
+
+// NewIndexAdd returns the signed announcement of sub as an index feed of meta for the messages that q selects
+func NewIndexAdd(meta *refs.FeedRef, sub ed25519.PrivateKey, subRef *refs.FeedRef, q IndexQuery, nonce []byte) (Add, error) {
+	if q.Author == nil || q.Type == "" {
+		return Add{}, errors.New("metafeeds: index query needs author and type")
+	}
+	encodedQuery, err := json.Marshal(q)
+	if err != nil {
+		return Add{}, fmt.Errorf("metafeeds: failed to encode index query: %w", err)
+	}
+
+	a := Add{
+		Type:        TypeAdd,
+		FeedPurpose: PurposeIndex,
+		SubFeed:     subRef,
+		MetaFeed:    meta,
+		Nonce:       nonce,
+		Metadata: map[string]string{
+			"querylang": QueryLanguage,
+			"query":     string(encodedQuery),
+		},
+	}
+	sig, err := sign(a, sub)
+	if err != nil {
+		return Add{}, err
+	}
+	a.ContentSignature = sig
+	return a, nil
+}
+
+// Query returns the query of an index feed announcement, nil for other feed purposes
+func (a Add) Query() (*IndexQuery, error) {
+	if a.FeedPurpose != PurposeIndex {
+		return nil, nil
+	}
+	if lang := a.Metadata["querylang"]; lang != QueryLanguage {
+		return nil, fmt.Errorf("metafeeds: unsupported query language %q", lang)
+	}
+
+	var q IndexQuery
+	if err := json.Unmarshal([]byte(a.Metadata["query"]), &q); err != nil {
+		return nil, fmt.Errorf("metafeeds: invalid index query: %w", err)
+	}
+	if q.Author == nil || q.Type == "" {
+		return nil, errors.New("metafeeds: index query needs author and type")
+	}
+	return &q, nil
+}
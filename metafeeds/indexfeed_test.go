@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: MIT
+
+package metafeeds_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message/legacy"
+	"go.cryptoscope.co/ssb/metafeeds"
+)
+
+func TestIndexAnnouncement(t *testing.T) {
+	r := require.New(t)
+
+	main, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+	idx, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+
+	q := metafeeds.IndexQuery{Author: main.Id, Type: "contact"}
+	add, err := metafeeds.NewIndexAdd(main.Id, idx.Pair.Secret, idx.Id, q, []byte("nonce"))
+	r.NoError(err)
+	r.NoError(add.Verify(main.Id))
+
+	b, err := json.Marshal(add)
+	r.NoError(err)
+	var decoded metafeeds.Add
+	r.NoError(json.Unmarshal(b, &decoded))
+	r.NoError(decoded.Verify(main.Id))
+
+	got, err := decoded.Query()
+	r.NoError(err)
+	r.NotNil(got)
+	r.True(got.Author.Equal(main.Id))
+	r.Equal("contact", got.Type)
+
+	// the query is signed
+	decoded.Metadata = map[string]string{"querylang": metafeeds.QueryLanguage, "query": `{"author":"` + main.Id.Ref() + `","type":"about"}`}
+	r.Error(decoded.Verify(main.Id))
+
+	// other purposes have no query
+	plain, err := metafeeds.NewAdd(main.Id, idx.Pair.Secret, idx.Id, "main", []byte("nonce"))
+	r.NoError(err)
+	got, err = plain.Query()
+	r.NoError(err)
+	r.Nil(got)
+
+	_, err = metafeeds.NewIndexAdd(main.Id, idx.Pair.Secret, idx.Id, metafeeds.IndexQuery{Author: main.Id}, []byte("nonce"))
+	r.Error(err)
+}
+
+func TestIndexEntry(t *testing.T) {
+	r := require.New(t)
+
+	kp, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+	key := &refs.MessageRef{Hash: bytes.Repeat([]byte{1}, 32), Algo: refs.RefAlgoMessageSSB1}
+	msg := &legacy.StoredMessage{
+		Author_:   kp.Id,
+		Key_:      key,
+		Sequence_: 23,
+		Raw_:      []byte(`{"content":{"type":"contact"}}`),
+	}
+
+	b, err := json.Marshal(metafeeds.NewIndexEntry(msg))
+	r.NoError(err)
+	entry, err := metafeeds.ParseIndexEntry(b)
+	r.NoError(err)
+	r.True(entry.Indexed.Key.Equal(key))
+	r.EqualValues(23, entry.Indexed.Sequence)
+
+	for _, invalid := range []string{
+		`{"type":"contact"}`,
+		`{"type":"metafeed/index"}`,
+		`{"type":"metafeed/index","indexed":{"key":"` + key.Ref() + `","sequence":0}}`,
+		`[]`,
+	} {
+		_, err := metafeeds.ParseIndexEntry([]byte(invalid))
+		r.Error(err, invalid)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/keks/persist"
 	"go.cryptoscope.co/librarian"
@@ -32,15 +34,17 @@ import (
 // Compared to the "old" fatbot approach of just having 4 independant indexes,
 // this one updates all 4 of them, resulting in less read-overhead
 // while also being able to index private massages by tangle and type.
+// partial can be nil if feeds are only stored from the start.
 func NewCombinedIndex(
 	repoPath string,
 	box *private.Manager,
 	self *refs.FeedRef,
 	rxlog margaret.Log,
-	// res *repo.SequenceResolver, // TODO[major/pgroups] fix storage and resumption
-	u, p, bt, tan *roaring.MultiLog,
+	res *repo.SequenceResolver,
+	u, p, bt, tan, links *roaring.MultiLog,
 	oh multilog.MultiLog,
 	sm *statematrix.StateMatrix,
+	partial PartialFeeds,
 ) (*CombinedIndex, error) {
 	r := repo.New(repoPath)
 	statePath := r.GetPath(repo.PrefixMultiLog, "combined", "state.json")
@@ -54,6 +58,12 @@ func NewCombinedIndex(
 		return nil, fmt.Errorf("error opening state file: %w", err)
 	}
 
+	backfillPath := r.GetPath(repo.PrefixMultiLog, "combined", "links-backfill.json")
+	linksOnlyUntil, err := loadBackfill(backfillPath)
+	if err != nil {
+		return nil, err
+	}
+
 	idx := &CombinedIndex{
 		self:  self,
 		boxer: box,
@@ -63,12 +73,16 @@ func NewCombinedIndex(
 		private: p,
 		byType:  bt,
 		tangles: tan,
+		links:   links,
+
+		linksOnlyUntil: linksOnlyUntil,
+		backfillPath:   backfillPath,
 
 		ebtState: sm,
+		partial:  partial,
 
-		// TODO[major/pgroups] fix storage and resumption
 		// timestamp sorting
-		// seqresolver: res,
+		seqresolver: res,
 
 		// groups reindexing
 		rxlog:        rxlog,
@@ -77,11 +91,32 @@ func NewCombinedIndex(
 		file: idxStateFile,
 		l:    &sync.Mutex{},
 	}
+
+	// what was saved before is on disk, except the links of a backfill that is still running
+	var seq margaret.BaseSeq
+	if err := persist.Load(idxStateFile, &seq); err != nil {
+		if !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("error loading state file: %w", err)
+		}
+		seq = margaret.SeqEmpty
+	}
+	idx.committed = seq.Seq()
+	if resN := res.Seq() - 1; resN < idx.committed {
+		idx.committed = resN
+	}
+	if linksOnlyUntil > idx.committed {
+		idx.committed = linksOnlyUntil
+	}
 	return idx, nil
 }
 
 var _ librarian.SinkIndex = (*CombinedIndex)(nil)
 
+// PartialFeeds tells up to which sequence the feeds that are stored partially have no gaps, see feedranges.Store
+type PartialFeeds interface {
+	Prefix(*refs.FeedRef) (end int64, partial bool)
+}
+
 type CombinedIndex struct {
 	self  *refs.FeedRef
 	boxer *private.Manager
@@ -92,13 +127,21 @@ type CombinedIndex struct {
 	private *roaring.MultiLog
 	byType  *roaring.MultiLog
 	tangles *roaring.MultiLog
+	links   *roaring.MultiLog
+
+	// set while the links of already indexed messages are filled in
+	linksOnlyUntil int64
+	backfillPath   string
 
 	orderdHelper multilog.MultiLog
 
-	// TODO[major/pgroups] fix storage and resumption
-	// seqresolver *repo.SequenceResolver
+	seqresolver *repo.SequenceResolver
+
+	// the last sequence that is in all the multilogs and in the state file, read and written atomically
+	committed int64
 
 	ebtState *statematrix.StateMatrix
+	partial  PartialFeeds
 
 	file *os.File
 	l    *sync.Mutex
@@ -179,15 +222,72 @@ func (slog *CombinedIndex) Pour(ctx context.Context, swv interface{}) error {
 		return fmt.Errorf("error saving current sequence number: %w", err)
 	}
 
-	v := sw.Value()
+	if err := slog.pour(seq, sw.Value()); err != nil {
+		return err
+	}
+	slog.commit(seq.Seq())
+	return nil
+}
+
+// Indexed returns the last sequence of the receive log that can be found in all the multilogs, or -1 if there is none.
+// Messages after it might already be in the sequence resolver while the rest of their batch is still being processed.
+func (slog *CombinedIndex) Indexed() int64 {
+	return atomic.LoadInt64(&slog.committed)
+}
+
+func (slog *CombinedIndex) commit(seq int64) {
+	// the links backfill starts over at the beginning
+	if seq > atomic.LoadInt64(&slog.committed) {
+		atomic.StoreInt64(&slog.committed, seq)
+	}
+}
+
+var _ repo.BatchSinkIndex = (*CombinedIndex)(nil)
+
+// PourBatch processes several messages under one lock and saves the state once for all of them.
+// The sublogs still write their bitmaps on every append, the batch only saves the state writes and the locking.
+// The state is only saved after the whole batch went through, if the process dies halfway the batch is indexed again.
+func (slog *CombinedIndex) PourBatch(ctx context.Context, vals []interface{}) error {
+	if len(vals) == 0 {
+		return nil
+	}
 
+	slog.l.Lock()
+	defer slog.l.Unlock()
+
+	var last margaret.Seq
+	for _, v := range vals {
+		sw, ok := v.(margaret.SeqWrapper)
+		if !ok {
+			return fmt.Errorf("error casting seq wrapper. got type %T", v)
+		}
+		if err := slog.pour(sw.Seq(), sw.Value()); err != nil {
+			return err
+		}
+		last = sw.Seq()
+	}
+
+	err := persist.Save(slog.file, last)
+	if err != nil {
+		return fmt.Errorf("error saving current sequence number: %w", err)
+	}
+	slog.commit(last.Seq())
+	return nil
+}
+
+// pour indexes a single value, slog.l has to be held
+func (slog *CombinedIndex) pour(seq margaret.Seq, v interface{}) error {
 	if isNulled, ok := v.(error); ok {
 		if margaret.IsErrNulled(isNulled) {
-			// TODO[major/pgroups] fix storage and resumption
-			// err = slog.seqresolver.Append(seq.Seq(), 0, time.Now(), time.Now())
-			// if err != nil {
-			// 	return fmt.Errorf("error updating sequence resolver (nulled message): %w", err)
-			// }
+			if seq.Seq() <= slog.linksOnlyUntil {
+				return slog.backfillDone(seq.Seq())
+			}
+			// keep the resolver in line with the receive log
+			zero := time.Unix(0, 0)
+			err := slog.seqresolver.Append(seq.Seq(), 0, zero, zero)
+			if err != nil {
+				return fmt.Errorf("error updating sequence resolver (nulled message): %w", err)
+			}
 			return nil
 		}
 		return isNulled
@@ -198,15 +298,19 @@ func (slog *CombinedIndex) Pour(ctx context.Context, swv interface{}) error {
 		return fmt.Errorf("error casting message. got type %T", v)
 	}
 
+	if seq.Seq() <= slog.linksOnlyUntil {
+		return slog.backfill(seq.Seq(), msg)
+	}
+
 	return slog.update(seq.Seq(), msg)
 }
 
 func (slog *CombinedIndex) update(seq int64, msg refs.Message) error {
-	// TODO[major/pgroups] fix storage and resumption
-	// err := slog.seqresolver.Append(seq, msg.Seq(), msg.Claimed(), msg.Received())
-	// if err != nil {
-	// 	return fmt.Errorf("error updating sequence resolver: %w", err)
-	// }
+	// re-indexed messages (like in Box2Reindex) are ignored by the resolver
+	err := slog.seqresolver.Append(seq, msg.Seq(), msg.Claimed(), msg.Received())
+	if err != nil {
+		return fmt.Errorf("error updating sequence resolver: %w", err)
+	}
 
 	author := msg.Author()
 
@@ -220,11 +324,19 @@ func (slog *CombinedIndex) update(seq int64, msg refs.Message) error {
 		return fmt.Errorf("error updating author sublog: %w", err)
 	}
 
+	// partial feeds only claim what they have without gaps
+	noteSeq := msg.Seq()
+	if slog.partial != nil {
+		if end, partial := slog.partial.Prefix(author); partial {
+			noteSeq = end
+		}
+	}
+
 	// batch/debounce me
 	err = slog.ebtState.Fill(slog.self, []statematrix.ObservedFeed{{
 		Feed: author,
 		Note: ssb.Note{
-			Seq:       msg.Seq(),
+			Seq:       noteSeq,
 			Receive:   true,
 			Replicate: true,
 		},
@@ -249,6 +361,10 @@ func (slog *CombinedIndex) update(seq int64, msg refs.Message) error {
 		content = cleartext
 	}
 
+	if err := slog.updateLinks(seq, content); err != nil {
+		return err
+	}
+
 	// by type:...  and tangles (v1 & v2)
 	var jsonContent struct {
 		Type    string
@@ -328,7 +444,7 @@ func (slog *CombinedIndex) update(seq int64, msg refs.Message) error {
 	return nil
 }
 
-// Close does nothing.
+// Close does nothing. The sequence resolver needs to be closed by the owner.
 func (slog *CombinedIndex) Close() error {
 	return nil
 }
@@ -348,11 +464,12 @@ func (slog *CombinedIndex) QuerySpec() margaret.QuerySpec {
 		seq = margaret.SeqEmpty
 	}
 
-	// TODO[major/pgroups] fix storage and resumption
-	// if resN := slog.seqresolver.Seq() - 1; resN != seq.Seq() {
-	// 	err := fmt.Errorf("combined idx (has:%d, will: %d)", resN, seq.Seq())
-	// 	return margaret.ErrorQuerySpec(err)
-	// }
+	// the state is saved before a message is processed,
+	// after a crash the resolver might be missing the last entries. Re-index those.
+	// The multilogs don't mind seeing the same sequence twice.
+	if resN := margaret.BaseSeq(slog.seqresolver.Seq() - 1); resN < seq {
+		seq = resN
+	}
 
 	return margaret.MergeQuerySpec(
 		margaret.Gt(seq),
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: MIT
+
+package multilogs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/keks/persist"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog/roaring"
+	multifs "go.cryptoscope.co/margaret/multilog/roaring/fs"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/statematrix"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/message/legacy"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// testIndex is a combined index like sbot opens it, without the parts that are only needed for private messages
+type testIndex struct {
+	idx *CombinedIndex
+	res *repo.SequenceResolver
+}
+
+func openTestIndex(t *testing.T, rpo repo.Interface, kp *ssb.KeyPair) testIndex {
+	r := require.New(t)
+
+	res, err := repo.NewSequenceResolver(rpo)
+	r.NoError(err)
+
+	var mlogs []*roaring.MultiLog
+	for _, name := range []string{IndexNameFeeds, IndexNamePrivates, "msgTypes", "tangles", IndexNameLinks} {
+		ml, err := multifs.NewMultiLog(rpo.GetPath(repo.PrefixMultiLog, "combined", name, "fs-bitmaps"))
+		r.NoError(err)
+		mlogs = append(mlogs, ml)
+	}
+
+	sm, err := statematrix.New(rpo.GetPath("ebt-state-matrix"), kp.Id, nil, nil)
+	r.NoError(err)
+
+	idx, err := NewCombinedIndex(rpo.GetPath(), nil, kp.Id, nil, res, mlogs[0], mlogs[1], mlogs[2], mlogs[3], mlogs[4], nil, sm, nil)
+	r.NoError(err)
+	return testIndex{idx, res}
+}
+
+// testMessage returns the message of kp at the receive log sequence seq
+func testMessage(kp *ssb.KeyPair, seq int64, content string) interface{} {
+	key := &refs.MessageRef{Hash: make([]byte, 32), Algo: refs.RefAlgoMessageSSB1}
+	key.Hash[0] = byte(seq)
+	return margaret.WrapWithSeq(legacy.StoredMessage{
+		Author_:    kp.Id,
+		Key_:       key,
+		Sequence_:  margaret.BaseSeq(seq + 1),
+		Timestamp_: time.Unix(seq, 0),
+		Raw_:       []byte(fmt.Sprintf(`{"timestamp":%d,"content":%s}`, seq*1000, content)),
+	}, margaret.BaseSeq(seq))
+}
+
+func TestCombinedIndexBatchCrash(t *testing.T) {
+	r := require.New(t)
+	ctx := context.TODO()
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+	rpo := repo.New(testPath)
+
+	kp, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+
+	open := func() testIndex { return openTestIndex(t, rpo, kp) }
+
+	msg := func(seq int64, content string) interface{} { return testMessage(kp, seq, content) }
+	batch := func(from, to int64, broken int64) []interface{} {
+		var b []interface{}
+		for seq := from; seq < to; seq++ {
+			if seq == broken {
+				// untyped messages stop the indexing
+				b = append(b, msg(seq, `{"text":"broken"}`))
+				continue
+			}
+			b = append(b, msg(seq, `{"type":"test"}`))
+		}
+		return b
+	}
+
+	// checks that the bitmaps, the resolver and state.json agree on everything up to Indexed()
+	check := func(o testIndex, wantIndexed int64) {
+		r.EqualValues(wantIndexed, o.idx.Indexed())
+
+		f, err := os.Open(rpo.GetPath(repo.PrefixMultiLog, "combined", "state.json"))
+		r.NoError(err)
+		defer f.Close()
+		var state margaret.BaseSeq
+		r.NoError(persist.Load(f, &state))
+		r.EqualValues(wantIndexed, state.Seq())
+
+		r.True(o.res.Seq()-1 >= wantIndexed, "resolver behind the state")
+
+		users, err := o.idx.users.LoadInternalBitmap(storedrefs.Feed(kp.Id))
+		r.NoError(err)
+		typed, err := o.idx.byType.LoadInternalBitmap(librarian.Addr("string:test"))
+		r.NoError(err)
+		for seq := int64(0); seq <= wantIndexed; seq++ {
+			r.True(users.Contains(uint32(seq)), "author bitmap is missing %d", seq)
+			r.True(typed.Contains(uint32(seq)), "type bitmap is missing %d", seq)
+		}
+	}
+
+	first := open()
+	r.NoError(first.idx.PourBatch(ctx, batch(0, 10, -1)))
+	check(first, 9)
+
+	// the process dies in the middle of the next batch, nothing is flushed or saved
+	err = first.idx.PourBatch(ctx, batch(10, 20, 15))
+	r.Error(err)
+	r.EqualValues(9, first.idx.Indexed(), "half a batch must not be visible")
+	r.EqualValues(16, first.res.Seq(), "the resolver was ahead")
+
+	// after a restart the resolver still has the first half of the broken batch.
+	// The index needs to pick up after the last saved batch and not after the resolver.
+	second := open()
+	check(second, 9)
+	r.NoError(second.idx.PourBatch(ctx, batch(10, 20, -1)))
+	check(second, 19)
+	r.EqualValues(20, second.res.Seq())
+
+	r.NoError(first.res.Close())
+	r.NoError(second.res.Close())
+}
+
+func TestLinksBackfillEndsOnSkipped(t *testing.T) {
+	r := require.New(t)
+	ctx := context.TODO()
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+	rpo := repo.New(testPath)
+
+	kp, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+
+	// the last message is boxed but can't be decoded, so it's skipped
+	var msgs []interface{}
+	for seq := int64(0); seq < 4; seq++ {
+		msgs = append(msgs, testMessage(kp, seq, `{"type":"test"}`))
+	}
+	msgs = append(msgs, testMessage(kp, 4, `"%%%.box"`))
+
+	first := openTestIndex(t, rpo, kp)
+	r.NoError(first.idx.PourBatch(ctx, msgs))
+	r.NoError(first.idx.BackfillLinks())
+	r.NoError(first.res.Close())
+
+	marker := rpo.GetPath(repo.PrefixMultiLog, "combined", "links-backfill.json")
+	r.FileExists(marker)
+
+	second := openTestIndex(t, rpo, kp)
+	r.EqualValues(4, second.idx.linksOnlyUntil)
+	r.NoError(second.idx.PourBatch(ctx, msgs))
+	r.EqualValues(-1, second.idx.linksOnlyUntil, "backfill didn't end")
+	_, err = os.Stat(marker)
+	r.True(os.IsNotExist(err), "marker is still there")
+	r.NoError(second.res.Close())
+}
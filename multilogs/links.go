@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: MIT
+
+package multilogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/keks/persist"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// IndexNameLinks is the multilog of the combined index that has one sublog per feed, message or blob ref,
+// with all the messages that mention it somewhere in their content.
+const IndexNameLinks = "links"
+
+// LinkAddr returns the address of the sublog for ref in the links multilog
+func LinkAddr(ref string) librarian.Addr {
+	return librarian.Addr(ref)
+}
+
+// ContentLinks returns all the feed, message and blob refs in the JSON content (as values or object keys) without duplicates
+func ContentLinks(content []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+
+	var (
+		links []string
+		seen  = make(map[string]struct{})
+	)
+
+	check := func(s string) {
+		if len(s) < 2 || !strings.ContainsAny(s[:1], "@%&") {
+			return
+		}
+		ref, err := refs.ParseRef(s)
+		if err != nil {
+			return
+		}
+		r := ref.Ref()
+		if _, has := seen[r]; has {
+			return
+		}
+		seen[r] = struct{}{}
+		links = append(links, r)
+	}
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch tv := v.(type) {
+		case string:
+			check(tv)
+		case []interface{}:
+			for _, e := range tv {
+				walk(e)
+			}
+		case map[string]interface{}:
+			for k, e := range tv {
+				check(k)
+				walk(e)
+			}
+		}
+	}
+	walk(v)
+
+	return links
+}
+
+func (slog *CombinedIndex) updateLinks(seq int64, content []byte) error {
+	for _, link := range ContentLinks(content) {
+		sublog, err := slog.links.Get(LinkAddr(link))
+		if err != nil {
+			return fmt.Errorf("error opening links sublog: %w", err)
+		}
+		if _, err := sublog.Append(margaret.BaseSeq(seq)); err != nil {
+			return fmt.Errorf("error updating links sublog: %w", err)
+		}
+	}
+	return nil
+}
+
+// BackfillLinks needs to be called if the links multilog was just created for an existing repo.
+// The next time the index is served, all the messages that were processed before are read again, but only to fill the links.
+func (slog *CombinedIndex) BackfillLinks() error {
+	slog.l.Lock()
+	defer slog.l.Unlock()
+
+	var seq margaret.BaseSeq
+	if err := persist.Load(slog.file, &seq); err != nil {
+		if errors.Is(err, io.EOF) {
+			// nothing processed yet
+			return nil
+		}
+		return fmt.Errorf("links backfill: failed to load state: %w", err)
+	}
+	if seq < 0 {
+		return nil
+	}
+
+	f, err := os.Create(slog.backfillPath)
+	if err != nil {
+		return fmt.Errorf("links backfill: failed to create marker: %w", err)
+	}
+	defer f.Close()
+	if err := persist.Save(f, seq); err != nil {
+		return fmt.Errorf("links backfill: failed to save marker: %w", err)
+	}
+
+	// start over
+	if err := persist.Save(slog.file, margaret.SeqEmpty); err != nil {
+		return fmt.Errorf("links backfill: failed to reset state: %w", err)
+	}
+	slog.linksOnlyUntil = seq.Seq()
+	return nil
+}
+
+// loadBackfill returns the last sequence that only needs the links updated or -1 if there is no backfill in progress
+func loadBackfill(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return -1, nil
+		}
+		return -1, err
+	}
+	defer f.Close()
+
+	var seq margaret.BaseSeq
+	if err := persist.Load(f, &seq); err != nil {
+		return -1, fmt.Errorf("links backfill: broken marker: %w", err)
+	}
+	return seq.Seq(), nil
+}
+
+// backfill only updates the links for messages that were fully indexed before the links multilog existed
+func (slog *CombinedIndex) backfill(seq int64, msg refs.Message) error {
+	content := msg.ContentBytes()
+	if len(content) > 0 && content[0] != '{' {
+		cleartext, err := slog.tryDecrypt(msg, seq)
+		if err != nil {
+			if err == errSkip {
+				// not for us, but it might still be the last one of the backfill
+				return slog.backfillDone(seq)
+			}
+			return err
+		}
+		content = cleartext
+	}
+
+	if err := slog.updateLinks(seq, content); err != nil {
+		return err
+	}
+
+	return slog.backfillDone(seq)
+}
+
+// backfillDone ends the backfill once the last message before it was started is processed
+func (slog *CombinedIndex) backfillDone(seq int64) error {
+	if seq != slog.linksOnlyUntil {
+		return nil
+	}
+	slog.linksOnlyUntil = -1
+	if err := os.Remove(slog.backfillPath); err != nil {
+		return fmt.Errorf("links backfill: failed to remove marker: %w", err)
+	}
+	return nil
+}
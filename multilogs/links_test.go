@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: MIT
+
+package multilogs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestContentLinks(t *testing.T) {
+	r := require.New(t)
+
+	h := sha256.Sum256([]byte("links"))
+	feed := refs.FeedRef{ID: h[:], Algo: refs.RefAlgoFeedSSB1}
+	msg := refs.MessageRef{Hash: h[:], Algo: refs.RefAlgoMessageSSB1}
+	blob := refs.BlobRef{Hash: h[:], Algo: refs.RefAlgoBlobSSB1}
+
+	content := fmt.Sprintf(`{
+		"type": "post",
+		"root": %q,
+		"mentions": [{"link": %q}, %q],
+		"votes": {%q: 1},
+		"text": "not a ref @nobody",
+		"again": %q,
+		"n": 1.5
+	}`, msg.Ref(), feed.Ref(), blob.Ref(), feed.Ref(), msg.Ref())
+
+	links := ContentLinks([]byte(content))
+	r.ElementsMatch([]string{msg.Ref(), feed.Ref(), blob.Ref()}, links)
+
+	r.Nil(ContentLinks([]byte("broken")))
+}
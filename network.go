@@ -21,11 +21,37 @@ type EndpointStat struct {
 	Endpoint muxrpc.Endpoint
 }
 
+// ListenAddr describes one of the listeners of a network node
+type ListenAddr struct {
+	// Addr is the bound address, wrapped with the secret-handshake address of the listener
+	Addr net.Addr
+
+	// Multiserver is the address in multiserver notation (net:host:port~shs:pubkey)
+	Multiserver string
+
+	// Advertise is true if the listener should be shared with others (local broadcasts and invites)
+	Advertise bool
+}
+
 type Network interface {
 	Connect(ctx context.Context, addr net.Addr) error
+
+	// ConnectConn runs the client side of secret-handshake with remote over an already established connection,
+	// like a tunnel through a room server. The muxrpc session is served in the background.
+	ConnectConn(ctx context.Context, conn net.Conn, remote *refs.FeedRef) error
+
+	// ServeConn runs the server side of secret-handshake over an already established connection
+	// and serves muxrpc on it until the connection is closed.
+	ServeConn(ctx context.Context, conn net.Conn) error
 	Serve(context.Context, ...muxrpc.HandlerWrapper) error
+
+	// GetListenAddr returns the address of the first listener.
+	// Deprecated: use GetListenAddrs to get all of them.
 	GetListenAddr() net.Addr
 
+	// GetListenAddrs waits for Serve() to be called and returns all the listeners of the node.
+	GetListenAddrs() []ListenAddr
+
 	GetAllEndpoints() []EndpointStat
 	GetEndpointFor(*refs.FeedRef) (muxrpc.Endpoint, bool)
 
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: MIT
+
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"go.cryptoscope.co/ssb/network/msaddr"
+)
+
+// TransportDialer opens a plain connection to the passed transport address.
+// The secret-handshake is done by the network node afterwards.
+type TransportDialer func(ctx context.Context, addr net.Addr) (net.Conn, error)
+
+// DefaultTransportDialers returns the dialers for the transports that don't need extra configuration (unix, ws and wss).
+// TCP is handled by Options.Dialer. Onion addresses need a tor daemon, see OnionDialer.
+func DefaultTransportDialers() map[string]TransportDialer {
+	return map[string]TransportDialer{
+		"unix":              UnixDialer,
+		msaddr.TransportWS:  WebsocketDialer,
+		msaddr.TransportWSS: WebsocketDialer,
+	}
+}
+
+// UnixDialer connects to a unix socket file
+func UnixDialer(ctx context.Context, addr net.Addr) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", addr.String())
+}
+
+// WebsocketDialer opens an outbound websocket connection. The address needs to be a msaddr.WebsocketAddr.
+func WebsocketDialer(ctx context.Context, addr net.Addr) (net.Conn, error) {
+	wsAddr, ok := addr.(msaddr.WebsocketAddr)
+	if !ok {
+		return nil, fmt.Errorf("websocket dialer: unexpected address type: %T", addr)
+	}
+
+	wsConn, _, err := websocket.DefaultDialer.DialContext(ctx, wsAddr.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("websocket dialer: failed to connect to %s: %w", wsAddr, err)
+	}
+
+	return &wrappedConn{
+		remote: wsAddr,
+		local:  wsConn.LocalAddr(),
+		wsc:    wsConn,
+	}, nil
+}
+
+// OnionDialer returns a dialer that connects to onion addresses through the SOCKS5 proxy of a tor daemon (usually localhost:9050)
+func OnionDialer(socksAddr string) TransportDialer {
+	return func(ctx context.Context, addr net.Addr) (net.Conn, error) {
+		oa, ok := addr.(msaddr.OnionAddr)
+		if !ok {
+			return nil, fmt.Errorf("onion dialer: unexpected address type: %T", addr)
+		}
+
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", socksAddr)
+		if err != nil {
+			return nil, fmt.Errorf("onion dialer: failed to connect to tor socks proxy: %w", err)
+		}
+
+		if deadline, has := ctx.Deadline(); has {
+			conn.SetDeadline(deadline)
+		}
+
+		if err := socks5Connect(conn, oa.Host, oa.Port); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("onion dialer: %w", err)
+		}
+
+		if _, has := ctx.Deadline(); has {
+			conn.SetDeadline(time.Time{})
+		}
+
+		return onionConn{Conn: conn, remote: oa}, nil
+	}
+}
+
+type onionConn struct {
+	net.Conn
+
+	remote msaddr.OnionAddr
+}
+
+func (oc onionConn) RemoteAddr() net.Addr { return oc.remote }
+
+// socks5Connect does a minimal, unauthenticated SOCKS5 handshake (RFC1928) with a CONNECT command for host:port.
+// The hostname is passed to the proxy unresolved so that tor can resolve .onion addresses.
+func socks5Connect(rw io.ReadWriter, host string, port int) error {
+	if len(host) > 255 {
+		return errors.New("socks5: hostname too long")
+	}
+
+	// version 5, one method: no authentication
+	if _, err := rw.Write([]byte{5, 1, 0}); err != nil {
+		return fmt.Errorf("socks5: failed to send greeting: %w", err)
+	}
+
+	var resp = make([]byte, 2)
+	if _, err := io.ReadFull(rw, resp); err != nil {
+		return fmt.Errorf("socks5: failed to read method selection: %w", err)
+	}
+	if resp[0] != 5 || resp[1] != 0 {
+		return fmt.Errorf("socks5: proxy refused unauthenticated access (%v)", resp)
+	}
+
+	// version 5, connect, reserved, address type: domain name
+	req := []byte{5, 1, 0, 3, byte(len(host))}
+	req = append(req, host...)
+	var portBytes = make([]byte, 2)
+	binary.BigEndian.PutUint16(portBytes, uint16(port))
+	req = append(req, portBytes...)
+	if _, err := rw.Write(req); err != nil {
+		return fmt.Errorf("socks5: failed to send connect request: %w", err)
+	}
+
+	var hdr = make([]byte, 4)
+	if _, err := io.ReadFull(rw, hdr); err != nil {
+		return fmt.Errorf("socks5: failed to read connect reply: %w", err)
+	}
+	if hdr[1] != 0 {
+		return fmt.Errorf("socks5: connect to %s failed with code %d", net.JoinHostPort(host, strconv.Itoa(port)), hdr[1])
+	}
+
+	// skip the bound address
+	var skip int
+	switch hdr[3] {
+	case 1: // ipv4
+		skip = net.IPv4len
+	case 4: // ipv6
+		skip = net.IPv6len
+	case 3: // domain
+		var l = make([]byte, 1)
+		if _, err := io.ReadFull(rw, l); err != nil {
+			return fmt.Errorf("socks5: failed to read bound address: %w", err)
+		}
+		skip = int(l[0])
+	default:
+		return fmt.Errorf("socks5: unknown address type in reply: %d", hdr[3])
+	}
+	skip += 2 // port
+	if _, err := io.ReadFull(rw, make([]byte, skip)); err != nil {
+		return fmt.Errorf("socks5: failed to read bound address: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: MIT
+
+package network
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocks5Connect(t *testing.T) {
+	r := require.New(t)
+
+	client, proxy := net.Pipe()
+
+	host := "2xk4uulbv2xkqg2m.onion"
+	proxyErr := make(chan error, 1)
+	go func() {
+		defer close(proxyErr)
+
+		var greeting = make([]byte, 3)
+		if _, err := io.ReadFull(proxy, greeting); err != nil {
+			proxyErr <- err
+			return
+		}
+		r.Equal([]byte{5, 1, 0}, greeting)
+		proxy.Write([]byte{5, 0})
+
+		var req = make([]byte, 5+len(host)+2)
+		if _, err := io.ReadFull(proxy, req); err != nil {
+			proxyErr <- err
+			return
+		}
+		r.Equal([]byte{5, 1, 0, 3, byte(len(host))}, req[:5])
+		r.Equal(host, string(req[5:5+len(host)]))
+		r.Equal([]byte{0x1f, 0x48}, req[5+len(host):]) // 8008
+
+		// success, bound to 127.0.0.1:1234
+		proxy.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0x04, 0xd2})
+	}()
+
+	err := socks5Connect(client, host, 8008)
+	r.NoError(err)
+	r.NoError(<-proxyErr)
+}
+
+func TestSocks5ConnectRefused(t *testing.T) {
+	r := require.New(t)
+
+	client, proxy := net.Pipe()
+
+	go func() {
+		io.ReadFull(proxy, make([]byte, 3))
+		proxy.Write([]byte{5, 0})
+		io.ReadFull(proxy, make([]byte, 5+len("nope.onion")+2))
+		// host unreachable
+		proxy.Write([]byte{5, 4, 0, 1})
+	}()
+
+	err := socks5Connect(client, "nope.onion", 8008)
+	r.Error(err)
+}
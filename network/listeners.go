@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: MIT
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"go.cryptoscope.co/netwrap"
+	"go.cryptoscope.co/secretstream"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/network/msaddr"
+)
+
+// ListenerOptions define one listener of a network node.
+// Each listener can use it's own app key and connection wrappers.
+type ListenerOptions struct {
+	// Addr is the address the listener binds to
+	Addr net.Addr
+
+	// AppKey overwrites Options.AppKey for connections accepted on this listener (optional)
+	AppKey []byte
+
+	// BeforeCryptoWrappers are applied before the shs+boxstream wrapping of this listener
+	BeforeCryptoWrappers []netwrap.ConnWrapper
+
+	// AfterSecureWrappers are applied to connections of this listener after the handshake completed
+	// and before the node-wide Options.AfterSecureWrappers.
+	AfterSecureWrappers []netwrap.ConnWrapper
+
+	// Advertise controls if this listener is used for local UDP broadcasts and shared in invites.
+	Advertise bool
+
+	// ExternalHost is the hostname or IP that is used for the multiserver address of this listener.
+	// Useful for listeners behind NAT or onion services where the bound address is not reachable by others.
+	// If it's empty, the bound address is used.
+	ExternalHost string
+}
+
+type listener struct {
+	opts ListenerOptions
+
+	secretServer *secretstream.Server
+
+	closeOnce sync.Once
+	lis       net.Listener
+}
+
+func (l *listener) listen(before []netwrap.ConnWrapper) error {
+	var wrappers []netwrap.ConnWrapper
+	wrappers = append(wrappers, before...)
+	wrappers = append(wrappers, l.opts.BeforeCryptoWrappers...)
+	wrappers = append(wrappers, l.secretServer.ConnWrapper())
+	wrappers = append(wrappers, l.opts.AfterSecureWrappers...)
+
+	lisWrap := netwrap.NewListenerWrapper(l.secretServer.Addr(), wrappers...)
+
+	var err error
+	l.lis, err = netwrap.Listen(l.opts.Addr, lisWrap)
+	if err != nil {
+		return fmt.Errorf("error creating listener for %s: %w", l.opts.Addr, err)
+	}
+	l.closeOnce = sync.Once{} // reset once
+	return nil
+}
+
+func (l *listener) close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		if l.lis != nil {
+			err = l.lis.Close()
+		}
+	})
+	if err != nil && strings.Contains(err.Error(), "use of closed network connection") {
+		err = nil
+	}
+	return err
+}
+
+// listenAddr returns the bound address, wrapped with the secret-handshake address of the listener
+func (l *listener) listenAddr() net.Addr {
+	if l.lis == nil {
+		return nil
+	}
+	return l.lis.Addr()
+}
+
+func (l *listener) listenAddrInfo(kp *ssb.KeyPair) ssb.ListenAddr {
+	addr := l.listenAddr()
+	return ssb.ListenAddr{
+		Addr:        addr,
+		Advertise:   l.opts.Advertise,
+		Multiserver: formatMultiserverAddress(addr, l.opts.ExternalHost, kp),
+	}
+}
+
+// formatMultiserverAddress returns the multiserver address for the passed listen address.
+// If host is set, it replaces the host part of addr. Onion hosts use the onion transport.
+func formatMultiserverAddress(addr net.Addr, host string, kp *ssb.KeyPair) string {
+	if addr == nil {
+		return ""
+	}
+	ma, err := msaddr.FromNetAddr(addr)
+	if err != nil {
+		return ""
+	}
+	ma.Ref = kp.Id
+
+	if ma.Transport == msaddr.TransportNet && host == "" {
+		if ip := net.ParseIP(ma.Host); ip == nil || ip.IsUnspecified() {
+			host = "localhost"
+		}
+	}
+	if host != "" {
+		ma.Host = host
+		if strings.HasSuffix(host, ".onion") {
+			ma.Transport = msaddr.TransportOnion
+		}
+	}
+	return ma.String()
+}
@@ -0,0 +1,100 @@
+package network_test
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/netwrap"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/network"
+)
+
+func TestMultipleListeners(t *testing.T) {
+	r := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var appkey = make([]byte, 32)
+	rand.Read(appkey)
+
+	var otherAppKey = make([]byte, 32)
+	rand.Read(otherAppKey)
+
+	logger := log.NewLogfmtLogger(os.Stderr)
+
+	kpServ, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+
+	server, err := network.New(network.Options{
+		Logger:  logger,
+		AppKey:  appkey,
+		KeyPair: kpServ,
+
+		Listeners: []network.ListenerOptions{
+			{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}, Advertise: true},
+			{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}, AppKey: otherAppKey, ExternalHost: "example.onion"},
+		},
+
+		MakeHandler: makeServerHandler(t, false),
+	})
+	r.NoError(err)
+
+	serveErr := make(chan error)
+	go func() {
+		serveErr <- server.Serve(ctx)
+	}()
+
+	addrs := server.GetListenAddrs()
+	r.Len(addrs, 2)
+	r.True(addrs[0].Advertise)
+	r.False(addrs[1].Advertise)
+	r.True(strings.HasPrefix(addrs[0].Multiserver, "net:127.0.0.1:"), "wrong ms addr: %s", addrs[0].Multiserver)
+	r.True(strings.HasPrefix(addrs[1].Multiserver, "onion:example.onion:"), "wrong ms addr: %s", addrs[1].Multiserver)
+	r.True(strings.HasSuffix(addrs[1].Multiserver, "~shs:"+strings.TrimSuffix(strings.TrimPrefix(kpServ.Id.Ref(), "@"), ".ed25519")))
+	r.Equal(addrs[0].Addr, server.GetListenAddr())
+
+	for i, ak := range [][]byte{appkey, otherAppKey} {
+		kpClient, err := ssb.NewKeyPair(nil)
+		r.NoError(err)
+
+		client, err := network.New(network.Options{
+			Logger:  logger,
+			AppKey:  ak,
+			KeyPair: kpClient,
+
+			MakeHandler: makeServerHandler(t, true),
+		})
+		r.NoError(err)
+
+		err = client.Connect(ctx, addrs[i].Addr)
+		r.NoError(err, "failed to connect to listener #%d", i)
+		client.Close()
+	}
+
+	// using the wrong app key fails the handshake
+	kpClient, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+	client, err := network.New(network.Options{
+		Logger:  logger,
+		AppKey:  appkey,
+		KeyPair: kpClient,
+
+		MakeHandler: makeServerHandler(t, true),
+	})
+	r.NoError(err)
+	err = client.Connect(ctx, netwrap.WrapAddr(netwrap.GetAddr(addrs[1].Addr, "tcp"), netwrap.GetAddr(addrs[1].Addr, "shs-bs")))
+	r.Error(err)
+	client.Close()
+
+	r.NoError(server.Close())
+	cancel()
+	<-serveErr
+}
@@ -0,0 +1,314 @@
+// SPDX-License-Identifier: MIT
+
+// Package msaddr parses and formats multiserver addresses (https://github.com/ssbc/multiserver) for all the transports go-sbot supports.
+//
+// Supported formats are:
+//
+//	net:host:port~shs:key
+//	onion:host.onion:port~shs:key
+//	ws://host:port/path~shs:key (and wss://)
+//	unix:/path/to/socket~shs:key
+//
+// The key is the base64 encoded ed25519 public key of the remote (without @ prefix and .ed25519 suffix).
+package msaddr
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.cryptoscope.co/netwrap"
+	"go.cryptoscope.co/secretstream"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// The transport names as they appear in multiserver addresses
+const (
+	TransportNet   = "net"
+	TransportOnion = "onion"
+	TransportWS    = "ws"
+	TransportWSS   = "wss"
+	TransportUnix  = "unix"
+)
+
+// ErrNoSHS is returned if the address doesn't have a secret-handshake part
+var ErrNoSHS = errors.New("msaddr: no shs part in address")
+
+// ErrUnsupportedTransport is returned for transports this package doesn't know about
+type ErrUnsupportedTransport struct {
+	Transport string
+}
+
+func (e ErrUnsupportedTransport) Error() string {
+	return fmt.Sprintf("msaddr: unsupported transport: %q", e.Transport)
+}
+
+// Address is a single multiserver address, consisting of one transport and secret-handshake
+type Address struct {
+	Transport string
+
+	// Host and Port are used by net, onion and the websocket transports
+	Host string
+	Port int
+
+	// Path is the location of the socket file for unix or the URL path for websockets
+	Path string
+
+	// Ref is the identity of the remote, used for secret-handshake
+	Ref *refs.FeedRef
+}
+
+// Parse parses a single multiserver address. Use ParseList if the input might contain multiple (seperated by ;).
+func Parse(input string) (*Address, error) {
+	input = strings.TrimSpace(input)
+
+	tilde := strings.LastIndex(input, "~")
+	if tilde == -1 {
+		return nil, ErrNoSHS
+	}
+
+	var a Address
+
+	shs := input[tilde+1:]
+	if !strings.HasPrefix(shs, "shs:") {
+		return nil, ErrNoSHS
+	}
+	// shs can carry an optional seed after another colon (used by invites), ignore it
+	keyPart := strings.SplitN(strings.TrimPrefix(shs, "shs:"), ":", 2)[0]
+	pubKey, err := base64.StdEncoding.DecodeString(keyPart)
+	if err != nil {
+		return nil, fmt.Errorf("msaddr: invalid shs key: %w", err)
+	}
+	if n := len(pubKey); n != 32 {
+		return nil, fmt.Errorf("msaddr: invalid shs key length: %d", n)
+	}
+	a.Ref = &refs.FeedRef{ID: pubKey, Algo: refs.RefAlgoFeedSSB1}
+
+	transport := input[:tilde]
+	switch {
+	case strings.HasPrefix(transport, "ws://") || strings.HasPrefix(transport, "wss://"):
+		u, err := url.Parse(transport)
+		if err != nil {
+			return nil, fmt.Errorf("msaddr: invalid websocket url: %w", err)
+		}
+		a.Transport = u.Scheme
+		a.Host = u.Hostname()
+		a.Path = u.Path
+		if p := u.Port(); p != "" {
+			a.Port, err = strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("msaddr: invalid websocket port: %w", err)
+			}
+		} else if a.Transport == TransportWSS {
+			a.Port = 443
+		} else {
+			a.Port = 80
+		}
+
+	case strings.HasPrefix(transport, TransportUnix+":"):
+		a.Transport = TransportUnix
+		a.Path = strings.TrimPrefix(transport, TransportUnix+":")
+		if a.Path == "" {
+			return nil, fmt.Errorf("msaddr: empty unix socket path")
+		}
+
+	case strings.HasPrefix(transport, TransportNet+":"), strings.HasPrefix(transport, TransportOnion+":"):
+		colon := strings.Index(transport, ":")
+		a.Transport = transport[:colon]
+
+		hostPort := transport[colon+1:]
+		portColon := strings.LastIndex(hostPort, ":")
+		if portColon == -1 {
+			return nil, fmt.Errorf("msaddr: %s address without port", a.Transport)
+		}
+		a.Host = strings.Trim(hostPort[:portColon], "[]")
+		a.Port, err = strconv.Atoi(hostPort[portColon+1:])
+		if err != nil {
+			return nil, fmt.Errorf("msaddr: invalid port: %w", err)
+		}
+
+		// some implementations use net: for onion addresses
+		if a.Transport == TransportNet && strings.HasSuffix(a.Host, ".onion") {
+			a.Transport = TransportOnion
+		}
+
+	default:
+		return nil, ErrUnsupportedTransport{Transport: strings.SplitN(transport, ":", 2)[0]}
+	}
+
+	return &a, nil
+}
+
+// ParseList parses a list of multiserver addresses, seperated by semicolons.
+// Addresses with unsupported transports are skipped. It only returns an error if none of them could be parsed.
+func ParseList(input string) ([]Address, error) {
+	var (
+		addrs   []Address
+		lastErr error
+	)
+	for _, part := range strings.Split(input, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		a, err := Parse(part)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		addrs = append(addrs, *a)
+	}
+	if len(addrs) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("msaddr: empty address list")
+		}
+		return nil, lastErr
+	}
+	return addrs, nil
+}
+
+// String returns the address in multiserver notation
+func (a Address) String() string {
+	var transport string
+	switch a.Transport {
+	case TransportWS, TransportWSS:
+		u := url.URL{
+			Scheme: a.Transport,
+			Host:   net.JoinHostPort(a.Host, strconv.Itoa(a.Port)),
+			Path:   a.Path,
+		}
+		transport = u.String()
+	case TransportUnix:
+		transport = TransportUnix + ":" + a.Path
+	default:
+		transport = a.Transport + ":" + net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+	}
+
+	var key string
+	if a.Ref != nil {
+		key = base64.StdEncoding.EncodeToString(a.Ref.PubKey())
+	}
+	return transport + "~shs:" + key
+}
+
+// TransportAddr returns the net.Addr used to dial the transport of the address (without the secret-handshake part).
+func (a Address) TransportAddr() (net.Addr, error) {
+	switch a.Transport {
+	case TransportNet:
+		return net.ResolveTCPAddr("tcp", net.JoinHostPort(a.Host, strconv.Itoa(a.Port)))
+	case TransportOnion:
+		return OnionAddr{Host: a.Host, Port: a.Port}, nil
+	case TransportWS, TransportWSS:
+		return WebsocketAddr{
+			Secure: a.Transport == TransportWSS,
+			Host:   net.JoinHostPort(a.Host, strconv.Itoa(a.Port)),
+			Path:   a.Path,
+		}, nil
+	case TransportUnix:
+		return &net.UnixAddr{Net: "unix", Name: a.Path}, nil
+	}
+	return nil, ErrUnsupportedTransport{Transport: a.Transport}
+}
+
+// WrappedAddr returns the transport address wrapped with the secret-handshake address.
+// This is the form network.Connect expects.
+func (a Address) WrappedAddr() (net.Addr, error) {
+	if a.Ref == nil {
+		return nil, ErrNoSHS
+	}
+	ta, err := a.TransportAddr()
+	if err != nil {
+		return nil, err
+	}
+	return netwrap.WrapAddr(ta, secretstream.Addr{PubKey: a.Ref.PubKey()}), nil
+}
+
+// FromNetAddr creates an Address from a (possibly netwrap'ed) address.
+// If it contains a secret-handshake address, Ref is set accordingly.
+func FromNetAddr(addr net.Addr) (*Address, error) {
+	var a Address
+
+	if shs, ok := netwrap.GetAddr(addr, "shs-bs").(secretstream.Addr); ok {
+		a.Ref = &refs.FeedRef{ID: shs.PubKey, Algo: refs.RefAlgoFeedSSB1}
+	}
+
+	if tcp, ok := netwrap.GetAddr(addr, "tcp").(*net.TCPAddr); ok {
+		a.Transport = TransportNet
+		a.Host = tcp.IP.String()
+		a.Port = tcp.Port
+		return &a, nil
+	}
+
+	if unix, ok := netwrap.GetAddr(addr, "unix").(*net.UnixAddr); ok {
+		a.Transport = TransportUnix
+		a.Path = unix.Name
+		return &a, nil
+	}
+
+	if onion, ok := netwrap.GetAddr(addr, TransportOnion).(OnionAddr); ok {
+		a.Transport = TransportOnion
+		a.Host = onion.Host
+		a.Port = onion.Port
+		return &a, nil
+	}
+
+	for _, network := range []string{TransportWS, TransportWSS} {
+		ws, ok := netwrap.GetAddr(addr, network).(WebsocketAddr)
+		if !ok {
+			continue
+		}
+		host, port, err := net.SplitHostPort(ws.Host)
+		if err != nil {
+			return nil, fmt.Errorf("msaddr: invalid websocket host: %w", err)
+		}
+		a.Transport = network
+		a.Host = host
+		a.Port, err = strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("msaddr: invalid websocket port: %w", err)
+		}
+		a.Path = ws.Path
+		return &a, nil
+	}
+
+	return nil, ErrUnsupportedTransport{Transport: addr.Network()}
+}
+
+// OnionAddr is the address of a tor onion service
+type OnionAddr struct {
+	Host string
+	Port int
+}
+
+// Network returns "onion"
+func (oa OnionAddr) Network() string { return TransportOnion }
+
+func (oa OnionAddr) String() string { return net.JoinHostPort(oa.Host, strconv.Itoa(oa.Port)) }
+
+// WebsocketAddr is the address of a websocket endpoint
+type WebsocketAddr struct {
+	Secure bool
+	Host   string // host:port
+	Path   string
+}
+
+// Network returns "ws" or "wss"
+func (wa WebsocketAddr) Network() string {
+	if wa.Secure {
+		return TransportWSS
+	}
+	return TransportWS
+}
+
+// String returns the URL of the websocket endpoint
+func (wa WebsocketAddr) String() string {
+	u := url.URL{
+		Scheme: wa.Network(),
+		Host:   wa.Host,
+		Path:   wa.Path,
+	}
+	return u.String()
+}
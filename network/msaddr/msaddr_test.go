@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: MIT
+
+package msaddr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/netwrap"
+	"go.cryptoscope.co/secretstream"
+)
+
+const testKey = "rHMHHCqW0WkyhsmhkQoG1KQqSjXb3H6Fp0Q1KQxxyAk="
+
+func TestParseAndFormat(t *testing.T) {
+	type tcase struct {
+		in string
+
+		transport string
+		host      string
+		port      int
+		path      string
+		out       string // if different from in
+	}
+
+	cases := []tcase{
+		{in: "net:192.168.1.2:8008~shs:" + testKey, transport: TransportNet, host: "192.168.1.2", port: 8008},
+		{in: "net:[fe80::1]:8008~shs:" + testKey, transport: TransportNet, host: "fe80::1", port: 8008},
+		{in: "net:example.com:8008~shs:" + testKey, transport: TransportNet, host: "example.com", port: 8008},
+		{in: "onion:2xk4uulbv2xkqg2m.onion:8008~shs:" + testKey, transport: TransportOnion, host: "2xk4uulbv2xkqg2m.onion", port: 8008},
+		{
+			in:        "net:2xk4uulbv2xkqg2m.onion:8008~shs:" + testKey,
+			transport: TransportOnion, host: "2xk4uulbv2xkqg2m.onion", port: 8008,
+			out: "onion:2xk4uulbv2xkqg2m.onion:8008~shs:" + testKey,
+		},
+		{in: "ws://example.com:8989~shs:" + testKey, transport: TransportWS, host: "example.com", port: 8989},
+		{in: "ws://example.com:8989/room~shs:" + testKey, transport: TransportWS, host: "example.com", port: 8989, path: "/room"},
+		{
+			in:        "wss://example.com~shs:" + testKey,
+			transport: TransportWSS, host: "example.com", port: 443,
+			out: "wss://example.com:443~shs:" + testKey,
+		},
+		{in: "unix:/home/alice/.ssb/socket~shs:" + testKey, transport: TransportUnix, path: "/home/alice/.ssb/socket"},
+		{
+			in:        "net:localhost:8008~shs:" + testKey + ":seedseedseed",
+			transport: TransportNet, host: "localhost", port: 8008,
+			out: "net:localhost:8008~shs:" + testKey,
+		},
+	}
+
+	for i, tc := range cases {
+		a, err := Parse(tc.in)
+		require.NoError(t, err, "case %d", i)
+		require.Equal(t, tc.transport, a.Transport, "case %d", i)
+		require.Equal(t, tc.host, a.Host, "case %d", i)
+		require.Equal(t, tc.port, a.Port, "case %d", i)
+		require.Equal(t, tc.path, a.Path, "case %d", i)
+		require.Equal(t, "@"+testKey+".ed25519", a.Ref.Ref(), "case %d", i)
+
+		want := tc.out
+		if want == "" {
+			want = tc.in
+		}
+		require.Equal(t, want, a.String(), "case %d", i)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for i, in := range []string{
+		"",
+		"net:localhost:8008",
+		"net:localhost:8008~noauth",
+		"net:localhost~shs:" + testKey,
+		"net:localhost:port~shs:" + testKey,
+		"net:localhost:8008~shs:nope",
+		"dht:somekey~shs:" + testKey,
+		"unix:~shs:" + testKey,
+	} {
+		_, err := Parse(in)
+		require.Error(t, err, "case %d: %q", i, in)
+	}
+
+	_, err := Parse("bt:somedevice~shs:" + testKey)
+	require.Equal(t, ErrUnsupportedTransport{Transport: "bt"}, err)
+}
+
+func TestParseList(t *testing.T) {
+	r := require.New(t)
+
+	list, err := ParseList("net:10.0.0.1:8008~shs:" + testKey + ";dht:nope~shs:" + testKey + ";ws://10.0.0.1:8989~shs:" + testKey)
+	r.NoError(err)
+	r.Len(list, 2)
+	r.Equal(TransportNet, list[0].Transport)
+	r.Equal(TransportWS, list[1].Transport)
+
+	_, err = ParseList("dht:nope~shs:" + testKey)
+	r.Error(err)
+}
+
+func TestWrappedAddr(t *testing.T) {
+	r := require.New(t)
+
+	a, err := Parse("net:127.0.0.1:8008~shs:" + testKey)
+	r.NoError(err)
+
+	wrapped, err := a.WrappedAddr()
+	r.NoError(err)
+
+	tcpAddr, ok := netwrap.GetAddr(wrapped, "tcp").(*net.TCPAddr)
+	r.True(ok)
+	r.Equal(8008, tcpAddr.Port)
+
+	shsAddr, ok := netwrap.GetAddr(wrapped, "shs-bs").(secretstream.Addr)
+	r.True(ok)
+	r.Equal(a.Ref.PubKey(), shsAddr.PubKey)
+
+	a, err = Parse("ws://example.com:8989/room~shs:" + testKey)
+	r.NoError(err)
+
+	wrapped, err = a.WrappedAddr()
+	r.NoError(err)
+
+	wsAddr, ok := netwrap.GetAddr(wrapped, TransportWS).(WebsocketAddr)
+	r.True(ok)
+	r.Equal("ws://example.com:8989/room", wsAddr.String())
+}
@@ -30,9 +30,18 @@ const DefaultPort = 8008
 type Options struct {
 	Logger log.Logger
 
-	Dialer     netwrap.Dialer
+	Dialer netwrap.Dialer
+
+	// TransportDialers are used by Connect for addresses that are not tcp, keyed by their network name (like ws or onion).
+	// They are added to DefaultTransportDialers(), overwriting existing entries.
+	TransportDialers map[string]TransportDialer
+
+	// ListenAddr is a shorthand for a single, advertised listener using the default app key
 	ListenAddr net.Addr
 
+	// Listeners can be used to listen on multiple addresses with different settings
+	Listeners []ListenerOptions
+
 	AdvertsSend      bool
 	AdvertsConnectTo bool
 
@@ -55,6 +64,11 @@ type Options struct {
 	EndpointWrapper func(muxrpc.Endpoint) muxrpc.Endpoint
 
 	WebsocketAddr string
+
+	// WebsocketNoAuthToken enables websocket connections without secret-handshake on /noauth if it is not empty.
+	// Only connections from loopback addresses that pass the token as query parameter are accepted.
+	// These are handled as if they came from KeyPair itself.
+	WebsocketNoAuthToken string
 }
 
 type node struct {
@@ -65,10 +79,10 @@ type node struct {
 	listening chan struct{}
 
 	listenerLock sync.Mutex
-	lisClose     sync.Once
-	lis          net.Listener
+	listeners    []*listener
 
 	dialer        netwrap.Dialer
+	transports    map[string]TransportDialer
 	localDiscovRx *Discoverer
 	localDiscovTx *Advertiser
 	secretServer  *secretstream.Server
@@ -110,6 +124,11 @@ func New(opts Options) (ssb.Network, error) {
 		n.dialer = netwrap.Dial
 	}
 
+	n.transports = DefaultTransportDialers()
+	for network, d := range opts.TransportDialers {
+		n.transports[network] = d
+	}
+
 	n.secretClient, err = secretstream.NewClient(opts.KeyPair.Pair, opts.AppKey)
 	if err != nil {
 		return nil, fmt.Errorf("error creating secretstream.Client: %w", err)
@@ -120,8 +139,38 @@ func New(opts Options) (ssb.Network, error) {
 		return nil, fmt.Errorf("error creating secretstream.Server: %w", err)
 	}
 
+	lisOpts := opts.Listeners
+	if opts.ListenAddr != nil {
+		lisOpts = append([]ListenerOptions{{Addr: opts.ListenAddr, Advertise: true}}, lisOpts...)
+	}
+
+	var advertAddr net.Addr
+	for i, lo := range lisOpts {
+		if lo.Addr == nil {
+			return nil, fmt.Errorf("listener #%d has no address", i)
+		}
+
+		l := &listener{opts: lo}
+		if lo.AppKey == nil {
+			l.secretServer = n.secretServer
+		} else {
+			l.secretServer, err = secretstream.NewServer(opts.KeyPair.Pair, lo.AppKey)
+			if err != nil {
+				return nil, fmt.Errorf("error creating secretstream.Server for listener #%d: %w", i, err)
+			}
+		}
+		n.listeners = append(n.listeners, l)
+
+		if lo.Advertise && advertAddr == nil {
+			advertAddr = lo.Addr
+		}
+	}
+
 	if n.opts.AdvertsSend {
-		n.localDiscovTx, err = NewAdvertiser(n.opts.ListenAddr, opts.KeyPair)
+		if advertAddr == nil {
+			return nil, fmt.Errorf("error creating Advertiser: no listener to advertise")
+		}
+		n.localDiscovTx, err = NewAdvertiser(advertAddr, opts.KeyPair)
 		if err != nil {
 			return nil, fmt.Errorf("error creating Advertiser: %w", err)
 		}
@@ -154,12 +203,20 @@ func New(opts Options) (ssb.Network, error) {
 
 	// local websocket
 	wsHandler := websockHandler(n)
+	var wsNoAuthHandler http.HandlerFunc
+	if opts.WebsocketNoAuthToken != "" {
+		wsNoAuthHandler = websockNoAuthHandler(n, opts.WebsocketNoAuthToken)
+	}
 	httpHandler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		url := req.URL.String()
 		if url == "/" {
 			wsHandler(w, req)
 			return
 		}
+		if req.URL.Path == "/noauth" && wsNoAuthHandler != nil {
+			wsNoAuthHandler(w, req)
+			return
+		}
 		// n.log.Log("http-url-req", url)
 		if n.httpHandler != nil {
 			n.httpHandler.ServeHTTP(w, req)
@@ -342,28 +399,27 @@ func (n *node) handleConnection(ctx context.Context, origConn net.Conn, isServer
 // Canceling the passed context makes the function return. Defers take care of stopping these resources.
 func (n *node) Serve(ctx context.Context, wrappers ...muxrpc.HandlerWrapper) error {
 	evtLog := log.With(n.log, "event", "network.Serve")
-	// TODO: make multiple listeners (localhost:8008 should not restrict or kill connections)
-	lisWrap := netwrap.NewListenerWrapper(n.secretServer.Addr(), append(n.opts.BefreCryptoWrappers, n.secretServer.ConnWrapper())...)
-	var err error
 
 	n.listenerLock.Lock()
-	n.lis, err = netwrap.Listen(n.opts.ListenAddr, lisWrap)
-	if err != nil {
-		n.listenerLock.Unlock()
-		return fmt.Errorf("error creating listener: %w", err)
+	for i, l := range n.listeners {
+		if err := l.listen(n.opts.BefreCryptoWrappers); err != nil {
+			for _, started := range n.listeners[:i] {
+				started.close()
+			}
+			n.listenerLock.Unlock()
+			return err
+		}
 	}
-	n.lisClose = sync.Once{} // reset once
 	close(n.listening)
 	n.listenerLock.Unlock()
 
-	defer func() { // refresh listener to re-call
-		n.lisClose.Do(func() {
-			n.listenerLock.Lock()
-			n.lis.Close()
-			n.lis = nil
-			n.listenerLock.Unlock()
-		})
+	defer func() { // refresh listeners to re-call
+		n.listenerLock.Lock()
+		for _, l := range n.listeners {
+			l.close()
+		}
 		n.listening = make(chan struct{})
+		n.listenerLock.Unlock()
 	}()
 
 	if n.localDiscovTx != nil {
@@ -390,30 +446,34 @@ func (n *node) Serve(ctx context.Context, wrappers ...muxrpc.HandlerWrapper) err
 		}()
 	}
 
-	// accept in a goroutine so that we can react to context cancel and close the listener
+	// accept in goroutines so that we can react to context cancel and close the listeners
 	newConn := make(chan net.Conn)
-	go func() {
-		defer close(newConn)
-		for {
-			n.listenerLock.Lock()
-			if n.lis == nil {
-				n.listenerLock.Unlock()
-				return
-			}
-			n.listenerLock.Unlock()
-			conn, err := n.lis.Accept()
-			if err != nil {
-				if strings.Contains(err.Error(), "use of closed network connection") {
-					// yikes way of handling this
-					// but means this needs to be restarted anyway
-					return
+	var accepting sync.WaitGroup
+	n.listenerLock.Lock()
+	for _, l := range n.listeners {
+		accepting.Add(1)
+		go func(lis net.Listener) {
+			defer accepting.Done()
+			for {
+				conn, err := lis.Accept()
+				if err != nil {
+					if strings.Contains(err.Error(), "use of closed network connection") {
+						// yikes way of handling this
+						// but means this needs to be restarted anyway
+						return
+					}
+
+					continue
 				}
 
-				continue
+				newConn <- conn
 			}
-
-			newConn <- conn
-		}
+		}(l.lis)
+	}
+	n.listenerLock.Unlock()
+	go func() {
+		accepting.Wait()
+		close(newConn)
 	}()
 
 	defer level.Debug(n.log).Log("event", "network listen loop exited")
@@ -448,8 +508,17 @@ func (n *node) Connect(ctx context.Context, addr net.Addr) error {
 		return errors.New("node/connect: expected shs-bs address to be of type secretstream.Addr")
 	}
 
-	conn, err := n.dialer(netwrap.GetAddr(addr, "tcp"), append(n.beforeCryptoConnWrappers,
-		n.secretClient.ConnWrapper(pubKey))...)
+	wrappers := append(n.beforeCryptoConnWrappers, n.secretClient.ConnWrapper(pubKey))
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if tcpAddr := netwrap.GetAddr(addr, "tcp"); tcpAddr != nil {
+		conn, err = n.dialer(tcpAddr, wrappers...)
+	} else {
+		conn, err = n.dialTransport(ctx, addr, wrappers)
+	}
 	if err != nil {
 		if conn != nil {
 			conn.Close()
@@ -463,14 +532,101 @@ func (n *node) Connect(ctx context.Context, addr net.Addr) error {
 	return nil
 }
 
+// ConnectConn runs the client side of secret-handshake over conn and starts muxrpc on it in the background
+func (n *node) ConnectConn(ctx context.Context, conn net.Conn, remote *refs.FeedRef) error {
+	if remote == nil {
+		conn.Close()
+		return errors.New("node/connectConn: remote can't be nil")
+	}
+
+	shsConn, err := n.secretClient.ConnWrapper(remote.PubKey())(conn)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("node/connectConn: handshake failed: %w", err)
+	}
+
+	go n.handleConnection(ctx, shsConn, false)
+	return nil
+}
+
+// ServeConn runs the server side of secret-handshake over conn and blocks until the muxrpc session is done
+func (n *node) ServeConn(ctx context.Context, conn net.Conn) error {
+	shsConn, err := n.secretServer.ConnWrapper()(conn)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("node/serveConn: handshake failed: %w", err)
+	}
+
+	n.handleConnection(ctx, shsConn, true)
+	return nil
+}
+
+// dialTransport finds a TransportDialer for the address and applies the passed wrappers to the new connection
+func (n *node) dialTransport(ctx context.Context, addr net.Addr, wrappers []netwrap.ConnWrapper) (net.Conn, error) {
+	var (
+		dial      TransportDialer
+		transport net.Addr
+	)
+	for network, d := range n.transports {
+		if ta := netwrap.GetAddr(addr, network); ta != nil {
+			dial, transport = d, ta
+			break
+		}
+	}
+	if dial == nil {
+		return nil, fmt.Errorf("no dialer for address: %s", addr)
+	}
+
+	conn, err := dial(ctx, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, cw := range wrappers {
+		wrapped, err := cw(conn)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error applying connection wrapper #%d: %w", i, err)
+		}
+		conn = wrapped
+	}
+	return conn, nil
+}
+
 // GetListenAddr waits for Serve() to be called!
+// It returns the address of the first listener.
 func (n *node) GetListenAddr() net.Addr {
-	_, ok := <-n.listening
-	if !ok {
-		return n.lis.Addr()
+	addrs := n.GetListenAddrs()
+	if len(addrs) == 0 {
+		return nil
 	}
-	level.Error(n.log).Log("msg", "listener not ready")
-	return nil
+	return addrs[0].Addr
+}
+
+// GetListenAddrs waits for Serve() to be called!
+func (n *node) GetListenAddrs() []ssb.ListenAddr {
+	// Serve replaces the channel when it returns
+	n.listenerLock.Lock()
+	listening := n.listening
+	n.listenerLock.Unlock()
+
+	_, ok := <-listening
+	if ok {
+		level.Error(n.log).Log("msg", "listener not ready")
+		return nil
+	}
+
+	n.listenerLock.Lock()
+	defer n.listenerLock.Unlock()
+
+	addrs := make([]ssb.ListenAddr, 0, len(n.listeners))
+	for _, l := range n.listeners {
+		if l.lis == nil {
+			continue
+		}
+		addrs = append(addrs, l.listenAddrInfo(n.opts.KeyPair))
+	}
+	return addrs
 }
 
 func (n *node) applyConnWrappers(conn net.Conn) (net.Conn, error) {
@@ -497,13 +653,9 @@ func (n *node) Close() error {
 	}
 	n.listenerLock.Lock()
 	defer n.listenerLock.Unlock()
-	if n.lis != nil {
-		var closeErr error
-		n.lisClose.Do(func() {
-			closeErr = n.lis.Close()
-		})
-		if closeErr != nil && !strings.Contains(closeErr.Error(), "use of closed network connection") {
-			return fmt.Errorf("ssb: network node failed to close it's listener: %w", closeErr)
+	for _, l := range n.listeners {
+		if err := l.close(); err != nil {
+			return fmt.Errorf("ssb: network node failed to close it's listener: %w", err)
 		}
 	}
 
@@ -2,15 +2,20 @@ package network
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/go-kit/kit/log/level"
 	"github.com/gorilla/websocket"
 	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/netwrap"
+
+	"go.cryptoscope.co/ssb/internal/netwraputil"
 )
 
 func websockHandler(n *node) http.HandlerFunc {
@@ -22,71 +27,118 @@ func websockHandler(n *node) http.HandlerFunc {
 		},
 		EnableCompression: false,
 	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		n.serveWebsocket(w, req, upgrader, n.secretServer.ConnWrapper())
+	}
+}
+
+// websockNoAuthHandler serves websocket connections without secret-handshake.
+// It's only meant for trusted, local applications (like a browser on the same machine).
+// Requests need to come from a loopback address, with a loopback origin and the correct token as query parameter.
+// Connections are treated as if they came from the key-pair of the node, which usually grants full (master) access.
+func websockNoAuthHandler(n *node, token string) http.HandlerFunc {
+	var upgrader = websocket.Upgrader{
+		ReadBufferSize:    1024 * 4,
+		WriteBufferSize:   1024 * 4,
+		CheckOrigin:       isLoopbackOrigin,
+		EnableCompression: false,
+	}
+	spoofWrapper := netwraputil.SpoofRemoteAddress(n.opts.KeyPair.Id.PubKey())
 	return func(w http.ResponseWriter, req *http.Request) {
 		remoteAddr, err := net.ResolveTCPAddr("tcp", req.RemoteAddr)
-		if err != nil {
-			n.log.Log("warning", "failed wrap", "err", err, "remote", remoteAddr)
+		if err != nil || !remoteAddr.IP.IsLoopback() {
+			level.Warn(n.log).Log("event", "ws-noauth", "msg", "denied non-local request", "remote", req.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
 			return
 		}
-		wsConn, err := upgrader.Upgrade(w, req, nil)
-		if err != nil {
-			n.log.Log("warning", "failed wrap", "err", err, "remote", remoteAddr)
+
+		got := []byte(req.URL.Query().Get("token"))
+		if subtle.ConstantTimeCompare(got, []byte(token)) != 1 {
+			level.Warn(n.log).Log("event", "ws-noauth", "msg", "denied request with wrong token", "remote", req.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
 			return
 		}
 
-		var wc net.Conn
-		wc = &wrappedConn{
-			remote: remoteAddr,
-			local: &net.TCPAddr{
-				IP:   nil,
-				Port: 8989,
-			},
-			wsc: wsConn,
-		}
+		n.serveWebsocket(w, req, upgrader, spoofWrapper)
+	}
+}
 
-		// comment out this block to get `noauth` instead of `shs`
-		// TODO:
-		// netwrap.WrapAddr(remoteAddr, secretstream.Addr{
-		// 	PubKey: n.opts.KeyPair.Id.ID,
-		// })
-		cw := n.secretServer.ConnWrapper()
-		wc, err = cw(wc)
-		if err != nil {
-			level.Error(n.log).Log("warning", "failed to crypt", "err", err, "remote", remoteAddr)
-			wsConn.Close()
-			return
-		}
+// isLoopbackOrigin allows requests without an origin (non-browser clients) and those from a page on localhost
+func isLoopbackOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
 
-		// debugging copy of all muxrpc frames
-		// can be handy for reversing applications
-		// wrapped, err := debug.WrapDump("webmux", cryptoConn)
-		// if err != nil {
-		// 	level.Error(n.log).Log("warning", "failed wrap", "err", err, "remote", remoteAddr)
-		// 	wsConn.Close()
-		// 	return
-		// }
-
-		pkr := muxrpc.NewPacker(wc)
-
-		h, err := n.opts.MakeHandler(wc)
-		if err != nil {
-			err = fmt.Errorf("unix sock make handler: %w", err)
-			level.Error(n.log).Log("warn", err)
-			wsConn.Close()
-			return
-		}
+func (n *node) serveWebsocket(w http.ResponseWriter, req *http.Request, upgrader websocket.Upgrader, cw netwrap.ConnWrapper) {
+	remoteAddr, err := net.ResolveTCPAddr("tcp", req.RemoteAddr)
+	if err != nil {
+		n.log.Log("warning", "failed wrap", "err", err, "remote", remoteAddr)
+		return
+	}
+	wsConn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		n.log.Log("warning", "failed wrap", "err", err, "remote", remoteAddr)
+		return
+	}
 
-		edp := muxrpc.Handle(pkr, h,
-			muxrpc.WithContext(req.Context()),
-			muxrpc.WithRemoteAddr(wc.RemoteAddr()))
+	var wc net.Conn
+	wc = &wrappedConn{
+		remote: remoteAddr,
+		local: &net.TCPAddr{
+			IP:   nil,
+			Port: 8989,
+		},
+		wsc: wsConn,
+	}
 
-		srv := edp.(muxrpc.Server)
-		// TODO: bundle root and connection context
-		if err := srv.Serve(); err != nil {
-			level.Error(n.log).Log("conn", "serve exited", "err", err, "peer", remoteAddr)
-		}
+	wc, err = cw(wc)
+	if err != nil {
+		level.Error(n.log).Log("warning", "failed to crypt", "err", err, "remote", remoteAddr)
 		wsConn.Close()
+		return
+	}
+
+	// debugging copy of all muxrpc frames
+	// can be handy for reversing applications
+	// wrapped, err := debug.WrapDump("webmux", cryptoConn)
+	// if err != nil {
+	// 	level.Error(n.log).Log("warning", "failed wrap", "err", err, "remote", remoteAddr)
+	// 	wsConn.Close()
+	// 	return
+	// }
+
+	pkr := muxrpc.NewPacker(wc)
+
+	h, err := n.opts.MakeHandler(wc)
+	if err != nil {
+		err = fmt.Errorf("websocket make handler: %w", err)
+		level.Error(n.log).Log("warn", err)
+		wsConn.Close()
+		return
+	}
+
+	edp := muxrpc.Handle(pkr, h,
+		muxrpc.WithContext(req.Context()),
+		muxrpc.WithRemoteAddr(wc.RemoteAddr()))
+
+	srv := edp.(muxrpc.Server)
+	// TODO: bundle root and connection context
+	if err := srv.Serve(); err != nil {
+		level.Error(n.log).Log("conn", "serve exited", "err", err, "peer", remoteAddr)
 	}
+	wsConn.Close()
 }
 
 type wrappedConn struct {
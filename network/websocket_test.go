@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: MIT
+
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/muxrpc/v2"
+
+	"go.cryptoscope.co/ssb"
+)
+
+func TestIsLoopbackOrigin(t *testing.T) {
+	cases := []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true},
+		{"http://localhost:3000", true},
+		{"http://127.0.0.1:8080", true},
+		{"http://[::1]:8080", true},
+		{"https://example.com", false},
+		{"http://192.168.1.10", false},
+		{"http://localhost.example.com", false},
+		{"%%%", false},
+	}
+	for i, tc := range cases {
+		req, err := http.NewRequest("GET", "http://localhost:8989/noauth", nil)
+		require.NoError(t, err)
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		require.Equal(t, tc.ok, isLoopbackOrigin(req), "case %d: %s", i, tc.origin)
+	}
+}
+
+type noauthTestHandler struct {
+	remotes chan net.Addr
+}
+
+func (h noauthTestHandler) Handled(muxrpc.Method) bool { return false }
+
+func (h noauthTestHandler) HandleConnect(ctx context.Context, edp muxrpc.Endpoint) {
+	h.remotes <- edp.Remote()
+}
+
+func (h noauthTestHandler) HandleCall(ctx context.Context, req *muxrpc.Request) {
+	req.CloseWithError(fmt.Errorf("no such command: %v", req.Method))
+}
+
+func TestWebsocketNoAuth(t *testing.T) {
+	r := require.New(t)
+
+	appKey := make([]byte, 32)
+	rand.Read(appKey)
+	kp, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+
+	h := noauthTestHandler{remotes: make(chan net.Addr, 1)}
+	nw, err := New(Options{
+		Logger:  log.NewNopLogger(),
+		AppKey:  appKey,
+		KeyPair: kp,
+		MakeHandler: func(net.Conn) (muxrpc.Handler, error) {
+			return h, nil
+		},
+	})
+	r.NoError(err)
+	n := nw.(*node)
+
+	const token = "s3cr3t"
+	srv := httptest.NewServer(websockNoAuthHandler(n, token))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// wrong or missing token
+	for _, q := range []string{"", "?token=", "?token=wrong"} {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL+q, nil)
+		r.Error(err, "query %q", q)
+		r.NotNil(resp, "query %q", q)
+		r.Equal(http.StatusForbidden, resp.StatusCode, "query %q", q)
+	}
+
+	// not from a loopback address
+	req := httptest.NewRequest("GET", "/noauth?token="+token, nil)
+	req.RemoteAddr = "192.0.2.1:4242"
+	rec := httptest.NewRecorder()
+	websockNoAuthHandler(n, token)(rec, req)
+	r.Equal(http.StatusForbidden, rec.Code)
+
+	// a foreign origin
+	hdr := http.Header{}
+	hdr.Set("Origin", "https://example.com")
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL+"?token="+token, hdr)
+	r.Error(err)
+	r.NotNil(resp)
+	r.Equal(http.StatusForbidden, resp.StatusCode)
+
+	// the correct token is treated as the key-pair of the node
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?token="+token, nil)
+	r.NoError(err)
+	defer conn.Close()
+
+	select {
+	case remote := <-h.remotes:
+		ref, err := ssb.GetFeedRefFromAddr(remote)
+		r.NoError(err)
+		r.True(ref.Equal(kp.Id), "wrong remote: %s", ref.Ref())
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection wasn't handled")
+	}
+}
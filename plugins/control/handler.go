@@ -15,13 +15,10 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"go.cryptoscope.co/muxrpc/v2"
 	"go.cryptoscope.co/muxrpc/v2/typemux"
-	"go.cryptoscope.co/netwrap"
-	"go.cryptoscope.co/secretstream"
-
-	multiserver "go.mindeco.de/ssb-multiserver"
 	refs "go.mindeco.de/ssb-refs"
 
 	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/network/msaddr"
 )
 
 type handler struct {
@@ -128,21 +125,31 @@ func (h *handler) connect(ctx context.Context, req *muxrpc.Request) (interface{}
 	}
 	if len(args) != 1 {
 		h.info.Log("error", "usage", "args", req.Args, "method", req.Method)
-		return nil, errors.New("usage: ctrl.connect host:port:key")
+		return nil, errors.New("usage: ctrl.connect net:host:port~shs:key")
 	}
 	dest := args[0]
 
-	msaddr, err := multiserver.ParseNetAddress([]byte(dest))
+	addrs, err := msaddr.ParseList(dest)
 	if err != nil {
 		return nil, fmt.Errorf("ctrl.connect call: failed to parse input %q: %w", dest, err)
 	}
 
-	wrappedAddr := netwrap.WrapAddr(&msaddr.Addr, secretstream.Addr{PubKey: msaddr.Ref.PubKey()})
-	level.Info(h.info).Log("event", "doing gossip.connect", "remote", msaddr.Ref.ShortRef())
-	// TODO: add context to tracker to cancel connections
-	err = h.node.Connect(context.Background(), wrappedAddr)
-	if err != nil {
-		return nil, fmt.Errorf("ctrl.connect call: error connecting to %q: %w", msaddr.Addr, err)
+	// try all the addresses until one of them works
+	for _, a := range addrs {
+		wrappedAddr, err := a.WrappedAddr()
+		if err != nil {
+			level.Debug(h.info).Log("event", "ctrl.connect", "msg", "skipping address", "addr", a.String(), "err", err)
+			continue
+		}
+
+		level.Info(h.info).Log("event", "doing gossip.connect", "remote", a.Ref.ShortRef(), "transport", a.Transport)
+		// TODO: add context to tracker to cancel connections
+		err = h.node.Connect(context.Background(), wrappedAddr)
+		if err != nil {
+			level.Debug(h.info).Log("event", "ctrl.connect", "msg", "dialing failed", "addr", a.String(), "err", err)
+			continue
+		}
+		return "connected", nil
 	}
-	return "connected", nil
+	return nil, fmt.Errorf("ctrl.connect call: error connecting to %q: none of the addresses worked", dest)
 }
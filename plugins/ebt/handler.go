@@ -199,8 +199,8 @@ func (h *MUXRPCHandler) Loop(ctx context.Context, tx *muxrpc.ByteSink, rx *muxrp
 			}
 
 			err = vsnk.Verify(jsonBody)
-			if err != nil {
-				// TODO: mark feed as bad
+			if err != nil && !errors.Is(err, message.ErrQuarantined) {
+				// forks are recorded by the verify sink, which refuses further messages of the feed
 				h.check(err)
 			}
 
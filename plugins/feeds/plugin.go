@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: MIT
+
+// Package feeds offers muxrpc calls to inspect and manage the feeds the bot stores and the ones it owns.
+package feeds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/cryptix/go/logging"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// ForkLister is implemented by the fork registry of the bot
+type ForkLister interface {
+	List() []message.ForkEvidence
+}
+
+// ForkClearer is implemented by the bot, it lifts the quarantine of a feed and drops its stored messages if asked to
+type ForkClearer interface {
+	ClearForked(feed *refs.FeedRef, drop bool) error
+}
+
+// FeedOwner is implemented by the bot, it publishes to the additional feeds whose keys are stored in its repo
+type FeedOwner interface {
+	CreateFeed(name, algo string) (*refs.FeedRef, error)
+	PublishAs(name string, content interface{}) (*refs.MessageRef, error)
+	OwnedFeeds() (map[string]*refs.FeedRef, error)
+}
+
+type Plugin struct {
+	h muxrpc.Handler
+}
+
+var _ ssb.Plugin = (*Plugin)(nil)
+
+// NewPlugin returns the feeds plugin. It should only be registered on the master muxrpc handler.
+func NewPlugin(log logging.Interface, forks ForkLister, clearer ForkClearer, owner FeedOwner) *Plugin {
+	mux := typemux.New(log)
+
+	h := handler{forks: forks, clearer: clearer, owner: owner}
+	mux.RegisterAsync(muxrpc.Method{"feeds", "forked"}, typemux.AsyncFunc(h.forked))
+	mux.RegisterAsync(muxrpc.Method{"feeds", "clearForked"}, typemux.AsyncFunc(h.clearForked))
+	mux.RegisterAsync(muxrpc.Method{"feeds", "create"}, typemux.AsyncFunc(h.create))
+	mux.RegisterAsync(muxrpc.Method{"feeds", "publishAs"}, typemux.AsyncFunc(h.publishAs))
+	mux.RegisterAsync(muxrpc.Method{"feeds", "owned"}, typemux.AsyncFunc(h.owned))
+
+	return &Plugin{
+		h: &mux,
+	}
+}
+
+func (lt Plugin) Name() string            { return "feeds" }
+func (Plugin) Method() muxrpc.Method      { return muxrpc.Method{"feeds"} }
+func (lt Plugin) Handler() muxrpc.Handler { return lt.h }
+
+type handler struct {
+	forks   ForkLister
+	clearer ForkClearer
+	owner   FeedOwner
+}
+
+// forked returns the evidence of all quarantined feeds
+func (h handler) forked(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	return h.forks.List(), nil
+}
+
+// ClearForkedArgs are the optional second argument of feeds.clearForked.
+// Drop nulls the stored messages of the feed, so that it is fetched again from the start.
+type ClearForkedArgs struct {
+	Drop bool `json:"drop"`
+}
+
+// clearForked lifts the quarantine of the feed that is passed as the first argument
+func (h handler) clearForked(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	var args []json.RawMessage
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return nil, fmt.Errorf("feeds.clearForked: bad arguments: %w", err)
+	}
+	if n := len(args); n < 1 || n > 2 {
+		return nil, fmt.Errorf("feeds.clearForked: expected a feed and options but got %d arguments", n)
+	}
+
+	var feed *refs.FeedRef
+	if err := json.Unmarshal(args[0], &feed); err != nil || feed == nil {
+		return nil, fmt.Errorf("feeds.clearForked: first argument is not a feed")
+	}
+	var opts ClearForkedArgs
+	if len(args) == 2 {
+		if err := json.Unmarshal(args[1], &opts); err != nil {
+			return nil, fmt.Errorf("feeds.clearForked: bad options: %w", err)
+		}
+	}
+
+	if err := h.clearer.ClearForked(feed, opts.Drop); err != nil {
+		return nil, err
+	}
+	return feed.Ref(), nil
+}
+
+// CreateArgs are the arguments of feeds.create, Format is a feed reference suffix and defaults to classic feeds
+type CreateArgs struct {
+	Name   string `json:"name"`
+	Format string `json:"format,omitempty"`
+}
+
+// create makes a new feed that the bot owns and returns its reference
+func (h handler) create(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	var args []CreateArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return nil, fmt.Errorf("feeds.create: bad arguments: %w", err)
+	}
+	if n := len(args); n != 1 {
+		return nil, fmt.Errorf("feeds.create: expected one argument but got %d", n)
+	}
+
+	algo := args[0].Format
+	if algo == "" {
+		algo = refs.RefAlgoFeedSSB1
+	}
+	ref, err := h.owner.CreateFeed(args[0].Name, algo)
+	if err != nil {
+		return nil, err
+	}
+	return OwnedFeed{Name: args[0].Name, ID: ref}, nil
+}
+
+// publishAs publishes the content (second argument) on the owned feed with the name (first argument)
+func (h handler) publishAs(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	var args []json.RawMessage
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return nil, fmt.Errorf("feeds.publishAs: bad arguments: %w", err)
+	}
+	if n := len(args); n != 2 {
+		return nil, fmt.Errorf("feeds.publishAs: expected name and content but got %d arguments", n)
+	}
+
+	var name string
+	if err := json.Unmarshal(args[0], &name); err != nil {
+		return nil, fmt.Errorf("feeds.publishAs: name is not a string: %w", err)
+	}
+	return h.owner.PublishAs(name, args[1])
+}
+
+// OwnedFeed is one of the feeds the bot owns, as returned by feeds.create and feeds.owned
+type OwnedFeed struct {
+	Name string        `json:"name"`
+	ID   *refs.FeedRef `json:"id"`
+}
+
+// owned lists the feeds the bot owns, sorted by name
+func (h handler) owned(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	feeds, err := h.owner.OwnedFeeds()
+	if err != nil {
+		return nil, err
+	}
+
+	lst := make([]OwnedFeed, 0, len(feeds))
+	for name, ref := range feeds {
+		lst = append(lst, OwnedFeed{Name: name, ID: ref})
+	}
+	sort.Slice(lst, func(i, j int) bool { return lst[i].Name < lst[j].Name })
+	return lst, nil
+}
@@ -20,11 +20,13 @@ import (
 	"go.cryptoscope.co/muxrpc/v2"
 
 	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/feedranges"
 	"go.cryptoscope.co/ssb/internal/luigiutils"
 	"go.cryptoscope.co/ssb/internal/mutil"
 	"go.cryptoscope.co/ssb/internal/storedrefs"
 	"go.cryptoscope.co/ssb/internal/transform"
 	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/message/bendybutt"
 	refs "go.mindeco.de/ssb-refs"
 )
 
@@ -36,6 +38,9 @@ type FeedManager struct {
 	UserFeeds  multilog.MultiLog
 	logger     logging.Interface
 
+	unboxer Unboxer
+	partial PartialFeeds
+
 	liveFeeds    map[string]*luigiutils.MultiSink
 	liveFeedsMut sync.Mutex
 
@@ -44,12 +49,27 @@ type FeedManager struct {
 	sysCtr   metrics.Counter
 }
 
+// Unboxer decrypts private messages, see private.Manager
+type Unboxer interface {
+	// UnboxedMessage returns a copy of the message with the decrypted content or an error if it can't be decrypted.
+	UnboxedMessage(refs.Message) (refs.Message, error)
+}
+
+// PartialFeeds tells which parts are stored of the feeds that aren't stored from the first message on, see feedranges.Store
+type PartialFeeds interface {
+	// Ranges returns the stored ranges of the feed in ascending order, nil if the feed isn't partial
+	Ranges(*refs.FeedRef) []feedranges.Range
+}
+
 // NewFeedManager returns a new FeedManager used for gossiping about User
-// Feeds.
+// Feeds. The unboxer is used for requests with the private option, it can be nil.
+// Of the feeds that partial knows about only the stored ranges are served, it can also be nil.
 func NewFeedManager(
 	ctx context.Context,
 	rxlog margaret.Log,
 	userFeeds multilog.MultiLog,
+	unboxer Unboxer,
+	partial PartialFeeds,
 	info logging.Interface,
 	sysGauge metrics.Gauge,
 	sysCtr metrics.Counter,
@@ -57,6 +77,8 @@ func NewFeedManager(
 	fm := &FeedManager{
 		ReceiveLog: rxlog,
 		UserFeeds:  userFeeds,
+		unboxer:    unboxer,
+		partial:    partial,
 		logger:     info,
 		rootCtx:    ctx,
 		sysCtr:     sysCtr,
@@ -221,6 +243,17 @@ func (m *FeedManager) CreateStreamHistory(
 		return fmt.Errorf("userLog sequence: %w", err)
 	}
 
+	// the sublog of a partial feed isn't in feed order, it needs to be checked before anything that relies on it
+	if m.partial != nil {
+		if ranges := m.partial.Ranges(arg.ID); ranges != nil {
+			return m.partialStreamHistory(ctx, sink, arg, userLog, ranges)
+		}
+	}
+
+	if arg.Private {
+		return m.privateStreamHistory(ctx, sink, arg, userLog)
+	}
+
 	if arg.Seq != 0 {
 		arg.Seq--             // our idx is 0 ed
 		if arg.Seq > latest { // more than we got
@@ -268,21 +301,9 @@ func (m *FeedManager) CreateStreamHistory(
 		return fmt.Errorf("invalid user log query: %w", err)
 	}
 
-	var luigiSink luigi.Sink
-	switch arg.ID.Algo {
-	case refs.RefAlgoFeedSSB1:
-		luigiSink = transform.NewKeyValueWrapper(sink, arg.Keys)
-
-	case refs.RefAlgoFeedGabby:
-		switch {
-		case arg.AsJSON:
-			luigiSink = transform.NewKeyValueWrapper(sink, arg.Keys)
-		default:
-			luigiSink = luigiutils.NewGabbyStreamSink(sink)
-		}
-
-	default:
-		return fmt.Errorf("unsupported feed format.")
+	luigiSink, err := feedSink(sink, arg)
+	if err != nil {
+		return err
 	}
 
 	sent := 0
@@ -316,3 +337,239 @@ func (m *FeedManager) CreateStreamHistory(
 	}
 	return sink.Close()
 }
+
+// feedSink encodes the messages for a CreateStreamHistory request, depending on the feed format
+func feedSink(sink *muxrpc.ByteSink, arg *message.CreateHistArgs) (luigi.Sink, error) {
+	switch arg.ID.Algo {
+	case refs.RefAlgoFeedSSB1:
+		return transform.NewKeyValueWrapper(sink, arg.Keys), nil
+
+	case refs.RefAlgoFeedGabby:
+		switch {
+		case arg.AsJSON:
+			return transform.NewKeyValueWrapper(sink, arg.Keys), nil
+		default:
+			return luigiutils.NewGabbyStreamSink(sink), nil
+		}
+
+	case bendybutt.RefAlgoFeedBendyButt:
+		if arg.AsJSON {
+			return transform.NewKeyValueWrapper(sink, arg.Keys), nil
+		}
+		return luigiutils.NewBendyButtStreamSink(sink), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported feed format.")
+	}
+}
+
+// partialStreamHistory serves a CreateStreamHistory request for a feed that is only partially stored.
+// Only the range that contains the requested sequence is served, so that the receiver gets messages without gaps.
+// Without a sequence that's the first range or, in reverse, the newest one.
+// Seq, Gt and Lt are feed sequences here.
+// Live requests only get new messages if the newest range was served completely, otherwise they just stay open.
+// That's also what happens for requests from before the horizon, since EBT streams all feeds over the same sink.
+// Private requests get the decrypted messages of the range, like with privateStreamHistory, but can't be live.
+func (m *FeedManager) partialStreamHistory(
+	ctx context.Context,
+	sink *muxrpc.ByteSink,
+	arg *message.CreateHistArgs,
+	userLog margaret.Log,
+	ranges []feedranges.Range,
+) error {
+	if arg.Private && arg.Live {
+		// the live feeds can't decrypt and the sublog of a partial feed can't be followed in feed order
+		return fmt.Errorf("bad request: private live streams are not supported for partially stored feeds")
+	}
+
+	var (
+		rng   feedranges.Range
+		found bool
+	)
+	switch {
+	case arg.Seq > 0:
+		for _, r := range ranges {
+			if r.Contains(arg.Seq) {
+				rng, found = r, true
+				rng.From = arg.Seq
+				break
+			}
+		}
+	case len(ranges) > 0 && arg.Reverse:
+		rng, found = ranges[len(ranges)-1], true
+	case len(ranges) > 0:
+		rng, found = ranges[0], true
+	}
+	if arg.Gt >= rng.From {
+		rng.From = arg.Gt + 1
+	}
+	if arg.Lt > 0 && arg.Lt <= rng.To {
+		rng.To = arg.Lt - 1
+	}
+	if !found || rng.From > rng.To {
+		if arg.Live {
+			return nil
+		}
+		return sink.Close()
+	}
+	newest := !arg.Reverse && rng.To == ranges[len(ranges)-1].To
+
+	var (
+		luigiSink luigi.Sink
+		err       error
+	)
+	if arg.Private {
+		luigiSink, err = m.unboxingSink(sink, arg)
+	} else {
+		luigiSink, err = feedSink(sink, arg)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the sublog of a partial feed isn't in feed order
+	msgs := make([]refs.Message, rng.To-rng.From+1)
+	src, err := mutil.Indirect(m.ReceiveLog, userLog).Query()
+	if err != nil {
+		return fmt.Errorf("invalid user log query: %w", err)
+	}
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				break
+			}
+			return fmt.Errorf("failed to read user log: %w", err)
+		}
+		msg, ok := v.(refs.Message)
+		if !ok {
+			continue // nulled
+		}
+		if seq := msg.Seq(); rng.Contains(seq) {
+			msgs[seq-rng.From] = msg
+		}
+	}
+
+	if arg.Reverse {
+		for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+			msgs[i], msgs[j] = msgs[j], msgs[i]
+		}
+	}
+	if arg.Limit > 0 && int64(len(msgs)) > arg.Limit {
+		msgs = msgs[:arg.Limit]
+		newest = false
+	}
+
+	sent := 0
+	for _, msg := range msgs {
+		if msg == nil {
+			// recorded but not indexed yet, stop at the gap
+			newest = false
+			break
+		}
+		if err = luigiSink.Pour(ctx, msg); err != nil {
+			break
+		}
+		sent++
+	}
+	if sent > 0 {
+		level.Debug(m.logger).Log("event", "partialtx", "fr", arg.ID.ShortRef(), "n", sent)
+	}
+
+	if errors.Is(err, context.Canceled) || muxrpc.IsSinkClosed(err) {
+		sink.Close()
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to send messages to peer: %w", err)
+	}
+
+	if arg.Live {
+		if !newest {
+			return nil
+		}
+		latest, err := getLatestSeq(userLog)
+		if err != nil {
+			return fmt.Errorf("userLog sequence: %w", err)
+		}
+		return m.addLiveFeed(ctx, sink, arg.ID.Ref(), latest, -1)
+	}
+	return sink.Close()
+}
+
+// privateStreamHistory serves a CreateStreamHistory request with the private option.
+// Messages that can be decrypted are sent with their cleartext content, the others as they are.
+// The live part is served by the same query, since the live feeds share the encoded messages between all requests.
+// Callers need to make sure only the local user can make such requests.
+func (m *FeedManager) privateStreamHistory(
+	ctx context.Context,
+	sink *muxrpc.ByteSink,
+	arg *message.CreateHistArgs,
+	userLog margaret.Log,
+) error {
+	unboxSink, err := m.unboxingSink(sink, arg)
+	if err != nil {
+		return err
+	}
+
+	if arg.Limit == 0 {
+		arg.Limit = -1
+	}
+	qryArgs := []margaret.QuerySpec{
+		margaret.Limit(int(arg.Limit)),
+		margaret.Reverse(arg.Reverse),
+		margaret.Live(arg.Live),
+	}
+
+	if arg.Seq > 1 { // our idx is 0 ed
+		qryArgs = append(qryArgs, margaret.Gte(margaret.BaseSeq(arg.Seq-1)))
+	}
+
+	if arg.Lt > 0 {
+		qryArgs = append(qryArgs, margaret.Lt(margaret.BaseSeq(arg.Lt)))
+	}
+
+	if arg.Gt > 0 {
+		qryArgs = append(qryArgs, margaret.Gt(margaret.BaseSeq(arg.Gt)))
+	}
+
+	resolved := mutil.Indirect(m.ReceiveLog, userLog)
+	src, err := resolved.Query(qryArgs...)
+	if err != nil {
+		return fmt.Errorf("invalid user log query: %w", err)
+	}
+
+	sent := 0
+	err = luigi.Pump(ctx, luigiutils.NewSinkCounter(&sent, unboxSink), src)
+	if sent > 0 {
+		level.Debug(m.logger).Log("event", "privatetx", "fr", arg.ID.ShortRef(), "n", sent)
+	}
+
+	if errors.Is(err, context.Canceled) || muxrpc.IsSinkClosed(err) {
+		sink.Close()
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to pump messages: %w", err)
+	}
+	return sink.Close()
+}
+
+// unboxingSink sends the messages with their content decrypted, if it can be.
+// Decrypted content can't be sent in the gabbygrove transfer format, so all feeds are sent as json.
+func (m *FeedManager) unboxingSink(sink *muxrpc.ByteSink, arg *message.CreateHistArgs) (luigi.Sink, error) {
+	if m.unboxer == nil {
+		return nil, fmt.Errorf("bad request: private messages are not supported")
+	}
+
+	kvSink := transform.NewKeyValueWrapper(sink, arg.Keys)
+	return luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			return err
+		}
+		if msg, ok := v.(refs.Message); ok {
+			if unboxed, err := m.unboxer.UnboxedMessage(msg); err == nil {
+				v = unboxed
+			}
+		}
+		return kvSink.Pour(ctx, v)
+	}), nil
+}
@@ -5,6 +5,7 @@ package gossip
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 
 	"go.cryptoscope.co/muxrpc/v2/codec"
 
+	"github.com/cryptix/go/encodedTime"
 	"github.com/go-kit/kit/log"
 	"github.com/stretchr/testify/require"
 	refs "go.mindeco.de/ssb-refs"
@@ -23,11 +25,13 @@ import (
 	"go.cryptoscope.co/margaret/multilog"
 	"go.cryptoscope.co/muxrpc/v2"
 	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/feedranges"
 	"go.cryptoscope.co/ssb/internal/asynctesting"
 	"go.cryptoscope.co/ssb/internal/ctxutils"
 	"go.cryptoscope.co/ssb/internal/storedrefs"
 	"go.cryptoscope.co/ssb/internal/testutils"
 	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/message/legacy"
 	"go.cryptoscope.co/ssb/multilogs"
 	"go.cryptoscope.co/ssb/repo"
 )
@@ -168,7 +172,7 @@ func TestCreateHistoryStream(t *testing.T) {
 			var buf = new(bytes.Buffer)
 			var sink = muxrpc.NewTestSink(buf)
 
-			fm := NewFeedManager(context.TODO(), rootLog, userFeeds, infoAlice, nil, nil)
+			fm := NewFeedManager(context.TODO(), rootLog, userFeeds, nil, nil, infoAlice, nil, nil)
 
 			err = fm.CreateStreamHistory(ctx, sink, &test.Args)
 			r.NoError(err)
@@ -197,3 +201,111 @@ func readAllPackets(r io.Reader) []*codec.Packet {
 	}
 	return pkts
 }
+
+// testUnboxer decrypts the messages it has the cleartext of
+type testUnboxer map[string][]byte
+
+func (tu testUnboxer) UnboxedMessage(msg refs.Message) (refs.Message, error) {
+	cleartxt, has := tu[msg.Key().Ref()]
+	if !has {
+		return nil, errors.New("not boxed")
+	}
+
+	var rv refs.KeyValueRaw
+	rv.Key_ = msg.Key()
+	rv.Value.Author = *msg.Author()
+	rv.Value.Previous = msg.Previous()
+	rv.Value.Sequence = margaret.BaseSeq(msg.Seq())
+	rv.Value.Timestamp = encodedTime.NewMillisecs(msg.Claimed().Unix())
+	rv.Value.Signature = "reboxed"
+	rv.Value.Content = cleartxt
+	return rv, nil
+}
+
+func TestPartialPrivateHistory(t *testing.T) {
+	r := require.New(t)
+	ctx := context.TODO()
+
+	repoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(repoPath)
+	rpo := repo.New(repoPath)
+
+	rootLog, err := repo.OpenLog(rpo)
+	r.NoError(err)
+	userFeeds, refresh, err := multilogs.OpenUserFeeds(rpo)
+	r.NoError(err)
+	defer userFeeds.Close()
+	partial, err := feedranges.Open(rpo)
+	r.NoError(err)
+
+	vs, err := message.NewVerificationSinker(rootLog, userFeeds, nil, nil, partial, nil)
+	r.NoError(err)
+
+	author, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+
+	// every other message is only readable by us
+	unboxer := make(testUnboxer)
+	var (
+		msgs [][]byte
+		prev *refs.MessageRef
+	)
+	for i := 0; i < 20; i++ {
+		cleartxt := []byte(fmt.Sprintf(`{"type":"test","i":%d}`, i))
+		var content interface{} = map[string]interface{}{"type": "test", "i": i}
+		if i%2 == 1 {
+			content = fmt.Sprintf("boxed%d.box", i)
+		}
+		ref, raw, err := legacy.LegacyMessage{
+			Previous:  prev,
+			Author:    author.Id.Ref(),
+			Sequence:  margaret.BaseSeq(i + 1),
+			Timestamp: int64(i + 1),
+			Hash:      "sha256",
+			Content:   content,
+		}.Sign(author.Pair.Secret, nil)
+		r.NoError(err)
+		if i%2 == 1 {
+			unboxer[ref.Ref()] = cleartxt
+		}
+		msgs = append(msgs, raw)
+		prev = ref
+	}
+
+	// only the end of the feed is stored
+	r.NoError(vs.VerifyRange(author.Id, msgs[15:]))
+	r.Equal([]feedranges.Range{{From: 16, To: 20}}, partial.Ranges(author.Id))
+	r.NoError(<-asynctesting.ServeLog(ctx, "fill", rootLog, refresh, false))
+
+	fm := NewFeedManager(ctx, rootLog, userFeeds, unboxer, partial, testutils.NewRelativeTimeLogger(nil), nil, nil)
+
+	var args message.CreateHistArgs
+	args.ID = author.Id
+	args.Keys = true
+	args.Limit = -1
+	args.Private = true
+
+	// only the stored range, in order and decrypted
+	var buf bytes.Buffer
+	r.NoError(fm.CreateStreamHistory(ctx, muxrpc.NewTestSink(&buf), &args))
+	pkts := readAllPackets(&buf)
+	r.True(len(pkts) > 0)
+	var seqs []int64
+	for _, pkt := range pkts[:len(pkts)-1] {
+		var msg refs.KeyValueRaw
+		r.NoError(json.Unmarshal(pkt.Body, &msg))
+
+		var content struct {
+			I int64 `json:"i"`
+		}
+		r.NoError(json.Unmarshal(msg.Value.Content, &content), "not decrypted: %s", msg.Value.Content)
+		r.EqualValues(msg.Seq()-1, content.I)
+		seqs = append(seqs, msg.Seq())
+	}
+	r.Equal([]int64{16, 17, 18, 19, 20}, seqs)
+
+	// the live part couldn't be decrypted
+	args.Live = true
+	buf.Reset()
+	r.Error(fm.CreateStreamHistory(ctx, muxrpc.NewTestSink(&buf), &args))
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -18,9 +19,13 @@ import (
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/internal/neterr"
 	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/message/bendybutt"
 	refs "go.mindeco.de/ssb-refs"
 )
 
+// FetchAll requests the wanted feeds from the remote of e.
+// The scheduler limits how many are fetched at once and skips the ones in transit over other connections.
+// With live, some of the slots are used for live streams that keep running after FetchAll returned.
 func (h *LegacyGossip) FetchAll(
 	ctx context.Context,
 	e muxrpc.Endpoint,
@@ -32,44 +37,89 @@ func (h *LegacyGossip) FetchAll(
 		return err
 	}
 
-	// TODO: warning unbound parallellism ahead.
-	// since we don't have a way yet to handoff a feed
-	// all feeds will be stuck in the pool.
-	//
-	// this is very bad if you have a lot of them.
-	//
-	// ebt will make this better
-	// we need some kind of pull feed manager, similar to Blobs
-	// which we can ask for which feeds aren't in transit,
-	// due for a (probabilistic) update
-	// and manage live feeds more granularly across open connections
-
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	fetchGroup, ctx := errgroup.WithContext(ctx)
+	conn := h.scheduler.connect(e)
+
+	dist, _ := h.WantList.(FeedDistancer)
+	queue := h.scheduler.order(lst, dist)
+
+	var (
+		queueMu sync.Mutex
+		next    int
+	)
+	pop := func() (*refs.FeedRef, bool) {
+		queueMu.Lock()
+		defer queueMu.Unlock()
+		for next < len(queue) {
+			fr := queue[next]
+			next++
+			if h.scheduler.claim(conn, fr) {
+				return fr, true
+			}
+		}
+		return nil, false
+	}
 
-	for _, r := range lst {
-		fetchGroup.Go(h.workFeed(ctx, e, r, withLive))
+	fetchGroup, fetchCtx := errgroup.WithContext(ctx)
+	for i := 0; i < h.scheduler.maxPerConn; i++ {
+		fetchGroup.Go(func() error {
+			for {
+				// wait for a free slot, live streams hold theirs
+				select {
+				case conn.slots <- struct{}{}:
+				case <-fetchCtx.Done():
+					return fetchCtx.Err()
+				}
+
+				fr, ok := pop()
+				if !ok {
+					<-conn.slots
+					return nil
+				}
+
+				if withLive && h.scheduler.startLive(conn) {
+					// bound to the connection, not this round of fetching
+					go func() {
+						err := h.workFeed(ctx, e, conn, fr, true)
+						<-conn.slots
+						if err != nil {
+							level.Debug(h.Info).Log("event", "live stream ended", "err", err, "fr", fr.ShortRef())
+						}
+					}()
+					continue
+				}
+
+				err := h.workFeed(fetchCtx, e, conn, fr, false)
+				<-conn.slots
+				if err != nil {
+					return err
+				}
+			}
+		})
 	}
 
-	err = fetchGroup.Wait()
-	return err
+	return fetchGroup.Wait()
 }
 
-func (h *LegacyGossip) workFeed(ctx context.Context, edp muxrpc.Endpoint, ref *refs.FeedRef, withLive bool) func() error {
-	return func() error {
-		err := h.fetchFeed(ctx, ref, edp, time.Now(), withLive)
-		if muxrpc.IsSinkClosed(err) || errors.Is(err, context.Canceled) || errors.Is(err, muxrpc.ErrSessionTerminated) || neterr.IsConnBrokenErr(err) {
-			return err
-		} else if err != nil {
-			// just logging the error assuming forked feed for instance
-			level.Warn(h.Info).Log("event", "skipped updating of stored feed", "err", err, "fr", ref.ShortRef())
-		}
-
-		return nil
+// workFeed fetches one feed and tells the scheduler about it.
+// Only errors that end the connection are returned.
+func (h *LegacyGossip) workFeed(ctx context.Context, edp muxrpc.Endpoint, conn *fetchConn, ref *refs.FeedRef, withLive bool) error {
+	err := h.fetchFeed(ctx, ref, edp, time.Now(), withLive)
+	h.scheduler.done(conn, ref, withLive, err)
+	if muxrpc.IsSinkClosed(err) || errors.Is(err, context.Canceled) || errors.Is(err, muxrpc.ErrSessionTerminated) || neterr.IsConnBrokenErr(err) {
+		return err
+	} else if errors.Is(err, message.ErrQuarantined) {
+		level.Debug(h.Info).Log("event", "skipped quarantined feed", "fr", ref.ShortRef())
+	} else if err != nil {
+		// forks are recorded by the verify sink, the others are just logged
+		level.Warn(h.Info).Log("event", "skipped updating of stored feed", "err", err, "fr", ref.ShortRef())
 	}
+
+	return nil
 }
 
+// maxVerifyBatch is the most messages of a feed that are verified at once
+const maxVerifyBatch = 256
+
 // fetchFeed requests the feed fr from endpoint e into the repo of the handler
 func (h *LegacyGossip) fetchFeed(
 	ctx context.Context,
@@ -117,37 +167,78 @@ func (h *LegacyGossip) fetchFeed(
 	// level.Info(info).Log("starting", "fetch")
 	method := muxrpc.Method{"createHistoryStream"}
 
+	// also stops the reader below if verification fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var src *muxrpc.ByteSource
 	switch fr.Algo {
 	case refs.RefAlgoFeedSSB1:
 		src, err = edp.Source(ctx, muxrpc.TypeJSON, method, q)
-	case refs.RefAlgoFeedGabby:
+	case refs.RefAlgoFeedGabby, bendybutt.RefAlgoFeedBendyButt:
 		src, err = edp.Source(ctx, muxrpc.TypeBinary, method, q)
+	default:
+		return fmt.Errorf("fetchFeed(%s): unsupported feed format", fr.Ref())
 	}
 	if err != nil {
 		return fmt.Errorf("fetchFeed(%s:%d) failed to create source: %w", fr.Ref(), latestSeq, err)
 	}
 
-	var buf = &bytes.Buffer{}
-	for src.Next(ctx) {
+	// read ahead while the previous batch is verified
+	var (
+		msgs    = make(chan []byte, maxVerifyBatch)
+		readErr = make(chan error, 1)
+	)
+	go func() {
+		defer close(msgs)
+		for src.Next(ctx) {
+			var buf bytes.Buffer
+			err := src.Reader(func(r io.Reader) error {
+				_, err := buf.ReadFrom(r)
+				return err
+			})
+			if err != nil {
+				readErr <- err
+				return
+			}
 
-		err = src.Reader(func(r io.Reader) error {
-			_, err = buf.ReadFrom(r)
-			return err
-		})
-		if err != nil {
-			return err
+			select {
+			case msgs <- buf.Bytes():
+			case <-ctx.Done():
+				readErr <- ctx.Err()
+				return
+			}
+		}
+		readErr <- src.Err()
+	}()
+
+	// verify everything that arrived so far as one batch, without waiting for more.
+	// this keeps live streams responsive and makes big batches during the initial sync.
+	batch := make([][]byte, 0, maxVerifyBatch)
+	for msg := range msgs {
+		batch = append(batch[:0], msg)
+	collect:
+		for len(batch) < maxVerifyBatch {
+			select {
+			case msg, more := <-msgs:
+				if !more {
+					break collect
+				}
+				batch = append(batch, msg)
+			default:
+				break collect
+			}
 		}
 
-		err = snk.Verify(buf.Bytes())
+		// a failed batch might have stored the messages before the broken one
+		err = message.VerifyBatch(snk, batch)
+		latestSeq = int(snk.Seq())
 		if err != nil {
 			return err
 		}
-		buf.Reset()
-		latestSeq++
 	}
 
-	if err := src.Err(); err != nil {
+	if err := <-readErr; err != nil {
 		return fmt.Errorf("gossip pump failed: %w", err)
 	}
 
@@ -52,6 +52,8 @@ type LegacyGossip struct {
 	activeLock  *sync.Mutex
 	activeFetch map[string]struct{}
 
+	scheduler *fetchScheduler
+
 	sysGauge metrics.Gauge
 	sysCtr   metrics.Counter
 
@@ -99,6 +101,10 @@ func (g *LegacyGossip) StartLegacyFetching(ctx context.Context, e muxrpc.Endpoin
 		}
 	}
 
+	// hand the feeds of this connection over to the others once it's done
+	conn := g.scheduler.connect(e)
+	defer g.scheduler.disconnect(conn)
+
 	feeds := g.WantList.ReplicationList()
 	//level.Debug(info).Log("msg", "hops count", "count", feeds.Count())
 	err = g.FetchAll(ctx, e, feeds, withLive)
@@ -107,23 +113,25 @@ func (g *LegacyGossip) StartLegacyFetching(ctx context.Context, e muxrpc.Endpoin
 		return
 	}
 
-	if !g.enableLiveStreaming {
-		// start polling
-		tick := time.NewTicker(5 * time.Minute)
+	// start polling, also with live since not every feed gets a live stream.
+	// feeds that are handed over from a dropped connection are picked up right away.
+	tick := time.NewTicker(5 * time.Minute)
+	defer tick.Stop()
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
+	for {
+		select {
+		case <-ctx.Done():
+			return
 
-			case <-tick.C:
-				feeds := g.WantList.ReplicationList()
-				err = g.FetchAll(ctx, e, feeds, withLive)
-				if err != nil && !muxrpc.IsSinkClosed(err) {
-					level.Warn(info).Log("msg", "hops failed", "err", err)
-					return
-				}
-			}
+		case <-tick.C:
+		case <-conn.wake:
+		}
+
+		feeds := g.WantList.ReplicationList()
+		err = g.FetchAll(ctx, e, feeds, withLive)
+		if err != nil && !muxrpc.IsSinkClosed(err) {
+			level.Warn(info).Log("msg", "hops failed", "err", err)
+			return
 		}
 	}
 }
@@ -185,6 +193,13 @@ func (g *LegacyGossip) HandleCall(
 			return
 		}
 
+		if query.Private {
+			if err := ssb.AuthorizePrivate(req, ssb.OnlySelf(g.Id)); err != nil {
+				closeIfErr(fmt.Errorf("createHistoryStream: %w", err))
+				return
+			}
+		}
+
 		hlog = log.With(hlog, "fr", query.ID.ShortRef(), "remote", remote.ShortRef())
 		// dbgLog = level.Warn(hlog)
 
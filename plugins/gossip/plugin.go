@@ -57,6 +57,7 @@ func NewFetcher(
 
 		enableLiveStreaming: true,
 	}
+	maxFetches := defaultMaxConcurrentFetches
 
 	for i, o := range opts {
 		switch v := o.(type) {
@@ -70,10 +71,13 @@ func NewFetcher(
 			h.promisc = bool(v)
 		case WithLive:
 			h.enableLiveStreaming = bool(v)
+		case MaxConcurrentFetches:
+			maxFetches = int(v)
 		default:
 			level.Warn(log).Log("event", "unhandled gossip option", "i", i, "type", fmt.Sprintf("%T", o))
 		}
 	}
+	h.scheduler = newFetchScheduler(maxFetches, fetchRefreshInterval)
 
 	return &plugin{h}
 }
@@ -113,10 +117,13 @@ func NewServer(
 			h.hmacSec = v
 		case WithLive:
 			// no consequence - the outgoing live code is fine
+		case MaxConcurrentFetches:
+			// only used for fetching
 		default:
 			level.Warn(log).Log("event", "unhandled gossip option", "i", i, "type", fmt.Sprintf("%T", o))
 		}
 	}
+	h.scheduler = newFetchScheduler(defaultMaxConcurrentFetches, fetchRefreshInterval)
 
 	return histPlugin{h}
 }
@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: MIT
+
+package gossip
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// MaxConcurrentFetches sets how many createHistoryStream calls legacy gossip makes at once on each connection.
+// Half of them can be used for live streams.
+type MaxConcurrentFetches int
+
+const defaultMaxConcurrentFetches = 16
+
+// fetchRefreshInterval is how long a feed isn't requested again from the same peer.
+// It's shorter than the polling interval, so that every poll asks again.
+const fetchRefreshInterval = time.Minute
+
+// FeedDistancer is implemented by replication listers that know how many hops away a wanted feed is.
+// It's used to fetch the closer feeds first.
+type FeedDistancer interface {
+	FeedDistance(*refs.FeedRef) (int, bool)
+}
+
+// fetchScheduler decides which feeds are fetched over which connection.
+// Each feed is only requested over one connection at a time,
+// the closest and then the longest not fetched feeds go first
+// and the feeds of a dropped connection are handed over to the others.
+// Connections are told apart by their endpoint, there can be more than one to the same peer.
+type fetchScheduler struct {
+	maxPerConn int
+
+	// refresh is how long a feed fetched from a peer isn't asked for again on that connection
+	refresh time.Duration
+
+	mu        sync.Mutex
+	inTransit map[string]*fetchConn // feed -> connection it's fetched over
+	lastFetch map[string]time.Time  // feed -> last time it was fetched from anyone
+	conns     map[muxrpc.Endpoint]*fetchConn
+}
+
+// fetchConn is the state of one connection
+type fetchConn struct {
+	edp muxrpc.Endpoint
+
+	// slots limits the concurrent fetches, live streams hold theirs until they end
+	slots chan struct{}
+	live  int
+
+	// fetched is the last time each feed was fetched over this connection
+	fetched map[string]time.Time
+
+	// wake gets a signal when feeds are handed over from a dropped connection
+	wake chan struct{}
+}
+
+func newFetchScheduler(maxPerConn int, refresh time.Duration) *fetchScheduler {
+	if maxPerConn < 1 {
+		maxPerConn = 1
+	}
+	return &fetchScheduler{
+		maxPerConn: maxPerConn,
+		refresh:    refresh,
+
+		inTransit: make(map[string]*fetchConn),
+		lastFetch: make(map[string]time.Time),
+		conns:     make(map[muxrpc.Endpoint]*fetchConn),
+	}
+}
+
+// connect returns the state of the connection edp, creating it if needed
+func (fs *fetchScheduler) connect(edp muxrpc.Endpoint) *fetchConn {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if c, has := fs.conns[edp]; has {
+		return c
+	}
+	c := &fetchConn{
+		edp:     edp,
+		slots:   make(chan struct{}, fs.maxPerConn),
+		fetched: make(map[string]time.Time),
+		wake:    make(chan struct{}, 1),
+	}
+	fs.conns[edp] = c
+	return c
+}
+
+// disconnect forgets the connection c and hands the feeds that were in transit over it to the other connections.
+// Other connections to the same peer keep their feeds.
+func (fs *fetchScheduler) disconnect(c *fetchConn) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.conns[c.edp] == c {
+		delete(fs.conns, c.edp)
+	}
+
+	var released int
+	for feed, over := range fs.inTransit {
+		if over == c {
+			delete(fs.inTransit, feed)
+			released++
+		}
+	}
+	if released == 0 {
+		return
+	}
+
+	for _, c := range fs.conns {
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// order sorts the wanted feeds by their priority: the closest first and then the ones that weren't fetched for the longest time.
+// dist can be nil, feeds with an unknown distance go after the known ones.
+func (fs *fetchScheduler) order(wants []*refs.FeedRef, dist FeedDistancer) []*refs.FeedRef {
+	type prio struct {
+		ref  *refs.FeedRef
+		hops int
+		last time.Time
+	}
+
+	fs.mu.Lock()
+	lst := make([]prio, len(wants))
+	for i, fr := range wants {
+		hops := math.MaxInt32
+		if dist != nil {
+			if d, ok := dist.FeedDistance(fr); ok {
+				hops = d
+			}
+		}
+		lst[i] = prio{fr, hops, fs.lastFetch[fr.Ref()]}
+	}
+	fs.mu.Unlock()
+
+	sort.SliceStable(lst, func(i, j int) bool {
+		if lst[i].hops != lst[j].hops {
+			return lst[i].hops < lst[j].hops
+		}
+		return lst[i].last.Before(lst[j].last)
+	})
+
+	sorted := make([]*refs.FeedRef, len(lst))
+	for i, p := range lst {
+		sorted[i] = p.ref
+	}
+	return sorted
+}
+
+// claim marks feed as in transit over c, if it isn't fetched already and wasn't fetched over c recently
+func (fs *fetchScheduler) claim(c *fetchConn, feed *refs.FeedRef) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, busy := fs.inTransit[feed.Ref()]; busy {
+		return false
+	}
+	if last, has := c.fetched[feed.Ref()]; has && time.Since(last) < fs.refresh {
+		return false
+	}
+	fs.inTransit[feed.Ref()] = c
+	return true
+}
+
+// startLive reports if one more live stream fits on c and counts it if so.
+// Up to half of the slots (but at least one) can be taken by live streams.
+func (fs *fetchScheduler) startLive(c *fetchConn) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	maxLive := fs.maxPerConn / 2
+	if maxLive < 1 {
+		maxLive = 1
+	}
+	if c.live >= maxLive {
+		return false
+	}
+	c.live++
+	return true
+}
+
+// done releases feed after a fetch over c ended.
+// Only successful fetches count as fetched, failed ones are due again.
+func (fs *fetchScheduler) done(c *fetchConn, feed *refs.FeedRef, live bool, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if live {
+		c.live--
+	}
+
+	// it might have been handed over already
+	if fs.inTransit[feed.Ref()] == c {
+		delete(fs.inTransit, feed.Ref())
+	}
+
+	if err == nil {
+		now := time.Now()
+		fs.lastFetch[feed.Ref()] = now
+		c.fetched[feed.Ref()] = now
+	}
+}
+
+// transitCount returns the number of feeds that are currently fetched over c
+func (fs *fetchScheduler) transitCount(c *fetchConn) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var n int
+	for _, over := range fs.inTransit {
+		if over == c {
+			n++
+		}
+	}
+	return n
+}
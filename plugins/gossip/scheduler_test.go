@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: MIT
+
+package gossip
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+type testDistances map[string]int
+
+func (td testDistances) FeedDistance(ref *refs.FeedRef) (int, bool) {
+	d, has := td[ref.Ref()]
+	return d, has
+}
+
+// testEndpoint is a connection, the scheduler only uses it to tell them apart
+type testEndpoint struct {
+	muxrpc.Endpoint
+	name string
+}
+
+func testConn(name string) muxrpc.Endpoint {
+	return &testEndpoint{name: name}
+}
+
+func testFeed(name string) *refs.FeedRef {
+	h := sha256.Sum256([]byte(name))
+	return &refs.FeedRef{ID: h[:], Algo: refs.RefAlgoFeedSSB1}
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	r := require.New(t)
+
+	fs := newFetchScheduler(4, time.Minute)
+
+	var (
+		self    = testFeed("self")
+		friend  = testFeed("friend")
+		foaf    = testFeed("foaf")
+		stale   = testFeed("stale foaf")
+		unknown = testFeed("manually added")
+	)
+	dist := testDistances{
+		self.Ref():   0,
+		friend.Ref(): 1,
+		foaf.Ref():   2,
+		stale.Ref():  2,
+	}
+
+	// foaf was fetched just now, so the other one on the same hop goes first
+	peer := fs.connect(testConn("peer"))
+	r.True(fs.claim(peer, foaf))
+	fs.done(peer, foaf, false, nil)
+
+	got := fs.order([]*refs.FeedRef{unknown, foaf, stale, friend, self}, dist)
+	r.Equal([]string{self.Ref(), friend.Ref(), stale.Ref(), foaf.Ref(), unknown.Ref()}, refStrings(got))
+
+	// without distances just the staleness counts
+	got = fs.order([]*refs.FeedRef{foaf, stale}, nil)
+	r.Equal([]string{stale.Ref(), foaf.Ref()}, refStrings(got))
+}
+
+func TestSchedulerClaim(t *testing.T) {
+	r := require.New(t)
+
+	fs := newFetchScheduler(4, time.Minute)
+
+	feed := testFeed("feed")
+	peerA := fs.connect(testConn("a"))
+	peerB := fs.connect(testConn("b"))
+
+	r.True(fs.claim(peerA, feed))
+	r.False(fs.claim(peerB, feed), "in transit from a")
+
+	// failed fetches are due again right away
+	fs.done(peerA, feed, false, errors.New("broken"))
+	r.True(fs.claim(peerA, feed))
+
+	// successful ones only from other peers
+	fs.done(peerA, feed, false, nil)
+	r.False(fs.claim(peerA, feed), "just fetched from a")
+	r.True(fs.claim(peerB, feed))
+	fs.done(peerB, feed, false, nil)
+
+	// after the refresh interval it's due again
+	short := newFetchScheduler(4, time.Millisecond)
+	peer := short.connect(testConn("a"))
+	r.True(short.claim(peer, feed))
+	short.done(peer, feed, false, nil)
+	time.Sleep(2 * time.Millisecond)
+	r.True(short.claim(peer, feed))
+}
+
+func TestSchedulerLiveSlots(t *testing.T) {
+	r := require.New(t)
+
+	fs := newFetchScheduler(4, time.Minute)
+	peer := fs.connect(testConn("peer"))
+
+	// half of the slots can be live
+	r.True(fs.startLive(peer))
+	r.True(fs.startLive(peer))
+	r.False(fs.startLive(peer))
+
+	feed := testFeed("feed")
+	r.True(fs.claim(peer, feed))
+	fs.done(peer, feed, true, nil)
+	r.True(fs.startLive(peer))
+
+	// a single slot can still be live
+	single := newFetchScheduler(1, time.Minute)
+	only := single.connect(testConn("only"))
+	r.True(single.startLive(only))
+	r.False(single.startLive(only))
+}
+
+func TestSchedulerHandover(t *testing.T) {
+	r := require.New(t)
+
+	fs := newFetchScheduler(4, time.Minute)
+
+	edpA := testConn("a")
+	peerA := fs.connect(edpA)
+	peerB := fs.connect(testConn("b"))
+	r.True(peerA == fs.connect(edpA), "same state for the same connection")
+
+	var feeds []*refs.FeedRef
+	for i := 0; i < 3; i++ {
+		f := testFeed(fmt.Sprint("feed", i))
+		feeds = append(feeds, f)
+		r.True(fs.claim(peerA, f))
+	}
+	r.Equal(3, fs.transitCount(peerA))
+	r.False(fs.claim(peerB, feeds[0]))
+
+	fs.disconnect(peerA)
+	r.Equal(0, fs.transitCount(peerA))
+
+	select {
+	case <-peerB.wake:
+	default:
+		t.Fatal("expected b to be woken up")
+	}
+	for _, f := range feeds {
+		r.True(fs.claim(peerB, f))
+	}
+	r.Equal(3, fs.transitCount(peerB))
+
+	// the late end of a fetch on the dropped connection doesn't release them
+	fs.done(peerA, feeds[0], false, nil)
+	r.Equal(3, fs.transitCount(peerB))
+
+	// nothing in transit, nobody to wake
+	fs.disconnect(fs.connect(testConn("c")))
+	select {
+	case <-peerB.wake:
+		t.Fatal("unexpected wake up")
+	default:
+	}
+}
+
+func TestSchedulerSamePeerTwice(t *testing.T) {
+	r := require.New(t)
+
+	fs := newFetchScheduler(4, time.Minute)
+
+	// two connections to the same peer, like an inbound and an outbound one
+	first := fs.connect(testConn("peer"))
+	second := fs.connect(testConn("peer"))
+	r.False(first == second, "separate state per connection")
+
+	feedA, feedB := testFeed("a"), testFeed("b")
+	r.True(fs.claim(first, feedA))
+	r.True(fs.claim(second, feedB))
+
+	// closing one keeps the claims of the other
+	fs.disconnect(first)
+	r.Equal(1, fs.transitCount(second))
+	r.False(fs.claim(second, feedB), "still in transit")
+	r.True(fs.claim(second, feedA), "handed over")
+
+	// and the late end of its fetch doesn't release them either
+	fs.done(first, feedB, false, nil)
+	r.Equal(2, fs.transitCount(second))
+}
+
+func refStrings(lst []*refs.FeedRef) []string {
+	strs := make([]string, len(lst))
+	for i, r := range lst {
+		strs[i] = r.Ref()
+	}
+	return strs
+}
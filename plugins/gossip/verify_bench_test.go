@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: MIT
+
+package gossip
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+type benchFeed struct {
+	ref  *refs.FeedRef
+	msgs [][]byte
+}
+
+// loadLargeRepo returns the signed messages of testdata/largeRepo, grouped by feed and in order
+func loadLargeRepo(b *testing.B) []benchFeed {
+	// offset2 might touch the files, so work on a copy
+	tRepoPath := filepath.Join("testrun", b.Name())
+	os.RemoveAll(tRepoPath)
+	os.MkdirAll(filepath.Dir(tRepoPath), 0700)
+	out, err := exec.Command("cp", "-r", "testdata/largeRepo", tRepoPath).CombinedOutput()
+	if err != nil {
+		b.Fatalf("failed to copy repo: %s: %s", err, out)
+	}
+
+	rl, err := repo.OpenLog(repo.New(tRepoPath))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	src, err := rl.Query()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var (
+		ctx    = context.TODO()
+		byFeed = make(map[string][]refs.Message)
+		feeds  = make(map[string]*refs.FeedRef)
+	)
+	for {
+		v, err := src.Next(ctx)
+		if luigi.IsEOS(err) {
+			break
+		} else if err != nil {
+			b.Fatal(err)
+		}
+
+		if nulled, ok := v.(error); ok && margaret.IsErrNulled(nulled) {
+			continue
+		}
+		msg, ok := v.(refs.Message)
+		if !ok {
+			b.Fatalf("unexpected value: %T", v)
+		}
+		author := msg.Author()
+		byFeed[author.Ref()] = append(byFeed[author.Ref()], msg)
+		feeds[author.Ref()] = author
+	}
+
+	var lst []benchFeed
+	for ref, msgs := range byFeed {
+		sort.Slice(msgs, func(i, j int) bool { return msgs[i].Seq() < msgs[j].Seq() })
+		bf := benchFeed{ref: feeds[ref]}
+		for _, msg := range msgs {
+			bf.msgs = append(bf.msgs, msg.ValueContentJSON())
+		}
+		lst = append(lst, bf)
+	}
+	if len(lst) == 0 {
+		b.Fatal("no messages in test repo")
+	}
+	return lst
+}
+
+type countingSaver struct{ n int }
+
+func (cs *countingSaver) Save(refs.Message) error {
+	cs.n++
+	return nil
+}
+
+func countMsgs(feeds []benchFeed) int {
+	var n int
+	for _, f := range feeds {
+		n += len(f.msgs)
+	}
+	return n
+}
+
+func BenchmarkVerifySingle(b *testing.B) {
+	feeds := loadLargeRepo(b)
+	total := countMsgs(feeds)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var saved countingSaver
+		for _, f := range feeds {
+			snk := message.NewVerifySink(f.ref, margaret.BaseSeq(0), nil, &saved, nil)
+			for _, msg := range f.msgs {
+				if err := snk.Verify(msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		if saved.n != total {
+			b.Fatalf("expected %d messages, saved %d", total, saved.n)
+		}
+	}
+}
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	feeds := loadLargeRepo(b)
+	total := countMsgs(feeds)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var saved countingSaver
+		for _, f := range feeds {
+			snk := message.NewVerifySink(f.ref, margaret.BaseSeq(0), nil, &saved, nil)
+			for start := 0; start < len(f.msgs); start += maxVerifyBatch {
+				end := start + maxVerifyBatch
+				if end > len(f.msgs) {
+					end = len(f.msgs)
+				}
+				if err := message.VerifyBatch(snk, f.msgs[start:end]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		if saved.n != total {
+			b.Fatalf("expected %d messages, saved %d", total, saved.n)
+		}
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"sync"
 
 	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/muxrpc/v2"
 	refs "go.mindeco.de/ssb-refs"
@@ -18,6 +20,7 @@ import (
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/internal/storedrefs"
 	"go.cryptoscope.co/ssb/invite"
+	"go.cryptoscope.co/ssb/network/msaddr"
 	"go.cryptoscope.co/ssb/repo"
 )
 
@@ -160,12 +163,36 @@ func (s Service) Create(uses uint, note string) (*invite.Token, error) {
 	}
 
 	inv.Peer = *s.self
-	// TODO: external host configuration?
-	inv.Address = s.network.GetListenAddr()
+	inv.Address = s.inviteAddress()
+	if inv.Address == nil {
+		s.kv.Rollback()
+		return nil, fmt.Errorf("invite/create: no advertised listener to use as invite address")
+	}
 
 	return &inv, s.kv.Commit()
 }
 
+// inviteAddress returns the address of the first advertised tcp listener.
+// It uses the multiserver address of the listener, which has the external host if one is configured.
+func (s *Service) inviteAddress() net.Addr {
+	for _, la := range s.network.GetListenAddrs() {
+		if !la.Advertise {
+			continue
+		}
+		ma, err := msaddr.Parse(la.Multiserver)
+		if err != nil || ma.Transport != msaddr.TransportNet {
+			continue // legacy invites only have room for host:port
+		}
+		addr, err := ma.WrappedAddr()
+		if err != nil {
+			level.Warn(s.logger).Log("event", "invite address not resolvable", "addr", la.Multiserver, "err", err)
+			continue
+		}
+		return addr
+	}
+	return nil
+}
+
 type inviteState struct {
 	CreateArguments
 
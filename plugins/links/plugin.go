@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: MIT
+
+// Package links supplies the links and backlinks.read sources, which return the messages that mention a feed, message or blob ref anywhere in their content.
+package links
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/transform"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/query"
+)
+
+type Plugin struct {
+	name   string
+	method muxrpc.Method
+	h      muxrpc.Handler
+}
+
+// NewPlugin returns the links source, which sends one message.LinkReply per message that links to dest, in receive order.
+func NewPlugin(logger log.Logger, planner *query.Planner, isSelf ssb.Authorizer) *Plugin {
+	mux := typemux.New(logger)
+
+	mux.RegisterSource(muxrpc.Method{"links"}, linksHandler{
+		planner: planner,
+		isSelf:  isSelf,
+	})
+
+	return &Plugin{
+		name:   "links",
+		method: muxrpc.Method{"links"},
+		h:      &mux,
+	}
+}
+
+// NewBacklinksPlugin returns backlinks.read, which sends the full messages that link to dest, sorted by their claimed timestamp.
+func NewBacklinksPlugin(logger log.Logger, planner *query.Planner, isSelf ssb.Authorizer) *Plugin {
+	mux := typemux.New(logger)
+
+	mux.RegisterSource(muxrpc.Method{"backlinks", "read"}, backlinksHandler{
+		planner: planner,
+		isSelf:  isSelf,
+	})
+
+	return &Plugin{
+		name:   "backlinks",
+		method: muxrpc.Method{"backlinks"},
+		h:      &mux,
+	}
+}
+
+func (p Plugin) Name() string            { return p.name }
+func (p Plugin) Method() muxrpc.Method   { return p.method }
+func (p Plugin) Handler() muxrpc.Handler { return p.h }
+
+type linksHandler struct {
+	planner *query.Planner
+
+	isSelf ssb.Authorizer
+}
+
+func (h linksHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
+	var args []message.LinksArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return fmt.Errorf("links: bad request data: %w", err)
+	}
+	if n := len(args); n != 1 {
+		return fmt.Errorf("links: expected one argument but got %d", n)
+	}
+	qry := args[0]
+
+	dest, err := parseDest(qry.Dest)
+	if err != nil {
+		return fmt.Errorf("links: %w", err)
+	}
+
+	if qry.Private {
+		if err := ssb.AuthorizePrivate(req, h.isSelf); err != nil {
+			return fmt.Errorf("links: %w", err)
+		}
+	}
+
+	spec := query.Spec{
+		Links:   []string{dest},
+		Type:    qry.Type,
+		Private: qry.Private,
+
+		Order:   query.OrderSeq,
+		Reverse: qry.Reverse,
+		Limit:   qry.Limit,
+		Live:    qry.Live,
+	}
+	if qry.Source != nil {
+		spec.Authors = []*refs.FeedRef{qry.Source}
+	}
+
+	snk.SetEncoding(muxrpc.TypeJSON)
+
+	err = h.planner.Iterate(ctx, spec, func(ctx context.Context, res query.Result) error {
+		var reply message.LinkReply
+		reply.Key = res.Message.Key()
+		reply.Source = res.Message.Author()
+		reply.Dest = dest
+		if qry.Values {
+			reply.Value = res.Message.ValueContent()
+		}
+
+		b, err := json.Marshal(reply)
+		if err != nil {
+			return fmt.Errorf("failed to encode reply: %w", err)
+		}
+		_, err = snk.Write(b)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("links: query failed: %w", err)
+	}
+	return snk.Close()
+}
+
+type backlinksHandler struct {
+	planner *query.Planner
+
+	isSelf ssb.Authorizer
+}
+
+func (h backlinksHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
+	var args []message.BacklinksArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return fmt.Errorf("backlinks: bad request data: %w", err)
+	}
+	if n := len(args); n != 1 {
+		return fmt.Errorf("backlinks: expected one argument but got %d", n)
+	}
+	qry := args[0]
+
+	dest, err := parseDest(qry.Dest)
+	if err != nil {
+		return fmt.Errorf("backlinks: %w", err)
+	}
+
+	if qry.Private {
+		if err := ssb.AuthorizePrivate(req, h.isSelf); err != nil {
+			return fmt.Errorf("backlinks: %w", err)
+		}
+	}
+
+	lsnk := transform.NewKeyValueWrapper(snk, qry.Keys)
+
+	err = h.planner.Run(ctx, lsnk, query.Spec{
+		Links:   []string{dest},
+		Authors: qry.Authors,
+		Type:    qry.Type,
+		Private: qry.Private,
+
+		Order:   query.OrderClaimed,
+		Gt:      query.ArgBound(qry.Gt),
+		Lt:      query.ArgBound(qry.Lt),
+		Reverse: qry.Reverse,
+		Limit:   qry.Limit,
+		Live:    qry.Live,
+	})
+	if err != nil {
+		return fmt.Errorf("backlinks: query failed: %w", err)
+	}
+	return lsnk.Close()
+}
+
+// parseDest checks the ref and brings it into the form the links index uses
+func parseDest(dest string) (string, error) {
+	if dest == "" {
+		return "", fmt.Errorf("missing dest")
+	}
+	ref, err := refs.ParseRef(dest)
+	if err != nil {
+		return "", fmt.Errorf("invalid dest %q: %w", dest, err)
+	}
+	return ref.Ref(), nil
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: MIT
+
+// Package metafeeds offers muxrpc calls to look at the subfeeds of metafeeds.
+package metafeeds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cryptix/go/logging"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/metafeeds"
+)
+
+// TreeBuilder is implemented by metafeeds.Index
+type TreeBuilder interface {
+	Tree(*refs.FeedRef) (metafeeds.Node, error)
+}
+
+type Plugin struct {
+	h muxrpc.Handler
+}
+
+var _ ssb.Plugin = (*Plugin)(nil)
+
+// NewPlugin returns the metafeeds plugin. Without an argument, tree returns the tree of self.
+func NewPlugin(log logging.Interface, self *refs.FeedRef, trees TreeBuilder) *Plugin {
+	mux := typemux.New(log)
+
+	h := handler{self: self, trees: trees}
+	mux.RegisterAsync(muxrpc.Method{"metafeeds", "tree"}, typemux.AsyncFunc(h.tree))
+
+	return &Plugin{
+		h: &mux,
+	}
+}
+
+func (lt Plugin) Name() string            { return "metafeeds" }
+func (Plugin) Method() muxrpc.Method      { return muxrpc.Method{"metafeeds"} }
+func (lt Plugin) Handler() muxrpc.Handler { return lt.h }
+
+type handler struct {
+	self  *refs.FeedRef
+	trees TreeBuilder
+}
+
+// tree returns the subfeeds of the metafeed that is passed as the only argument
+func (h handler) tree(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	var args []*refs.FeedRef
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return nil, fmt.Errorf("metafeeds.tree: bad arguments: %w", err)
+	}
+
+	root := h.self
+	switch n := len(args); {
+	case n == 1 && args[0] != nil:
+		root = args[0]
+	case n > 1:
+		return nil, fmt.Errorf("metafeeds.tree: expected one feed but got %d arguments", n)
+	}
+
+	return h.trees.Tree(root)
+}
@@ -9,6 +9,7 @@ import (
 	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/muxrpc/v2"
 
+	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/message"
 	"go.cryptoscope.co/ssb/plugins/gossip"
 )
@@ -16,7 +17,8 @@ import (
 //  https://ssbc.github.io/scuttlebutt-protocol-guide/#createHistoryStream
 
 type getFeedHandler struct {
-	fm *gossip.FeedManager
+	fm     *gossip.FeedManager
+	isSelf ssb.Authorizer
 }
 
 func (h getFeedHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
@@ -40,6 +42,12 @@ func (h getFeedHandler) HandleSource(ctx context.Context, req *muxrpc.Request, s
 		query.Limit = -1
 	}
 
+	if query.Private {
+		if err := ssb.AuthorizePrivate(req, h.isSelf); err != nil {
+			return fmt.Errorf("partial/feed: %w", err)
+		}
+	}
+
 	fmt.Printf("partial/feed (forward): %s:%d\n", query.ID.Ref(), query.Seq)
 	// fmt.Printf("partial/feed: full query %+v\n", query)
 	fmt.Println(string(args[0]))
@@ -58,7 +66,8 @@ func (h getFeedHandler) HandleSource(ctx context.Context, req *muxrpc.Request, s
 }
 
 type getFeedReverseHandler struct {
-	fm *gossip.FeedManager
+	fm     *gossip.FeedManager
+	isSelf ssb.Authorizer
 }
 
 func (h getFeedReverseHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
@@ -81,6 +90,12 @@ func (h getFeedReverseHandler) HandleSource(ctx context.Context, req *muxrpc.Req
 	if query.Limit == 0 { // stupid unset default
 		query.Limit = -1
 	}
+
+	if query.Private {
+		if err := ssb.AuthorizePrivate(req, h.isSelf); err != nil {
+			return fmt.Errorf("partial/feed: %w", err)
+		}
+	}
 	query.Reverse = true
 
 	fmt.Printf("partial/feed (reverse): %s:%d\n", query.ID.Ref(), query.Seq)
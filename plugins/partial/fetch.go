@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: MIT
+
+package partial
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/message"
+)
+
+// RangeVerifier stores messages of a feed without the ones that come before them, see message.VerifySink.
+// VerifyRange takes consecutive messages, VerifyMessages any of them.
+type RangeVerifier interface {
+	VerifyRange(*refs.FeedRef, [][]byte) error
+	VerifyMessages(*refs.FeedRef, [][]byte) error
+}
+
+// FetchLatest asks the peer behind edp for the latest n messages of feed, with getFeedReverse, and stores them as a partial feed.
+// It returns how many messages were received.
+func FetchLatest(ctx context.Context, edp muxrpc.Endpoint, rv RangeVerifier, feed *refs.FeedRef, n int64) (int, error) {
+	msgs, err := fetchLatest(ctx, edp, rv, feed, n)
+	return len(msgs), err
+}
+
+// fetchLatest is FetchLatest but returns the stored messages
+func fetchLatest(ctx context.Context, edp muxrpc.Endpoint, rv RangeVerifier, feed *refs.FeedRef, n int64) ([][]byte, error) {
+	var q = message.CreateHistArgs{
+		ID:         feed,
+		StreamArgs: message.StreamArgs{Limit: n},
+	}
+
+	enc := muxrpc.TypeJSON
+	if feed.Algo == refs.RefAlgoFeedGabby {
+		enc = muxrpc.TypeBinary
+	}
+
+	src, err := edp.Source(ctx, enc, muxrpc.Method{name, "getFeedReverse"}, q)
+	if err != nil {
+		return nil, fmt.Errorf("partial(%s): failed to create source: %w", feed.ShortRef(), err)
+	}
+
+	msgs, err := readAll(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("partial(%s): failed to fetch: %w", feed.ShortRef(), err)
+	}
+
+	// newest first
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+
+	if err := rv.VerifyRange(feed, msgs); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// fetchSeqs asks the peer behind edp for the messages of feed with the sequences, with getFeed.
+// Each run of consecutive sequences is one request. The messages aren't stored.
+func fetchSeqs(ctx context.Context, edp muxrpc.Endpoint, feed *refs.FeedRef, seqs []int64) ([][]byte, error) {
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	var msgs [][]byte
+	for start := 0; start < len(seqs); {
+		end := start + 1
+		for end < len(seqs) && seqs[end] == seqs[end-1]+1 {
+			end++
+		}
+
+		var q = message.CreateHistArgs{
+			ID:         feed,
+			Seq:        seqs[start],
+			StreamArgs: message.StreamArgs{Limit: int64(end - start)},
+		}
+		src, err := edp.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{name, "getFeed"}, q)
+		if err != nil {
+			return nil, fmt.Errorf("partial(%s): failed to create source: %w", feed.ShortRef(), err)
+		}
+		run, err := readAll(ctx, src)
+		if err != nil {
+			return nil, fmt.Errorf("partial(%s): failed to fetch %d-%d: %w", feed.ShortRef(), seqs[start], seqs[end-1], err)
+		}
+		msgs = append(msgs, run...)
+		start = end
+	}
+	return msgs, nil
+}
+
+// FetchOfType asks the peer behind edp for the messages of feed with the type, with getMessagesOfType.
+// The ones with a sequence that want accepts are stored together, so that feed becomes partial.
+// Only classic feeds are supported. It returns how many messages were stored.
+func FetchOfType(ctx context.Context, edp muxrpc.Endpoint, rv RangeVerifier, feed *refs.FeedRef, tipe string, want func(seq int64) bool) (int, error) {
+	msgs, err := fetchOfType(ctx, edp, rv, feed, tipe, want)
+	return len(msgs), err
+}
+
+// classicMessage has the fields of a classic message that are needed to pick the ones to store
+type classicMessage struct {
+	Sequence int64           `json:"sequence"`
+	Content  json.RawMessage `json:"content"`
+}
+
+// fetchOfType is FetchOfType but returns the stored messages
+func fetchOfType(ctx context.Context, edp muxrpc.Endpoint, rv RangeVerifier, feed *refs.FeedRef, tipe string, want func(seq int64) bool) ([][]byte, error) {
+	if feed.Algo != refs.RefAlgoFeedSSB1 {
+		return nil, fmt.Errorf("partial(%s): fetching by type is only supported for classic feeds", feed.ShortRef())
+	}
+
+	var arg = struct {
+		ID   *refs.FeedRef `json:"id"`
+		Type string        `json:"type"`
+	}{feed, tipe}
+	src, err := edp.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{name, "getMessagesOfType"}, arg)
+	if err != nil {
+		return nil, fmt.Errorf("partial(%s): failed to create source: %w", feed.ShortRef(), err)
+	}
+
+	msgs, err := readAll(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("partial(%s): failed to fetch: %w", feed.ShortRef(), err)
+	}
+
+	var selected [][]byte
+	for _, raw := range msgs {
+		var msg classicMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, fmt.Errorf("partial(%s): invalid message: %w", feed.ShortRef(), err)
+		}
+		if want(msg.Sequence) {
+			selected = append(selected, raw)
+		}
+	}
+
+	if err := rv.VerifyMessages(feed, selected); err != nil {
+		return nil, err
+	}
+	return selected, nil
+}
+
+// readAll returns the messages of src
+func readAll(ctx context.Context, src *muxrpc.ByteSource) ([][]byte, error) {
+	var msgs [][]byte
+	for src.Next(ctx) {
+		var buf bytes.Buffer
+		err := src.Reader(func(r io.Reader) error {
+			_, err := buf.ReadFrom(r)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message: %w", err)
+		}
+		msgs = append(msgs, buf.Bytes())
+	}
+	if err := src.Err(); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
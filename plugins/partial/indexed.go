@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: MIT
+
+package partial
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/metafeeds"
+)
+
+// FetchIndexed fetches the messages of author with the type through its index feeds, from the peer behind edp.
+// The announcements of the index feeds and the latest n entries of each are fetched first, then the messages they point at by their sequence, with getFeed.
+// Everything is stored as partial feeds. It returns how many of the indexed messages were stored.
+func FetchIndexed(ctx context.Context, edp muxrpc.Endpoint, rv RangeVerifier, author *refs.FeedRef, tipe string, n int64) (int, error) {
+	all := func(int64) bool { return true }
+
+	adds, err := fetchOfType(ctx, edp, rv, author, metafeeds.TypeAdd, all)
+	if err != nil {
+		return 0, err
+	}
+	tombstones, err := fetchOfType(ctx, edp, rv, author, metafeeds.TypeTombstone, all)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := make(map[string]bool)
+	for _, raw := range tombstones {
+		var ts metafeeds.Tombstone
+		if err := unmarshalContent(raw, &ts); err != nil || ts.Verify(author) != nil {
+			continue
+		}
+		removed[ts.SubFeed.Ref()] = true
+	}
+
+	var indexFeeds []*refs.FeedRef
+	for _, raw := range adds {
+		var a metafeeds.Add
+		if err := unmarshalContent(raw, &a); err != nil || a.Verify(author) != nil {
+			continue
+		}
+		q, err := a.Query()
+		if err != nil || q == nil || q.Type != tipe || !q.Author.Equal(author) || removed[a.SubFeed.Ref()] {
+			continue
+		}
+		indexFeeds = append(indexFeeds, a.SubFeed)
+	}
+	if len(indexFeeds) == 0 {
+		return 0, fmt.Errorf("partial(%s): no index feed for %q", author.ShortRef(), tipe)
+	}
+
+	wanted := make(map[int64]bool)
+	var seqs []int64
+	for _, idxFeed := range indexFeeds {
+		entries, err := fetchLatest(ctx, edp, rv, idxFeed, n)
+		if err != nil {
+			return 0, err
+		}
+		for _, raw := range entries {
+			var content json.RawMessage
+			if err := unmarshalContent(raw, &content); err != nil {
+				continue
+			}
+			entry, err := metafeeds.ParseIndexEntry(content)
+			if err != nil {
+				continue
+			}
+			if !wanted[entry.Indexed.Sequence] {
+				wanted[entry.Indexed.Sequence] = true
+				seqs = append(seqs, entry.Indexed.Sequence)
+			}
+		}
+	}
+
+	msgs, err := fetchSeqs(ctx, edp, author, seqs)
+	if err != nil {
+		return 0, err
+	}
+
+	// the peer might send other messages than the ones that were asked for
+	var indexed [][]byte
+	for _, raw := range msgs {
+		var msg classicMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return 0, fmt.Errorf("partial(%s): invalid message: %w", author.ShortRef(), err)
+		}
+		var typed struct {
+			Type string `json:"type"`
+		}
+		if !wanted[msg.Sequence] || json.Unmarshal(msg.Content, &typed) != nil || typed.Type != tipe {
+			continue
+		}
+		delete(wanted, msg.Sequence)
+		indexed = append(indexed, raw)
+	}
+
+	if err := rv.VerifyMessages(author, indexed); err != nil {
+		return 0, err
+	}
+	return len(indexed), nil
+}
+
+// unmarshalContent decodes the content of a classic message into v
+func unmarshalContent(raw []byte, v interface{}) error {
+	var msg classicMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return err
+	}
+	return json.Unmarshal(msg.Content, v)
+}
@@ -37,6 +37,7 @@ func New(log logging.Interface,
 	feeds, bytype, roots *roaring.MultiLog,
 	rxlog margaret.Log,
 	get ssb.Getter,
+	isSelf ssb.Authorizer,
 ) ssb.Plugin {
 	rootHdlr := typemux.New(log)
 
@@ -47,11 +48,13 @@ func New(log logging.Interface,
 	})
 
 	rootHdlr.RegisterSource(muxrpc.Method{name, "getFeed"}, getFeedHandler{
-		fm: fm,
+		fm:     fm,
+		isSelf: isSelf,
 	})
 
 	rootHdlr.RegisterSource(muxrpc.Method{name, "getFeedReverse"}, getFeedReverseHandler{
-		fm: fm,
+		fm:     fm,
+		isSelf: isSelf,
 	})
 
 	rootHdlr.RegisterSource(muxrpc.Method{name, "getMessagesOfType"}, getMessagesOfTypeHandler{
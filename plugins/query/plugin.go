@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: MIT
+
+// Package query supplies query.read, a source that combines author, type, thread and content filters using the indexes of the bot.
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cryptix/go/encodedTime"
+	"github.com/go-kit/kit/log"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/query"
+)
+
+type Plugin struct {
+	h muxrpc.Handler
+}
+
+func NewPlugin(logger log.Logger, planner *query.Planner, isSelf ssb.Authorizer) *Plugin {
+	mux := typemux.New(logger)
+
+	mux.RegisterSource(muxrpc.Method{"query", "read"}, readHandler{
+		planner: planner,
+		isSelf:  isSelf,
+	})
+
+	return &Plugin{
+		h: &mux,
+	}
+}
+
+func (lt Plugin) Name() string            { return "query" }
+func (Plugin) Method() muxrpc.Method      { return muxrpc.Method{"query"} }
+func (lt Plugin) Handler() muxrpc.Handler { return lt.h }
+
+type readHandler struct {
+	planner *query.Planner
+
+	isSelf ssb.Authorizer
+}
+
+// HandleSource sends the matching messages sorted by their claimed timestamp, each with a cursor to continue after it.
+func (h readHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
+	var args []message.QueryArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return fmt.Errorf("query.read: bad request data: %w", err)
+	}
+	var qry message.QueryArgs
+	if n := len(args); n == 1 {
+		qry = args[0]
+	} else if n > 1 {
+		return fmt.Errorf("query.read: expected one filter argument but got %d", n)
+	}
+
+	spec, err := SpecFromArgs(qry)
+	if err != nil {
+		return err
+	}
+
+	if spec.Private || spec.OnlyPrivate {
+		if err := ssb.AuthorizePrivate(req, h.isSelf); err != nil {
+			return fmt.Errorf("query.read: %w", err)
+		}
+	}
+
+	snk.SetEncoding(muxrpc.TypeJSON)
+
+	err = h.planner.Iterate(ctx, spec, func(ctx context.Context, res query.Result) error {
+		var reply message.QueryReply
+		reply.Cursor = res.Cursor.String()
+		reply.Message.Key_ = res.Message.Key()
+		reply.Message.Value = *res.Message.ValueContent()
+		reply.Message.Timestamp = encodedTime.Millisecs(res.Message.Received())
+		b, err := json.Marshal(reply)
+		if err != nil {
+			return fmt.Errorf("failed to encode reply: %w", err)
+		}
+		_, err = snk.Write(b)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("query.read: failed: %w", err)
+	}
+	return snk.Close()
+}
+
+// SpecFromArgs turns the rpc arguments into a query.Spec, ordered by the claimed timestamp
+func SpecFromArgs(qry message.QueryArgs) (query.Spec, error) {
+	spec := query.Spec{
+		Authors:    qry.Authors,
+		Type:       qry.Type,
+		Tangle:     qry.Root,
+		TangleName: qry.TangleName,
+		Mentions:   qry.Mentions,
+		Channel:    qry.Channel,
+
+		Private: qry.Private,
+
+		Order:   query.OrderClaimed,
+		Gt:      query.ArgBound(qry.Gt),
+		Lt:      query.ArgBound(qry.Lt),
+		Reverse: qry.Reverse,
+		Limit:   qry.Limit,
+		Live:    qry.Live,
+	}
+
+	if qry.TangleName != "" && qry.Root == nil {
+		return spec, fmt.Errorf("query.read: tangle needs a root")
+	}
+
+	for _, m := range qry.Mentions {
+		if _, err := refs.ParseRef(m); err != nil {
+			return spec, fmt.Errorf("query.read: invalid mention %q: %w", m, err)
+		}
+	}
+
+	if qry.Boxed != nil {
+		if *qry.Boxed {
+			spec.OnlyPrivate = true
+		} else {
+			spec.Private = false
+		}
+	}
+
+	if qry.Cursor != "" {
+		var err error
+		spec.After, err = query.ParseCursor(qry.Cursor)
+		if err != nil {
+			return spec, err
+		}
+	}
+
+	return spec, nil
+}
@@ -8,13 +8,13 @@ import (
 	"fmt"
 	"os"
 
-	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/muxrpc/v2"
 
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/internal/transform"
 	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/query"
 )
 
 // ~> sbot createLogStream --help
@@ -24,10 +24,11 @@ type rxLogPlug struct {
 	h muxrpc.Handler
 }
 
-func NewRXLog(rootLog margaret.Log) ssb.Plugin {
+func NewRXLog(rootLog margaret.Log, planner *query.Planner) ssb.Plugin {
 	plug := &rxLogPlug{}
 	plug.h = rxLogHandler{
-		root: rootLog,
+		root:    rootLog,
+		planner: planner,
 	}
 	return plug
 }
@@ -42,7 +43,8 @@ func (lt rxLogPlug) Handler() muxrpc.Handler {
 }
 
 type rxLogHandler struct {
-	root margaret.Log
+	root    margaret.Log
+	planner *query.Planner
 }
 
 func (rxLogHandler) Handled(m muxrpc.Method) bool { return m.String() == "createLogStream" }
@@ -87,30 +89,29 @@ func (g rxLogHandler) HandleCall(ctx context.Context, req *muxrpc.Request) {
 		qry.Seq = seq.Seq() - 1
 	}
 
-	// start := time.Now()
-	src, err := g.root.Query(
-		margaret.SeqWrap(false),
-		margaret.Gte(margaret.BaseSeq(qry.Seq)),
-		margaret.Limit(int(qry.Limit)),
-		margaret.Live(qry.Live),
-		margaret.Reverse(qry.Reverse),
-	)
-	if err != nil {
-		req.CloseWithError(fmt.Errorf("logStream: failed to qry tipe: %w", err))
-		return
-	}
-
 	snk, err := req.ResponseSink()
 	if err != nil {
 		req.CloseWithError(err)
 		return
 	}
-	err = luigi.Pump(ctx, transform.NewKeyValueWrapper(snk, qry.Keys), src)
+
+	// boxed messages are passed as they are, unless private is set and they can be decrypted
+	kvSnk := transform.NewKeyValueWrapper(snk, qry.Keys)
+	err = g.planner.Run(ctx, kvSnk, query.Spec{
+		Private:   qry.Private,
+		KeepBoxed: true,
+
+		Order:   query.OrderSeq,
+		Gt:      query.Bound(qry.Seq - 1),
+		Reverse: qry.Reverse,
+		Limit:   qry.Limit,
+		Live:    qry.Live,
+	})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "createLogStream err:", err)
 		req.CloseWithError(fmt.Errorf("logStream: failed to pump msgs: %w", err))
 		return
 	}
-	snk.Close()
+	kvSnk.Close()
 	// fmt.Fprintln(os.Stderr, "createLogStream closed:", err, "after:", time.Since(start))
 }
@@ -4,34 +4,29 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"time"
 
 	"github.com/go-kit/kit/log"
-	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/muxrpc/v2"
 
 	"go.cryptoscope.co/muxrpc/v2/typemux"
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/internal/transform"
 	"go.cryptoscope.co/ssb/message"
-	"go.cryptoscope.co/ssb/repo"
+	"go.cryptoscope.co/ssb/query"
 )
 
 // ~> sbot createFeedStream --help
-// (log) Fetch messages ordered by the time received.
-// log [--live] [--gt ts] [--lt ts] [--reverse]  [--keys] [--limit n]
+// (feed) Fetch messages ordered by their claimed timestamps.
+// feed [--live] [--gt ts] [--lt ts] [--reverse]  [--keys] [--limit n]
 type sortedPlug struct {
-	root margaret.Log
-	res  *repo.SequenceResolver
+	planner *query.Planner
 
 	h muxrpc.Handler
 }
 
-func NewSortedStream(log log.Logger, rootLog margaret.Log, res *repo.SequenceResolver) ssb.Plugin {
+func NewSortedStream(log log.Logger, planner *query.Planner) ssb.Plugin {
 	plug := &sortedPlug{
-		root: rootLog,
-		res:  res,
+		planner: planner,
 	}
 
 	h := typemux.New(log)
@@ -47,8 +42,9 @@ func (lt sortedPlug) Name() string            { return "createFeedStream" }
 func (sortedPlug) Method() muxrpc.Method      { return muxrpc.Method{"createFeedStream"} }
 func (lt sortedPlug) Handler() muxrpc.Handler { return lt.h }
 
+// HandleSource sends the messages with a claimed timestamp (in milliseconds) between gt and lt, oldest first unless reverse is set.
+// With live, new messages are sent in the order they arrive after the sorted ones.
 func (g sortedPlug) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
-	start := time.Now()
 	var qry message.CreateLogArgs
 	if len(req.Args()) == 1 {
 		var args []message.CreateLogArgs
@@ -65,46 +61,21 @@ func (g sortedPlug) HandleSource(ctx context.Context, req *muxrpc.Request, snk *
 		qry.Limit = -1
 	}
 
-	// empty query doesn't make much sense...
-	if qry.Limit == 0 {
-		qry.Limit = -1
-	}
-
-	// TODO: only return message keys
-	// qry.Values = true
-
-	sortedSeqs, err := g.res.SortAndFilterAll(repo.SortByClaimed, func(ts int64) bool {
-		isGreater := ts > qry.Gt
-		isSmaller := ts < qry.Lt
-		return isGreater && isSmaller
-	}, true)
-
-	if err != nil {
-		return err
-	}
-	fmt.Fprintln(os.Stderr, "createFeedStream sorted seqs:", len(sortedSeqs), "after:", time.Since(start))
-
 	toJSON := transform.NewKeyValueWrapper(snk, qry.Keys)
 
-	for _, res := range sortedSeqs {
-		v, err := g.root.Get(margaret.BaseSeq(res.Seq))
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "createFeedStream failed to get seq:", res.Seq, " with:", err, "after:", time.Since(start))
-			continue
-		}
-
-		if err := toJSON.Pour(ctx, v); err != nil {
-			fmt.Fprintln(os.Stderr, "createFeedStream failed send:", res.Seq, " with:", err, "after:", time.Since(start))
-			break
-		}
-
-		if qry.Limit >= 0 {
-			qry.Limit--
-			if qry.Limit == 0 {
-				break
-			}
-		}
+	err := g.planner.Run(ctx, toJSON, query.Spec{
+		Private:   qry.Private,
+		KeepBoxed: true,
+
+		Order:   query.OrderClaimed,
+		Gt:      query.ArgBound(qry.Gt),
+		Lt:      query.ArgBound(qry.Lt),
+		Reverse: qry.Reverse,
+		Limit:   qry.Limit,
+		Live:    qry.Live,
+	})
+	if err != nil {
+		return fmt.Errorf("createFeedStream: query failed: %w", err)
 	}
-	fmt.Fprintln(os.Stderr, "createFeedStream closed after:", time.Since(start))
-	return snk.Close()
+	return toJSON.Close()
 }
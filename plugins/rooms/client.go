@@ -0,0 +1,436 @@
+// SPDX-License-Identifier: MIT
+
+// Package rooms implements the client side of ssb rooms (https://github.com/ssb-ngi-pointer/rooms2).
+//
+// A room is a server that relays connections between it's members, so that peers behind NAT can reach each other.
+// The client joins a room, keeps track of the other attendants and opens tunnel.connect streams through it.
+// These streams are run through secret-handshake and are then handled like any other connection of the network node.
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/network/msaddr"
+)
+
+// ErrNotJoined is returned if a room is used that wasn't joined or isn't connected
+var ErrNotJoined = errors.New("rooms: not connected to this room")
+
+// ConnectArgs are the arguments of tunnel.connect.
+// Origin is only set by the room when it calls the target.
+type ConnectArgs struct {
+	Portal *refs.FeedRef `json:"portal"`
+	Target *refs.FeedRef `json:"target"`
+	Origin *refs.FeedRef `json:"origin,omitempty"`
+}
+
+// AttendantsEvent is emitted by room.attendants.
+// The first one is of type "state" and has the full list in IDs, updates are "joined" or "left" with ID set.
+type AttendantsEvent struct {
+	Type string          `json:"type"`
+	IDs  []*refs.FeedRef `json:"ids,omitempty"`
+	ID   *refs.FeedRef   `json:"id,omitempty"`
+}
+
+// Client manages the connections to rooms and the tunnels through them
+type Client struct {
+	rootCtx context.Context
+	logger  log.Logger
+
+	self    *refs.FeedRef
+	network ssb.Network
+
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+type room struct {
+	addr msaddr.Address
+
+	edp muxrpc.Endpoint // nil until connected
+
+	connected chan struct{}
+
+	attendants map[string]*refs.FeedRef
+}
+
+// NewClient creates a room client that uses the passed network node to connect to rooms and to handle the tunneled connections.
+// The connections to rooms and the tunnels through them are closed when ctx is canceled.
+func NewClient(ctx context.Context, logger log.Logger, self *refs.FeedRef, n ssb.Network) *Client {
+	return &Client{
+		rootCtx: ctx,
+		logger:  logger,
+		self:    self,
+		network: n,
+		rooms:   make(map[string]*room),
+	}
+}
+
+// Join connects to the room at addr and waits until the connection is established.
+// ctx only limits the waiting, the connection stays open until Leave is called.
+func (c *Client) Join(ctx context.Context, addr msaddr.Address) error {
+	if addr.Ref == nil {
+		return fmt.Errorf("rooms: address without key")
+	}
+	wrapped, err := addr.WrappedAddr()
+	if err != nil {
+		return fmt.Errorf("rooms: unusable room address: %w", err)
+	}
+
+	c.mu.Lock()
+	r, has := c.rooms[addr.Ref.Ref()]
+	if !has {
+		r = &room{
+			addr:       addr,
+			connected:  make(chan struct{}),
+			attendants: make(map[string]*refs.FeedRef),
+		}
+		c.rooms[addr.Ref.Ref()] = r
+	}
+	connected := r.connected
+	isConnected := r.edp != nil
+	c.mu.Unlock()
+
+	if !isConnected {
+		err = c.network.Connect(c.rootCtx, wrapped)
+		if err != nil {
+			return fmt.Errorf("rooms: failed to connect to room %s: %w", addr.Ref.ShortRef(), err)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-connected:
+		return nil
+	}
+}
+
+// Leave disconnects from the room and forgets it
+func (c *Client) Leave(roomRef *refs.FeedRef) error {
+	c.mu.Lock()
+	r, has := c.rooms[roomRef.Ref()]
+	var edp muxrpc.Endpoint
+	if has {
+		edp = r.edp
+	}
+	delete(c.rooms, roomRef.Ref())
+	c.mu.Unlock()
+	if !has {
+		return ErrNotJoined
+	}
+	if edp != nil {
+		return edp.Terminate()
+	}
+	return nil
+}
+
+// IsRoom returns true if ref is a joined room. Used to authorize connections to rooms.
+func (c *Client) IsRoom(ref *refs.FeedRef) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, has := c.rooms[ref.Ref()]
+	return has
+}
+
+// Rooms returns the addresses of all joined rooms
+func (c *Client) Rooms() []msaddr.Address {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lst := make([]msaddr.Address, 0, len(c.rooms))
+	for _, r := range c.rooms {
+		lst = append(lst, r.addr)
+	}
+	return lst
+}
+
+// Attendants returns the list of peers that are currently in the room
+func (c *Client) Attendants(roomRef *refs.FeedRef) ([]*refs.FeedRef, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, has := c.rooms[roomRef.Ref()]
+	if !has || r.edp == nil {
+		return nil, ErrNotJoined
+	}
+	lst := make([]*refs.FeedRef, 0, len(r.attendants))
+	for _, a := range r.attendants {
+		lst = append(lst, a)
+	}
+	return lst, nil
+}
+
+// Connect opens a tunnel to target through the room and does the secret-handshake with it.
+// The resulting connection is handled by the network node.
+// ctx only bounds opening the tunnel and the handshake, the tunnel stays open as long as the client.
+func (c *Client) Connect(ctx context.Context, roomRef, target *refs.FeedRef) error {
+	c.mu.Lock()
+	r, has := c.rooms[roomRef.Ref()]
+	var edp muxrpc.Endpoint
+	if has {
+		edp = r.edp
+	}
+	c.mu.Unlock()
+	if edp == nil {
+		return ErrNotJoined
+	}
+
+	args := ConnectArgs{Portal: roomRef, Target: target}
+	src, snk, err := edp.Duplex(c.rootCtx, muxrpc.TypeBinary, muxrpc.Method{"tunnel", "connect"}, args)
+	if err != nil {
+		return fmt.Errorf("rooms: failed to open tunnel to %s: %w", target.ShortRef(), err)
+	}
+
+	conn := newStreamConn(c.rootCtx, src, snk,
+		TunnelAddr{Room: roomRef, Peer: c.self},
+		TunnelAddr{Room: roomRef, Peer: target},
+	)
+
+	level.Debug(c.logger).Log("event", "tunnel opened", "room", roomRef.ShortRef(), "target", target.ShortRef())
+
+	// closing the tunnel aborts a pending handshake
+	handshaked := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshaked:
+		}
+	}()
+	err = c.network.ConnectConn(c.rootCtx, conn, target)
+	close(handshaked)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		conn.Close()
+		return fmt.Errorf("rooms: failed to connect to %s: %w", target.ShortRef(), ctxErr)
+	}
+	return err
+}
+
+// JoinWithInvite claims an invite of a restricted room and joins it as a member afterwards
+func (c *Client) JoinWithInvite(ctx context.Context, addr msaddr.Address, token string) error {
+	if err := c.Join(ctx, addr); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	var edp muxrpc.Endpoint
+	if r, has := c.rooms[addr.Ref.Ref()]; has {
+		edp = r.edp
+	}
+	c.mu.Unlock()
+	if edp == nil {
+		return ErrNotJoined
+	}
+
+	var ok bool
+	err := edp.Async(ctx, &ok, muxrpc.TypeJSON, muxrpc.Method{"room", "claimInvite"}, token)
+	if err != nil {
+		c.Leave(addr.Ref)
+		return fmt.Errorf("rooms: failed to claim invite: %w", err)
+	}
+
+	// the room only treats us as a member on a new connection
+	if err := c.Leave(addr.Ref); err != nil {
+		return err
+	}
+	return c.Join(ctx, addr)
+}
+
+// muxrpc handler
+
+// Handled returns true for tunnel.connect, which is called by the room for incoming tunnels
+func (c *Client) Handled(m muxrpc.Method) bool { return m.String() == "tunnel.connect" }
+
+// HandleConnect checks if the remote is a joined room. If it is, it announces itself and keeps track of the attendants.
+// Further connections to a room that is already connected (inbound ones or overlapping reconnects) are ignored.
+func (c *Client) HandleConnect(ctx context.Context, edp muxrpc.Endpoint) {
+	remote, err := ssb.GetFeedRefFromAddr(edp.Remote())
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	r, has := c.rooms[remote.Ref()]
+	if !has {
+		c.mu.Unlock()
+		return
+	}
+	if r.edp != nil {
+		c.mu.Unlock()
+		level.Debug(c.logger).Log("event", "ignoring duplicate room connection", "room", remote.ShortRef())
+		return
+	}
+	r.edp = edp
+	r.attendants = make(map[string]*refs.FeedRef)
+	select {
+	case <-r.connected:
+	default:
+		close(r.connected)
+	}
+	c.mu.Unlock()
+
+	logger := log.With(c.logger, "room", remote.ShortRef())
+	level.Info(logger).Log("event", "connected to room")
+
+	defer func() {
+		c.mu.Lock()
+		if r.edp == edp {
+			r.edp = nil
+			r.attendants = make(map[string]*refs.FeedRef)
+			r.connected = make(chan struct{})
+		}
+		c.mu.Unlock()
+	}()
+
+	// older rooms need to be told explicitly, newer ones ignore it
+	var ret interface{}
+	err = edp.Async(ctx, &ret, muxrpc.TypeJSON, muxrpc.Method{"tunnel", "announce"})
+	if err != nil {
+		level.Debug(logger).Log("event", "tunnel.announce failed", "err", err)
+	}
+
+	err = c.followAttendants(ctx, r, edp)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		level.Warn(logger).Log("event", "attendants stream closed", "err", err)
+	}
+
+	// keep the endpoint around as long as the connection is open, we might still be able to claim an invite or open tunnels
+	<-ctx.Done()
+}
+
+// followAttendants reads room.attendants and falls back to the legacy tunnel.endpoints if that fails
+func (c *Client) followAttendants(ctx context.Context, r *room, edp muxrpc.Endpoint) error {
+	src, err := edp.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{"room", "attendants"})
+	if err != nil {
+		return c.followEndpoints(ctx, r, edp)
+	}
+
+	first := true
+	for src.Next(ctx) {
+		var evt AttendantsEvent
+		err = src.Reader(func(rd io.Reader) error {
+			return json.NewDecoder(rd).Decode(&evt)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to decode attendants event: %w", err)
+		}
+		first = false
+
+		c.mu.Lock()
+		switch evt.Type {
+		case "state":
+			r.attendants = make(map[string]*refs.FeedRef, len(evt.IDs))
+			for _, id := range evt.IDs {
+				r.attendants[id.Ref()] = id
+			}
+		case "joined":
+			if evt.ID != nil {
+				r.attendants[evt.ID.Ref()] = evt.ID
+			}
+		case "left":
+			if evt.ID != nil {
+				delete(r.attendants, evt.ID.Ref())
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	if err := src.Err(); err != nil {
+		if first {
+			// the room doesn't know room.attendants
+			return c.followEndpoints(ctx, r, edp)
+		}
+		return err
+	}
+	return nil
+}
+
+// followEndpoints reads the full list of attendants from tunnel.endpoints (rooms v1)
+func (c *Client) followEndpoints(ctx context.Context, r *room, edp muxrpc.Endpoint) error {
+	src, err := edp.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{"tunnel", "endpoints"})
+	if err != nil {
+		return fmt.Errorf("failed to open tunnel.endpoints: %w", err)
+	}
+
+	for src.Next(ctx) {
+		var ids []*refs.FeedRef
+		err = src.Reader(func(rd io.Reader) error {
+			return json.NewDecoder(rd).Decode(&ids)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to decode endpoints: %w", err)
+		}
+
+		c.mu.Lock()
+		r.attendants = make(map[string]*refs.FeedRef, len(ids))
+		for _, id := range ids {
+			r.attendants[id.Ref()] = id
+		}
+		c.mu.Unlock()
+	}
+	return src.Err()
+}
+
+// HandleCall handles incoming tunnel.connect calls from rooms
+func (c *Client) HandleCall(ctx context.Context, req *muxrpc.Request) {
+	if err := c.handleIncoming(ctx, req); err != nil {
+		level.Warn(c.logger).Log("event", "incoming tunnel failed", "err", err)
+		req.CloseWithError(err)
+	}
+}
+
+func (c *Client) handleIncoming(ctx context.Context, req *muxrpc.Request) error {
+	if req.Type != "duplex" {
+		return fmt.Errorf("tunnel.connect: invalid type: %s", req.Type)
+	}
+
+	var args []ConnectArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return fmt.Errorf("tunnel.connect: invalid arguments: %w", err)
+	}
+	if n := len(args); n != 1 {
+		return fmt.Errorf("tunnel.connect: expected one argument but got %d", n)
+	}
+	arg := args[0]
+	if arg.Origin == nil || arg.Portal == nil || arg.Target == nil {
+		return errors.New("tunnel.connect: missing origin, portal or target")
+	}
+
+	caller, err := ssb.GetFeedRefFromAddr(req.RemoteAddr())
+	if err != nil {
+		return fmt.Errorf("tunnel.connect: %w", err)
+	}
+	if !caller.Equal(arg.Portal) || !c.IsRoom(caller) {
+		return fmt.Errorf("tunnel.connect: %s is not a joined room", caller.ShortRef())
+	}
+	if !arg.Target.Equal(c.self) {
+		return fmt.Errorf("tunnel.connect: wrong target %s", arg.Target.ShortRef())
+	}
+
+	snk, err := req.ResponseSink()
+	if err != nil {
+		return fmt.Errorf("tunnel.connect: %w", err)
+	}
+	src, err := req.ResponseSource()
+	if err != nil {
+		return fmt.Errorf("tunnel.connect: %w", err)
+	}
+
+	var conn net.Conn = newStreamConn(ctx, src, snk,
+		TunnelAddr{Room: arg.Portal, Peer: c.self},
+		TunnelAddr{Room: arg.Portal, Peer: arg.Origin},
+	)
+	level.Debug(c.logger).Log("event", "incoming tunnel", "room", arg.Portal.ShortRef(), "origin", arg.Origin.ShortRef())
+	return c.network.ServeConn(ctx, conn)
+}
@@ -0,0 +1,244 @@
+// SPDX-License-Identifier: MIT
+
+package rooms_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+	"golang.org/x/sync/errgroup"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/network"
+	"go.cryptoscope.co/ssb/network/msaddr"
+	"go.cryptoscope.co/ssb/plugins/rooms"
+	"go.cryptoscope.co/ssb/sbot"
+)
+
+// fakeRoom is a minimal room that relays tunnel.connect calls between it's attendants
+type fakeRoom struct {
+	self *refs.FeedRef
+
+	mu        sync.Mutex
+	endpoints map[string]muxrpc.Endpoint
+}
+
+func (fr *fakeRoom) Handled(m muxrpc.Method) bool { return true }
+
+func (fr *fakeRoom) HandleConnect(ctx context.Context, edp muxrpc.Endpoint) {
+	remote, err := ssb.GetFeedRefFromAddr(edp.Remote())
+	if err != nil {
+		return
+	}
+	fr.mu.Lock()
+	fr.endpoints[remote.Ref()] = edp
+	fr.mu.Unlock()
+}
+
+func (fr *fakeRoom) HandleCall(ctx context.Context, req *muxrpc.Request) {
+	switch req.Method.String() {
+	case "tunnel.announce":
+		req.Return(ctx, true)
+
+	case "room.attendants":
+		snk, err := req.ResponseSink()
+		if err != nil {
+			return
+		}
+		snk.SetEncoding(muxrpc.TypeJSON)
+		var evt rooms.AttendantsEvent
+		evt.Type = "state"
+		fr.mu.Lock()
+		for _, edp := range fr.endpoints {
+			ref, err := ssb.GetFeedRefFromAddr(edp.Remote())
+			if err == nil {
+				evt.IDs = append(evt.IDs, ref)
+			}
+		}
+		fr.mu.Unlock()
+		json.NewEncoder(snk).Encode(evt)
+		<-ctx.Done()
+		snk.Close()
+
+	case "tunnel.connect":
+		var args []rooms.ConnectArgs
+		if err := json.Unmarshal(req.RawArgs, &args); err != nil || len(args) != 1 {
+			req.CloseWithError(fmt.Errorf("fake room: invalid tunnel.connect arguments"))
+			return
+		}
+		origin, err := ssb.GetFeedRefFromAddr(req.RemoteAddr())
+		if err != nil {
+			req.CloseWithError(err)
+			return
+		}
+
+		fr.mu.Lock()
+		targetEdp, has := fr.endpoints[args[0].Target.Ref()]
+		fr.mu.Unlock()
+		if !has {
+			req.CloseWithError(rooms.ErrNotJoined)
+			return
+		}
+
+		fwd := rooms.ConnectArgs{Portal: fr.self, Target: args[0].Target, Origin: origin}
+		targetSrc, targetSnk, err := targetEdp.Duplex(ctx, muxrpc.TypeBinary, muxrpc.Method{"tunnel", "connect"}, fwd)
+		if err != nil {
+			req.CloseWithError(err)
+			return
+		}
+
+		originSnk, err := req.ResponseSink()
+		if err != nil {
+			return
+		}
+		originSrc, err := req.ResponseSource()
+		if err != nil {
+			return
+		}
+		originSnk.SetEncoding(muxrpc.TypeBinary)
+		targetSnk.SetEncoding(muxrpc.TypeBinary)
+
+		go pipe(ctx, originSrc, targetSnk)
+		pipe(ctx, targetSrc, originSnk)
+
+	default:
+		req.CloseWithError(fmt.Errorf("fake room: no such method: %s", req.Method))
+	}
+}
+
+func pipe(ctx context.Context, src *muxrpc.ByteSource, snk *muxrpc.ByteSink) {
+	defer snk.Close()
+	for src.Next(ctx) {
+		err := src.Reader(func(r io.Reader) error {
+			_, err := io.Copy(snk, r)
+			return err
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+func TestClientConnectThroughRoom(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	botgroup, ctx := errgroup.WithContext(ctx)
+
+	info := testutils.NewRelativeTimeLogger(nil)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	appKey := make([]byte, 32)
+	rand.Read(appKey)
+
+	// the room
+	roomKey, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+	fr := &fakeRoom{
+		self:      roomKey.Id,
+		endpoints: make(map[string]muxrpc.Endpoint),
+	}
+	roomNode, err := network.New(network.Options{
+		Logger:     log.With(info, "peer", "room"),
+		ListenAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		KeyPair:    roomKey,
+		AppKey:     appKey,
+		MakeHandler: func(net.Conn) (muxrpc.Handler, error) {
+			return fr, nil
+		},
+	})
+	r.NoError(err)
+	botgroup.Go(func() error {
+		err := roomNode.Serve(ctx)
+		if err != nil && err != context.Canceled {
+			return err
+		}
+		return nil
+	})
+
+	roomAddr, err := msaddr.FromNetAddr(roomNode.GetListenAddr())
+	r.NoError(err)
+	roomAddr.Ref = roomKey.Id
+
+	// the two peers
+	mkBot := func(name string) *sbot.Sbot {
+		bot, err := sbot.New(
+			sbot.WithAppKey(appKey),
+			sbot.WithContext(ctx),
+			sbot.WithInfo(log.With(info, "peer", name)),
+			sbot.WithRepoPath(filepath.Join(testPath, name)),
+			sbot.WithListenAddr(":0"),
+			sbot.WithPromisc(true),
+		)
+		r.NoError(err)
+		r.NotNil(bot.Rooms)
+		return bot
+	}
+	ali := mkBot("ali")
+	bob := mkBot("bob")
+
+	r.NoError(ali.Rooms.Join(ctx, *roomAddr))
+	r.NoError(bob.Rooms.Join(ctx, *roomAddr))
+
+	r.True(ali.Rooms.IsRoom(roomKey.Id))
+	r.Len(ali.Rooms.Rooms(), 1)
+
+	// joining again doesn't open a second connection
+	r.NoError(ali.Rooms.Join(ctx, *roomAddr))
+	r.Len(ali.Rooms.Rooms(), 1)
+
+	// bob joined after ali, so only he sees both
+	r.Eventually(func() bool {
+		lst, err := bob.Rooms.Attendants(roomKey.Id)
+		return err == nil && len(lst) == 2
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// the call context only bounds the handshake
+	canceled, cancelCall := context.WithCancel(ctx)
+	cancelCall()
+	err = ali.Rooms.Connect(canceled, roomKey.Id, bob.KeyPair.Id)
+	r.True(errors.Is(err, context.Canceled), "unexpected error: %v", err)
+
+	r.NoError(ali.Rooms.Connect(ctx, roomKey.Id, bob.KeyPair.Id))
+
+	r.Eventually(func() bool {
+		_, has := ali.Network.GetEndpointFor(bob.KeyPair.Id)
+		return has
+	}, 5*time.Second, 100*time.Millisecond)
+
+	edp, _ := ali.Network.GetEndpointFor(bob.KeyPair.Id)
+	var who struct {
+		ID *refs.FeedRef `json:"id"`
+	}
+	err = edp.Async(ctx, &who, muxrpc.TypeJSON, muxrpc.Method{"whoami"})
+	r.NoError(err)
+	r.True(who.ID.Equal(bob.KeyPair.Id))
+
+	r.NoError(ali.Rooms.Leave(roomKey.Id))
+	r.False(ali.Rooms.IsRoom(roomKey.Id))
+
+	ali.Shutdown()
+	bob.Shutdown()
+	roomNode.Close()
+	cancel()
+	r.NoError(ali.Close())
+	r.NoError(bob.Close())
+	r.NoError(botgroup.Wait())
+}
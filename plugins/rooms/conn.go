@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MIT
+
+package rooms
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// TunnelAddr is the address of a peer that is reached through a room
+type TunnelAddr struct {
+	Room *refs.FeedRef
+	Peer *refs.FeedRef
+}
+
+// Network returns "tunnel"
+func (ta TunnelAddr) Network() string { return "tunnel" }
+
+// String returns the multiserver notation of the tunnel (without the shs part)
+func (ta TunnelAddr) String() string {
+	return fmt.Sprintf("tunnel:%s:%s", ta.Room.Ref(), ta.Peer.Ref())
+}
+
+// streamConn turns a binary duplex stream into a net.Conn, so that it can be used for secret-handshake.
+type streamConn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	src *muxrpc.ByteSource
+	snk *muxrpc.ByteSink
+
+	readMu sync.Mutex
+	buf    bytes.Buffer
+
+	local, remote net.Addr
+}
+
+var _ net.Conn = (*streamConn)(nil)
+
+func newStreamConn(ctx context.Context, src *muxrpc.ByteSource, snk *muxrpc.ByteSink, local, remote net.Addr) *streamConn {
+	snk.SetEncoding(muxrpc.TypeBinary)
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &streamConn{
+		ctx:    ctx,
+		cancel: cancel,
+
+		src: src,
+		snk: snk,
+
+		local:  local,
+		remote: remote,
+	}
+}
+
+// Read returns buffered data from the last muxrpc packet or waits for the next one
+func (c *streamConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for c.buf.Len() == 0 {
+		if !c.src.Next(c.ctx) {
+			if err := c.src.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+
+		err := c.src.Reader(func(r io.Reader) error {
+			_, err := c.buf.ReadFrom(r)
+			return err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("tunnel: failed to read packet: %w", err)
+		}
+	}
+
+	return c.buf.Read(b)
+}
+
+func (c *streamConn) Write(b []byte) (int, error) {
+	return c.snk.Write(b)
+}
+
+func (c *streamConn) Close() error {
+	c.cancel()
+	return c.snk.Close()
+}
+
+func (c *streamConn) LocalAddr() net.Addr  { return c.local }
+func (c *streamConn) RemoteAddr() net.Addr { return c.remote }
+
+// deadlines are not supported by the underlying muxrpc streams
+
+func (c *streamConn) SetDeadline(t time.Time) error      { return nil }
+func (c *streamConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *streamConn) SetWriteDeadline(t time.Time) error { return nil }
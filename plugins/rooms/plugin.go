@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MIT
+
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/network/msaddr"
+)
+
+// TunnelPlugin handles incoming tunnel.connect calls from joined rooms. It needs to be registered as a public plugin.
+type TunnelPlugin struct{ *Client }
+
+func (TunnelPlugin) Name() string              { return "tunnel" }
+func (TunnelPlugin) Method() muxrpc.Method     { return muxrpc.Method{"tunnel"} }
+func (p TunnelPlugin) Handler() muxrpc.Handler { return p.Client }
+
+// MasterPlugin offers rooms.join, rooms.leave, rooms.list, rooms.attendants and rooms.connect to local clients.
+type MasterPlugin struct {
+	h muxrpc.Handler
+}
+
+// NewMasterPlugin returns the muxrpc plugin to control the room client
+func NewMasterPlugin(logger log.Logger, c *Client) *MasterPlugin {
+	mux := typemux.New(logger)
+
+	mux.RegisterAsync(muxrpc.Method{"rooms", "join"}, typemux.AsyncFunc(func(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+		var args []string
+		if err := json.Unmarshal(req.RawArgs, &args); err != nil || len(args) < 1 || len(args) > 2 {
+			return nil, fmt.Errorf("usage: rooms.join net:host:port~shs:key [invite]")
+		}
+		addr, err := msaddr.Parse(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 2 {
+			err = c.JoinWithInvite(ctx, *addr, args[1])
+		} else {
+			err = c.Join(ctx, *addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return "joined", nil
+	}))
+
+	mux.RegisterAsync(muxrpc.Method{"rooms", "leave"}, typemux.AsyncFunc(func(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+		roomRef, err := feedArg(req, "rooms.leave @room")
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Leave(roomRef); err != nil {
+			return nil, err
+		}
+		return "left", nil
+	}))
+
+	mux.RegisterAsync(muxrpc.Method{"rooms", "list"}, typemux.AsyncFunc(func(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+		var lst []string
+		for _, a := range c.Rooms() {
+			lst = append(lst, a.String())
+		}
+		return lst, nil
+	}))
+
+	mux.RegisterAsync(muxrpc.Method{"rooms", "attendants"}, typemux.AsyncFunc(func(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+		roomRef, err := feedArg(req, "rooms.attendants @room")
+		if err != nil {
+			return nil, err
+		}
+		return c.Attendants(roomRef)
+	}))
+
+	mux.RegisterAsync(muxrpc.Method{"rooms", "connect"}, typemux.AsyncFunc(func(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+		var args []*refs.FeedRef
+		if err := json.Unmarshal(req.RawArgs, &args); err != nil || len(args) != 2 {
+			return nil, fmt.Errorf("usage: rooms.connect @room @target")
+		}
+		if err := c.Connect(ctx, args[0], args[1]); err != nil {
+			return nil, err
+		}
+		return "connected", nil
+	}))
+
+	return &MasterPlugin{h: &mux}
+}
+
+func (MasterPlugin) Name() string              { return "rooms" }
+func (MasterPlugin) Method() muxrpc.Method     { return muxrpc.Method{"rooms"} }
+func (p MasterPlugin) Handler() muxrpc.Handler { return p.h }
+
+func feedArg(req *muxrpc.Request, usage string) (*refs.FeedRef, error) {
+	var args []*refs.FeedRef
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil || len(args) != 1 {
+		return nil, fmt.Errorf("usage: %s", usage)
+	}
+	return args[0], nil
+}
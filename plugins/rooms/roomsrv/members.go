@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: MIT
+
+package roomsrv
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	refs "go.mindeco.de/ssb-refs"
+	"modernc.org/kv"
+
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+)
+
+// ErrInvalidInvite is returned if an invite token is unknown or was already used
+var ErrInvalidInvite = errors.New("roomsrv: invalid invite")
+
+var (
+	prefixMember = []byte("member:")
+	prefixInvite = []byte("invite:")
+)
+
+// Member is an entry of the allow-list
+type Member struct {
+	ID    *refs.FeedRef `json:"id"`
+	Added time.Time     `json:"added"`
+	Note  string        `json:"note,omitempty"`
+}
+
+type inviteState struct {
+	Created time.Time `json:"created"`
+	Note    string    `json:"note,omitempty"`
+}
+
+// Members is the persistent allow-list of the room and the invites to it.
+// Invites can be used once, claiming one adds the caller to the allow-list.
+type Members struct {
+	mu sync.Mutex
+	kv *kv.DB
+}
+
+// Add puts ref on the allow-list
+func (m *Members) Add(ref *refs.FeedRef, note string) error {
+	data, err := json.Marshal(Member{ID: ref, Added: time.Now(), Note: note})
+	if err != nil {
+		return fmt.Errorf("roomsrv: failed to encode member: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.kv.Set(memberKey(ref), data)
+}
+
+// Remove deletes ref from the allow-list
+func (m *Members) Remove(ref *refs.FeedRef) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.kv.Delete(memberKey(ref))
+}
+
+// Has returns true if ref is on the allow-list
+func (m *Members) Has(ref *refs.FeedRef) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, err := m.kv.Get(nil, memberKey(ref))
+	if err != nil {
+		return false, fmt.Errorf("roomsrv: failed to look up member: %w", err)
+	}
+	return v != nil, nil
+}
+
+// List returns all the entries of the allow-list
+func (m *Members) List() ([]Member, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	en, _, err := m.kv.Seek(prefixMember)
+	if err != nil {
+		return nil, fmt.Errorf("roomsrv: failed to seek members: %w", err)
+	}
+
+	var lst []Member
+	for {
+		k, v, err := en.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("roomsrv: failed to iterate members: %w", err)
+		}
+		if !bytes.HasPrefix(k, prefixMember) {
+			break
+		}
+
+		var mem Member
+		if err := json.Unmarshal(v, &mem); err != nil {
+			return nil, fmt.Errorf("roomsrv: failed to decode member: %w", err)
+		}
+		lst = append(lst, mem)
+	}
+	return lst, nil
+}
+
+// CreateInvite returns a new, random token that can be used once to become a member
+func (m *Members) CreateInvite(note string) (string, error) {
+	var raw = make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("roomsrv: failed to generate invite: %w", err)
+	}
+	token := base64.URLEncoding.EncodeToString(raw)
+
+	data, err := json.Marshal(inviteState{Created: time.Now(), Note: note})
+	if err != nil {
+		return "", fmt.Errorf("roomsrv: failed to encode invite: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.kv.Set(inviteKey(token), data); err != nil {
+		return "", fmt.Errorf("roomsrv: failed to store invite: %w", err)
+	}
+	return token, nil
+}
+
+// ClaimInvite consumes the token and adds ref to the allow-list
+func (m *Members) ClaimInvite(token string, ref *refs.FeedRef) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.kv.BeginTransaction(); err != nil {
+		return err
+	}
+
+	v, err := m.kv.Get(nil, inviteKey(token))
+	if err != nil {
+		m.kv.Rollback()
+		return fmt.Errorf("roomsrv: failed to look up invite: %w", err)
+	}
+	if v == nil {
+		m.kv.Rollback()
+		return ErrInvalidInvite
+	}
+
+	var st inviteState
+	if err := json.Unmarshal(v, &st); err != nil {
+		m.kv.Rollback()
+		return fmt.Errorf("roomsrv: failed to decode invite: %w", err)
+	}
+
+	data, err := json.Marshal(Member{ID: ref, Added: time.Now(), Note: st.Note})
+	if err != nil {
+		m.kv.Rollback()
+		return fmt.Errorf("roomsrv: failed to encode member: %w", err)
+	}
+
+	if err := m.kv.Delete(inviteKey(token)); err != nil {
+		m.kv.Rollback()
+		return fmt.Errorf("roomsrv: failed to delete invite: %w", err)
+	}
+	if err := m.kv.Set(memberKey(ref), data); err != nil {
+		m.kv.Rollback()
+		return fmt.Errorf("roomsrv: failed to store member: %w", err)
+	}
+	return m.kv.Commit()
+}
+
+func memberKey(ref *refs.FeedRef) []byte {
+	return append(append([]byte{}, prefixMember...), storedrefs.Feed(ref)...)
+}
+
+func inviteKey(token string) []byte {
+	return append(append([]byte{}, prefixInvite...), token...)
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: MIT
+
+package roomsrv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+)
+
+// Plugins returns the public room.* and tunnel.* plugins
+func (s *Server) Plugins() []ssb.Plugin {
+	return []ssb.Plugin{
+		roomPlug{s},
+		tunnelPlug{s},
+	}
+}
+
+type roomPlug struct{ s *Server }
+
+func (roomPlug) Name() string              { return "room" }
+func (roomPlug) Method() muxrpc.Method     { return muxrpc.Method{"room"} }
+func (p roomPlug) Handler() muxrpc.Handler { return p.s }
+
+// tunnelPlug shares the handler with roomPlug but doesn't track the connection a second time
+type tunnelPlug struct{ s *Server }
+
+func (tunnelPlug) Name() string              { return "tunnel" }
+func (tunnelPlug) Method() muxrpc.Method     { return muxrpc.Method{"tunnel"} }
+func (p tunnelPlug) Handler() muxrpc.Handler { return callsOnly{p.s} }
+
+type callsOnly struct{ *Server }
+
+func (callsOnly) HandleConnect(context.Context, muxrpc.Endpoint) {}
+
+// GuestHandler is used for peers that aren't members of a restricted room. It only lets them claim an invite.
+func (s *Server) GuestHandler() muxrpc.Handler {
+	return guestHandler{s}
+}
+
+type guestHandler struct{ s *Server }
+
+func (guestHandler) Handled(m muxrpc.Method) bool {
+	return m.String() == "room.claimInvite" || m.String() == "tunnel.isRoom"
+}
+
+func (guestHandler) HandleConnect(context.Context, muxrpc.Endpoint) {}
+
+func (h guestHandler) HandleCall(ctx context.Context, req *muxrpc.Request) {
+	switch req.Method.String() {
+	case "tunnel.isRoom":
+		req.Return(ctx, true)
+
+	case "room.claimInvite":
+		var args []string
+		if err := json.Unmarshal(req.RawArgs, &args); err != nil || len(args) != 1 {
+			req.CloseWithError(fmt.Errorf("usage: room.claimInvite token"))
+			return
+		}
+		caller, err := ssb.GetFeedRefFromAddr(req.RemoteAddr())
+		if err != nil {
+			req.CloseWithError(err)
+			return
+		}
+		if err := h.s.Members.ClaimInvite(args[0], caller); err != nil {
+			req.CloseWithError(err)
+			return
+		}
+		h.s.logger.Log("invite", "claimed", "peer", caller.ShortRef())
+		req.Return(ctx, true)
+
+	default:
+		req.CloseWithError(fmt.Errorf("roomsrv: not a member of this room"))
+	}
+}
+
+// MasterPlugin offers the managment calls for the operator of the room
+func (s *Server) MasterPlugin(logger log.Logger) ssb.Plugin {
+	mux := typemux.New(logger)
+
+	mux.RegisterAsync(muxrpc.Method{"room", "attendants"}, typemux.AsyncFunc(func(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+		return s.Attendants(), nil
+	}))
+
+	mux.RegisterAsync(muxrpc.Method{"room", "members", "list"}, typemux.AsyncFunc(func(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+		return s.Members.List()
+	}))
+
+	mux.RegisterAsync(muxrpc.Method{"room", "members", "add"}, typemux.AsyncFunc(func(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+		var args []*refs.FeedRef
+		if err := json.Unmarshal(req.RawArgs, &args); err != nil || len(args) != 1 {
+			return nil, fmt.Errorf("usage: room.members.add @feed")
+		}
+		if err := s.Members.Add(args[0], ""); err != nil {
+			return nil, err
+		}
+		return "added", nil
+	}))
+
+	mux.RegisterAsync(muxrpc.Method{"room", "members", "remove"}, typemux.AsyncFunc(func(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+		var args []*refs.FeedRef
+		if err := json.Unmarshal(req.RawArgs, &args); err != nil || len(args) != 1 {
+			return nil, fmt.Errorf("usage: room.members.remove @feed")
+		}
+		if err := s.Members.Remove(args[0]); err != nil {
+			return nil, err
+		}
+		return "removed", nil
+	}))
+
+	mux.RegisterAsync(muxrpc.Method{"room", "invites", "create"}, typemux.AsyncFunc(func(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+		var args []struct {
+			Note string `json:"note"`
+		}
+		json.Unmarshal(req.RawArgs, &args)
+		var note string
+		if len(args) == 1 {
+			note = args[0].Note
+		}
+		return s.Members.CreateInvite(note)
+	}))
+
+	return masterPlug{h: &mux}
+}
+
+type masterPlug struct {
+	h muxrpc.Handler
+}
+
+func (masterPlug) Name() string              { return "room" }
+func (masterPlug) Method() muxrpc.Method     { return muxrpc.Method{"room"} }
+func (p masterPlug) Handler() muxrpc.Handler { return p.h }
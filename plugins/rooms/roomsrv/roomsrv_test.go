@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: MIT
+
+package roomsrv_test
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+	"golang.org/x/sync/errgroup"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/network/msaddr"
+	"go.cryptoscope.co/ssb/plugins/rooms/roomsrv"
+	"go.cryptoscope.co/ssb/repo"
+	"go.cryptoscope.co/ssb/sbot"
+)
+
+func TestMembers(t *testing.T) {
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	srv, err := roomsrv.New(log.NewNopLogger(), repo.New(testPath), newFeed(t), roomsrv.ModeRestricted)
+	r.NoError(err)
+	defer srv.Close()
+
+	alice := newFeed(t)
+	bob := newFeed(t)
+
+	r.Error(srv.Authorize(alice))
+
+	r.NoError(srv.Members.Add(alice, "friend"))
+	r.NoError(srv.Authorize(alice))
+
+	tok, err := srv.Members.CreateInvite("for bob")
+	r.NoError(err)
+	r.NoError(srv.Members.ClaimInvite(tok, bob))
+	r.NoError(srv.Authorize(bob))
+
+	err = srv.Members.ClaimInvite(tok, newFeed(t))
+	r.Equal(roomsrv.ErrInvalidInvite, err, "invite was used twice")
+
+	lst, err := srv.Members.List()
+	r.NoError(err)
+	r.Len(lst, 2)
+
+	r.NoError(srv.Members.Remove(alice))
+	r.Error(srv.Authorize(alice))
+
+	open, err := roomsrv.ParseMode("open")
+	r.NoError(err)
+	r.Equal(roomsrv.ModeOpen, open)
+	_, err = roomsrv.ParseMode("closed")
+	r.Error(err)
+}
+
+func TestTunnelThroughRoom(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	botgroup, ctx := errgroup.WithContext(ctx)
+
+	info := testutils.NewRelativeTimeLogger(nil)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	appKey := make([]byte, 32)
+	rand.Read(appKey)
+
+	mkBot := func(name string, opts ...sbot.Option) *sbot.Sbot {
+		opts = append(opts,
+			sbot.WithAppKey(appKey),
+			sbot.WithContext(ctx),
+			sbot.WithInfo(log.With(info, "peer", name)),
+			sbot.WithRepoPath(filepath.Join(testPath, name)),
+			sbot.WithListenAddr("localhost:0"),
+			sbot.WithPromisc(true),
+		)
+		bot, err := sbot.New(opts...)
+		r.NoError(err)
+		botgroup.Go(func() error {
+			err := bot.Network.Serve(ctx)
+			if err != nil && err != context.Canceled {
+				return err
+			}
+			return nil
+		})
+		return bot
+	}
+
+	room := mkBot("room", sbot.EnableRoomServer(roomsrv.ModeRestricted))
+	r.NotNil(room.Room)
+	r.Nil(room.Rooms)
+
+	ali := mkBot("ali")
+	bob := mkBot("bob")
+
+	roomAddr, err := msaddr.FromNetAddr(room.Network.GetListenAddr())
+	r.NoError(err)
+	roomAddr.Ref = room.KeyPair.Id
+
+	// ali is added by the operator, bob uses an invite
+	r.NoError(room.Room.Members.Add(ali.KeyPair.Id, ""))
+	tok, err := room.Room.Members.CreateInvite("")
+	r.NoError(err)
+
+	r.NoError(ali.Rooms.Join(ctx, *roomAddr))
+	r.NoError(bob.Rooms.JoinWithInvite(ctx, *roomAddr, tok))
+
+	r.Eventually(func() bool {
+		return len(room.Room.Attendants()) == 2
+	}, 5*time.Second, 100*time.Millisecond)
+
+	r.Eventually(func() bool {
+		lst, err := ali.Rooms.Attendants(room.KeyPair.Id)
+		return err == nil && len(lst) == 2
+	}, 5*time.Second, 100*time.Millisecond)
+
+	r.NoError(ali.Rooms.Connect(ctx, room.KeyPair.Id, bob.KeyPair.Id))
+
+	r.Eventually(func() bool {
+		_, has := ali.Network.GetEndpointFor(bob.KeyPair.Id)
+		return has
+	}, 5*time.Second, 100*time.Millisecond)
+
+	edp, _ := ali.Network.GetEndpointFor(bob.KeyPair.Id)
+	var who struct {
+		ID *refs.FeedRef `json:"id"`
+	}
+	err = edp.Async(ctx, &who, muxrpc.TypeJSON, muxrpc.Method{"whoami"})
+	r.NoError(err)
+	r.True(who.ID.Equal(bob.KeyPair.Id))
+
+	// the room didn't store any of their messages
+	_, has := room.GetMultiLog("userFeeds")
+	r.False(has)
+
+	// outsiders are not let in
+	eve := mkBot("eve")
+	r.NoError(eve.Rooms.Join(ctx, *roomAddr))
+	err = eve.Rooms.Connect(ctx, room.KeyPair.Id, bob.KeyPair.Id)
+	if err == nil {
+		time.Sleep(time.Second)
+		_, has := eve.Network.GetEndpointFor(bob.KeyPair.Id)
+		r.False(has, "eve shouldn't be able to connect to bob")
+	}
+	r.Len(room.Room.Attendants(), 2)
+
+	var bots = []*sbot.Sbot{room, ali, bob, eve}
+	for _, bot := range bots {
+		bot.Shutdown()
+	}
+	cancel()
+	for _, bot := range bots {
+		r.NoError(bot.Close())
+	}
+	r.NoError(botgroup.Wait())
+}
+
+func newFeed(t *testing.T) *refs.FeedRef {
+	kp, err := ssb.NewKeyPair(nil)
+	require.NoError(t, err)
+	return kp.Id
+}
@@ -0,0 +1,386 @@
+// SPDX-License-Identifier: MIT
+
+// Package roomsrv implements the server side of ssb rooms.
+//
+// A room relays tunnel.connect streams between it's attendants. The streams are end-to-end encrypted by the peers,
+// the room only sees the boxstream ciphertext and doesn't store any of their feeds.
+// Who can become an attendant depends on the Mode: everyone (open) or only peers on the allow-list (restricted).
+// Peers can be put on the allow-list by the operator directly or by claiming an invite.
+package roomsrv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/plugins/rooms"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// Mode defines who can use the room
+type Mode uint
+
+const (
+	// ModeRestricted only lets members of the allow-list into the room
+	ModeRestricted Mode = iota
+
+	// ModeOpen lets everyone into the room
+	ModeOpen
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeRestricted:
+		return "restricted"
+	case ModeOpen:
+		return "open"
+	}
+	return fmt.Sprintf("unknown(%d)", uint(m))
+}
+
+// ParseMode returns the Mode for "open" or "restricted"
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "restricted":
+		return ModeRestricted, nil
+	case "open":
+		return ModeOpen, nil
+	}
+	return 0, fmt.Errorf("roomsrv: unknown mode: %q", s)
+}
+
+// ErrNotAttendant is returned if a tunnel is requested to a peer that isn't in the room
+var ErrNotAttendant = errors.New("roomsrv: peer is not in the room")
+
+// Server keeps track of the attendants and relays tunnels between them
+type Server struct {
+	logger log.Logger
+
+	self *refs.FeedRef
+	mode Mode
+
+	Members *Members
+
+	mu         sync.Mutex
+	endpoints  map[string]muxrpc.Endpoint
+	attendants map[string]*refs.FeedRef
+
+	changes luigi.Sink
+	bcast   luigi.Broadcast
+}
+
+var _ ssb.Authorizer = (*Server)(nil)
+
+// New opens the allow-list in the repo and returns a room server
+func New(logger log.Logger, r repo.Interface, self *refs.FeedRef, mode Mode) (*Server, error) {
+	db, err := repo.OpenMKV(r.GetPath("plugin", "rooms"))
+	if err != nil {
+		return nil, fmt.Errorf("roomsrv: failed to open key-value database: %w", err)
+	}
+
+	s := &Server{
+		logger: logger,
+
+		self: self,
+		mode: mode,
+
+		Members: &Members{kv: db},
+
+		endpoints:  make(map[string]muxrpc.Endpoint),
+		attendants: make(map[string]*refs.FeedRef),
+	}
+	s.changes, s.bcast = luigi.NewBroadcast()
+	return s, nil
+}
+
+// Close closes the allow-list database
+func (s *Server) Close() error { return s.Members.kv.Close() }
+
+// Mode returns the mode the room was created with
+func (s *Server) Mode() Mode { return s.mode }
+
+// Authorize decides if remote gets the full room handler or just the GuestHandler
+func (s *Server) Authorize(remote *refs.FeedRef) error {
+	if s.mode == ModeOpen {
+		return nil
+	}
+	has, err := s.Members.Has(remote)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return fmt.Errorf("roomsrv: %s is not a member", remote.ShortRef())
+	}
+	return nil
+}
+
+// Attendants returns the sorted list of peers that are currently in the room
+func (s *Server) Attendants() []*refs.FeedRef {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attendantList()
+}
+
+func (s *Server) attendantList() []*refs.FeedRef {
+	lst := make([]*refs.FeedRef, 0, len(s.attendants))
+	for _, a := range s.attendants {
+		lst = append(lst, a)
+	}
+	sort.Slice(lst, func(i, j int) bool { return lst[i].Ref() < lst[j].Ref() })
+	return lst
+}
+
+func (s *Server) join(ctx context.Context, ref *refs.FeedRef) {
+	s.mu.Lock()
+	_, had := s.attendants[ref.Ref()]
+	s.attendants[ref.Ref()] = ref
+	s.mu.Unlock()
+	if had {
+		return
+	}
+	level.Debug(s.logger).Log("event", "attendant joined", "peer", ref.ShortRef())
+	s.changes.Pour(ctx, rooms.AttendantsEvent{Type: "joined", ID: ref})
+}
+
+func (s *Server) leave(ctx context.Context, ref *refs.FeedRef) {
+	s.mu.Lock()
+	_, had := s.attendants[ref.Ref()]
+	delete(s.attendants, ref.Ref())
+	s.mu.Unlock()
+	if !had {
+		return
+	}
+	level.Debug(s.logger).Log("event", "attendant left", "peer", ref.ShortRef())
+	s.changes.Pour(ctx, rooms.AttendantsEvent{Type: "left", ID: ref})
+}
+
+// subscribe registers fn for changes to the attendants.
+// The first call of fn is done with the current state before subscribe returns.
+func (s *Server) subscribe(ctx context.Context, fn func(rooms.AttendantsEvent) error) (func(), error) {
+	var sendMu sync.Mutex
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := fn(rooms.AttendantsEvent{Type: "state", IDs: s.attendantList()})
+	if err != nil {
+		return nil, err
+	}
+
+	done := s.bcast.Register(luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			return nil
+		}
+		evt, ok := v.(rooms.AttendantsEvent)
+		if !ok {
+			return nil
+		}
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return fn(evt)
+	}))
+	return done, nil
+}
+
+// muxrpc handler
+
+// Handled returns true for the room.* and tunnel.* calls of the room
+func (s *Server) Handled(m muxrpc.Method) bool {
+	switch m.String() {
+	case "room.announce", "room.leave", "room.attendants",
+		"tunnel.announce", "tunnel.leave", "tunnel.endpoints", "tunnel.connect", "tunnel.isRoom", "tunnel.ping":
+		return true
+	}
+	return false
+}
+
+// HandleConnect remembers the endpoint for relaying tunnels and removes the peer from the attendants once it disconnects
+func (s *Server) HandleConnect(ctx context.Context, edp muxrpc.Endpoint) {
+	remote, err := ssb.GetFeedRefFromAddr(edp.Remote())
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.endpoints[remote.Ref()] = edp
+	s.mu.Unlock()
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	current, has := s.endpoints[remote.Ref()]
+	stale := has && current != edp
+	if !stale {
+		delete(s.endpoints, remote.Ref())
+	}
+	s.mu.Unlock()
+
+	// a newer connection of the same peer took over
+	if stale {
+		return
+	}
+	s.leave(context.Background(), remote)
+}
+
+// HandleCall dispatches the room calls
+func (s *Server) HandleCall(ctx context.Context, req *muxrpc.Request) {
+	caller, err := ssb.GetFeedRefFromAddr(req.RemoteAddr())
+	if err != nil {
+		req.CloseWithError(err)
+		return
+	}
+
+	switch req.Method.String() {
+	case "tunnel.isRoom":
+		req.Return(ctx, true)
+
+	case "tunnel.ping":
+		req.Return(ctx, true)
+
+	case "room.announce", "tunnel.announce":
+		s.join(ctx, caller)
+		req.Return(ctx, true)
+
+	case "room.leave", "tunnel.leave":
+		s.leave(ctx, caller)
+		req.Return(ctx, true)
+
+	case "room.attendants":
+		err = s.streamAttendants(ctx, req, func(evt rooms.AttendantsEvent) interface{} {
+			return evt
+		})
+
+	case "tunnel.endpoints":
+		err = s.streamAttendants(ctx, req, func(rooms.AttendantsEvent) interface{} {
+			return s.Attendants()
+		})
+
+	case "tunnel.connect":
+		err = s.relay(ctx, req, caller)
+
+	default:
+		err = fmt.Errorf("roomsrv: unhandled call: %s", req.Method)
+	}
+
+	if err != nil {
+		level.Debug(s.logger).Log("event", "call failed", "method", req.Method.String(), "peer", caller.ShortRef(), "err", err)
+		req.CloseWithError(err)
+	}
+}
+
+// streamAttendants sends the current state and all changes to the caller until it closes the stream.
+// transform decides what is sent for each event.
+func (s *Server) streamAttendants(ctx context.Context, req *muxrpc.Request, transform func(rooms.AttendantsEvent) interface{}) error {
+	if req.Type != "source" {
+		return fmt.Errorf("%s: invalid type: %s", req.Method, req.Type)
+	}
+
+	snk, err := req.ResponseSink()
+	if err != nil {
+		return err
+	}
+	snk.SetEncoding(muxrpc.TypeJSON)
+	enc := json.NewEncoder(snk)
+
+	done, err := s.subscribe(ctx, func(evt rooms.AttendantsEvent) error {
+		return enc.Encode(transform(evt))
+	})
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	<-ctx.Done()
+	return snk.Close()
+}
+
+// relay forwards the duplex stream of the caller to the target by opening a tunnel.connect stream to it
+func (s *Server) relay(ctx context.Context, req *muxrpc.Request, origin *refs.FeedRef) error {
+	if req.Type != "duplex" {
+		return fmt.Errorf("tunnel.connect: invalid type: %s", req.Type)
+	}
+
+	var args []rooms.ConnectArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return fmt.Errorf("tunnel.connect: invalid arguments: %w", err)
+	}
+	if n := len(args); n != 1 {
+		return fmt.Errorf("tunnel.connect: expected one argument but got %d", n)
+	}
+	target := args[0].Target
+	if target == nil {
+		return errors.New("tunnel.connect: missing target")
+	}
+	if target.Equal(origin) {
+		return errors.New("tunnel.connect: can't connect to self")
+	}
+
+	s.mu.Lock()
+	_, isAttendant := s.attendants[target.Ref()]
+	targetEdp, has := s.endpoints[target.Ref()]
+	s.mu.Unlock()
+	if !isAttendant || !has {
+		return ErrNotAttendant
+	}
+
+	fwd := rooms.ConnectArgs{Portal: s.self, Target: target, Origin: origin}
+	targetSrc, targetSnk, err := targetEdp.Duplex(ctx, muxrpc.TypeBinary, muxrpc.Method{"tunnel", "connect"}, fwd)
+	if err != nil {
+		return fmt.Errorf("tunnel.connect: failed to call target: %w", err)
+	}
+
+	originSnk, err := req.ResponseSink()
+	if err != nil {
+		return err
+	}
+	originSrc, err := req.ResponseSource()
+	if err != nil {
+		return err
+	}
+	originSnk.SetEncoding(muxrpc.TypeBinary)
+	targetSnk.SetEncoding(muxrpc.TypeBinary)
+
+	level.Debug(s.logger).Log("event", "relaying tunnel", "origin", origin.ShortRef(), "target", target.ShortRef())
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- pipe(ctx, originSrc, targetSnk)
+	}()
+	err = pipe(ctx, targetSrc, originSnk)
+	cancel()
+	if err2 := <-errc; err == nil {
+		err = err2
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// pipe copies every packet from src to snk and closes snk once src ends
+func pipe(ctx context.Context, src *muxrpc.ByteSource, snk *muxrpc.ByteSink) error {
+	defer snk.Close()
+	for src.Next(ctx) {
+		err := src.Reader(func(r io.Reader) error {
+			_, err := io.Copy(snk, r)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return src.Err()
+}
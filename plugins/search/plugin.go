@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: MIT
+
+// Package search supplies search.query, a source of message keys ranked by how well their text matches the query.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/search"
+)
+
+type Plugin struct {
+	h muxrpc.Handler
+}
+
+func NewPlugin(logger log.Logger, searcher *search.Searcher, isSelf ssb.Authorizer) *Plugin {
+	mux := typemux.New(logger)
+
+	mux.RegisterSource(muxrpc.Method{"search", "query"}, queryHandler{
+		searcher: searcher,
+		isSelf:   isSelf,
+	})
+
+	return &Plugin{
+		h: &mux,
+	}
+}
+
+func (lt Plugin) Name() string            { return "search" }
+func (Plugin) Method() muxrpc.Method      { return muxrpc.Method{"search"} }
+func (lt Plugin) Handler() muxrpc.Handler { return lt.h }
+
+type queryHandler struct {
+	searcher *search.Searcher
+
+	isSelf ssb.Authorizer
+}
+
+// HandleSource sends one message.SearchReply per match, the best ones first.
+// The argument is either a message.SearchArgs object or just the query string.
+func (h queryHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
+	var qry message.SearchArgs
+
+	var args []message.SearchArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		var strs []string
+		if err := json.Unmarshal(req.RawArgs, &strs); err != nil || len(strs) != 1 {
+			return fmt.Errorf("search.query: bad request data: %w", err)
+		}
+		qry.Query = strs[0]
+	} else {
+		if n := len(args); n != 1 {
+			return fmt.Errorf("search.query: expected one argument but got %d", n)
+		}
+		qry = args[0]
+	}
+
+	if qry.Query == "" {
+		return fmt.Errorf("search.query: empty query")
+	}
+
+	if qry.Private {
+		if err := ssb.AuthorizePrivate(req, h.isSelf); err != nil {
+			return fmt.Errorf("search.query: %w", err)
+		}
+	}
+
+	results, err := h.searcher.Search(search.Spec{
+		Query:   qry.Query,
+		Private: qry.Private,
+		Limit:   qry.Limit,
+	})
+	if err != nil {
+		return fmt.Errorf("search.query: failed: %w", err)
+	}
+
+	snk.SetEncoding(muxrpc.TypeJSON)
+	for _, res := range results {
+		b, err := json.Marshal(message.SearchReply{
+			Key:   res.Key,
+			Score: res.Score,
+		})
+		if err != nil {
+			return fmt.Errorf("search.query: failed to encode reply: %w", err)
+		}
+		if _, err := snk.Write(b); err != nil {
+			return err
+		}
+	}
+	return snk.Close()
+}
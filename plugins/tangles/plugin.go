@@ -6,23 +6,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 
-	bmap "github.com/RoaringBitmap/roaring"
-	"github.com/davecgh/go-spew/spew"
 	"github.com/go-kit/kit/log"
-	"go.cryptoscope.co/librarian"
-	"go.cryptoscope.co/luigi"
-	"go.cryptoscope.co/margaret"
-	"go.cryptoscope.co/margaret/multilog/roaring"
 	"go.cryptoscope.co/muxrpc/v2"
 
 	"go.cryptoscope.co/muxrpc/v2/typemux"
 	"go.cryptoscope.co/ssb"
-	"go.cryptoscope.co/ssb/internal/mutil"
 	"go.cryptoscope.co/ssb/internal/transform"
 	"go.cryptoscope.co/ssb/message"
-	"go.cryptoscope.co/ssb/private"
+	"go.cryptoscope.co/ssb/query"
 	refs "go.mindeco.de/ssb-refs"
 )
 
@@ -30,16 +22,11 @@ type Plugin struct {
 	h muxrpc.Handler
 }
 
-func NewPlugin(rxlog margaret.Log, tangles, private *roaring.MultiLog, unboxer *private.Manager, isSelf ssb.Authorizer) *Plugin {
+func NewPlugin(planner *query.Planner, isSelf ssb.Authorizer) *Plugin {
 	mux := typemux.New(log.NewNopLogger())
 
 	mux.RegisterSource(muxrpc.Method{"tangles", "replies"}, repliesHandler{
-		rxlog:   rxlog,
-		tangles: tangles,
-
-		// private utils
-		private: private,
-		unboxer: unboxer,
+		planner: planner,
 		isSelf:  isSelf,
 	})
 
@@ -65,14 +52,12 @@ func (Plugin) Method() muxrpc.Method      { return muxrpc.Method{"tangles"} }
 func (lt Plugin) Handler() muxrpc.Handler { return lt.h }
 
 type repliesHandler struct {
-	rxlog   margaret.Log
-	tangles *roaring.MultiLog
-	private *roaring.MultiLog
+	planner *query.Planner
 
-	isSelf  ssb.Authorizer
-	unboxer *private.Manager
+	isSelf ssb.Authorizer
 }
 
+// HandleSource sends the messages of a tangle, sorted by their claimed timestamps.
 func (g repliesHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
 	var qryarr []message.TanglesArgs
 	var qry message.TanglesArgs
@@ -113,101 +98,28 @@ func (g repliesHandler) HandleSource(ctx context.Context, req *muxrpc.Request, s
 		return fmt.Errorf("not authroized")
 	}
 
-	fmt.Println("query for:", qry.Root.Ref())
-	spew.Dump(qry)
+	if qry.Root == nil {
+		return fmt.Errorf("bad request - missing root")
+	}
 
 	// create toJSON sink
 	lsnk := transform.NewKeyValueWrapper(snk, qry.Keys)
 
-	// lookup address depending if we have a name for the tangle or not
-	addr := librarian.Addr(append([]byte("v1:"), qry.Root.Hash...))
-	if qry.Name != "" {
-		addr = librarian.Addr("v2:"+qry.Name+":") + librarian.Addr(qry.Root.Hash)
-	}
-
-	// TODO: needs same kind of refactor that messagesByType needs
-
-	if qry.Live {
-		if qry.Private {
-			return fmt.Errorf("TODO: fix live && private")
-		}
-		threadLog, err := g.tangles.Get(addr)
-		if err != nil {
-			return fmt.Errorf("failed to load thread: %w", err)
-		}
-
-		src, err := mutil.Indirect(g.rxlog, threadLog).Query(margaret.Limit(int(qry.Limit)), margaret.Live(qry.Live), margaret.Reverse(qry.Reverse))
-		if err != nil {
-			return fmt.Errorf("tangle: failed to create query: %w", err)
-		}
-
-		err = luigi.Pump(ctx, lsnk, src)
-		if err != nil {
-			return fmt.Errorf("tangle: failed to pump msgs: %w", err)
-		}
-
-		return snk.Close()
-	}
-
-	// not live
-	threadBmap, err := g.tangles.LoadInternalBitmap(addr)
-	if err != nil {
-		// TODO: check err == persist: not found
-		return snk.Close()
-	}
-
-	if qry.Private {
-		lsnk = g.unboxer.WrappedUnboxingSink(lsnk)
-	} else {
-		// filter all boxed messages from the stream
-		box1, err := g.private.LoadInternalBitmap(librarian.Addr("meta:box1"))
-		if err != nil {
-			// TODO: compare not found
-			// return errors.Wrap(err, "failed to load bmap for box1")
-			box1 = bmap.New()
-		}
-
-		box2, err := g.private.LoadInternalBitmap(librarian.Addr("meta:box2"))
-		if err != nil {
-			// TODO: compare not found
-			// return errors.Wrap(err, "failed to load bmap for box2")
-			box2 = bmap.New()
-		}
-
-		box1.Or(box2) // all the boxed messages
-
-		// remove all the boxed ones from the type we are looking up
-		threadBmap.AndNot(box1)
-	}
-
 	// TODO: sort by previous
-
-	it := threadBmap.Iterator()
-
-	for it.HasNext() {
-		seq := margaret.BaseSeq(it.Next())
-		v, err := g.rxlog.Get(seq)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "tangles failed to get seq:", seq, " with:", err)
-			continue
-		}
-
-		// skip nulled
-		if verr, ok := v.(error); ok && margaret.IsErrNulled(verr) {
-			continue
-		}
-
-		if err := lsnk.Pour(ctx, v); err != nil {
-			fmt.Fprintln(os.Stderr, "tangles failed send:", seq, " with:", err)
-			break
-		}
-
-		if qry.Limit >= 0 {
-			qry.Limit--
-			if qry.Limit == 0 {
-				break
-			}
-		}
+	err = g.planner.Run(ctx, lsnk, query.Spec{
+		Tangle:     qry.Root,
+		TangleName: qry.Name,
+		Private:    qry.Private,
+
+		Order:   query.OrderClaimed,
+		Gt:      query.ArgBound(qry.Gt),
+		Lt:      query.ArgBound(qry.Lt),
+		Reverse: qry.Reverse,
+		Limit:   qry.Limit,
+		Live:    qry.Live,
+	})
+	if err != nil {
+		return fmt.Errorf("tangle: query failed: %w", err)
 	}
 
 	return lsnk.Close()
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: MIT
+
+package threads
+
+import (
+	"encoding/json"
+	"sort"
+
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// previousLinks returns the messages this one replies to.
+// That is content.branch for v1 threads and content.tangles[name].previous for v2 tangles.
+func previousLinks(content []byte, name string) []string {
+	var c struct {
+		Branch  json.RawMessage            `json:"branch"`
+		Tangles map[string]json.RawMessage `json:"tangles"`
+	}
+	if err := json.Unmarshal(content, &c); err != nil {
+		return nil
+	}
+
+	raw := c.Branch
+	if name != "" {
+		var tp struct {
+			Previous json.RawMessage `json:"previous"`
+		}
+		json.Unmarshal(c.Tangles[name], &tp)
+		raw = tp.Previous
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	// a single ref or a list of them
+	var links []string
+	if err := json.Unmarshal(raw, &links); err != nil {
+		var link string
+		if err := json.Unmarshal(raw, &link); err != nil {
+			return nil
+		}
+		links = []string{link}
+	}
+	return links
+}
+
+// causalOrder sorts the replies of a thread so that each message comes after the ones it links to as previous.
+// Messages that aren't ordered by their links are sorted by their claimed timestamp.
+// Links to unknown messages are ignored, as if they pointed to the root.
+func causalOrder(replies []refs.Message, name string) []refs.Message {
+	var (
+		byKey    = make(map[string]int, len(replies))
+		indegree = make([]int, len(replies))
+		next     = make([][]int, len(replies))
+	)
+	for i, msg := range replies {
+		byKey[msg.Key().Ref()] = i
+	}
+
+	for i, msg := range replies {
+		seen := make(map[int]struct{})
+		for _, prev := range previousLinks(msg.ContentBytes(), name) {
+			p, has := byKey[prev]
+			if !has || p == i {
+				continue
+			}
+			if _, dup := seen[p]; dup {
+				continue
+			}
+			seen[p] = struct{}{}
+			next[p] = append(next[p], i)
+			indegree[i]++
+		}
+	}
+
+	earlier := func(a, b int) bool {
+		ta, tb := replies[a].Claimed(), replies[b].Claimed()
+		if ta.Equal(tb) {
+			return replies[a].Key().Ref() < replies[b].Key().Ref()
+		}
+		return ta.Before(tb)
+	}
+
+	var ready []int
+	for i, d := range indegree {
+		if d == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	sorted := make([]refs.Message, 0, len(replies))
+	done := make([]bool, len(replies))
+	for len(sorted) < len(replies) {
+		if len(ready) == 0 {
+			// a cycle, which can only come from broken messages. Continue with the oldest one left.
+			for i := range replies {
+				if !done[i] && (len(ready) == 0 || earlier(i, ready[0])) {
+					ready = []int{i}
+				}
+			}
+		}
+
+		sort.Slice(ready, func(a, b int) bool { return earlier(ready[a], ready[b]) })
+		i := ready[0]
+		ready = ready[1:]
+		if done[i] {
+			continue
+		}
+		done[i] = true
+		sorted = append(sorted, replies[i])
+
+		for _, n := range next[i] {
+			indegree[n]--
+			if indegree[n] == 0 && !done[n] {
+				ready = append(ready, n)
+			}
+		}
+	}
+	return sorted
+}
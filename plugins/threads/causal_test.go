@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MIT
+
+package threads
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cryptix/go/encodedTime"
+	"github.com/stretchr/testify/require"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+func TestCausalOrder(t *testing.T) {
+	r := require.New(t)
+
+	mkRef := func(name string) *refs.MessageRef {
+		h := sha256.Sum256([]byte(name))
+		return &refs.MessageRef{Hash: h[:], Algo: refs.RefAlgoMessageSSB1}
+	}
+	root := mkRef("root")
+
+	start := time.Unix(1600000000, 0)
+	mkMsg := func(name string, minute int, content string) refs.Message {
+		var kv refs.KeyValueRaw
+		kv.Key_ = mkRef(name)
+		kv.Value.Timestamp = encodedTime.Millisecs(start.Add(time.Duration(minute) * time.Minute))
+		kv.Value.Content = []byte(content)
+		return kv
+	}
+
+	// c claims to be older than b but replies to it, d has a broken clock and replies to a and c
+	a := mkMsg("a", 1, fmt.Sprintf(`{"type":"post","root":%q,"branch":%q}`, root.Ref(), root.Ref()))
+	b := mkMsg("b", 3, fmt.Sprintf(`{"type":"post","root":%q,"branch":%q}`, root.Ref(), a.Key().Ref()))
+	c := mkMsg("c", 2, fmt.Sprintf(`{"type":"post","root":%q,"branch":[%q]}`, root.Ref(), b.Key().Ref()))
+	d := mkMsg("d", 0, fmt.Sprintf(`{"type":"post","root":%q,"branch":[%q,%q]}`, root.Ref(), a.Key().Ref(), c.Key().Ref()))
+	// unknown branch, sorted by time
+	e := mkMsg("e", 4, fmt.Sprintf(`{"type":"post","root":%q,"branch":%q}`, root.Ref(), mkRef("missing").Ref()))
+
+	keys := func(msgs []refs.Message) []string {
+		var lst []string
+		for _, m := range msgs {
+			lst = append(lst, m.Key().Ref())
+		}
+		return lst
+	}
+
+	sorted := causalOrder([]refs.Message{e, d, c, b, a}, "")
+	r.Equal(keys([]refs.Message{a, b, c, d, e}), keys(sorted))
+
+	// v2 tangles use previous
+	g1 := mkMsg("g1", 2, fmt.Sprintf(`{"type":"post","tangles":{"group":{"root":%q,"previous":[%q]}}}`, root.Ref(), root.Ref()))
+	g2 := mkMsg("g2", 1, fmt.Sprintf(`{"type":"post","tangles":{"group":{"root":%q,"previous":[%q]}}}`, root.Ref(), g1.Key().Ref()))
+	r.Equal(keys([]refs.Message{g1, g2}), keys(causalOrder([]refs.Message{g2, g1}, "group")))
+	// without the name they are just sorted by time
+	r.Equal(keys([]refs.Message{g2, g1}), keys(causalOrder([]refs.Message{g1, g2}, "")))
+}
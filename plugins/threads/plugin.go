@@ -0,0 +1,402 @@
+// SPDX-License-Identifier: MIT
+
+// Package threads supplies views on discussions: whole threads in causal order (threads.get), the most recently active ones (threads.recent)
+// and posts grouped by their channel field (channels.list and channels.read).
+// They are answered by the query planner, using the tangles and type indexes.
+package threads
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cryptix/go/encodedTime"
+	"github.com/go-kit/kit/log"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/transform"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/private"
+	"go.cryptoscope.co/ssb/query"
+)
+
+type Plugin struct {
+	name   string
+	method muxrpc.Method
+	h      muxrpc.Handler
+}
+
+// NewPlugin returns the threads plugin with get and recent.
+// get is used to look up the root of a thread, unboxer to decrypt it for private threads.
+func NewPlugin(logger log.Logger, planner *query.Planner, get ssb.Getter, unboxer *private.Manager, isSelf ssb.Authorizer) *Plugin {
+	mux := typemux.New(logger)
+
+	mux.RegisterAsync(muxrpc.Method{"threads", "get"}, getHandler{
+		planner: planner,
+		get:     get,
+		unboxer: unboxer,
+		isSelf:  isSelf,
+	})
+
+	mux.RegisterSource(muxrpc.Method{"threads", "recent"}, recentHandler{
+		planner: planner,
+		isSelf:  isSelf,
+	})
+
+	return &Plugin{
+		name:   "threads",
+		method: muxrpc.Method{"threads"},
+		h:      &mux,
+	}
+}
+
+// NewChannelsPlugin returns the channels plugin with list and read
+func NewChannelsPlugin(logger log.Logger, planner *query.Planner, isSelf ssb.Authorizer) *Plugin {
+	mux := typemux.New(logger)
+
+	mux.RegisterSource(muxrpc.Method{"channels", "list"}, listHandler{
+		planner: planner,
+		isSelf:  isSelf,
+	})
+
+	mux.RegisterSource(muxrpc.Method{"channels", "read"}, readHandler{
+		planner: planner,
+		isSelf:  isSelf,
+	})
+
+	return &Plugin{
+		name:   "channels",
+		method: muxrpc.Method{"channels"},
+		h:      &mux,
+	}
+}
+
+func (p Plugin) Name() string            { return p.name }
+func (p Plugin) Method() muxrpc.Method   { return p.method }
+func (p Plugin) Handler() muxrpc.Handler { return p.h }
+
+type getHandler struct {
+	planner *query.Planner
+	get     ssb.Getter
+	unboxer *private.Manager
+
+	isSelf ssb.Authorizer
+}
+
+// HandleAsync returns a message.ThreadReply. The argument is either message.ThreadArgs or just the root.
+func (h getHandler) HandleAsync(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	var qry message.ThreadArgs
+
+	var args []message.ThreadArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		var roots []*refs.MessageRef
+		if err := json.Unmarshal(req.RawArgs, &roots); err != nil || len(roots) != 1 {
+			return nil, fmt.Errorf("threads.get: bad request data: %w", err)
+		}
+		qry.Root = roots[0]
+	} else {
+		if n := len(args); n != 1 {
+			return nil, fmt.Errorf("threads.get: expected one argument but got %d", n)
+		}
+		qry = args[0]
+	}
+
+	if qry.Root == nil {
+		return nil, fmt.Errorf("threads.get: missing root")
+	}
+
+	if qry.Private {
+		if err := ssb.AuthorizePrivate(req, h.isSelf); err != nil {
+			return nil, fmt.Errorf("threads.get: %w", err)
+		}
+	}
+
+	var replies []refs.Message
+	err := h.planner.Iterate(ctx, query.Spec{
+		Tangle:     qry.Root,
+		TangleName: qry.Name,
+		Private:    qry.Private,
+		Order:      query.OrderClaimed,
+	}, func(_ context.Context, res query.Result) error {
+		replies = append(replies, res.Message)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("threads.get: query failed: %w", err)
+	}
+
+	var thread []refs.Message
+	if root := h.loadRoot(qry.Root, qry.Private); root != nil {
+		thread = append(thread, root)
+	}
+	thread = append(thread, causalOrder(replies, qry.Name)...)
+
+	reply := message.ThreadReply{
+		Root:       qry.Root,
+		Messages:   make([]refs.KeyValueRaw, len(thread)),
+		ReplyCount: len(replies),
+	}
+	for i, msg := range thread {
+		reply.Messages[i] = toKeyValue(msg)
+		if ts := toMillis(msg); ts > reply.LatestActivity {
+			reply.LatestActivity = ts
+		}
+	}
+	return reply, nil
+}
+
+// loadRoot returns nil if the root isn't stored or can't be read
+func (h getHandler) loadRoot(ref *refs.MessageRef, private bool) refs.Message {
+	msg, err := h.get.Get(*ref)
+	if err != nil {
+		return nil
+	}
+
+	content := msg.ContentBytes()
+	if len(content) > 0 && content[0] != '{' {
+		if !private || h.unboxer == nil {
+			return nil
+		}
+		unboxed, err := h.unboxer.UnboxedMessage(msg)
+		if err != nil {
+			return nil
+		}
+		return unboxed
+	}
+	return msg
+}
+
+type recentHandler struct {
+	planner *query.Planner
+
+	isSelf ssb.Authorizer
+}
+
+var errEnough = errors.New("threads: limit reached")
+
+// HandleSource sends one message.ThreadSummary per thread, ordered by the claimed timestamp of their newest post.
+func (h recentHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
+	var qry message.RecentThreadsArgs
+
+	var args []message.RecentThreadsArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return fmt.Errorf("threads.recent: bad request data: %w", err)
+	}
+	if n := len(args); n == 1 {
+		qry = args[0]
+	} else if n > 1 {
+		return fmt.Errorf("threads.recent: expected one argument but got %d", n)
+	}
+
+	if qry.Private {
+		if err := ssb.AuthorizePrivate(req, h.isSelf); err != nil {
+			return fmt.Errorf("threads.recent: %w", err)
+		}
+	}
+
+	snk.SetEncoding(muxrpc.TypeJSON)
+
+	var (
+		seen = make(map[string]struct{})
+		sent int64
+	)
+	err := h.planner.Iterate(ctx, query.Spec{
+		Type:    "post",
+		Private: qry.Private,
+		Order:   query.OrderClaimed,
+		Reverse: true,
+	}, func(ctx context.Context, res query.Result) error {
+		root := threadRoot(res.Message)
+		if _, has := seen[root.Ref()]; has {
+			return nil
+		}
+		seen[root.Ref()] = struct{}{}
+
+		replies, err := h.planner.Bitmap(query.Spec{Tangle: root, Private: qry.Private})
+		if err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(message.ThreadSummary{
+			Root:           root,
+			Latest:         res.Message.Key(),
+			LatestActivity: res.Cursor.By,
+			ReplyCount:     int(replies.GetCardinality()),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode summary: %w", err)
+		}
+		if _, err := snk.Write(b); err != nil {
+			return err
+		}
+
+		sent++
+		if qry.Limit > 0 && sent >= qry.Limit {
+			return errEnough
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errEnough) {
+		return fmt.Errorf("threads.recent: query failed: %w", err)
+	}
+	return snk.Close()
+}
+
+// threadRoot returns content.root of a reply or the key of the message itself, if it starts a thread
+func threadRoot(msg refs.Message) *refs.MessageRef {
+	var c struct {
+		Root json.RawMessage `json:"root"`
+	}
+	if err := json.Unmarshal(msg.ContentBytes(), &c); err == nil && len(c.Root) > 0 {
+		var root *refs.MessageRef
+		if err := json.Unmarshal(c.Root, &root); err == nil && root != nil {
+			return root
+		}
+	}
+	return msg.Key()
+}
+
+type listHandler struct {
+	planner *query.Planner
+
+	isSelf ssb.Authorizer
+}
+
+// HandleSource sends one message.ChannelSummary per channel that has posts, the most recently active first.
+func (h listHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
+	var qry message.ChannelsListArgs
+
+	var args []message.ChannelsListArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return fmt.Errorf("channels.list: bad request data: %w", err)
+	}
+	if n := len(args); n == 1 {
+		qry = args[0]
+	} else if n > 1 {
+		return fmt.Errorf("channels.list: expected one argument but got %d", n)
+	}
+
+	if qry.Private {
+		if err := ssb.AuthorizePrivate(req, h.isSelf); err != nil {
+			return fmt.Errorf("channels.list: %w", err)
+		}
+	}
+
+	channels := make(map[string]*message.ChannelSummary)
+	err := h.planner.Iterate(ctx, query.Spec{
+		Type:    "post",
+		Private: qry.Private,
+		Order:   query.OrderClaimed,
+	}, func(_ context.Context, res query.Result) error {
+		var c struct {
+			Channel string `json:"channel"`
+		}
+		json.Unmarshal(res.Message.ContentBytes(), &c)
+		name := strings.TrimPrefix(c.Channel, "#")
+		if name == "" {
+			return nil
+		}
+
+		ch, has := channels[name]
+		if !has {
+			ch = &message.ChannelSummary{Channel: name}
+			channels[name] = ch
+		}
+		ch.Count++
+		if res.Cursor.By > ch.LatestActivity {
+			ch.LatestActivity = res.Cursor.By
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("channels.list: query failed: %w", err)
+	}
+
+	list := make([]*message.ChannelSummary, 0, len(channels))
+	for _, ch := range channels {
+		list = append(list, ch)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].LatestActivity != list[j].LatestActivity {
+			return list[i].LatestActivity > list[j].LatestActivity
+		}
+		return list[i].Channel < list[j].Channel
+	})
+
+	snk.SetEncoding(muxrpc.TypeJSON)
+	for _, ch := range list {
+		b, err := json.Marshal(ch)
+		if err != nil {
+			return fmt.Errorf("channels.list: failed to encode summary: %w", err)
+		}
+		if _, err := snk.Write(b); err != nil {
+			return err
+		}
+	}
+	return snk.Close()
+}
+
+type readHandler struct {
+	planner *query.Planner
+
+	isSelf ssb.Authorizer
+}
+
+// HandleSource sends the posts of a channel, sorted by their claimed timestamp.
+func (h readHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
+	var args []message.ChannelReadArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return fmt.Errorf("channels.read: bad request data: %w", err)
+	}
+	if n := len(args); n != 1 {
+		return fmt.Errorf("channels.read: expected one argument but got %d", n)
+	}
+	qry := args[0]
+
+	if strings.TrimPrefix(qry.Channel, "#") == "" {
+		return fmt.Errorf("channels.read: missing channel")
+	}
+
+	if qry.Private {
+		if err := ssb.AuthorizePrivate(req, h.isSelf); err != nil {
+			return fmt.Errorf("channels.read: %w", err)
+		}
+	}
+
+	lsnk := transform.NewKeyValueWrapper(snk, qry.Keys)
+
+	err := h.planner.Run(ctx, lsnk, query.Spec{
+		Type:    "post",
+		Channel: qry.Channel,
+		Private: qry.Private,
+
+		Order:   query.OrderClaimed,
+		Gt:      query.ArgBound(qry.Gt),
+		Lt:      query.ArgBound(qry.Lt),
+		Reverse: qry.Reverse,
+		Limit:   qry.Limit,
+		Live:    qry.Live,
+	})
+	if err != nil {
+		return fmt.Errorf("channels.read: query failed: %w", err)
+	}
+	return lsnk.Close()
+}
+
+func toKeyValue(msg refs.Message) refs.KeyValueRaw {
+	var kv refs.KeyValueRaw
+	kv.Key_ = msg.Key()
+	kv.Value = *msg.ValueContent()
+	kv.Timestamp = encodedTime.Millisecs(msg.Received())
+	return kv
+}
+
+func toMillis(msg refs.Message) int64 {
+	return msg.Claimed().UnixNano() / 1e6
+}
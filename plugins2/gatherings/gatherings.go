@@ -0,0 +1,249 @@
+// SPDX-License-Identifier: MIT
+
+// Package gatherings supplies events: gathering messages and the about messages that describe them (title, time, location, image) or attend them.
+// It offers gatherings.list, gatherings.get and gatherings.attend. Only public messages are considered.
+package gatherings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/query"
+)
+
+type Plugin struct {
+	log   log.Logger
+	store gatheringStore
+
+	planner *query.Planner
+	get     ssb.Getter
+	publish ssb.Publisher
+	self    *refs.FeedRef
+}
+
+// NewPlugin creates the plugin. The state of the gatherings comes from the about index of the names plugin.
+// The gathering messages are looked up through the planner and get, attend publishes as self.
+func NewPlugin(logger log.Logger, about AboutStore, planner *query.Planner, get ssb.Getter, publish ssb.Publisher, self *refs.FeedRef) *Plugin {
+	return &Plugin{
+		log:     logger,
+		store:   gatheringStore{about},
+		planner: planner,
+		get:     get,
+		publish: publish,
+		self:    self,
+	}
+}
+
+func (plug Plugin) Name() string     { return "gatherings" }
+func (Plugin) Method() muxrpc.Method { return muxrpc.Method{"gatherings"} }
+
+func (plug Plugin) Handler() muxrpc.Handler {
+	mux := typemux.New(plug.log)
+
+	mux.RegisterAsync(muxrpc.Method{"gatherings", "get"}, hGet{
+		gs:  plug.store,
+		get: plug.get,
+	})
+	mux.RegisterSource(muxrpc.Method{"gatherings", "list"}, hList{
+		gs:      plug.store,
+		planner: plug.planner,
+	})
+	mux.RegisterAsync(muxrpc.Method{"gatherings", "attend"}, hAttend{
+		get:     plug.get,
+		publish: plug.publish,
+		self:    plug.self,
+	})
+
+	return &mux
+}
+
+type hGet struct {
+	gs  gatheringStore
+	get ssb.Getter
+}
+
+// HandleAsync returns the message.Gathering of a gathering message
+func (h hGet) HandleAsync(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	ref, err := parseMessageRefFromArgs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := getGathering(h.get, ref)
+	if err != nil {
+		return nil, err
+	}
+	return h.gs.State(msg)
+}
+
+type hList struct {
+	gs      gatheringStore
+	planner *query.Planner
+}
+
+// HandleSource sends the message.Gathering of the upcoming or past gatherings, see message.GatheringsListArgs.
+// Gatherings without a startDateTime are only listed in the all mode.
+func (h hList) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
+	var qry message.GatheringsListArgs
+
+	var args []message.GatheringsListArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return fmt.Errorf("gatherings.list: bad request data: %w", err)
+	}
+	if n := len(args); n == 1 {
+		qry = args[0]
+	} else if n > 1 {
+		return fmt.Errorf("gatherings.list: expected one argument but got %d", n)
+	}
+
+	now := time.Now().UnixNano() / 1e6
+	var keep func(*message.Gathering) bool
+	switch qry.Mode {
+	case "", "upcoming":
+		keep = func(g *message.Gathering) bool { return g.StartDateTime != nil && g.StartDateTime.Epoch >= now }
+	case "past":
+		keep = func(g *message.Gathering) bool { return g.StartDateTime != nil && g.StartDateTime.Epoch < now }
+	case "all":
+		keep = func(*message.Gathering) bool { return true }
+	default:
+		return fmt.Errorf("gatherings.list: unknown mode %q", qry.Mode)
+	}
+
+	// newest gathering first
+	var list []*message.Gathering
+	err := h.planner.Iterate(ctx, query.Spec{
+		Type:    "gathering",
+		Order:   query.OrderClaimed,
+		Reverse: true,
+	}, func(ctx context.Context, res query.Result) error {
+		g, err := h.gs.State(res.Message)
+		if err != nil {
+			return err
+		}
+		if keep(g) {
+			list = append(list, g)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("gatherings.list: query failed: %w", err)
+	}
+
+	switch qry.Mode {
+	case "", "upcoming":
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].StartDateTime.Epoch < list[j].StartDateTime.Epoch
+		})
+	case "past":
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].StartDateTime.Epoch > list[j].StartDateTime.Epoch
+		})
+	}
+
+	snk.SetEncoding(muxrpc.TypeJSON)
+	for i, g := range list {
+		if qry.Limit > 0 && int64(i) >= qry.Limit {
+			break
+		}
+		b, err := json.Marshal(g)
+		if err != nil {
+			return fmt.Errorf("gatherings.list: failed to encode gathering: %w", err)
+		}
+		if _, err := snk.Write(b); err != nil {
+			return err
+		}
+	}
+	return snk.Close()
+}
+
+type hAttend struct {
+	get     ssb.Getter
+	publish ssb.Publisher
+	self    *refs.FeedRef
+}
+
+// HandleAsync publishes an about message that says self attends the gathering, or no longer does with remove.
+// It returns the key of the new message.
+func (h hAttend) HandleAsync(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	var qry message.GatheringsAttendArgs
+
+	var args []message.GatheringsAttendArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err == nil && len(args) == 1 && args[0].Gathering != nil {
+		qry = args[0]
+	} else {
+		ref, err := parseMessageRefFromArgs(req)
+		if err != nil {
+			return nil, err
+		}
+		qry.Gathering = ref
+	}
+
+	if _, err := getGathering(h.get, qry.Gathering); err != nil {
+		return nil, err
+	}
+
+	attendee := map[string]interface{}{
+		"link": h.self.Ref(),
+	}
+	if qry.Remove {
+		attendee["remove"] = true
+	}
+
+	ref, err := h.publish.Publish(map[string]interface{}{
+		"type":     "about",
+		"about":    qry.Gathering.Ref(),
+		"attendee": attendee,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gatherings.attend: failed to publish: %w", err)
+	}
+	return ref.Ref(), nil
+}
+
+// getGathering returns the message of ref, if it is a gathering
+func getGathering(get ssb.Getter, ref *refs.MessageRef) (refs.Message, error) {
+	msg, err := get.Get(*ref)
+	if err != nil {
+		return nil, fmt.Errorf("gatherings: failed to get %s: %w", ref.Ref(), err)
+	}
+
+	var content struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(msg.ContentBytes(), &content); err != nil || content.Type != "gathering" {
+		return nil, fmt.Errorf("gatherings: %s is not a gathering", ref.Ref())
+	}
+	return msg, nil
+}
+
+func parseMessageRefFromArgs(req *muxrpc.Request) (*refs.MessageRef, error) {
+	args := req.Args()
+	if len(args) != 1 {
+		return nil, fmt.Errorf("gatherings: expected one argument")
+	}
+
+	var refStr string
+	switch arg := args[0].(type) {
+	case string:
+		refStr = arg
+	case map[string]interface{}:
+		refStr, _ = arg["gathering"].(string)
+	}
+
+	ref, err := refs.ParseMessageRef(refStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing message reference: %w", err)
+	}
+
+	return ref, nil
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: MIT
+
+package gatherings
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/plugins2/names"
+)
+
+// AboutStore is the about index of the names plugin, which has the about messages of the gatherings
+type AboutStore interface {
+	LatestValues(about refs.Ref, fields []string) (map[string]message.AboutLatest, error)
+	History(about refs.Ref, field string) (map[string][]message.AboutValue, error)
+}
+
+// the about fields that describe a gathering, attendee is handled separately
+var gatheringFields = []string{"title", "description", "location", "image", "startDateTime"}
+
+const fieldAttendee = "attendee"
+
+type gatheringStore struct {
+	about AboutStore
+}
+
+// State combines the gathering message with the about messages that updated it.
+// Every field has the most recent value, no matter who set it.
+func (gs gatheringStore) State(msg refs.Message) (*message.Gathering, error) {
+	g := message.Gathering{
+		Key:       msg.Key(),
+		Author:    msg.Author(),
+		Timestamp: msg.Claimed().UnixNano() / 1e6,
+		Attendees: []*refs.FeedRef{},
+	}
+
+	latest, err := gs.about.LatestValues(msg.Key(), gatheringFields)
+	if err != nil {
+		return nil, fmt.Errorf("gatherings: about lookup failed: %w", err)
+	}
+	current := func(field string) json.RawMessage {
+		l := latest[field]
+		var newest *message.AboutValue
+		if l.Self != nil {
+			newest = l.Self
+		}
+		for i, v := range l.Others {
+			if newest == nil || v.Timestamp > newest.Timestamp {
+				newest = &l.Others[i]
+			}
+		}
+		if newest == nil {
+			return nil
+		}
+		return newest.Value
+	}
+
+	json.Unmarshal(current("title"), &g.Title)
+	json.Unmarshal(current("description"), &g.Description)
+	json.Unmarshal(current("location"), &g.Location)
+	if link, ok := names.ImageLink(current("image")); ok {
+		g.Image = link
+	}
+	var start message.GatheringTime
+	if err := json.Unmarshal(current("startDateTime"), &start); err == nil && start.Epoch != 0 {
+		g.StartDateTime = &start
+	}
+
+	g.Attendees, err = gs.attendees(msg.Key())
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// attendees returns the feeds that currently attend the gathering, in the order they joined.
+// An attendee entry only counts if it's about the author itself.
+func (gs gatheringStore) attendees(gathering *refs.MessageRef) ([]*refs.FeedRef, error) {
+	hist, err := gs.about.History(gathering, fieldAttendee)
+	if err != nil {
+		return nil, fmt.Errorf("gatherings: attendee lookup failed: %w", err)
+	}
+
+	type attendance struct {
+		who       *refs.FeedRef
+		attending bool
+		ts        int64
+	}
+	// the history is oldest first, so the last entry of each author wins
+	byAuthor := make(map[string]*attendance)
+	for _, v := range hist[fieldAttendee] {
+		var att struct {
+			Link   string `json:"link"`
+			Remove bool   `json:"remove"`
+		}
+		if err := json.Unmarshal(v.Value, &att); err != nil || att.Link != v.Author.Ref() {
+			continue
+		}
+		byAuthor[v.Author.Ref()] = &attendance{who: v.Author, attending: !att.Remove, ts: v.Timestamp}
+	}
+
+	var attending []*attendance
+	for _, a := range byAuthor {
+		if a.attending {
+			attending = append(attending, a)
+		}
+	}
+	sort.Slice(attending, func(i, j int) bool {
+		if attending[i].ts == attending[j].ts {
+			return attending[i].who.Ref() < attending[j].who.Ref()
+		}
+		return attending[i].ts < attending[j].ts
+	})
+
+	attendees := make([]*refs.FeedRef, len(attending))
+	for i, a := range attending {
+		attendees[i] = a.who
+	}
+	return attendees, nil
+}
@@ -7,7 +7,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/dgraph-io/badger"
@@ -72,8 +71,8 @@ func (ab aboutStore) All() (client.NamesGetResult, error) {
 		for iter.Rewind(); iter.Valid(); iter.Next() {
 			it := iter.Item()
 			k := it.Key()
-			if string(k) == "__current_observable" {
-				return nil // skip
+			if string(k) == "__current_observable" || bytes.HasPrefix(k, historyPrefix) {
+				continue
 			}
 
 			parts := strings.Split(string(k), ":")
@@ -149,25 +148,24 @@ func (ab aboutStore) CollectedFor(ref *refs.FeedRef) (*AboutInfo, error) {
 			if err != nil {
 				return fmt.Errorf("about: couldnt make author ref from db key: %s: %w", splitted, err)
 			}
+			var fieldPtr *AboutAttribute
+			switch {
+			case bytes.HasSuffix(k, []byte(":name")):
+				fieldPtr = &reduced.Name
+			case bytes.HasSuffix(k, []byte(":description")):
+				fieldPtr = &reduced.Description
+			case bytes.HasSuffix(k, []byte(":image")):
+				fieldPtr = &reduced.Image
+			default:
+				// other fields are only available through the history
+				continue
+			}
+
 			err = it.Value(func(v []byte) error {
-				var fieldPtr *AboutAttribute
 				var foundVal string
 				if err := json.Unmarshal(v, &foundVal); err != nil {
 					return err
 				}
-				switch {
-				case bytes.HasSuffix(k, []byte(":name")):
-					fieldPtr = &reduced.Name
-				case bytes.HasSuffix(k, []byte(":description")):
-					fieldPtr = &reduced.Description
-				case bytes.HasSuffix(k, []byte(":image")):
-					fieldPtr = &reduced.Image
-				}
-				if fieldPtr == nil {
-					log.Printf("about debug: %s ", c.Ref())
-					log.Printf("no field for: %q", string(k))
-					return nil
-				}
 				if c.Equal(ref) {
 					fieldPtr.Chosen = foundVal
 				} else {
@@ -196,12 +194,13 @@ func (ab aboutStore) CollectedFor(ref *refs.FeedRef) (*AboutInfo, error) {
 	return &reduced, nil
 }
 
-const FolderNameAbout = "about"
+// FolderNameAbout is changed when the layout of the keys changes, which rebuilds the index
+const FolderNameAbout = "about2"
 
 func (plug *Plugin) MakeSimpleIndex(r repo.Interface) (librarian.Index, librarian.SinkIndex, error) {
 	f := func(db *badger.DB) (librarian.SeqSetterIndex, librarian.SinkIndex) {
 		aboutIdx := libbadger.NewIndex(db, 0)
-		snk := librarian.NewSinkIndex(updateAboutMessage, aboutIdx)
+		snk := repo.NewBadgerSinkIndex(db, updateAboutMessage, aboutIdx)
 		return aboutIdx, snk
 	}
 
@@ -215,6 +214,19 @@ func (plug *Plugin) MakeSimpleIndex(r repo.Interface) (librarian.Index, libraria
 	return idx, update, err
 }
 
+// these describe the about message itself, they are not attributes of the target
+var nonAttributes = map[string]bool{
+	"type":    true,
+	"about":   true,
+	"recps":   true,
+	"tangles": true,
+	"root":    true,
+	"branch":  true,
+}
+
+// updateAboutMessage stores the latest value of each field under about:from:field
+// and every assigned value in the history (see historyAddr).
+// Any field is stored, like title, location and startDateTime of gatherings or the names of git repos.
 func updateAboutMessage(ctx context.Context, seq margaret.Seq, msgv interface{}, idx librarian.SetterIndex) error {
 	msg, ok := msgv.(refs.Message)
 	if !ok {
@@ -224,41 +236,99 @@ func updateAboutMessage(ctx context.Context, seq margaret.Seq, msgv interface{},
 		return fmt.Errorf("about(%d): wrong msgT: %T", seq, msgv)
 	}
 
-	var aboutMSG refs.About
-	err := json.Unmarshal(msg.ContentBytes(), &aboutMSG)
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(msg.ContentBytes(), &fields)
 	if err != nil {
-		// nothing to do with this message
-		// TODO: git repos and gathering use about messages for their names
+		// nothing to do with this message (boxed or broken)
 		return nil
 	}
 
-	//	fmt.Println("msg", "decoded", "seq", seq.Seq())
+	var typ, aboutStr string
+	json.Unmarshal(fields["type"], &typ)
+	json.Unmarshal(fields["about"], &aboutStr)
+	if typ != "about" {
+		return nil
+	}
+	about, err := refs.ParseRef(aboutStr)
+	if err != nil {
+		return nil
+	}
+	target := about.Ref()
 
 	// about:from:field
-	addr := aboutMSG.About.Ref()
+	addr := target
 	addr += ":"
 	addr += msg.Author().Ref()
 	addr += ":"
 
-	var val string
-	if aboutMSG.Name != "" {
-		val = aboutMSG.Name
-		if err := idx.Set(ctx, librarian.Addr(addr+"name"), val); err != nil {
-			return fmt.Errorf("db/idx about: failed to update field: %w", err)
+	for field, raw := range fields {
+		if nonAttributes[field] || strings.Contains(field, ":") {
+			continue
 		}
-	}
-	if aboutMSG.Description != "" {
-		val = aboutMSG.Description
-		if err := idx.Set(ctx, librarian.Addr(addr+"description"), val); err != nil {
-			return fmt.Errorf("db/idx about: failed to update field: %w", err)
+
+		val, ok := latestValue(field, raw)
+		if !ok {
+			continue
 		}
-	}
-	if aboutMSG.Image != nil {
-		val = aboutMSG.Image.Ref()
-		if err := idx.Set(ctx, librarian.Addr(addr+"image"), val); err != nil {
+		if err := idx.Set(ctx, librarian.Addr(addr+field), val); err != nil {
 			return fmt.Errorf("db/idx about: failed to update field: %w", err)
 		}
+
+		entry := historyEntry{
+			Author:    msg.Author().Ref(),
+			Key:       msg.Key().Ref(),
+			Value:     raw,
+			Timestamp: msg.Claimed().UnixNano() / 1e6,
+		}
+		if err := idx.Set(ctx, historyAddr(target, field, entry), entry); err != nil {
+			return fmt.Errorf("db/idx about: failed to update history: %w", err)
+		}
 	}
 
 	return nil
 }
+
+// latestValue returns what is stored as the latest value of a field.
+// name, description and image are kept as strings for CollectedFor, the others as they are.
+func latestValue(field string, raw json.RawMessage) (interface{}, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, false
+	}
+
+	switch field {
+	case "name", "description":
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil || str == "" {
+			return nil, false
+		}
+		return str, true
+
+	case "image":
+		link, ok := ImageLink(raw)
+		if !ok {
+			return nil, false
+		}
+		return link, true
+	}
+
+	return raw, true
+}
+
+// ImageLink returns the blob of an image field, which is either just the ref or an object with a link
+func ImageLink(raw json.RawMessage) (string, bool) {
+	var link string
+	if err := json.Unmarshal(raw, &link); err != nil {
+		var img struct {
+			Link string `json:"link"`
+		}
+		if err := json.Unmarshal(raw, &img); err != nil {
+			return "", false
+		}
+		link = img.Link
+	}
+	br, err := refs.ParseBlobRef(link)
+	if err != nil {
+		return "", false
+	}
+	return br.Ref(), true
+}
@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: MIT
+
+package names
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgraph-io/badger"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/muxrpc/v2"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+)
+
+// historyPrefix is the start of the keys of all the assigned values.
+// The ~ sorts them after the latest values of the about:from:field keys.
+var historyPrefix = []byte("~history:")
+
+// historyEntry is one assigned value, stored under ~history:about:field:timestamp:key
+type historyEntry struct {
+	Author    string          `json:"author"`
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+// historyAddr sorts the entries of a field by their claimed timestamp
+func historyAddr(about, field string, e historyEntry) librarian.Addr {
+	ts := e.Timestamp
+	if ts < 0 {
+		ts = 0
+	}
+	return librarian.Addr(fmt.Sprintf("%s%s:%s:%020d:%s", historyPrefix, about, field, ts, e.Key))
+}
+
+// History returns the values that were assigned to field of about, oldest first.
+// An empty field returns the history of all fields.
+// owner is the feed whose values count as self-assigned, it can be nil.
+func (ab aboutStore) History(about refs.Ref, field string, owner *refs.FeedRef) (map[string][]message.AboutValue, error) {
+	prefix := append([]byte{}, historyPrefix...)
+	prefix = append(prefix, about.Ref()+":"...)
+	if field != "" {
+		prefix = append(prefix, field+":"...)
+	}
+
+	hist := make(map[string][]message.AboutValue)
+	err := ab.kv.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			it := iter.Item()
+
+			// the field is the first part after about
+			rest := bytes.TrimPrefix(it.Key(), historyPrefix)
+			rest = bytes.TrimPrefix(rest, []byte(about.Ref()+":"))
+			i := bytes.IndexByte(rest, ':')
+			if i < 0 {
+				return fmt.Errorf("about history: illegal key:%q", it.Key())
+			}
+			key := string(rest[:i])
+
+			var e historyEntry
+			err := it.Value(func(v []byte) error {
+				return json.Unmarshal(v, &e)
+			})
+			if err != nil {
+				return fmt.Errorf("about history: value of item %q failed: %w", it.Key(), err)
+			}
+
+			av, err := e.aboutValue(owner)
+			if err != nil {
+				return err
+			}
+			hist[key] = append(hist[key], av)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("about history lookup failed: %w", err)
+	}
+	return hist, nil
+}
+
+func (e historyEntry) aboutValue(owner *refs.FeedRef) (message.AboutValue, error) {
+	var av message.AboutValue
+
+	author, err := refs.ParseFeedRef(e.Author)
+	if err != nil {
+		return av, fmt.Errorf("about history: invalid author: %w", err)
+	}
+	key, err := refs.ParseMessageRef(e.Key)
+	if err != nil {
+		return av, fmt.Errorf("about history: invalid key: %w", err)
+	}
+
+	av.Author = author
+	av.Key = key
+	av.Value = e.Value
+	av.Timestamp = e.Timestamp
+	av.Self = owner != nil && author.Equal(owner)
+	return av, nil
+}
+
+// LatestValues reduces the history to the latest value of each author per field
+func (ab aboutStore) LatestValues(about refs.Ref, fields []string, owner *refs.FeedRef) (map[string]message.AboutLatest, error) {
+	var hist = make(map[string][]message.AboutValue)
+	if len(fields) == 0 {
+		var err error
+		hist, err = ab.History(about, "", owner)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range fields {
+		fh, err := ab.History(about, f, owner)
+		if err != nil {
+			return nil, err
+		}
+		hist[f] = fh[f]
+	}
+
+	latest := make(map[string]message.AboutLatest, len(hist))
+	for field, values := range hist {
+		var l message.AboutLatest
+		l.Others = []message.AboutValue{}
+
+		// newest first, to keep the latest per author
+		seen := make(map[string]struct{})
+		for i := len(values) - 1; i >= 0; i-- {
+			v := values[i]
+			if _, has := seen[v.Author.Ref()]; has {
+				continue
+			}
+			seen[v.Author.Ref()] = struct{}{}
+
+			if v.Self {
+				self := v
+				l.Self = &self
+				continue
+			}
+			l.Others = append([]message.AboutValue{v}, l.Others...)
+		}
+
+		if l.Self != nil {
+			l.Value = l.Self.Value
+		} else if n := len(l.Others); n > 0 {
+			l.Value = l.Others[n-1].Value
+		}
+		latest[field] = l
+	}
+	return latest, nil
+}
+
+// ownerOf returns the feed whose values count as self-assigned for about.
+// That is the feed itself or the author of a message, if get knows it.
+func ownerOf(about refs.Ref, get ssb.Getter) *refs.FeedRef {
+	switch tv := about.(type) {
+	case *refs.FeedRef:
+		return tv
+	case *refs.MessageRef:
+		if get == nil {
+			return nil
+		}
+		msg, err := get.Get(*tv)
+		if err != nil {
+			return nil
+		}
+		return msg.Author()
+	}
+	return nil
+}
+
+type hHistory struct {
+	as  aboutStore
+	get ssb.Getter
+}
+
+// HandleAsync returns the history of one field, as a list of message.AboutValue.
+// The argument is message.AboutHistoryArgs or just the about ref, for the history of names.
+func (h hHistory) HandleAsync(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	var qry message.AboutHistoryArgs
+
+	var args []message.AboutHistoryArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		var strs []string
+		if err := json.Unmarshal(req.RawArgs, &strs); err != nil || len(strs) != 1 {
+			return nil, fmt.Errorf("names.history: bad request data: %w", err)
+		}
+		qry.About = strs[0]
+	} else {
+		if n := len(args); n != 1 {
+			return nil, fmt.Errorf("names.history: expected one argument but got %d", n)
+		}
+		qry = args[0]
+	}
+
+	if qry.Field == "" {
+		qry.Field = "name"
+	}
+
+	about, err := refs.ParseRef(qry.About)
+	if err != nil {
+		return nil, fmt.Errorf("names.history: invalid about: %w", err)
+	}
+
+	hist, err := h.as.History(about, qry.Field, ownerOf(about, h.get))
+	if err != nil {
+		return nil, err
+	}
+
+	values := hist[qry.Field]
+	if values == nil {
+		values = []message.AboutValue{}
+	}
+	return values, nil
+}
+
+type hLatestValues struct {
+	as  aboutStore
+	get ssb.Getter
+}
+
+// HandleAsync returns a message.AboutLatest per field.
+// The arguments are message.AboutLatestArgs or, like the javascript version, the about ref followed by the list of keys.
+func (h hLatestValues) HandleAsync(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	var qry message.AboutLatestArgs
+
+	var args []message.AboutLatestArgs
+	if err := json.Unmarshal(req.RawArgs, &args); err == nil && len(args) == 1 {
+		qry = args[0]
+	} else {
+		var positional []json.RawMessage
+		if err := json.Unmarshal(req.RawArgs, &positional); err != nil || len(positional) < 1 || len(positional) > 2 {
+			return nil, fmt.Errorf("about.latestValues: bad request data")
+		}
+		if err := json.Unmarshal(positional[0], &qry.About); err != nil {
+			return nil, fmt.Errorf("about.latestValues: invalid about: %w", err)
+		}
+		if len(positional) == 2 {
+			if err := json.Unmarshal(positional[1], &qry.Keys); err != nil {
+				return nil, fmt.Errorf("about.latestValues: invalid keys: %w", err)
+			}
+		}
+	}
+
+	about, err := refs.ParseRef(qry.About)
+	if err != nil {
+		return nil, fmt.Errorf("about.latestValues: invalid about: %w", err)
+	}
+
+	return h.as.LatestValues(about, qry.Keys, ownerOf(about, h.get))
+}
@@ -11,17 +11,60 @@ import (
 
 	"github.com/cryptix/go/logging"
 	"go.cryptoscope.co/muxrpc/v2"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	refs "go.mindeco.de/ssb-refs"
 )
 
 type Plugin struct {
 	about aboutStore
+
+	// used to find the author of about targets that are messages, can be nil
+	get ssb.Getter
 }
 
+// SetGetter enables the self-assigned flag of values about messages (like gatherings)
+func (lt *Plugin) SetGetter(get ssb.Getter) { lt.get = get }
+
 func (lt Plugin) Name() string            { return "names" }
 func (Plugin) Method() muxrpc.Method      { return muxrpc.Method{"names"} }
-func (lt Plugin) Handler() muxrpc.Handler { return newNamesHandler(nil, lt.about) }
+func (lt Plugin) Handler() muxrpc.Handler { return newNamesHandler(nil, lt.about, lt.get) }
+
+// LatestValues returns the latest value of each author for the fields of about, see about.latestValues.
+// It's for other plugins that use the about index, MakeSimpleIndex has to be called before.
+func (lt Plugin) LatestValues(about refs.Ref, fields []string) (map[string]message.AboutLatest, error) {
+	return lt.about.LatestValues(about, fields, ownerOf(about, lt.get))
+}
 
-func newNamesHandler(l log.Logger, as aboutStore) muxrpc.Handler {
+// History returns the values that were assigned to field of about, oldest first, see names.history.
+// An empty field returns the history of all fields.
+func (lt Plugin) History(about refs.Ref, field string) (map[string][]message.AboutValue, error) {
+	return lt.about.History(about, field, ownerOf(about, lt.get))
+}
+
+// About returns the plugin for the about namespace (about.latestValues), which uses the same index
+func (lt Plugin) About() ssb.Plugin { return aboutPlugin{lt} }
+
+type aboutPlugin struct {
+	Plugin
+}
+
+func (ap aboutPlugin) Name() string       { return "about" }
+func (aboutPlugin) Method() muxrpc.Method { return muxrpc.Method{"about"} }
+func (ap aboutPlugin) Handler() muxrpc.Handler {
+	l := log.With(log.NewLogfmtLogger(os.Stderr), "plugin", "about")
+	mux := typemux.New(l)
+
+	mux.RegisterAsync(muxrpc.Method{"about", "latestValues"}, hLatestValues{
+		as:  ap.about,
+		get: ap.get,
+	})
+
+	return &mux
+}
+
+func newNamesHandler(l log.Logger, as aboutStore, get ssb.Getter) muxrpc.Handler {
 
 	if l == nil {
 		l = log.NewLogfmtLogger(os.Stderr)
@@ -42,6 +85,10 @@ func newNamesHandler(l log.Logger, as aboutStore) muxrpc.Handler {
 		log: l,
 		as:  as,
 	})
+	mux.RegisterAsync(muxrpc.Method{"names", "history"}, hHistory{
+		as:  as,
+		get: get,
+	})
 
 	return &mux
 }
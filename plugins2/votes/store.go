@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: MIT
+
+package votes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+const FolderNameVotes = "votes"
+
+// voteState is the latest vote of an author on a message, stored under link:author
+type voteState struct {
+	Value      int    `json:"value"`
+	Expression string `json:"expression,omitempty"`
+
+	// Sequence of the vote on the author's feed, older votes don't replace newer ones
+	Sequence  int64 `json:"sequence"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+type voteStore struct {
+	kv *badger.DB
+}
+
+func voteKey(link *refs.MessageRef, author *refs.FeedRef) []byte {
+	return []byte(link.Ref() + ":" + author.Ref())
+}
+
+func (vs voteStore) latest(link *refs.MessageRef, author *refs.FeedRef) (*voteState, error) {
+	var state *voteState
+	err := vs.kv.View(func(txn *badger.Txn) error {
+		it, err := txn.Get(voteKey(link, author))
+		if err != nil {
+			if err == badger.ErrKeyNotFound {
+				return nil
+			}
+			return err
+		}
+		return it.Value(func(v []byte) error {
+			state = new(voteState)
+			return json.Unmarshal(v, state)
+		})
+	})
+	return state, err
+}
+
+// Totals sums up the current votes on link
+func (vs voteStore) Totals(link *refs.MessageRef) (*message.VoteTotals, error) {
+	totals := message.VoteTotals{
+		Link:        link,
+		Voters:      []message.Voter{},
+		Expressions: make(map[string]int),
+	}
+
+	prefix := []byte(link.Ref() + ":")
+	err := vs.kv.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			it := iter.Item()
+
+			author, err := refs.ParseFeedRef(string(bytes.TrimPrefix(it.Key(), prefix)))
+			if err != nil {
+				return fmt.Errorf("votes: couldnt make author ref from db key: %q: %w", it.Key(), err)
+			}
+
+			var state voteState
+			err = it.Value(func(v []byte) error {
+				return json.Unmarshal(v, &state)
+			})
+			if err != nil {
+				return fmt.Errorf("votes: couldnt get idx value: %w", err)
+			}
+
+			if state.Value == 0 { // un-voted
+				continue
+			}
+
+			totals.Total += state.Value
+			totals.Voters = append(totals.Voters, message.Voter{
+				Author:     author,
+				Value:      state.Value,
+				Expression: state.Expression,
+				Timestamp:  state.Timestamp,
+			})
+			if state.Expression != "" {
+				totals.Expressions[state.Expression]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("votes db lookup failed: %w", err)
+	}
+
+	sort.SliceStable(totals.Voters, func(i, j int) bool {
+		return totals.Voters[i].Timestamp < totals.Voters[j].Timestamp
+	})
+	return &totals, nil
+}
+
+func (plug *Plugin) MakeSimpleIndex(r repo.Interface) (librarian.Index, librarian.SinkIndex, error) {
+	f := func(db *badger.DB) (librarian.SeqSetterIndex, librarian.SinkIndex) {
+		votesIdx := libbadger.NewIndex(db, 0)
+		snk := librarian.NewSinkIndex(plug.updateVoteMessage, votesIdx)
+		return votesIdx, snk
+	}
+
+	db, idx, update, err := repo.OpenBadgerIndex(r, FolderNameVotes, f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting votes index: %w", err)
+	}
+
+	plug.store = voteStore{db}
+
+	return idx, update, err
+}
+
+func (plug *Plugin) updateVoteMessage(ctx context.Context, seq margaret.Seq, msgv interface{}, idx librarian.SetterIndex) error {
+	msg, ok := msgv.(refs.Message)
+	if !ok {
+		if err, ok := msgv.(error); ok && margaret.IsErrNulled(err) {
+			return nil
+		}
+		return fmt.Errorf("votes(%d): wrong msgT: %T", seq, msgv)
+	}
+
+	link, vote, ok := decodeVote(msg.ContentBytes())
+	if !ok {
+		// boxed or not a proper vote
+		return nil
+	}
+	vote.Sequence = msg.Seq()
+	vote.Timestamp = msg.Claimed().UnixNano() / 1e6
+
+	current, err := plug.store.latest(link, msg.Author())
+	if err != nil {
+		return fmt.Errorf("db/idx votes: failed to get current vote: %w", err)
+	}
+	if current != nil && current.Sequence >= vote.Sequence {
+		return nil
+	}
+
+	if err := idx.Set(ctx, librarian.Addr(voteKey(link, msg.Author())), vote); err != nil {
+		return fmt.Errorf("db/idx votes: failed to update vote: %w", err)
+	}
+
+	return plug.changes.Pour(ctx, link)
+}
+
+// decodeVote returns the voted message and the value, clamped to -1, 0 or 1
+func decodeVote(content []byte) (*refs.MessageRef, voteState, bool) {
+	var state voteState
+
+	var v struct {
+		Type string `json:"type"`
+		Vote struct {
+			Link       string      `json:"link"`
+			Value      json.Number `json:"value"`
+			Expression string      `json:"expression"`
+		} `json:"vote"`
+	}
+	if err := json.Unmarshal(content, &v); err != nil || v.Type != "vote" {
+		return nil, state, false
+	}
+
+	link, err := refs.ParseMessageRef(v.Vote.Link)
+	if err != nil {
+		return nil, state, false
+	}
+
+	value, err := v.Vote.Value.Float64()
+	if err != nil {
+		return nil, state, false
+	}
+	switch {
+	case value > 0:
+		state.Value = 1
+	case value < 0:
+		state.Value = -1
+	}
+	state.Expression = v.Vote.Expression
+
+	return link, state, true
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: MIT
+
+// Package votes keeps the latest vote of each author per message and supplies votes.get and the live votes.stream.
+// Only public votes are counted.
+package votes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/muxrpc/v2"
+	"go.cryptoscope.co/muxrpc/v2/typemux"
+	refs "go.mindeco.de/ssb-refs"
+)
+
+type Plugin struct {
+	log   log.Logger
+	store voteStore
+
+	// the index pours the links of changed totals into changes
+	changes luigi.Sink
+	bcast   luigi.Broadcast
+}
+
+// NewPlugin creates the plugin, MakeSimpleIndex needs to be called before it's handler is used.
+func NewPlugin(logger log.Logger) *Plugin {
+	plug := &Plugin{log: logger}
+	plug.changes, plug.bcast = luigi.NewBroadcast()
+	return plug
+}
+
+func (plug Plugin) Name() string     { return "votes" }
+func (Plugin) Method() muxrpc.Method { return muxrpc.Method{"votes"} }
+
+func (plug Plugin) Handler() muxrpc.Handler {
+	mux := typemux.New(plug.log)
+
+	mux.RegisterAsync(muxrpc.Method{"votes", "get"}, hGet{
+		vs: plug.store,
+	})
+	mux.RegisterSource(muxrpc.Method{"votes", "stream"}, hStream{
+		vs:    plug.store,
+		bcast: plug.bcast,
+	})
+
+	return &mux
+}
+
+type hGet struct {
+	vs voteStore
+}
+
+// HandleAsync returns the message.VoteTotals of a message
+func (h hGet) HandleAsync(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	ref, err := parseMessageRefFromArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	return h.vs.Totals(ref)
+}
+
+type hStream struct {
+	vs    voteStore
+	bcast luigi.Broadcast
+}
+
+// HandleSource sends the current message.VoteTotals of a message and again every time they change
+func (h hStream) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
+	ref, err := parseMessageRefFromArgs(req)
+	if err != nil {
+		return err
+	}
+
+	// only one pending update is needed, the totals are read fresh
+	changed := make(chan struct{}, 1)
+	done := h.bcast.Register(luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			return nil
+		}
+		if link, ok := v.(*refs.MessageRef); !ok || link.Ref() != ref.Ref() {
+			return nil
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+		return nil
+	}))
+	defer done()
+
+	snk.SetEncoding(muxrpc.TypeJSON)
+	for {
+		totals, err := h.vs.Totals(ref)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(totals)
+		if err != nil {
+			return fmt.Errorf("votes.stream: failed to encode totals: %w", err)
+		}
+		if _, err := snk.Write(b); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return snk.Close()
+		case <-changed:
+		}
+	}
+}
+
+func parseMessageRefFromArgs(req *muxrpc.Request) (*refs.MessageRef, error) {
+	args := req.Args()
+	if len(args) != 1 {
+		return nil, fmt.Errorf("votes: expected one argument")
+	}
+
+	var refStr string
+	switch arg := args[0].(type) {
+	case string:
+		refStr = arg
+	case map[string]interface{}:
+		refStr, _ = arg["link"].(string)
+	}
+
+	ref, err := refs.ParseMessageRef(refStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing message reference: %w", err)
+	}
+
+	return ref, nil
+}
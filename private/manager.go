@@ -291,27 +291,37 @@ func (mgr *Manager) WrappedUnboxingSink(snk luigi.Sink) luigi.Sink {
 			return nil, fmt.Errorf("failed to find message in empty interface(%T)", v)
 		}
 
-		cleartxt, err := mgr.DecryptMessage(msg)
+		unboxed, err := mgr.UnboxedMessage(msg)
 		if err != nil {
 			if err == ErrNotBoxed {
 				return v, nil
 			}
 			return nil, err
 		}
+		return unboxed, nil
+	})
+}
 
-		var rv refs.KeyValueRaw
-		rv.Key_ = msg.Key()
-		rv.Value.Author = *msg.Author()
-		rv.Value.Previous = msg.Previous()
-		rv.Value.Sequence = margaret.BaseSeq(msg.Seq())
-		rv.Value.Timestamp = encodedTime.NewMillisecs(msg.Claimed().Unix())
-		rv.Value.Signature = "reboxed"
+// UnboxedMessage returns a copy of the message with the decrypted content.
+// ErrNotBoxed is returned if the message isn't boxed or can't be decrypted by us.
+func (mgr *Manager) UnboxedMessage(msg refs.Message) (refs.Message, error) {
+	cleartxt, err := mgr.DecryptMessage(msg)
+	if err != nil {
+		return nil, err
+	}
 
-		rv.Value.Content = cleartxt
+	var rv refs.KeyValueRaw
+	rv.Key_ = msg.Key()
+	rv.Value.Author = *msg.Author()
+	rv.Value.Previous = msg.Previous()
+	rv.Value.Sequence = margaret.BaseSeq(msg.Seq())
+	rv.Value.Timestamp = encodedTime.NewMillisecs(msg.Claimed().Unix())
+	rv.Value.Signature = "reboxed"
 
-		rv.Value.Meta = make(map[string]interface{})
-		rv.Value.Meta["private"] = true
+	rv.Value.Content = cleartxt
 
-		return rv, nil
-	})
+	rv.Value.Meta = make(map[string]interface{})
+	rv.Value.Meta["private"] = true
+
+	return rv, nil
 }
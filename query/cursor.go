@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: MIT
+
+package query
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cursor is the position of a result in the order of the query.
+// By is the value of the ordered domain (timestamp or sequence) and Seq the sequence in the receive log, which breaks ties.
+type Cursor struct {
+	By  int64
+	Seq int64
+}
+
+// String encodes the cursor as an opaque string for clients
+func (c Cursor) String() string {
+	plain := strconv.FormatInt(c.By, 10) + ":" + strconv.FormatInt(c.Seq, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(plain))
+}
+
+// ParseCursor decodes the output of Cursor.String()
+func ParseCursor(s string) (*Cursor, error) {
+	plain, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("query: invalid cursor encoding: %w", err)
+	}
+
+	parts := strings.Split(string(plain), ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("query: invalid cursor")
+	}
+
+	var c Cursor
+	c.By, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("query: invalid cursor position: %w", err)
+	}
+	c.Seq, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("query: invalid cursor sequence: %w", err)
+	}
+	return &c, nil
+}
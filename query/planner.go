@@ -0,0 +1,432 @@
+// SPDX-License-Identifier: MIT
+
+// Package query answers message queries by combining the bitmaps of the roaring multilogs (authors, types, tangles, links and private messages).
+// The selected sequences are sorted with the timestamp resolver and, if the query is live, continued with new messages from the receive log.
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	bmap "github.com/RoaringBitmap/roaring"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog/roaring"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/multilogs"
+	"go.cryptoscope.co/ssb/private"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// IndexProgress tells up to which sequence of the receive log the multilogs are complete, like multilogs.CombinedIndex
+type IndexProgress interface {
+	Indexed() int64
+}
+
+// Planner runs queries against the receive log and it's indexes
+type Planner struct {
+	rxlog   margaret.Log
+	res     *repo.SequenceResolver
+	indexed IndexProgress
+
+	users   *roaring.MultiLog
+	byType  *roaring.MultiLog
+	tangles *roaring.MultiLog
+	privs   *roaring.MultiLog
+	links   *roaring.MultiLog
+
+	self    *refs.FeedRef
+	unboxer *private.Manager
+}
+
+// NewPlanner creates a Planner. The multilogs are the ones maintained by the combined index, which also reports how far they are.
+// unboxer is used to decrypt private messages for self, it can be nil if private queries aren't needed.
+func NewPlanner(
+	rxlog margaret.Log,
+	res *repo.SequenceResolver,
+	indexed IndexProgress,
+	users, byType, tangles, privs, links *roaring.MultiLog,
+	self *refs.FeedRef,
+	unboxer *private.Manager,
+) *Planner {
+	return &Planner{
+		rxlog:   rxlog,
+		res:     res,
+		indexed: indexed,
+
+		users:   users,
+		byType:  byType,
+		tangles: tangles,
+		privs:   privs,
+		links:   links,
+
+		self:    self,
+		unboxer: unboxer,
+	}
+}
+
+// errStop ends the iteration once the limit or the end of the range is reached
+var errStop = errors.New("query: done")
+
+// Result is a message that matched a query together with it's position in the result
+type Result struct {
+	Cursor  Cursor
+	Message refs.Message
+}
+
+// Run pours the messages that match spec into snk.
+// For non-live queries it returns once all stored messages were sent, otherwise when the limit is reached or ctx is canceled.
+// The values are refs.Message, decrypted ones are refs.KeyValueRaw. snk is not closed.
+func (p *Planner) Run(ctx context.Context, snk luigi.Sink, spec Spec) error {
+	return p.Iterate(ctx, spec, func(ctx context.Context, res Result) error {
+		return snk.Pour(ctx, res.Message)
+	})
+}
+
+// Iterate is like Run but calls fn with each result, which includes the cursor to continue after it.
+// An error from fn ends the query and is returned.
+func (p *Planner) Iterate(ctx context.Context, spec Spec, fn func(context.Context, Result) error) error {
+	var sent int64
+	send := func(ctx context.Context, res Result) error {
+		if err := fn(ctx, res); err != nil {
+			return err
+		}
+		sent++
+		if spec.Limit > 0 && sent >= spec.Limit {
+			return errStop
+		}
+		return nil
+	}
+
+	var (
+		storedUntil int64
+		err         error
+	)
+	if spec.needsIndex() {
+		storedUntil, err = p.runIndexed(ctx, spec, send)
+	} else {
+		storedUntil, err = p.runScan(ctx, spec, send)
+	}
+	if err != nil {
+		if errors.Is(err, errStop) {
+			return nil
+		}
+		return err
+	}
+
+	if !spec.Live {
+		return nil
+	}
+
+	if storedUntil < -1 {
+		storedUntil = -1
+	}
+	src, err := p.rxlog.Query(
+		margaret.Gt(margaret.BaseSeq(storedUntil)),
+		margaret.Live(true),
+		margaret.SeqWrap(true),
+	)
+	if err != nil {
+		return fmt.Errorf("query: failed to open live query: %w", err)
+	}
+
+	liveSnk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			return err
+		}
+		sw, ok := v.(margaret.SeqWrapper)
+		if !ok {
+			return fmt.Errorf("query: expected seq wrapper, got %T", v)
+		}
+		res, ok := p.filter(spec, sw.Seq().Seq(), sw.Value(), true)
+		if !ok {
+			return nil
+		}
+		return send(ctx, res)
+	})
+
+	err = luigi.Pump(ctx, liveSnk, src)
+	if err != nil && !errors.Is(err, errStop) && !luigi.IsEOS(err) && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// runScan iterates the receive log directly, for queries that don't filter or sort by an index.
+// It returns the last sequence it looked at.
+func (p *Planner) runScan(ctx context.Context, spec Spec, send func(context.Context, Result) error) (int64, error) {
+	sv, err := p.rxlog.Seq().Value()
+	if err != nil {
+		return 0, fmt.Errorf("query: failed to get current sequence: %w", err)
+	}
+	current := sv.(margaret.Seq).Seq()
+	if current < 0 {
+		return current, nil
+	}
+
+	specs := []margaret.QuerySpec{
+		margaret.SeqWrap(true),
+		margaret.Lt(margaret.BaseSeq(current + 1)),
+		margaret.Reverse(spec.Reverse),
+	}
+	if spec.Gt != nil && *spec.Gt >= 0 {
+		specs = append(specs, margaret.Gt(margaret.BaseSeq(*spec.Gt)))
+	}
+
+	src, err := p.rxlog.Query(specs...)
+	if err != nil {
+		return 0, fmt.Errorf("query: failed to scan receive log: %w", err)
+	}
+
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return current, nil
+			}
+			return 0, err
+		}
+
+		sw, ok := v.(margaret.SeqWrapper)
+		if !ok {
+			return 0, fmt.Errorf("query: expected seq wrapper, got %T", v)
+		}
+
+		res, ok := p.filter(spec, sw.Seq().Seq(), sw.Value(), false)
+		if !ok {
+			continue
+		}
+		if err := send(ctx, res); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// runIndexed combines the bitmaps of the query and sorts the result.
+// It returns the last sequence that was covered by the indexes.
+func (p *Planner) runIndexed(ctx context.Context, spec Spec, send func(context.Context, Result) error) (int64, error) {
+	// the combined index adds messages to the resolver before the other multilogs are flushed.
+	// Only what it committed is taken from the bitmaps, the rest is left to the live part.
+	indexedUntil := p.indexed.Indexed()
+
+	set, err := p.Bitmap(spec)
+	if err != nil {
+		return 0, err
+	}
+
+	// newer messages are picked up by the live part
+	indexed := bmap.New()
+	if indexedUntil >= 0 {
+		indexed.AddRange(0, uint64(indexedUntil)+1)
+	}
+	set.And(indexed)
+
+	for it := p.sorted(spec, set); ; {
+		seq, ok, err := it()
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+
+		v, err := p.rxlog.Get(margaret.BaseSeq(seq))
+		if err != nil {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return 0, fmt.Errorf("query: failed to get message %d: %w", seq, err)
+		}
+
+		res, ok := p.filter(spec, seq, v, false)
+		if !ok {
+			continue
+		}
+		if err := send(ctx, res); err != nil {
+			return 0, err
+		}
+	}
+
+	return indexedUntil, nil
+}
+
+// sorted returns an iterator over the sequences of set in the order of the query
+func (p *Planner) sorted(spec Spec, set *bmap.Bitmap) func() (int64, bool, error) {
+	if spec.Order == OrderSeq {
+		seqs := set.ToArray()
+		i := 0
+		return func() (int64, bool, error) {
+			for i < len(seqs) {
+				idx := i
+				if spec.Reverse {
+					idx = len(seqs) - 1 - i
+				}
+				i++
+
+				seq := int64(seqs[idx])
+				if spec.inRange(seq) {
+					return seq, true, nil
+				}
+			}
+			return 0, false, nil
+		}
+	}
+
+	domain := repo.SortByClaimed
+	if spec.Order == OrderReceived {
+		domain = repo.SortByReceived
+	}
+
+	sortedSeqs, err := p.res.SortAndFilterBitmap(set, domain, spec.inRange, spec.Reverse)
+	return func() (int64, bool, error) {
+		if err != nil {
+			return 0, false, fmt.Errorf("query: failed to sort: %w", err)
+		}
+		if len(sortedSeqs) == 0 {
+			return 0, false, nil
+		}
+		next := sortedSeqs[0]
+		sortedSeqs = sortedSeqs[1:]
+		return next.Seq, true, nil
+	}
+}
+
+// Bitmap returns the sequences of all indexed messages that match the authors, type, tangle, links and private settings of spec.
+// Ordering, range and limit are not applied.
+func (p *Planner) Bitmap(spec Spec) (*bmap.Bitmap, error) {
+	var set *bmap.Bitmap
+	and := func(b *bmap.Bitmap) {
+		if set == nil {
+			set = b
+		} else {
+			set.And(b)
+		}
+	}
+
+	if len(spec.Authors) > 0 {
+		authors := bmap.New()
+		for _, a := range spec.Authors {
+			authors.Or(loadBitmap(p.users, storedrefs.Feed(a)))
+		}
+		and(authors)
+	}
+
+	if spec.Type != "" {
+		and(loadBitmap(p.byType, librarian.Addr("string:"+spec.Type)))
+	}
+
+	if spec.Tangle != nil {
+		and(loadBitmap(p.tangles, TangleAddr(spec.Tangle, spec.TangleName)))
+	}
+
+	if len(spec.Links) > 0 {
+		linked := bmap.New()
+		for _, l := range spec.Links {
+			linked.Or(loadBitmap(p.links, multilogs.LinkAddr(l)))
+		}
+		and(linked)
+	}
+
+	if set == nil {
+		// no filters, start with everything that was indexed
+		set = bmap.New()
+		if n := p.res.Seq(); n > 0 {
+			set.AddRange(0, uint64(n))
+		}
+	}
+
+	readable := bmap.New()
+	if spec.decrypt() && p.self != nil {
+		readable.Or(loadBitmap(p.privs, librarian.Addr("box1:")+storedrefs.Feed(p.self)))
+		readable.Or(loadBitmap(p.privs, librarian.Addr("box2:")+storedrefs.Feed(p.self)))
+	}
+
+	if spec.OnlyPrivate {
+		set.And(readable)
+		return set, nil
+	}
+
+	if spec.KeepBoxed {
+		return set, nil
+	}
+
+	// all the boxed messages, except the ones we can read
+	boxed := loadBitmap(p.privs, librarian.Addr("meta:box1"))
+	boxed.Or(loadBitmap(p.privs, librarian.Addr("meta:box2")))
+	boxed.AndNot(readable)
+
+	set.AndNot(boxed)
+	return set, nil
+}
+
+// loadBitmap returns an empty bitmap for unknown addresses
+func loadBitmap(mlog *roaring.MultiLog, addr librarian.Addr) *bmap.Bitmap {
+	b, err := mlog.LoadInternalBitmap(addr)
+	if err != nil {
+		// TODO: compare not found
+		return bmap.New()
+	}
+	return b
+}
+
+// filter checks a message from the receive log against the query and decrypts it if needed.
+// checkContent is set for messages that didn't come through the indexes.
+func (p *Planner) filter(spec Spec, seq int64, v interface{}, checkContent bool) (Result, bool) {
+	var res Result
+
+	msg, ok := v.(refs.Message)
+	if !ok {
+		// nulled entries
+		return res, false
+	}
+
+	res.Cursor.Seq = seq
+	switch spec.Order {
+	case OrderClaimed:
+		res.Cursor.By = msg.Claimed().UnixNano() / 1e6
+	case OrderReceived:
+		res.Cursor.By = msg.Received().UnixNano() / 1e6
+	default:
+		res.Cursor.By = seq
+	}
+	if !spec.inRange(res.Cursor.By) || !spec.afterCursor(res.Cursor) {
+		return res, false
+	}
+
+	if checkContent && !spec.hasAuthor(msg.Author()) {
+		return res, false
+	}
+
+	content := msg.ContentBytes()
+	if len(content) == 0 {
+		return res, false
+	}
+
+	if content[0] != '{' { // boxed
+		if spec.decrypt() && p.unboxer != nil {
+			if unboxed, err := p.unboxer.UnboxedMessage(msg); err == nil {
+				if !spec.matchesContent(unboxed.ContentBytes(), checkContent) {
+					return res, false
+				}
+				res.Message = unboxed
+				return res, true
+			}
+		}
+
+		if !spec.KeepBoxed || spec.OnlyPrivate || spec.hasContentFilter() {
+			return res, false
+		}
+		res.Message = msg
+		return res, true
+	}
+
+	if spec.OnlyPrivate || !spec.matchesContent(content, checkContent) {
+		return res, false
+	}
+	res.Message = msg
+	return res, true
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: MIT
+
+package query_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/luigi"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/query"
+	"go.cryptoscope.co/ssb/sbot"
+)
+
+func TestPlanner(t *testing.T) {
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	bot, err := sbot.New(
+		sbot.WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		sbot.WithRepoPath(testPath),
+		sbot.DisableNetworkNode(),
+	)
+	r.NoError(err)
+
+	type post struct {
+		Type string           `json:"type"`
+		Text string           `json:"text"`
+		Root *refs.MessageRef `json:"root,omitempty"`
+	}
+
+	rootRef, err := bot.PublishLog.Publish(post{Type: "post", Text: "root"})
+	r.NoError(err)
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = bot.PublishLog.Publish(map[string]interface{}{"type": "contact", "following": true})
+	r.NoError(err)
+	time.Sleep(5 * time.Millisecond)
+
+	var replies []string
+	for _, txt := range []string{"first", "second"} {
+		ref, err := bot.PublishLog.Publish(post{Type: "post", Text: txt, Root: rootRef})
+		r.NoError(err)
+		replies = append(replies, ref.Ref())
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// a private message that only self can read
+	boxed, err := bot.Groups.EncryptBox1([]byte(`{"type":"post","text":"secret"}`), bot.KeyPair.Id)
+	r.NoError(err)
+	_, err = bot.PublishLog.Publish(boxed)
+	r.NoError(err)
+
+	bot.WaitUntilIndexesAreSynced()
+
+	run := func(spec query.Spec) []string {
+		var vals []interface{}
+		err := bot.QueryPlanner.Run(context.TODO(), luigi.NewSliceSink(&vals), spec)
+		r.NoError(err)
+
+		var keys []string
+		for _, v := range vals {
+			msg, ok := v.(refs.Message)
+			r.True(ok, "wrong type: %T", v)
+			keys = append(keys, msg.Key().Ref())
+		}
+		return keys
+	}
+
+	posts := run(query.Spec{Type: "post", Order: query.OrderClaimed})
+	r.Equal(append([]string{rootRef.Ref()}, replies...), posts)
+
+	r.Len(run(query.Spec{Type: "post", Order: query.OrderClaimed, Private: true}), 4)
+
+	r.Equal([]string{replies[1]}, run(query.Spec{Type: "post", Order: query.OrderClaimed, Reverse: true, Limit: 1}))
+
+	r.Equal(replies, run(query.Spec{Tangle: rootRef, Authors: []*refs.FeedRef{bot.KeyPair.Id}, Order: query.OrderClaimed}))
+
+	// receive order, without boxed messages
+	r.Len(run(query.Spec{}), 4)
+	r.Len(run(query.Spec{KeepBoxed: true}), 5)
+	r.Equal([]string{rootRef.Ref()}, run(query.Spec{Lt: query.Bound(1)}))
+	r.Len(run(query.Spec{Gt: query.Bound(0)}), 3)
+
+	// live continues with new replies
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	liveCh := make(chan refs.Message)
+	done := make(chan error, 1)
+	go func() {
+		done <- bot.QueryPlanner.Run(ctx, luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+			if err != nil {
+				return err
+			}
+			liveCh <- v.(refs.Message)
+			return nil
+		}), query.Spec{Tangle: rootRef, Order: query.OrderClaimed, Live: true, Limit: 3})
+	}()
+
+	for i := 0; i < 2; i++ {
+		msg := <-liveCh
+		r.Equal(replies[i], msg.Key().Ref())
+	}
+
+	// not part of the thread
+	_, err = bot.PublishLog.Publish(post{Type: "post", Text: "unrelated"})
+	r.NoError(err)
+
+	third, err := bot.PublishLog.Publish(post{Type: "post", Text: "third", Root: rootRef})
+	r.NoError(err)
+
+	select {
+	case msg := <-liveCh:
+		r.Equal(third.Ref(), msg.Key().Ref())
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for live reply")
+	}
+	r.NoError(<-done)
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+}
@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: MIT
+
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"go.cryptoscope.co/librarian"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/multilogs"
+)
+
+// Order selects the domain the results are sorted by and the range filters apply to.
+type Order uint
+
+// The known orders
+const (
+	// OrderSeq sorts by the sequence of the receive log, which is the order the messages were stored in.
+	OrderSeq Order = iota
+
+	// OrderClaimed sorts by the timestamp the author put on the message.
+	OrderClaimed
+
+	// OrderReceived sorts by the time the message was received.
+	OrderReceived
+)
+
+// Spec describes which messages a query returns and in which order.
+// The zero value selects all public messages in receive order.
+type Spec struct {
+	// Authors limits the results to these feeds
+	Authors []*refs.FeedRef
+
+	// Type only returns messages with this content type
+	Type string
+
+	// Tangle only returns messages that are part of the tangle with this root.
+	// TangleName selects a v2 tangle (like group) and should be empty for v1 (content.root) threads.
+	Tangle     *refs.MessageRef
+	TangleName string
+
+	// Mentions only returns messages that link to one of these refs in their mentions field
+	Mentions []string
+
+	// Links only returns messages that contain one of these refs anywhere in their (decrypted) content
+	Links []string
+
+	// Channel only returns messages posted to this channel (with or without the leading #)
+	Channel string
+
+	// Private also returns the boxed messages that can be decrypted, with their cleartext content.
+	Private bool
+
+	// OnlyPrivate returns just the decrypted messages, it implies Private.
+	OnlyPrivate bool
+
+	// KeepBoxed returns boxed messages that weren't decrypted as they are, instead of dropping them.
+	// Boxed messages never match the content filters (type, tangle, mentions and channel).
+	KeepBoxed bool
+
+	Order Order
+
+	// Gt and Lt are exclusive bounds on the Order domain, nil means no bound (see Bound and ArgBound).
+	// These are milliseconds for the timestamps and sequences of the receive log for OrderSeq.
+	Gt, Lt *int64
+
+	Reverse bool
+
+	// After continues a previous query after the result with this cursor.
+	// The query must use the same Order and Reverse setting.
+	After *Cursor
+
+	// Limit stops after that many messages. Zero or negative values mean no limit.
+	Limit int64
+
+	// Live keeps the query open and sends new messages as they arrive, after the stored ones.
+	Live bool
+}
+
+// needsIndex returns true if the query can't be answered by just iterating the receive log
+func (s Spec) needsIndex() bool {
+	return len(s.Authors) > 0 || s.Type != "" || s.Tangle != nil || len(s.Links) > 0 || s.OnlyPrivate || s.Order != OrderSeq
+}
+
+func (s Spec) decrypt() bool {
+	return s.Private || s.OnlyPrivate
+}
+
+// hasContentFilter returns true if the query looks into the content, which boxed messages can't match
+func (s Spec) hasContentFilter() bool {
+	return s.Type != "" || s.Tangle != nil || len(s.Links) > 0 || len(s.Mentions) > 0 || s.Channel != ""
+}
+
+func (s Spec) inRange(v int64) bool {
+	if s.Gt != nil && v <= *s.Gt {
+		return false
+	}
+	if s.Lt != nil && v >= *s.Lt {
+		return false
+	}
+	return true
+}
+
+// Bound returns a pointer to v, for the Gt and Lt fields of Spec
+func Bound(v int64) *int64 { return &v }
+
+// ArgBound is like Bound but returns nil for zero, like the gt and lt arguments of the muxrpc calls use it
+func ArgBound(v int64) *int64 {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+func (s Spec) afterCursor(c Cursor) bool {
+	if s.After == nil {
+		return true
+	}
+	if c.By == s.After.By {
+		if s.Reverse {
+			return c.Seq < s.After.Seq
+		}
+		return c.Seq > s.After.Seq
+	}
+	if s.Reverse {
+		return c.By < s.After.By
+	}
+	return c.By > s.After.By
+}
+
+func (s Spec) hasAuthor(author *refs.FeedRef) bool {
+	if len(s.Authors) == 0 {
+		return true
+	}
+	for _, a := range s.Authors {
+		if a.Equal(author) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesContent checks the fields of the content that aren't indexed.
+// checkIndexed also checks type, tangle and links, for messages that weren't picked through the indexes.
+func (s Spec) matchesContent(content []byte, checkIndexed bool) bool {
+	if !s.hasContentFilter() {
+		return true
+	}
+
+	var jsonContent struct {
+		Type     string
+		Root     json.RawMessage
+		Tangles  json.RawMessage
+		Channel  string
+		Mentions json.RawMessage
+	}
+	if err := json.Unmarshal(content, &jsonContent); err != nil {
+		return false
+	}
+
+	if checkIndexed && s.Type != "" && jsonContent.Type != s.Type {
+		return false
+	}
+
+	// root and tangles are only decoded if needed, they are broken on some messages
+	if checkIndexed && s.Tangle != nil {
+		var root *refs.MessageRef
+		if s.TangleName == "" {
+			json.Unmarshal(jsonContent.Root, &root)
+		} else {
+			var tangles refs.Tangles
+			json.Unmarshal(jsonContent.Tangles, &tangles)
+			if tip, has := tangles[s.TangleName]; has {
+				root = tip.Root
+			}
+		}
+		if root == nil || !bytes.Equal(root.Hash, s.Tangle.Hash) {
+			return false
+		}
+	}
+
+	if checkIndexed && len(s.Links) > 0 && !hasAny(multilogs.ContentLinks(content), s.Links) {
+		return false
+	}
+
+	if s.Channel != "" && strings.TrimPrefix(jsonContent.Channel, "#") != strings.TrimPrefix(s.Channel, "#") {
+		return false
+	}
+
+	if len(s.Mentions) > 0 {
+		return hasAny(MentionedLinks(jsonContent.Mentions), s.Mentions)
+	}
+	return true
+}
+
+func hasAny(links, want []string) bool {
+	for _, link := range links {
+		for _, w := range want {
+			if link == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MentionedLinks returns the links of a mentions field.
+// It understands lists of strings or objects with a link field and, for older messages, an object of those.
+func MentionedLinks(mentions json.RawMessage) []string {
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	type mention struct {
+		Link string `json:"link"`
+	}
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal(mentions, &elems); err != nil {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(mentions, &obj); err != nil {
+			return nil
+		}
+		for _, v := range obj {
+			elems = append(elems, v)
+		}
+	}
+
+	var links []string
+	for _, e := range elems {
+		var str string
+		if err := json.Unmarshal(e, &str); err == nil {
+			links = append(links, str)
+			continue
+		}
+		var m mention
+		if err := json.Unmarshal(e, &m); err == nil && m.Link != "" {
+			links = append(links, m.Link)
+		}
+	}
+	return links
+}
+
+// TangleAddr returns the address of a tangle in the tangles multilog.
+// name should be empty for v1 threads.
+func TangleAddr(root *refs.MessageRef, name string) librarian.Addr {
+	if name == "" {
+		return librarian.Addr(append([]byte("v1:"), root.Hash...))
+	}
+	return librarian.Addr("v2:"+name+":") + librarian.Addr(root.Hash)
+}
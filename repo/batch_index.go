@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+)
+
+// BatchSinkIndex is implemented by indexes that can process several messages of the receive log at once.
+// The index is served with batches of everything that is available, up to a limit, instead of one message at a time.
+type BatchSinkIndex interface {
+	librarian.SinkIndex
+
+	// PourBatch processes the margaret.SeqWrapper values of the batch, in order.
+	PourBatch(ctx context.Context, vals []interface{}) error
+}
+
+// IndexUpdateFunc is the update function of a librarian.SinkIndex
+type IndexUpdateFunc = func(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error
+
+// NewBadgerSinkIndex works like librarian.NewSinkIndex on a badger backed index
+// but writes all the values of a batch in one transaction and sets the sequence of the index once per batch.
+//
+// Values are stored as JSON, like the librarian badger index does.
+// Observables of idx are not updated by batches, the badger indexes are read from the database directly.
+// If the process dies before the sequence of a batch is set, the batch is processed again.
+// The update functions only overwrite values so that's fine.
+func NewBadgerSinkIndex(db *badger.DB, f IndexUpdateFunc, idx librarian.SeqSetterIndex) BatchSinkIndex {
+	return badgerSinkIndex{
+		SinkIndex: librarian.NewSinkIndex(f, idx),
+
+		db:     db,
+		idx:    idx,
+		update: f,
+	}
+}
+
+type badgerSinkIndex struct {
+	// single messages, QuerySpec and Close
+	librarian.SinkIndex
+
+	db     *badger.DB
+	idx    librarian.SeqSetterIndex
+	update IndexUpdateFunc
+}
+
+func (bs badgerSinkIndex) PourBatch(ctx context.Context, vals []interface{}) error {
+	if len(vals) == 0 {
+		return nil
+	}
+
+	var last margaret.Seq
+	err := bs.db.Update(func(txn *badger.Txn) error {
+		setter := txnSetter{SeqSetterIndex: bs.idx, txn: txn}
+		for _, v := range vals {
+			sw, ok := v.(margaret.SeqWrapper)
+			if !ok {
+				return fmt.Errorf("badger batch index: expected seq wrapper, got %T", v)
+			}
+			if err := bs.update(ctx, sw.Seq(), sw.Value(), setter); err != nil {
+				return err
+			}
+			last = sw.Seq()
+		}
+		return nil
+	})
+	if errors.Is(err, badger.ErrTxnTooBig) && len(vals) > 1 {
+		half := len(vals) / 2
+		if err := bs.PourBatch(ctx, vals[:half]); err != nil {
+			return err
+		}
+		return bs.PourBatch(ctx, vals[half:])
+	}
+	if err != nil {
+		return err
+	}
+
+	return bs.idx.SetSeq(last)
+}
+
+// txnSetter writes into a badger transaction instead of the index.
+// Reads still go to the index and don't see the values of the current batch.
+type txnSetter struct {
+	librarian.SeqSetterIndex
+
+	txn *badger.Txn
+}
+
+func (ts txnSetter) Set(_ context.Context, addr librarian.Addr, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("badger batch index: failed to encode value: %w", err)
+	}
+	return ts.txn.Set([]byte(addr), raw)
+}
+
+func (ts txnSetter) Delete(_ context.Context, addr librarian.Addr) error {
+	return ts.txn.Delete([]byte(addr))
+}
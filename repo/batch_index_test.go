@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/librarian"
+	libbadger "go.cryptoscope.co/librarian/badger"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestBadgerSinkIndexBatch(t *testing.T) {
+	r := require.New(t)
+	ctx := context.TODO()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	errBroken := errors.New("broken message")
+	update := func(ctx context.Context, seq margaret.Seq, val interface{}, idx librarian.SetterIndex) error {
+		str := val.(string)
+		if str == "broken" {
+			return errBroken
+		}
+		return idx.Set(ctx, librarian.Addr(fmt.Sprint("key", seq.Seq())), str)
+	}
+
+	var snk repo.BatchSinkIndex
+	db, _, _, err := repo.OpenBadgerIndex(repo.New(rpath), "test", func(db *badger.DB) (librarian.SeqSetterIndex, librarian.SinkIndex) {
+		idx := libbadger.NewIndex(db, 0)
+		snk = repo.NewBadgerSinkIndex(db, update, idx)
+		return idx, snk
+	})
+	r.NoError(err)
+	defer db.Close()
+
+	stored := func() map[string]string {
+		vals := make(map[string]string)
+		err := db.View(func(txn *badger.Txn) error {
+			iter := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer iter.Close()
+			prefix := []byte("key")
+			for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+				it := iter.Item()
+				k := string(it.KeyCopy(nil))
+				err := it.Value(func(v []byte) error {
+					vals[k] = string(v)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		r.NoError(err)
+		return vals
+	}
+
+	batch := func(from int64, vals ...string) []interface{} {
+		var b []interface{}
+		for i, v := range vals {
+			b = append(b, margaret.WrapWithSeq(v, margaret.BaseSeq(from+int64(i))))
+		}
+		return b
+	}
+
+	r.NoError(snk.PourBatch(ctx, batch(0, "a", "b", "c")))
+	r.Equal(map[string]string{"key0": `"a"`, "key1": `"b"`, "key2": `"c"`}, stored())
+
+	// a batch that breaks off leaves nothing behind
+	err = snk.PourBatch(ctx, batch(3, "d", "broken", "f"))
+	r.True(errors.Is(err, errBroken))
+	r.Len(stored(), 3)
+
+	// single messages still work
+	r.NoError(snk.Pour(ctx, margaret.WrapWithSeq("d", margaret.BaseSeq(3))))
+	r.NoError(snk.PourBatch(ctx, batch(4, "e", "f")))
+	r.Equal(map[string]string{
+		"key0": `"a"`, "key1": `"b"`, "key2": `"c"`,
+		"key3": `"d"`, "key4": `"e"`, "key5": `"f"`,
+	}, stored())
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 
 	bmap "github.com/RoaringBitmap/roaring"
@@ -56,51 +57,105 @@ func (ss *sortedSource) Next(_ context.Context) (interface{}, error) {
 // SortedAscending wraps around SortedSeqSlice to give it a Less that sorts values from small to large.
 type SortedAscending struct{ SortedSeqSlice }
 
-// Less sorts values up
+// Less sorts values up. Equal values are sorted by their sequence.
 func (ts SortedAscending) Less(i int, j int) bool {
 	vi := ts.SortedSeqSlice[i]
 	vj := ts.SortedSeqSlice[j]
+	if vi.By == vj.By {
+		return vi.Seq < vj.Seq
+	}
 	return vi.By < vj.By
 }
 
 // SortedDescending wraps around SortedSeqSlice to give it a Less that sorts values from large to small.
 type SortedDescending struct{ SortedSeqSlice }
 
-// Less sorts values down
+// Less sorts values down. Equal values are sorted by their sequence, the newest first.
 func (ts SortedDescending) Less(i int, j int) bool {
 	vi := ts.SortedSeqSlice[i]
 	vj := ts.SortedSeqSlice[j]
+	if vi.By == vj.By {
+		return vi.Seq > vj.Seq
+	}
 	return vi.By > vj.By
 }
 
 // SequenceResolver holds three gigantic arrays for each of the understood ResolveDomains.
+// Timestamps are stored as milliseconds since the unix epoch, like the JS stack does.
 //
 // It should be hooked into a receive log, and filled with Append.
+// When opened from a repo, every Append is also written to the end of three files, one per domain.
+// After a crash these files might have different lengths, Load only keeps the entries that made it into all three.
 //
 // TODO: a better approach might be to fetch these lazyly from disk if they become too large.
 // At 1mio messages we roughly look at 8mb per domain.
 type SequenceResolver struct {
+	mu sync.RWMutex
+
 	seq2claimed  []int64
 	seq2received []int64
 	seq2feedseq  []int64
 
 	dirty bool      // has not been written to disk yet
 	repo  Interface // where to store the arrays
+
+	files []*os.File // append-only files of the three domains (nil if not opened from a repo)
 }
 
+// the order of the files in SequenceResolver.files
+var seqResolverFileNames = []string{"ts-claimed", "ts-received", "feed-seqs"}
+
 // NewSequenceResolver opens the stored resolver at r.GetPath("seqmaps") and Loads existing values.
+// New entries are appended to the files as they are added.
 func NewSequenceResolver(r Interface) (*SequenceResolver, error) {
 	var sr SequenceResolver
 	sr.repo = r
 
-	_, err := sr.Load()
+	n, err := sr.Load()
 	if err != nil {
 		return nil, fmt.Errorf("seq resolver: failed to load: %w", err)
 	}
 
+	err = os.MkdirAll(filepath.Dir(sr.indexPath("create.dir")), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("seq resolver: failed to create directory: %w", err)
+	}
+
+	for _, name := range seqResolverFileNames {
+		f, err := os.OpenFile(sr.indexPath(name), os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			sr.closeFiles()
+			return nil, fmt.Errorf("seq resolver: failed to open %s: %w", name, err)
+		}
+
+		// drop incomplete entries from a crash
+		if err := f.Truncate(n * 8); err != nil {
+			f.Close()
+			sr.closeFiles()
+			return nil, fmt.Errorf("seq resolver: failed to truncate %s: %w", name, err)
+		}
+		if _, err := f.Seek(n*8, io.SeekStart); err != nil {
+			f.Close()
+			sr.closeFiles()
+			return nil, fmt.Errorf("seq resolver: failed to seek %s: %w", name, err)
+		}
+		sr.files = append(sr.files, f)
+	}
+
 	return &sr, nil
 }
 
+func (sr *SequenceResolver) closeFiles() error {
+	var err error
+	for _, f := range sr.files {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	sr.files = nil
+	return err
+}
+
 // NewSequenceResolverFromLog creates a fresh resolver reading the full margaret log.
 // Expects to read refs.Message from the log.
 // Useful for testing.
@@ -131,8 +186,8 @@ func NewSequenceResolverFromLog(l margaret.Log) (*SequenceResolver, error) {
 		}
 
 		// TODO: seqWrap and use sr.Append()
-		sr.seq2claimed = append(sr.seq2claimed, msg.Claimed().Unix())
-		sr.seq2received = append(sr.seq2received, msg.Received().Unix())
+		sr.seq2claimed = append(sr.seq2claimed, toMillis(msg.Claimed()))
+		sr.seq2received = append(sr.seq2received, toMillis(msg.Received()))
 		sr.seq2feedseq = append(sr.seq2feedseq, msg.Seq())
 	}
 
@@ -160,7 +215,8 @@ const (
 // TODO: maybe some utilities, OTOH it's just generating the seq array
 // func (sr SequenceResolver) SortByRange(from, to, by, ok) ...
 
-func (sr SequenceResolver) prepare(by SortDomain) ([]int64, int64, error) {
+// prepare needs to be called with sr.mu held
+func (sr *SequenceResolver) prepare(by SortDomain) ([]int64, int64, error) {
 	err := sr.checkConsistency()
 	if err != nil {
 		return nil, -2, err
@@ -182,7 +238,10 @@ func (sr SequenceResolver) prepare(by SortDomain) ([]int64, int64, error) {
 	return domain, max, nil
 }
 
-func (sr SequenceResolver) SortAndFilterBitmap(seqs *bmap.Bitmap, by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+func (sr *SequenceResolver) SortAndFilterBitmap(seqs *bmap.Bitmap, by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
 	domain, max, err := sr.prepare(by)
 	if err != nil {
 		return nil, err
@@ -218,7 +277,10 @@ func (sr SequenceResolver) SortAndFilterBitmap(seqs *bmap.Bitmap, by SortDomain,
 	return result, nil
 }
 
-func (sr SequenceResolver) SortAndFilterAll(by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+func (sr *SequenceResolver) SortAndFilterAll(by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
 	domain, _, err := sr.prepare(by)
 	if err != nil {
 		return nil, err
@@ -248,7 +310,10 @@ func (sr SequenceResolver) SortAndFilterAll(by SortDomain, ok ResolverFilter, de
 
 // SortAndFilter goes through seqs in the passed domain using the filter function to include wanted elements.
 // desc: true means descending, desc: false means ascending.
-func (sr SequenceResolver) SortAndFilter(seqs []int64, by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+func (sr *SequenceResolver) SortAndFilter(seqs []int64, by SortDomain, ok ResolverFilter, desc bool) (SortedSeqSlice, error) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
 	domain, max, err := sr.prepare(by)
 	if err != nil {
 		return nil, err
@@ -297,7 +362,11 @@ func (sr *SequenceResolver) checkConsistency() error {
 }
 
 // Append adds all three domains to the resolver.
+// If the resolver was opened from a repo, the values are also written to disk.
 func (sr *SequenceResolver) Append(seq int64, feed int64, claimed, received time.Time) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
 	if err := sr.checkConsistency(); err != nil {
 		return err
 	}
@@ -313,20 +382,38 @@ func (sr *SequenceResolver) Append(seq int64, feed int64, claimed, received time
 		return fmt.Errorf("seq resolver: would break const (has:%d, will: %d)", has, seq)
 	}
 
-	sr.seq2claimed = append(sr.seq2claimed, claimed.Unix())
-	sr.seq2received = append(sr.seq2received, received.Unix())
-	sr.seq2feedseq = append(sr.seq2feedseq, feed)
+	var vals = []int64{toMillis(claimed), toMillis(received), feed}
+
+	if sr.files != nil {
+		var buf [8]byte
+		for i, f := range sr.files {
+			binary.BigEndian.PutUint64(buf[:], uint64(vals[i]))
+			if _, err := f.Write(buf[:]); err != nil {
+				return fmt.Errorf("seq resolver: failed to write %s: %w", seqResolverFileNames[i], err)
+			}
+		}
+	}
+
+	sr.seq2claimed = append(sr.seq2claimed, vals[0])
+	sr.seq2received = append(sr.seq2received, vals[1])
+	sr.seq2feedseq = append(sr.seq2feedseq, vals[2])
 
-	sr.dirty = true
+	sr.dirty = sr.files == nil
 	return nil
 }
 
-func (sr SequenceResolver) String() string {
+func (sr *SequenceResolver) String() string {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return fmt.Sprintf("seq resolver: %d elements", len(sr.seq2claimed))
 }
 
 // Load reads the files from repo and deserializes them.
+// Entries that are not present in all three files are dropped.
 func (sr *SequenceResolver) Load() (int64, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
 	if sr.repo == nil {
 		return -1, fmt.Errorf("seq resolver: not initialized with repo to read from")
 	}
@@ -340,11 +427,14 @@ func (sr *SequenceResolver) Load() (int64, error) {
 		{"feed-seqs", &sr.seq2feedseq},
 	}
 
+	var shortest = -1
 	for _, idx := range idxes {
 		f, err := os.Open(sr.indexPath(idx.name))
 		if err != nil {
 			if os.IsNotExist(err) {
-				return 0, nil
+				*idx.arr = nil
+				shortest = 0
+				continue
 			}
 			return -1, fmt.Errorf("seq resolver: failed to create temp file for %s: %w", idx.name, err)
 		}
@@ -366,6 +456,15 @@ func (sr *SequenceResolver) Load() (int64, error) {
 		}
 
 		*idx.arr = arr
+		if shortest == -1 || len(arr) < shortest {
+			shortest = len(arr)
+		}
+	}
+
+	for _, idx := range idxes {
+		if len(*idx.arr) > shortest {
+			*idx.arr = (*idx.arr)[:shortest]
+		}
 	}
 	if err := sr.checkConsistency(); err != nil {
 		return -1, err
@@ -379,11 +478,24 @@ func (sr *SequenceResolver) indexPath(name string) string {
 }
 
 // Serialize does the reverse from Load. It saves the three domains to disk.
+// If the resolver writes it's entries as they are appended, it only syncs the files.
 func (sr *SequenceResolver) Serialize() error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
 	if err := sr.checkConsistency(); err != nil {
 		return err
 	}
 
+	if sr.files != nil {
+		for i, f := range sr.files {
+			if err := f.Sync(); err != nil {
+				return fmt.Errorf("seq resolver: failed to sync %s: %w", seqResolverFileNames[i], err)
+			}
+		}
+		return nil
+	}
+
 	os.MkdirAll(filepath.Dir(sr.indexPath("create.dir")), 0700)
 
 	var idxes = []struct {
@@ -421,7 +533,10 @@ func (sr *SequenceResolver) Serialize() error {
 }
 
 // Seq returns the number of entries held by the resolver.
-func (sr SequenceResolver) Seq() int64 {
+func (sr *SequenceResolver) Seq() int64 {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
 	err := sr.checkConsistency()
 	if err != nil {
 		panic(err)
@@ -430,9 +545,18 @@ func (sr SequenceResolver) Seq() int64 {
 	return int64(len(sr.seq2claimed))
 }
 
-// Close serialzes the resolver to disk.
-func (sr SequenceResolver) Close() error {
-	return sr.Serialize()
+// Close serialzes the resolver to disk and closes the files.
+func (sr *SequenceResolver) Close() error {
+	if err := sr.Serialize(); err != nil {
+		return err
+	}
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.closeFiles()
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
 }
 
 // util
@@ -3,6 +3,8 @@ package repo_test
 import (
 	"context"
 	"encoding/json"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
@@ -34,7 +36,7 @@ func TestTimestampSorting(t *testing.T) {
 	r.NoError(err, "failed to get sliced array")
 
 	under9000 := func(v int64) bool {
-		ok := v < 9000
+		ok := v < 9000*1000 // milliseconds
 		t.Log(v, ok)
 		return ok
 	}
@@ -45,7 +47,7 @@ func TestTimestampSorting(t *testing.T) {
 	t.Log(sorted)
 
 	under3000 := func(v int64) bool {
-		ok := v < 3000
+		ok := v < 3000*1000
 		t.Log(v, ok)
 		return ok
 	}
@@ -72,6 +74,51 @@ func TestTimestampSorting(t *testing.T) {
 	t.Log(elems)
 }
 
+func TestSequenceResolverRecovery(t *testing.T) {
+	r := require.New(t)
+
+	rpath, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	res, err := repo.NewSequenceResolver(testRepo)
+	r.NoError(err)
+	r.EqualValues(0, res.Seq())
+
+	for i := int64(0); i < 3; i++ {
+		err = res.Append(i, i+1, time.Unix(1000+i, 0), time.Now())
+		r.NoError(err)
+	}
+	r.NoError(res.Close())
+
+	res, err = repo.NewSequenceResolver(testRepo)
+	r.NoError(err)
+	r.EqualValues(3, res.Seq())
+
+	// append one more but simulate a crash that only wrote part of it
+	r.NoError(res.Append(3, 4, time.Unix(1003, 0), time.Now()))
+	r.NoError(res.Close())
+	claimedPath := testRepo.GetPath(repo.PrefixMultiLog, "combined", "seqmaps", "ts-claimed")
+	r.NoError(os.Truncate(claimedPath, 3*8+5))
+
+	res, err = repo.NewSequenceResolver(testRepo)
+	r.NoError(err)
+	r.EqualValues(3, res.Seq(), "should have dropped the incomplete entry")
+
+	// the entry can be added again
+	r.NoError(res.Append(3, 4, time.Unix(1003, 0), time.Now()))
+	r.EqualValues(4, res.Seq())
+
+	all := func(int64) bool { return true }
+	sorted, err := res.SortAndFilterAll(repo.SortByClaimed, all, true)
+	r.NoError(err)
+	r.Len(sorted, 4)
+	r.EqualValues(3, sorted[0].Seq)
+	r.EqualValues(1003*1000, sorted[0].By)
+	r.NoError(res.Close())
+}
+
 // utils
 
 var seq int64
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// WebsocketTokenFile is the name of the file that holds the token for websocket connections without secret-handshake
+const WebsocketTokenFile = "ws-noauth-token"
+
+// RotateWebsocketToken creates a new random token for websocket connections without secret-handshake
+// and writes it to the repo, replacing the previous one. The file is only readable by the owner.
+func RotateWebsocketToken(r Interface) (string, error) {
+	var buf = make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("repo: failed to read random bytes for websocket token: %w", err)
+	}
+	token := base64.URLEncoding.EncodeToString(buf)
+
+	tokenPath := r.GetPath(WebsocketTokenFile)
+	// remove the old one first, WriteFile doesn't change the permissions of existing files
+	if err := os.Remove(tokenPath); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("repo: failed to remove old websocket token: %w", err)
+	}
+	if err := ioutil.WriteFile(tokenPath, []byte(token), 0600); err != nil {
+		return "", fmt.Errorf("repo: failed to write websocket token: %w", err)
+	}
+	return token, nil
+}
+
+// ReadWebsocketToken returns the current token for websocket connections without secret-handshake
+func ReadWebsocketToken(r Interface) (string, error) {
+	data, err := ioutil.ReadFile(r.GetPath(WebsocketTokenFile))
+	if err != nil {
+		return "", fmt.Errorf("repo: failed to read websocket token: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebsocketToken(t *testing.T) {
+	r := require.New(t)
+
+	rpath, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(rpath)
+
+	repo := New(rpath)
+
+	_, err = ReadWebsocketToken(repo)
+	r.Error(err, "no token yet")
+
+	tok1, err := RotateWebsocketToken(repo)
+	r.NoError(err)
+	r.NotEqual("", tok1)
+
+	read, err := ReadWebsocketToken(repo)
+	r.NoError(err)
+	r.Equal(tok1, read)
+
+	info, err := os.Stat(repo.GetPath(WebsocketTokenFile))
+	r.NoError(err)
+	r.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	tok2, err := RotateWebsocketToken(repo)
+	r.NoError(err)
+	r.NotEqual(tok1, tok2, "token not rotated")
+
+	read, err = ReadWebsocketToken(repo)
+	r.NoError(err)
+	r.Equal(tok2, read)
+}
@@ -10,7 +10,8 @@ import (
 	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/margaret/multilog"
 	refs "go.mindeco.de/ssb-refs"
-	"go.mindeco.de/ssb-refs/tfk"
+
+	"go.cryptoscope.co/ssb/internal/storedrefs"
 )
 
 type Publisher interface {
@@ -72,6 +73,9 @@ type Status struct {
 	Blobs    []BlobWant
 	Root     margaret.BaseSeq
 	Indicies IndexStates
+
+	// Forked are the feeds that are quarantined because they forked
+	Forked []*refs.FeedRef
 }
 
 type IndexStates []IndexState
@@ -109,12 +113,10 @@ func FeedsWithSequnce(feedIndex multilog.MultiLog) (luigi.Source, error) {
 	var feedsWithSeqs []interface{}
 
 	for i, author := range storedFeeds {
-		var sr tfk.Feed
-		err := sr.UnmarshalBinary([]byte(author))
+		authorRef, err := storedrefs.ParseFeed([]byte(author))
 		if err != nil {
 			return nil, fmt.Errorf("feedSrc(%d): invalid storage ref: %w", i, err)
 		}
-		authorRef := sr.Feed()
 
 		subLog, err := feedIndex.Get(author)
 		if err != nil {
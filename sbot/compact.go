@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// the folders of the receive log while it is compacted
+const (
+	compactedLogName = "compacted"
+	droppedLogName   = "log.dropped"
+)
+
+// keptIndexes are the folders below repo.PrefixIndex that can't be rebuilt from the receive log
+var keptIndexes = []string{
+	filepath.Join("groups", "keys"),
+}
+
+// CompactReceiveLog rewrites the receive log of the repo at path without the nulled messages,
+// like the ones that were dropped by the replication horizon or NullFeed, and returns how many were left out.
+//
+// The indexes refer to the messages by their position in the receive log, so all of them are dropped
+// (sublogs, the sequence resolver and the badger indexes) and rebuilt the next time the repo is opened, see RebuildIndicies.
+// The bot must not be running while the log is compacted.
+func CompactReceiveLog(path string) (int, error) {
+	r := repo.New(path)
+
+	from, err := repo.OpenLog(r)
+	if err != nil {
+		return 0, fmt.Errorf("compact: failed to open receive log: %w", err)
+	}
+
+	// left over from an interrupted run
+	toPath := r.GetPath("logs", compactedLogName)
+	if err := os.RemoveAll(toPath); err != nil {
+		from.Close()
+		return 0, fmt.Errorf("compact: failed to remove old copy: %w", err)
+	}
+	to, err := repo.OpenLog(r, compactedLogName)
+	if err != nil {
+		from.Close()
+		return 0, fmt.Errorf("compact: failed to open new receive log: %w", err)
+	}
+
+	nulled, err := copyNonNulled(from, to)
+	if cerr := to.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("compact: failed to close new receive log: %w", cerr)
+	}
+	if cerr := from.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("compact: failed to close receive log: %w", cerr)
+	}
+	if err != nil || nulled == 0 {
+		os.RemoveAll(toPath)
+		return 0, err
+	}
+
+	// the indexes go first, if the swap is interrupted they are rebuilt from whichever log is there
+	if err := dropDerivedIndexes(r); err != nil {
+		return 0, err
+	}
+
+	logPath := r.GetPath("log")
+	droppedPath := r.GetPath(droppedLogName)
+	if err := os.Rename(logPath, droppedPath); err != nil {
+		return 0, fmt.Errorf("compact: failed to move receive log: %w", err)
+	}
+	if err := os.Rename(toPath, logPath); err != nil {
+		return 0, fmt.Errorf("compact: failed to move new receive log in place (the old one is at %s): %w", droppedPath, err)
+	}
+	if err := os.RemoveAll(droppedPath); err != nil {
+		return 0, fmt.Errorf("compact: failed to remove old receive log: %w", err)
+	}
+	return nulled, nil
+}
+
+// copyNonNulled appends the messages of from that aren't nulled to to and returns how many were.
+// The messages are copied as they are stored, with their received timestamp.
+func copyNonNulled(from, to margaret.Log) (int, error) {
+	src, err := from.Query()
+	if err != nil {
+		return 0, fmt.Errorf("compact: failed to query receive log: %w", err)
+	}
+
+	var nulled int
+	ctx := context.TODO()
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				break
+			}
+			return 0, fmt.Errorf("compact: failed to read receive log: %w", err)
+		}
+
+		if errv, ok := v.(error); ok {
+			if margaret.IsErrNulled(errv) {
+				nulled++
+				continue
+			}
+			return 0, fmt.Errorf("compact: failed to read message: %w", errv)
+		}
+
+		if _, err := to.Append(v); err != nil {
+			return 0, fmt.Errorf("compact: failed to copy message: %w", err)
+		}
+	}
+	return nulled, nil
+}
+
+// dropDerivedIndexes removes all the sublogs and indexes, except the keptIndexes
+func dropDerivedIndexes(r repo.Interface) error {
+	if err := os.RemoveAll(r.GetPath(repo.PrefixMultiLog)); err != nil {
+		return fmt.Errorf("compact: failed to remove sublogs: %w", err)
+	}
+	return removeAllExcept(r.GetPath(repo.PrefixIndex), keptIndexes)
+}
+
+// removeAllExcept removes everything in dir but the keep paths, which are relative to dir
+func removeAllExcept(dir string, keep []string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("compact: failed to list %s: %w", dir, err)
+	}
+
+	for _, e := range entries {
+		var (
+			kept  bool
+			inner []string // what is kept below e
+		)
+		for _, k := range keep {
+			parts := strings.SplitN(k, string(filepath.Separator), 2)
+			if parts[0] != e.Name() {
+				continue
+			}
+			if len(parts) == 1 {
+				kept = true
+				break
+			}
+			inner = append(inner, parts[1])
+		}
+		if kept {
+			continue
+		}
+
+		pth := filepath.Join(dir, e.Name())
+		if len(inner) > 0 {
+			err = removeAllExcept(pth, inner)
+		} else {
+			err = os.RemoveAll(pth)
+		}
+		if err != nil {
+			return fmt.Errorf("compact: failed to remove %s: %w", pth, err)
+		}
+	}
+	return nil
+}
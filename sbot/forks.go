@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"fmt"
+
+	refs "go.mindeco.de/ssb-refs"
+)
+
+// ClearForked lifts the quarantine of a forked feed.
+// With drop, the stored messages of the feed are nulled first and it is fetched again from the start.
+// Otherwise replication continues from the stored messages,
+// which quarantines the feed again if peers still send the other branch.
+func (s *Sbot) ClearForked(feed *refs.FeedRef, drop bool) error {
+	if s.Forks == nil {
+		return fmt.Errorf("sbot: this bot doesn't keep track of forks")
+	}
+	if !s.Forks.IsForked(feed) {
+		return fmt.Errorf("sbot: %s is not marked as forked", feed.Ref())
+	}
+
+	if drop {
+		if err := s.NullFeed(feed); err != nil {
+			return fmt.Errorf("sbot: failed to drop forked feed %s: %w", feed.ShortRef(), err)
+		}
+	}
+	return s.Forks.Clear(feed)
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/message/legacy"
+)
+
+func TestClearForked(t *testing.T) {
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+
+	bot, err := New(
+		WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		WithRepoPath(tRepoPath),
+		DisableNetworkNode(),
+	)
+	r.NoError(err)
+
+	kp, err := ssb.NewKeyPair(nil)
+	r.NoError(err)
+	sign := func(seq int64, prev *refs.MessageRef, text string) (*refs.MessageRef, []byte) {
+		ref, raw, err := legacy.LegacyMessage{
+			Previous:  prev,
+			Author:    kp.Id.Ref(),
+			Sequence:  margaret.BaseSeq(seq),
+			Timestamp: seq,
+			Hash:      "sha256",
+			Content:   map[string]interface{}{"type": "test", "text": text},
+		}.Sign(kp.Pair.Secret, nil)
+		r.NoError(err)
+		return ref, raw
+	}
+	ref1, msg1 := sign(1, nil, "one")
+	_, msg2 := sign(2, ref1, "two")
+	forkRef, fork2 := sign(2, ref1, "other two")
+
+	verify := func(msgs ...[]byte) error {
+		snk, err := bot.verifySinks.GetSink(kp.Id)
+		r.NoError(err)
+		for _, msg := range msgs {
+			if err := snk.Verify(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	forkAgain := func() {
+		r.NoError(verify(msg1, msg2))
+		var forked message.ErrForked
+		r.True(errors.As(verify(fork2), &forked))
+		r.True(bot.Forks.IsForked(kp.Id))
+		bot.WaitUntilIndexesAreSynced()
+	}
+	forkAgain()
+
+	// without dropping, the feed continues from the stored branch and forks again
+	r.NoError(bot.ClearForked(kp.Id, false))
+	r.False(bot.Forks.IsForked(kp.Id))
+	r.Error(verify(fork2))
+	r.True(bot.Forks.IsForked(kp.Id))
+
+	// dropping it lets the other branch be fetched from the start
+	r.NoError(bot.ClearForked(kp.Id, true))
+	r.False(bot.Forks.IsForked(kp.Id))
+	r.Error(bot.ClearForked(kp.Id, true), "not forked anymore")
+
+	r.NoError(verify(msg1, fork2))
+	r.False(bot.Forks.IsForked(kp.Id))
+	bot.WaitUntilIndexesAreSynced()
+
+	userLog, err := bot.Users.Get(storedrefs.Feed(kp.Id))
+	r.NoError(err)
+	rxSeq, err := userLog.Get(margaret.BaseSeq(1))
+	r.NoError(err)
+	v, err := bot.ReceiveLog.Get(rxSeq.(margaret.Seq))
+	r.NoError(err)
+	r.True(v.(refs.Message).Key().Equal(forkRef), "stored the other branch")
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+}
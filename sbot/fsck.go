@@ -15,9 +15,9 @@ import (
 	"go.cryptoscope.co/margaret"
 	"go.cryptoscope.co/margaret/multilog"
 	refs "go.mindeco.de/ssb-refs"
-	"go.mindeco.de/ssb-refs/tfk"
 
 	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
 	"go.cryptoscope.co/ssb/multilogs"
 )
 
@@ -124,12 +124,17 @@ func (s *Sbot) FSCK(opts ...FSCKOption) error {
 		opt.mode = FSCKModeLength
 	}
 
+	// partial feeds have gaps on purpose
+	isPartial := func(ref *refs.FeedRef) bool {
+		return s.PartialFeeds != nil && s.PartialFeeds.IsPartial(ref)
+	}
+
 	switch opt.mode {
 	case FSCKModeLength:
-		return lengthFSCK(opt.feedsIdx, s.ReceiveLog)
+		return lengthFSCK(opt.feedsIdx, s.ReceiveLog, isPartial)
 
 	case FSCKModeSequences:
-		return sequenceFSCK(s.ReceiveLog, opt.progressFn)
+		return sequenceFSCK(s.ReceiveLog, opt.progressFn, isPartial)
 
 	default:
 		return errors.New("sbot: unknown fsck mode")
@@ -138,19 +143,22 @@ func (s *Sbot) FSCK(opts ...FSCKOption) error {
 
 // lengthFSCK just checks the length of each stored feed.
 // It expects a multilog as first parameter where each sublog is one feed
-// and each entry maps to another entry in the receiveLog
-func lengthFSCK(authorMlog multilog.MultiLog, receiveLog margaret.Log) error {
+// and each entry maps to another entry in the receiveLog.
+// Feeds for which isPartial returns true are skipped.
+func lengthFSCK(authorMlog multilog.MultiLog, receiveLog margaret.Log, isPartial func(*refs.FeedRef) bool) error {
 	feeds, err := authorMlog.List()
 	if err != nil {
 		return err
 	}
 
 	for _, author := range feeds {
-		var sr tfk.Feed
-		err := sr.UnmarshalBinary([]byte(author))
+		authorRef, err := storedrefs.ParseFeed([]byte(author))
 		if err != nil {
 			return err
 		}
+		if isPartial(authorRef) {
+			continue
+		}
 
 		subLog, err := authorMlog.Get(author)
 		if err != nil {
@@ -182,7 +190,7 @@ func lengthFSCK(authorMlog multilog.MultiLog, receiveLog margaret.Log) error {
 		// margaret indexes are 0-based, therefore +1
 		if msg.Seq() != currentSeqFromIndex.Seq()+1 {
 			return ssb.ErrWrongSequence{
-				Ref:     sr.Feed(),
+				Ref:     authorRef,
 				Stored:  currentSeqFromIndex,
 				Logical: msg,
 			}
@@ -213,8 +221,9 @@ func (p *processedCounter) N() int64 {
 func (p *processedCounter) Err() error { return nil }
 
 // sequenceFSCK goes through every message in the receiveLog
-// and checks tha the sequence of a feed is correctly increasing by one each message
-func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
+// and checks tha the sequence of a feed is correctly increasing by one each message.
+// Feeds for which isPartial returns true are skipped.
+func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc, isPartial func(*refs.FeedRef) bool) error {
 	ctx := context.Background()
 
 	// the last sequence number we saw of that author
@@ -276,6 +285,11 @@ func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
 			return fmt.Errorf("fsck/value: unexpected message type: %T (wanted %T)", val, msg)
 		}
 
+		if isPartial(msg.Author()) {
+			pc.Incr()
+			continue
+		}
+
 		msgSeq := msg.Seq()
 		authorRef := msg.Author().Ref()
 
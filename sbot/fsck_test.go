@@ -13,8 +13,11 @@ import (
 	"go.cryptoscope.co/luigi"
 	"go.cryptoscope.co/margaret"
 	refs "go.mindeco.de/ssb-refs"
+	"golang.org/x/crypto/ed25519"
 
+	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/message/bendybutt"
 	"go.cryptoscope.co/ssb/repo"
 )
 
@@ -56,6 +59,7 @@ func TestFSCK(t *testing.T) {
 	t.Run("correct", testFSCKcorrect)
 	t.Run("double", testFSCKdouble)
 	t.Run("multipleFeeds", testFSCKmultipleFeeds)
+	t.Run("bendyButt", testFSCKbendyButt)
 	// t.Run("rerpo", testFSCKrerpo)
 }
 
@@ -232,6 +236,57 @@ func testFSCKmultipleFeeds(t *testing.T) {
 	r.NoError(theBot.Close())
 }
 
+func testFSCKbendyButt(t *testing.T) {
+	r := require.New(t)
+	ctx := context.TODO()
+	theBot, _ := makeTestBot(t)
+
+	_, err := theBot.PublishLog.Publish(map[string]interface{}{"type": "test"})
+	r.NoError(err)
+
+	// a metafeed with two messages, the tfk package can't decode it's stored ref
+	metaPub, metaKey, err := ed25519.GenerateKey(rand.Reader)
+	r.NoError(err)
+	metaRef := &refs.FeedRef{ID: metaPub, Algo: bendybutt.RefAlgoFeedBendyButt}
+	enc := bendybutt.NewEncoder(metaKey)
+	content := map[string]interface{}{
+		"type":    "test",
+		"subfeed": theBot.KeyPair.Id.Ref(),
+	}
+	var prev *refs.MessageRef
+	for seq := int64(1); seq <= 2; seq++ {
+		msg, err := enc.Encode(seq, prev, content, theBot.KeyPair.Pair.Secret)
+		r.NoError(err)
+		_, err = theBot.ReceiveLog.Append(msg)
+		r.NoError(err)
+		prev = msg.Key()
+	}
+	theBot.WaitUntilIndexesAreSynced()
+
+	r.NoError(theBot.FSCK(FSCKWithMode(FSCKModeLength)))
+
+	src, err := ssb.FeedsWithSequnce(theBot.Users)
+	r.NoError(err)
+	lengths := make(map[string]int64)
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				break
+			}
+			r.NoError(err)
+		}
+		upto := v.(ssb.ReplicateUpToResponse)
+		lengths[upto.ID.Ref()] = upto.Sequence
+	}
+	r.EqualValues(1, lengths[theBot.KeyPair.Id.Ref()])
+	r.EqualValues(2, lengths[metaRef.Ref()])
+
+	// cleanup
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+}
+
 // to use this, put the repo in
 func testFSCKrepro(t *testing.T) {
 	r := require.New(t)
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"go.cryptoscope.co/luigi"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/internal/statematrix"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/plugins/gossip"
+)
+
+// horizonInterval is how often the replication horizon is enforced
+const horizonInterval = time.Hour
+
+func (s *Sbot) horizonEnabled() bool {
+	return s.horizonKeep > 0 || s.horizonKeepFor > 0
+}
+
+// serveHorizon enforces the replication horizon until ctx is done
+func (s *Sbot) serveHorizon(ctx context.Context) {
+	tick := time.NewTicker(horizonInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+
+		if err := s.EnforceHorizon(); err != nil {
+			level.Warn(s.info).Log("event", "replication horizon", "err", err)
+		}
+	}
+}
+
+// EnforceHorizon drops the older messages of the feeds that are beyond the replication horizon, see WithReplicationHorizon.
+// Feeds that came closer get their horizon lifted, so that they are fetched completely again.
+// The dropped messages are nulled, CompactReceiveLog removes them from the receive log.
+func (s *Sbot) EnforceHorizon() error {
+	if !s.horizonEnabled() {
+		return nil
+	}
+
+	lister := s.Replicator.Lister()
+	dist, ok := lister.(gossip.FeedDistancer)
+	if !ok {
+		return fmt.Errorf("horizon: the replicator doesn't know how far away feeds are")
+	}
+
+	wants, err := lister.ReplicationList().List()
+	if err != nil {
+		return fmt.Errorf("horizon: failed to list wanted feeds: %w", err)
+	}
+
+	var cutoff time.Time
+	if s.horizonKeepFor > 0 {
+		cutoff = time.Now().Add(-s.horizonKeepFor)
+	}
+
+	var dropped int
+	for _, ref := range wants {
+		// feeds that were added by hand are kept, like the close ones
+		hops, known := dist.FeedDistance(ref)
+		if !known || hops < int(s.horizonHops) {
+			if s.PartialFeeds.Horizon(ref) > 0 {
+				if err := s.liftHorizon(ref); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		n, err := s.truncateFeed(ref, cutoff)
+		if err != nil {
+			return err
+		}
+		dropped += n
+	}
+
+	if dropped > 0 {
+		level.Info(s.info).Log("event", "replication horizon", "dropped", dropped)
+	}
+	return nil
+}
+
+// truncateFeed nulls the messages of ref beyond the horizon and returns how many there were
+func (s *Sbot) truncateFeed(ref *refs.FeedRef, cutoff time.Time) (int, error) {
+	userLog, err := s.Users.Get(storedrefs.Feed(ref))
+	if err != nil {
+		return 0, fmt.Errorf("horizon: failed to open sublog for %s: %w", ref.ShortRef(), err)
+	}
+
+	src, err := userLog.Query()
+	if err != nil {
+		return 0, fmt.Errorf("horizon: failed to query sublog for %s: %w", ref.ShortRef(), err)
+	}
+
+	type storedMsg struct {
+		rxSeq margaret.Seq
+		seq   int64
+	}
+	var (
+		stored []storedMsg
+		latest int64
+		tooOld int64 // newest message that was published before the cutoff
+	)
+	ctx := context.TODO()
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				break
+			}
+			return 0, err
+		}
+		rxSeq, ok := v.(margaret.Seq)
+		if !ok {
+			return 0, fmt.Errorf("horizon: not a sequence from userlog query: %T", v)
+		}
+
+		mv, err := s.ReceiveLog.Get(rxSeq)
+		if err != nil {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return 0, fmt.Errorf("horizon: failed to get message %d: %w", rxSeq.Seq(), err)
+		}
+		msg, ok := mv.(refs.Message)
+		if !ok {
+			return 0, fmt.Errorf("horizon: wrong message type: %T", mv)
+		}
+
+		seq := msg.Seq()
+		stored = append(stored, storedMsg{rxSeq: rxSeq, seq: seq})
+		if seq > latest {
+			latest = seq
+		}
+		if !cutoff.IsZero() && msg.Claimed().Before(cutoff) && seq > tooOld {
+			tooOld = seq
+		}
+	}
+
+	horizon := tooOld
+	if s.horizonKeep > 0 && latest-s.horizonKeep > horizon {
+		horizon = latest - s.horizonKeep
+	}
+	if horizon >= latest {
+		horizon = latest - 1
+	}
+	if horizon <= 0 {
+		return 0, nil
+	}
+
+	// the horizon is recorded first, if the nulling is interrupted it is picked up by the next run
+	if !s.PartialFeeds.IsPartial(ref) {
+		if err := s.PartialFeeds.Add(ref, 1, latest); err != nil {
+			return 0, fmt.Errorf("horizon: failed to record %s: %w", ref.ShortRef(), err)
+		}
+	}
+	horizon, err = s.PartialFeeds.Truncate(ref, horizon)
+	if err != nil {
+		return 0, fmt.Errorf("horizon: %w", err)
+	}
+
+	var dropped int
+	for _, msg := range stored {
+		if msg.seq > horizon {
+			continue
+		}
+		if err := s.ReceiveLog.Null(msg.rxSeq); err != nil {
+			return dropped, fmt.Errorf("horizon: failed to null message %d of %s: %w", msg.seq, ref.ShortRef(), err)
+		}
+		dropped++
+	}
+	return dropped, nil
+}
+
+// liftHorizon makes sure the dropped messages of ref are fetched again
+func (s *Sbot) liftHorizon(ref *refs.FeedRef) error {
+	if err := s.PartialFeeds.Lift(ref); err != nil {
+		return fmt.Errorf("horizon: failed to lift %s: %w", ref.ShortRef(), err)
+	}
+
+	// legacy gossip continues from the open verify sink and EBT from the note
+	s.verifySinks.Reset(ref)
+
+	end, _ := s.PartialFeeds.Prefix(ref)
+	err := s.ebtState.Fill(s.KeyPair.Id, []statematrix.ObservedFeed{{
+		Feed: ref,
+		Note: ssb.Note{
+			Seq:       end,
+			Receive:   true,
+			Replicate: true,
+		},
+	}})
+	if err != nil {
+		return fmt.Errorf("horizon: failed to update ebt state of %s: %w", ref.ShortRef(), err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+	"golang.org/x/sync/errgroup"
+
+	"go.cryptoscope.co/ssb/feedranges"
+	"go.cryptoscope.co/ssb/internal/leakcheck"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestHorizonTruncate(t *testing.T) {
+	defer leakcheck.Check(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	botgroup, ctx := errgroup.WithContext(ctx)
+	logger := testutils.NewRelativeTimeLogger(nil)
+	bs := newBotServer(ctx, logger)
+
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+	tRepo := repo.New(tRepoPath)
+
+	kpArny, err := repo.NewKeyPair(tRepo, "arny", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	bot, err := New(
+		WithInfo(kitlog.With(logger, "bot", "main")),
+		WithRepoPath(tRepoPath),
+		WithReplicationHorizon(2, 5, 0),
+		WithListenAddr(":0"),
+	)
+	r.NoError(err)
+	botgroup.Go(bs.Serve(bot))
+
+	for i := 0; i < 20; i++ {
+		_, err := bot.PublishAs("arny", map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+	}
+	bot.WaitUntilIndexesAreSynced()
+
+	dropped, err := bot.truncateFeed(kpArny.Id, time.Time{})
+	r.NoError(err)
+	r.Equal(15, dropped)
+	r.EqualValues(15, bot.PartialFeeds.Horizon(kpArny.Id))
+	r.Equal([]feedranges.Range{{From: 16, To: 20}}, bot.PartialFeeds.Ranges(kpArny.Id))
+
+	// the older messages are nulled, the newer ones are still there
+	userLog, err := bot.Users.Get(storedrefs.Feed(kpArny.Id))
+	r.NoError(err)
+	for i := int64(0); i < 20; i++ {
+		rxSeq, err := userLog.Get(margaret.BaseSeq(i))
+		r.NoError(err)
+		_, err = bot.ReceiveLog.Get(rxSeq.(margaret.Seq))
+		if i < 15 {
+			r.True(margaret.IsErrNulled(err), "message %d: %v", i+1, err)
+		} else {
+			r.NoError(err, "message %d", i+1)
+		}
+	}
+
+	// nothing more to do
+	dropped, err = bot.truncateFeed(kpArny.Id, time.Time{})
+	r.NoError(err)
+	r.Equal(0, dropped)
+
+	// the feed continues after the horizon
+	r.NoError(bot.FSCK(FSCKWithMode(FSCKModeSequences)))
+	snk, err := bot.verifySinks.GetSink(kpArny.Id)
+	r.NoError(err)
+	r.EqualValues(20, snk.Seq())
+
+	note, err := bot.CurrentSequence(kpArny.Id)
+	r.NoError(err)
+	r.EqualValues(20, note.Seq)
+
+	bot.Shutdown()
+	cancel()
+	r.NoError(bot.Close())
+	r.NoError(botgroup.Wait())
+}
+
+func TestHorizonCompact(t *testing.T) {
+	defer leakcheck.Check(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	botgroup, ctx := errgroup.WithContext(ctx)
+	logger := testutils.NewRelativeTimeLogger(nil)
+	bs := newBotServer(ctx, logger)
+
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+	tRepo := repo.New(tRepoPath)
+
+	kpArny, err := repo.NewKeyPair(tRepo, "arny", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	openBot := func(name string) *Sbot {
+		bot, err := New(
+			WithInfo(kitlog.With(logger, "bot", name)),
+			WithRepoPath(tRepoPath),
+			WithReplicationHorizon(2, 5, 0),
+			WithListenAddr(":0"),
+		)
+		r.NoError(err)
+		botgroup.Go(bs.Serve(bot))
+		return bot
+	}
+
+	bot := openBot("before")
+	for i := 0; i < 20; i++ {
+		_, err := bot.PublishAs("arny", map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+	}
+	bot.WaitUntilIndexesAreSynced()
+
+	dropped, err := bot.truncateFeed(kpArny.Id, time.Time{})
+	r.NoError(err)
+	r.Equal(15, dropped)
+
+	sv, err := bot.ReceiveLog.Seq().Value()
+	r.NoError(err)
+	seqBefore := sv.(margaret.Seq).Seq()
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+
+	dataPath := filepath.Join(tRepoPath, "log", "data")
+	before, err := os.Stat(dataPath)
+	r.NoError(err)
+
+	compacted, err := CompactReceiveLog(tRepoPath)
+	r.NoError(err)
+	r.Equal(15, compacted)
+
+	after, err := os.Stat(dataPath)
+	r.NoError(err)
+	r.True(after.Size() < before.Size(), "receive log didn't shrink: %d -> %d", before.Size(), after.Size())
+
+	// nothing left to do
+	compacted, err = CompactReceiveLog(tRepoPath)
+	r.NoError(err)
+	r.Equal(0, compacted)
+
+	// the indexes are rebuilt from the compacted log
+	bot = openBot("after")
+	bot.WaitUntilIndexesAreSynced()
+
+	sv, err = bot.ReceiveLog.Seq().Value()
+	r.NoError(err)
+	r.EqualValues(seqBefore-15, sv.(margaret.Seq).Seq())
+
+	userLog, err := bot.Users.Get(storedrefs.Feed(kpArny.Id))
+	r.NoError(err)
+	for i := int64(0); i < 5; i++ {
+		rxSeq, err := userLog.Get(margaret.BaseSeq(i))
+		r.NoError(err)
+		mv, err := bot.ReceiveLog.Get(rxSeq.(margaret.Seq))
+		r.NoError(err)
+		r.EqualValues(16+i, mv.(refs.Message).Seq())
+	}
+	_, err = userLog.Get(margaret.BaseSeq(5))
+	r.Error(err)
+
+	// the feed still continues after the horizon
+	r.EqualValues(15, bot.PartialFeeds.Horizon(kpArny.Id))
+	r.NoError(bot.FSCK(FSCKWithMode(FSCKModeSequences)))
+	ref, err := bot.PublishAs("arny", map[string]interface{}{"type": "test", "i": 20})
+	r.NoError(err)
+	bot.WaitUntilIndexesAreSynced()
+	msg, err := bot.Get(*ref)
+	r.NoError(err)
+	r.EqualValues(21, msg.Seq())
+
+	bot.Shutdown()
+	cancel()
+	r.NoError(bot.Close())
+	r.NoError(botgroup.Wait())
+}
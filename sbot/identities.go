@@ -4,37 +4,114 @@ package sbot
 
 import (
 	"fmt"
+	"strings"
 
+	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/message"
-	"go.cryptoscope.co/ssb/multilogs"
 	"go.cryptoscope.co/ssb/repo"
 	refs "go.mindeco.de/ssb-refs"
 )
 
-func (sbot *Sbot) PublishAs(nick string, val interface{}) (*refs.MessageRef, error) {
-	r := repo.New(sbot.repoPath)
+// publishOptions returns the options of the publish logs of the bot
+func (sbot *Sbot) publishOptions() []message.PublishOption {
+	var pubopts = []message.PublishOption{
+		message.UseNowTimestamps(true),
+	}
+	if sbot.signHMACsecret != nil { // all feeds use the same settings right now
+		pubopts = append(pubopts, message.SetHMACKey(sbot.signHMACsecret))
+	}
+	return pubopts
+}
+
+// CreateFeed makes a new keypair with the name and the feed format algo (classic or gabbygrove) and stores it in the repo.
+// The feed can then be published to with PublishAs. Names starting with index- are reserved for the index feeds.
+func (sbot *Sbot) CreateFeed(nick, algo string) (*refs.FeedRef, error) {
+	switch {
+	case nick == "", nick == "-", nick == ".", nick == "..", strings.ContainsAny(nick, `/\`):
+		return nil, fmt.Errorf("createFeed: invalid name %q", nick)
+	case strings.HasPrefix(nick, indexKeyPrefix):
+		return nil, fmt.Errorf("createFeed: name %q is reserved for index feeds", nick)
+	}
 
-	uf, ok := sbot.GetMultiLog(multilogs.IndexNameFeeds)
-	if !ok {
-		return nil, fmt.Errorf("requried idx not present: userFeeds")
+	kp, err := repo.NewKeyPair(repo.New(sbot.repoPath), nick, algo)
+	if err != nil {
+		return nil, fmt.Errorf("createFeed: %w", err)
+	}
+	return kp.Id, nil
+}
+
+// OwnedFeeds returns the feeds whose keys are stored in the repo, by name.
+// Index feeds are left out, they are internal to the bot.
+func (sbot *Sbot) OwnedFeeds() (map[string]*refs.FeedRef, error) {
+	kps, err := repo.AllKeyPairs(repo.New(sbot.repoPath))
+	if err != nil {
+		return nil, fmt.Errorf("ownedFeeds: failed to load keypairs: %w", err)
 	}
 
-	kp, err := repo.LoadKeyPair(r, nick)
+	feeds := make(map[string]*refs.FeedRef, len(kps))
+	for name, kp := range kps {
+		if strings.HasPrefix(name, indexKeyPrefix) {
+			continue
+		}
+		feeds[name] = kp.Id
+	}
+	return feeds, nil
+}
+
+// PublishAs publishes val on the owned feed with the name, see CreateFeed.
+// The publisher of each feed is opened on first use and kept.
+func (sbot *Sbot) PublishAs(nick string, val interface{}) (*refs.MessageRef, error) {
+	pl, err := sbot.ownedPublisher(nick)
 	if err != nil {
 		return nil, err
 	}
+	return pl.Publish(val)
+}
 
-	var pubopts = []message.PublishOption{
-		message.UseNowTimestamps(true),
+type ownedPublisher struct {
+	id  *refs.FeedRef
+	pub ssb.Publisher
+}
+
+func (sbot *Sbot) ownedPublisher(nick string) (ssb.Publisher, error) {
+	// the indexing publisher has it's own publish logs for these, a second one would fork the feed
+	if strings.HasPrefix(nick, indexKeyPrefix) {
+		return nil, fmt.Errorf("publishAs: %q is an index feed", nick)
 	}
-	if sbot.signHMACsecret != nil { // all feeds use the same settings right now
-		pubopts = append(pubopts, message.SetHMACKey(sbot.signHMACsecret))
+
+	sbot.ownedMu.Lock()
+	defer sbot.ownedMu.Unlock()
+
+	if owned, has := sbot.ownedPubs[nick]; has {
+		return owned.pub, nil
 	}
 
-	pl, err := message.OpenPublishLog(sbot.ReceiveLog, uf, kp, pubopts...)
+	kp, err := repo.LoadKeyPair(repo.New(sbot.repoPath), nick)
+	if err != nil {
+		return nil, err
+	}
+
+	// the publisher finds the current end of the feed in its sublog of the receive log on every append
+	pl, err := message.OpenPublishLog(sbot.ReceiveLog, sbot.Users, kp, sbot.publishOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("publishAs: failed to create publish log: %w", err)
 	}
 
-	return pl.Publish(val)
+	if sbot.ownedPubs == nil {
+		sbot.ownedPubs = make(map[string]ownedPublisher)
+	}
+	sbot.ownedPubs[nick] = ownedPublisher{id: kp.Id, pub: pl}
+	return pl, nil
+}
+
+// forgetOwnedPublisher drops the kept publisher of feed, its sublog is gone after NullFeed
+func (sbot *Sbot) forgetOwnedPublisher(feed *refs.FeedRef) {
+	sbot.ownedMu.Lock()
+	defer sbot.ownedMu.Unlock()
+
+	for nick, owned := range sbot.ownedPubs {
+		if owned.id.Equal(feed) {
+			delete(sbot.ownedPubs, nick)
+		}
+	}
 }
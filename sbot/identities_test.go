@@ -161,3 +161,67 @@ func XTestMultipleIdentities(t *testing.T) {
 	mainbot.Shutdown()
 	r.NoError(mainbot.Close())
 }
+
+func TestOwnedFeeds(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+
+	bot, err := New(
+		WithInfo(log.NewNopLogger()),
+		WithRepoPath(tRepoPath),
+		WithIndexFeeds("contact"),
+		DisableNetworkNode(),
+	)
+	r.NoError(err)
+
+	classic, err := bot.CreateFeed("bridge", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	gabby, err := bot.CreateFeed("gabby", refs.RefAlgoFeedGabby)
+	r.NoError(err)
+	r.Equal(refs.RefAlgoFeedGabby, gabby.Algo)
+
+	_, err = bot.CreateFeed("bridge", refs.RefAlgoFeedSSB1)
+	r.Error(err, "name taken")
+	for _, invalid := range []string{"", "-", "..", "a/b", "index-post"} {
+		_, err = bot.CreateFeed(invalid, refs.RefAlgoFeedSSB1)
+		r.Error(err, "%q", invalid)
+	}
+
+	owned, err := bot.OwnedFeeds()
+	r.NoError(err)
+	r.Len(owned, 2)
+	r.True(owned["bridge"].Equal(classic))
+	r.True(owned["gabby"].Equal(gabby))
+
+	for i := 0; i < 3; i++ {
+		for _, name := range []string{"bridge", "gabby"} {
+			ref, err := bot.PublishAs(name, map[string]interface{}{"type": "test", "i": i})
+			r.NoError(err)
+			msg, err := bot.Get(*ref)
+			r.NoError(err)
+			r.True(msg.Author().Equal(owned[name]))
+			r.EqualValues(i+1, msg.Seq())
+		}
+	}
+
+	_, err = bot.PublishAs("unknown", map[string]interface{}{"type": "test"})
+	r.Error(err)
+
+	// the index feeds are only written by the bot itself
+	_, err = bot.PublishAs(indexKeyName("contact"), map[string]interface{}{"type": "test"})
+	r.Error(err)
+
+	// after nulling, the feed starts over
+	r.NoError(bot.NullFeed(classic))
+	ref, err := bot.PublishAs("bridge", map[string]interface{}{"type": "test"})
+	r.NoError(err)
+	msg, err := bot.Get(*ref)
+	r.NoError(err)
+	r.EqualValues(1, msg.Seq())
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+
+	"go.cryptoscope.co/luigi"
+)
+
+// maxIndexBatch is the most messages an index gets at once
+const maxIndexBatch = 512
+
+// batchPourer is implemented by the sinks that process several messages at once, like repo.BatchSinkIndex
+type batchPourer interface {
+	PourBatch(ctx context.Context, vals []interface{}) error
+}
+
+var _ batchPourer = (*progressSink)(nil)
+
+// pumpBatched works like luigi.Pump but passes everything that is already available as one batch, if snk supports that.
+// During the initial sync most of the messages come in large batches while live updates still get through right away.
+func pumpBatched(ctx context.Context, snk luigi.Sink, src luigi.Source) error {
+	// the progress sink only passes them on
+	backing := snk
+	if ps, ok := snk.(*progressSink); ok {
+		backing = ps.backing
+	}
+	if _, ok := backing.(batchPourer); !ok {
+		return luigi.Pump(ctx, snk, src)
+	}
+	bs := snk.(batchPourer)
+
+	// also stops the reader if the sink fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		vals   = make(chan interface{}, maxIndexBatch)
+		srcErr = make(chan error, 1)
+	)
+	go func() {
+		defer close(vals)
+		for {
+			v, err := src.Next(ctx)
+			if err != nil {
+				if luigi.IsEOS(err) {
+					err = nil
+				}
+				srcErr <- err
+				return
+			}
+
+			select {
+			case vals <- v:
+			case <-ctx.Done():
+				srcErr <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	batch := make([]interface{}, 0, maxIndexBatch)
+	for v := range vals {
+		batch = append(batch[:0], v)
+	collect:
+		for len(batch) < maxIndexBatch {
+			select {
+			case v, more := <-vals:
+				if !more {
+					break collect
+				}
+				batch = append(batch, v)
+			default:
+				break collect
+			}
+		}
+
+		if err := bs.PourBatch(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return <-srcErr
+}
+
+// PourBatch passes the batch on and counts it for the progress report
+func (ps *progressSink) PourBatch(ctx context.Context, vals []interface{}) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.erred != nil {
+		return ps.erred
+	}
+
+	err := ps.backing.(batchPourer).PourBatch(ctx, vals)
+	if err != nil {
+		ps.erred = err
+		return err
+	}
+
+	ps.n += uint(len(vals))
+	return nil
+}
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/metafeeds"
+	"go.cryptoscope.co/ssb/plugins/partial"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// indexFeed is one of our index feeds, see WithIndexFeeds
+type indexFeed struct {
+	query metafeeds.IndexQuery
+	kp    *ssb.KeyPair
+	pub   ssb.Publisher
+}
+
+// indexingPublisher publishes an index entry for each of our messages with an indexed type
+type indexingPublisher struct {
+	ssb.Publisher
+
+	rxlog margaret.Log
+	info  kitlog.Logger
+
+	mu      sync.Mutex
+	indexes map[string]*indexFeed // by type
+}
+
+// indexKeyPrefix starts the names of the keypairs of index feeds.
+// They are only published to by the indexing publisher, see CreateFeed and PublishAs.
+const indexKeyPrefix = "index-"
+
+// indexKeyName returns the name of the keypair of the index feed for the type
+func indexKeyName(tipe string) string {
+	clean := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, tipe)
+	return indexKeyPrefix + clean
+}
+
+// openIndexFeeds wraps the publish log so that our messages of the types from WithIndexFeeds get index entries
+func (s *Sbot) openIndexFeeds(r repo.Interface, pubopts []message.PublishOption) error {
+	if len(s.indexFeedTypes) == 0 {
+		return nil
+	}
+
+	ip := &indexingPublisher{
+		Publisher: s.PublishLog,
+		rxlog:     s.ReceiveLog,
+		info:      kitlog.With(s.info, "unit", "indexfeeds"),
+		indexes:   make(map[string]*indexFeed),
+	}
+	for _, tipe := range s.indexFeedTypes {
+		name := indexKeyName(tipe)
+		kp, err := repo.LoadKeyPair(r, name)
+		if errors.Is(err, os.ErrNotExist) {
+			kp, err = repo.NewKeyPair(r, name, refs.RefAlgoFeedSSB1)
+		}
+		if err != nil {
+			return fmt.Errorf("index feed %q: failed to get keypair: %w", tipe, err)
+		}
+
+		pub, err := message.OpenPublishLog(s.ReceiveLog, s.Users, kp, pubopts...)
+		if err != nil {
+			return fmt.Errorf("index feed %q: failed to create publish log: %w", tipe, err)
+		}
+		ip.indexes[tipe] = &indexFeed{
+			query: metafeeds.IndexQuery{Author: s.KeyPair.Id, Type: tipe},
+			kp:    kp,
+			pub:   pub,
+		}
+	}
+	s.PublishLog = ip
+	return nil
+}
+
+func (ip *indexingPublisher) Publish(content interface{}) (*refs.MessageRef, error) {
+	seq, err := ip.Append(content)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := ip.get(seq)
+	if err != nil {
+		return nil, fmt.Errorf("publish: failed to get new stored message: %w", err)
+	}
+	return msg.Key(), nil
+}
+
+func (ip *indexingPublisher) Append(val interface{}) (margaret.Seq, error) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	seq, err := ip.Publisher.Append(val)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ip.index(seq); err != nil {
+		level.Warn(ip.info).Log("event", "index feed entry failed", "seq", seq.Seq(), "err", err)
+	}
+	return seq, nil
+}
+
+// index publishes the entry for the message at seq of the receive log, if its type is indexed
+func (ip *indexingPublisher) index(seq margaret.Seq) error {
+	msg, err := ip.get(seq)
+	if err != nil {
+		return err
+	}
+
+	var typed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(msg.ContentBytes(), &typed); err != nil {
+		return nil // private or otherwise untyped
+	}
+	idx, has := ip.indexes[typed.Type]
+	if !has {
+		return nil
+	}
+
+	// announce the index feed before its first entry
+	curr, err := idx.pub.Seq().Value()
+	if err != nil {
+		return fmt.Errorf("failed to get index feed sequence: %w", err)
+	}
+	if curr.(margaret.Seq).Seq() == margaret.SeqEmpty.Seq() {
+		nonce := make([]byte, 32)
+		if _, err := rand.Read(nonce); err != nil {
+			return fmt.Errorf("failed to make nonce: %w", err)
+		}
+		add, err := metafeeds.NewIndexAdd(idx.query.Author, idx.kp.Pair.Secret, idx.kp.Id, idx.query, nonce)
+		if err != nil {
+			return err
+		}
+		if _, err := ip.Publisher.Append(add); err != nil {
+			return fmt.Errorf("failed to announce index feed: %w", err)
+		}
+	}
+
+	if _, err := idx.pub.Append(metafeeds.NewIndexEntry(msg)); err != nil {
+		return fmt.Errorf("failed to publish index entry: %w", err)
+	}
+	return nil
+}
+
+func (ip *indexingPublisher) get(seq margaret.Seq) (refs.Message, error) {
+	v, err := ip.rxlog.Get(seq)
+	if err != nil {
+		return nil, err
+	}
+	msg, ok := v.(refs.Message)
+	if !ok {
+		return nil, fmt.Errorf("unsupported message type %T", v)
+	}
+	return msg, nil
+}
+
+// FetchIndexed stores the messages of author with the type that its index feeds point at, fetched from the connected peer remote.
+// The latest n entries of each index feed are used. The feeds of the messages and of the index feeds become partial.
+// It returns how many of the indexed messages were stored.
+func (s *Sbot) FetchIndexed(ctx context.Context, remote, author *refs.FeedRef, tipe string, n int64) (int, error) {
+	if s.verifySinks == nil {
+		return 0, fmt.Errorf("sbot: this bot doesn't store feeds")
+	}
+
+	edp, ok := s.Network.GetEndpointFor(remote)
+	if !ok {
+		return 0, fmt.Errorf("sbot: not connected to %s", remote.ShortRef())
+	}
+	return partial.FetchIndexed(ctx, edp, s.verifySinks, author, tipe, n)
+}
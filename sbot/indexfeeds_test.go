@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"go.cryptoscope.co/margaret"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/internal/leakcheck"
+	"go.cryptoscope.co/ssb/internal/storedrefs"
+	"go.cryptoscope.co/ssb/internal/testutils"
+	"go.cryptoscope.co/ssb/metafeeds"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+func TestIndexFeedsPublish(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+
+	bot, err := New(
+		WithInfo(kitlog.With(testutils.NewRelativeTimeLogger(nil), "bot", "main")),
+		WithRepoPath(tRepoPath),
+		WithIndexFeeds("contact"),
+		DisableNetworkNode(),
+	)
+	r.NoError(err)
+
+	var contacts []*refs.MessageRef
+	for i := 0; i < 3; i++ {
+		_, err := bot.PublishLog.Publish(map[string]interface{}{"type": "post", "text": "hello"})
+		r.NoError(err)
+		ref, err := bot.PublishLog.Publish(refs.NewContactFollow(bot.KeyPair.Id))
+		r.NoError(err)
+		contacts = append(contacts, ref)
+	}
+	bot.WaitUntilIndexesAreSynced()
+
+	idxKey, err := repo.LoadKeyPair(repo.New(tRepoPath), indexKeyName("contact"))
+	r.NoError(err)
+
+	// the index feed is announced once, before the first entry
+	idxFeeds, err := bot.MetaFeeds.IndexFeeds(bot.KeyPair.Id, bot.KeyPair.Id, "contact")
+	r.NoError(err)
+	r.Len(idxFeeds, 1)
+	r.True(idxFeeds[0].Equal(idxKey.Id))
+
+	checkLogSeq := func(l margaret.Log, seq int) {
+		v, err := l.Seq().Value()
+		r.NoError(err)
+		r.EqualValues(seq, v.(margaret.Seq).Seq())
+	}
+
+	mainLog, err := bot.Users.Get(storedrefs.Feed(bot.KeyPair.Id))
+	r.NoError(err)
+	checkLogSeq(mainLog, 6) // 0-indexed: 6 messages and the announcement
+
+	// the entries point at the contact messages: post, contact, announcement, post, contact, post, contact
+	idxLog, err := bot.Users.Get(storedrefs.Feed(idxKey.Id))
+	r.NoError(err)
+	checkLogSeq(idxLog, 2)
+	for i, wantSeq := range []int64{2, 5, 7} {
+		rxSeq, err := idxLog.Get(margaret.BaseSeq(i))
+		r.NoError(err)
+		v, err := bot.ReceiveLog.Get(rxSeq.(margaret.Seq))
+		r.NoError(err)
+
+		entry, err := metafeeds.ParseIndexEntry(v.(refs.Message).ContentBytes())
+		r.NoError(err)
+		r.True(entry.Indexed.Key.Equal(contacts[i]), "entry %d", i)
+		r.Equal(wantSeq, entry.Indexed.Sequence, "entry %d", i)
+	}
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+}
@@ -175,7 +175,7 @@ func (s *Sbot) serveIndexFrom(name string, snk librarian.SinkIndex, msgs margare
 			}
 		}()
 
-		err = luigi.Pump(s.rootCtx, &ps, src)
+		err = pumpBatched(s.rootCtx, &ps, src)
 		cancel()
 		if errors.Is(err, ssb.ErrShuttingDown) || errors.Is(err, context.Canceled) {
 			return nil
@@ -202,7 +202,7 @@ func (s *Sbot) serveIndexFrom(name string, snk librarian.SinkIndex, msgs margare
 		s.indexStates[name] = "live"
 		s.indexStateMu.Unlock()
 
-		err = luigi.Pump(s.rootCtx, snk, src)
+		err = pumpBatched(s.rootCtx, snk, src)
 		if errors.Is(err, ssb.ErrShuttingDown) || errors.Is(err, context.Canceled) {
 			return nil
 		}
@@ -76,12 +76,64 @@ const manifestBlob manifestHandler = `
       "replies": "source"
 	},
 
+	"query": {
+	  "read": "source"
+	},
+
+	"links": "source",
+
+	"backlinks": {
+	  "read": "source"
+	},
+
+	"search": {
+	  "query": "source"
+	},
+
+	"threads": {
+	  "get": "async",
+	  "recent": "source"
+	},
+
+	"channels": {
+	  "list": "source",
+	  "read": "source"
+	},
+
+	"votes": {
+	  "get": "async",
+	  "stream": "source"
+	},
+
+	"gatherings": {
+	  "list": "source",
+	  "get": "async",
+	  "attend": "async"
+	},
+
     "names": {
         "get": "async",
         "getImageFor": "async",
-        "getSignifier": "async"
+        "getSignifier": "async",
+        "history": "async"
     },
 
+    "about": {
+        "latestValues": "async"
+    },
+
+	"feeds": {
+	  "forked": "async",
+	  "clearForked": "async",
+	  "create": "async",
+	  "publishAs": "async",
+	  "owned": "async"
+	},
+
+	"metafeeds": {
+	  "tree": "async"
+	},
+
 	"friends": {
 	  "isFollowing": "async",
 	  "isBlocking": "async"
@@ -103,6 +155,14 @@ const manifestBlob manifestHandler = `
       "publishTo":"async"
     },
 
+	"rooms": {
+	  "join": "async",
+	  "leave": "async",
+	  "list": "async",
+	  "attendants": "async",
+	  "connect": "async"
+	},
+
 	"blobs": {
 	  "get": "source",
 
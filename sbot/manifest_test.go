@@ -12,3 +12,11 @@ func TestManifest(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestRoomManifest(t *testing.T) {
+	var manifestObj map[string]interface{}
+	err := json.Unmarshal(json.RawMessage(roomManifestBlob), &manifestObj)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -25,6 +25,8 @@ import (
 
 	"go.cryptoscope.co/ssb"
 	"go.cryptoscope.co/ssb/blobstore"
+	"go.cryptoscope.co/ssb/feedranges"
+	"go.cryptoscope.co/ssb/forks"
 	"go.cryptoscope.co/ssb/graph"
 	"go.cryptoscope.co/ssb/indexes"
 	"go.cryptoscope.co/ssb/internal/ctxutils"
@@ -32,28 +34,40 @@ import (
 	"go.cryptoscope.co/ssb/internal/statematrix"
 	"go.cryptoscope.co/ssb/internal/storedrefs"
 	"go.cryptoscope.co/ssb/message"
+	"go.cryptoscope.co/ssb/metafeeds"
 	"go.cryptoscope.co/ssb/multilogs"
 	"go.cryptoscope.co/ssb/network"
 	"go.cryptoscope.co/ssb/plugins/blobs"
 	"go.cryptoscope.co/ssb/plugins/control"
 	"go.cryptoscope.co/ssb/plugins/ebt"
+	feedsplug "go.cryptoscope.co/ssb/plugins/feeds"
 	"go.cryptoscope.co/ssb/plugins/friends"
 	"go.cryptoscope.co/ssb/plugins/get"
 	"go.cryptoscope.co/ssb/plugins/gossip"
 	"go.cryptoscope.co/ssb/plugins/groups"
 	"go.cryptoscope.co/ssb/plugins/legacyinvites"
+	"go.cryptoscope.co/ssb/plugins/links"
+	metafeedsplug "go.cryptoscope.co/ssb/plugins/metafeeds"
 	"go.cryptoscope.co/ssb/plugins/partial"
 	privplug "go.cryptoscope.co/ssb/plugins/private"
 	"go.cryptoscope.co/ssb/plugins/publish"
+	queryplug "go.cryptoscope.co/ssb/plugins/query"
 	"go.cryptoscope.co/ssb/plugins/rawread"
 	"go.cryptoscope.co/ssb/plugins/replicate"
+	"go.cryptoscope.co/ssb/plugins/rooms"
+	searchplug "go.cryptoscope.co/ssb/plugins/search"
 	"go.cryptoscope.co/ssb/plugins/status"
 	"go.cryptoscope.co/ssb/plugins/tangles"
+	"go.cryptoscope.co/ssb/plugins/threads"
 	"go.cryptoscope.co/ssb/plugins/whoami"
+	"go.cryptoscope.co/ssb/plugins2/gatherings"
 	"go.cryptoscope.co/ssb/plugins2/names"
+	"go.cryptoscope.co/ssb/plugins2/votes"
 	"go.cryptoscope.co/ssb/private"
 	"go.cryptoscope.co/ssb/private/keys"
+	"go.cryptoscope.co/ssb/query"
 	"go.cryptoscope.co/ssb/repo"
+	"go.cryptoscope.co/ssb/search"
 	refs "go.mindeco.de/ssb-refs"
 )
 
@@ -175,6 +189,34 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		}
 	}
 
+	// a room only relays connections, it doesn't replicate or index
+	if s.roomServer {
+		return initRoomServer(s, r)
+	}
+
+	// forked feeds are quarantined until they are cleared
+	s.Forks, err = forks.Open(r)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to open fork registry: %w", err)
+	}
+	s.Forks.Notify(func(feed *refs.FeedRef, forked bool) {
+		if forked {
+			level.Warn(log).Log("event", "feed forked", "fr", feed.Ref())
+			s.DontReplicate(feed)
+			return
+		}
+		// the next fetch starts from what is stored (again), not from the sink that saw the fork
+		if s.verifySinks != nil {
+			s.verifySinks.Reset(feed)
+		}
+		s.Replicate(feed)
+	})
+
+	s.PartialFeeds, err = feedranges.Open(r)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to open partial feeds: %w", err)
+	}
+
 	// which feeds to replicate
 	if s.Replicator == nil {
 		s.Replicator, err = s.newGraphReplicator()
@@ -196,12 +238,12 @@ func initSbot(s *Sbot) (*Sbot, error) {
 	s.closers.addCloser(sm)
 	s.ebtState = sm
 
-	// TODO[major/pgroups] fix storage and resumption
-	// s.SeqResolver, err = repo.NewSequenceResolver(r)
-	// if err != nil {
-	// 	return nil, fmt.Errorf("error opening sequence resolver: %w", err)
-	// }
-	// s.closers.addCloser(s.SeqResolver)
+	// timestamp index, updated by the combined index
+	s.SeqResolver, err = repo.NewSequenceResolver(r)
+	if err != nil {
+		return nil, fmt.Errorf("error opening sequence resolver: %w", err)
+	}
+	s.closers.addCloser(s.SeqResolver)
 
 	// default multilogs
 	var mlogs = []struct {
@@ -212,9 +254,16 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		{multilogs.IndexNamePrivates, &s.Private},
 		{"msgTypes", &s.ByType},
 		{"tangles", &s.Tangles},
+		{multilogs.IndexNameLinks, &s.Links},
 	}
+	var freshLinks bool
 	for _, index := range mlogs {
 		mlogPath := r.GetPath(repo.PrefixMultiLog, "combined", index.Name, "fs-bitmaps")
+		if index.Name == multilogs.IndexNameLinks {
+			// added later, older repos need to fill it from the existing messages
+			_, err := os.Stat(mlogPath)
+			freshLinks = os.IsNotExist(err)
+		}
 
 		ml, err := multifs.NewMultiLog(mlogPath)
 		if err != nil {
@@ -230,16 +279,14 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		*index.Mlog = ml
 	}
 	// publish
-	var pubopts = []message.PublishOption{
-		message.UseNowTimestamps(true),
-	}
-	if s.signHMACsecret != nil {
-		pubopts = append(pubopts, message.SetHMACKey(s.signHMACsecret))
-	}
+	pubopts := s.publishOptions()
 	s.PublishLog, err = message.OpenPublishLog(s.ReceiveLog, s.Users, s.KeyPair, pubopts...)
 	if err != nil {
 		return nil, fmt.Errorf("sbot: failed to create publish log: %w", err)
 	}
+	if err := s.openIndexFeeds(r, pubopts); err != nil {
+		return nil, fmt.Errorf("sbot: failed to open index feeds: %w", err)
+	}
 
 	err = MountSimpleIndex("get", indexes.OpenGet)(s)
 	if err != nil {
@@ -280,20 +327,40 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		s.Groups,
 		s.KeyPair.Id,
 		s.ReceiveLog,
-		// s.SeqResolver, // TODO[major/pgroups] fix storage and resumption
+		s.SeqResolver,
 		s.Users,
 		s.Private,
 		s.ByType,
 		s.Tangles,
+		s.Links,
 		groupsHelperMlog,
 		sm,
+		s.PartialFeeds,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("sbot: failed to open combined application index: %w", err)
 	}
+	if freshLinks {
+		if err := combIdx.BackfillLinks(); err != nil {
+			return nil, fmt.Errorf("sbot: failed to start links backfill: %w", err)
+		}
+	}
 	s.serveIndex("combined", combIdx)
+
+	s.QueryPlanner = query.NewPlanner(s.ReceiveLog, s.SeqResolver, combIdx, s.Users, s.ByType, s.Tangles, s.Private, s.Links, s.KeyPair.Id, s.Groups)
 	s.closers.addCloser(combIdx)
 
+	// full-text search
+	searchIdx, searchSnk, err := search.OpenIndex(r, s.Groups)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to open search index: %w", err)
+	}
+	s.closers.addCloser(searchSnk)
+	s.closers.addCloser(searchIdx)
+	s.serveIndex(search.IndexName, searchSnk)
+	s.mlogIndicies[search.IndexName] = searchIdx
+	s.Searcher = search.NewSearcher(s.ReceiveLog, searchIdx, s.QueryPlanner)
+
 	// groups re-indexing
 	members, membersSnk, err := multilogs.NewMembershipIndex(r, s.KeyPair.Id, s.Groups, combIdx)
 	if err != nil {
@@ -352,6 +419,15 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		s.GraphBuilder = gb
 	}
 
+	// subfeeds of metafeeds
+	mfIdx, mfSeqSetter, mfSnk, err := metafeeds.OpenIndex(kitlog.With(log, "module", "metafeeds"), r)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to open metafeeds index: %w", err)
+	}
+	s.closers.addCloser(mfSeqSetter)
+	s.serveIndex(metafeeds.FolderName, mfSnk)
+	s.MetaFeeds = mfIdx
+
 	// abouts
 	aboutSeqs, err := s.ByType.Get(librarian.Addr("string:about"))
 	if err != nil {
@@ -360,6 +436,7 @@ func initSbot(s *Sbot) (*Sbot, error) {
 	aboutsOnly := mutil.Indirect(s.ReceiveLog, aboutSeqs)
 
 	var namesPlug names.Plugin
+	namesPlug.SetGetter(s)
 	_, aboutSnk, err := namesPlug.MakeSimpleIndex(r)
 	if err != nil {
 		return nil, fmt.Errorf("sbot: failed to open about idx: %w", err)
@@ -367,6 +444,22 @@ func initSbot(s *Sbot) (*Sbot, error) {
 	s.closers.addCloser(aboutSnk)
 	s.serveIndexFrom("abouts", aboutSnk, aboutsOnly)
 
+	// votes
+	voteSeqs, err := s.ByType.Get(librarian.Addr("string:vote"))
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to open message vote sublog: %w", err)
+	}
+	votesPlug := votes.NewPlugin(kitlog.With(log, "plugin", "votes"))
+	_, votesSnk, err := votesPlug.MakeSimpleIndex(r)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to open votes idx: %w", err)
+	}
+	s.closers.addCloser(votesSnk)
+	s.serveIndexFrom("votes", votesSnk, mutil.Indirect(s.ReceiveLog, voteSeqs))
+
+	// gatherings
+	gatheringsPlug := gatherings.NewPlugin(kitlog.With(log, "plugin", "gatherings"), namesPlug, s.QueryPlanner, s, s.PublishLog, s.KeyPair.Id)
+
 	// from here on just network related stuff
 	if s.disableNetwork {
 		return s, nil
@@ -385,6 +478,7 @@ func initSbot(s *Sbot) (*Sbot, error) {
 	// }
 
 	var inviteService *legacyinvites.Service
+	var roomsClient *rooms.Client
 
 	// muxrpc handler creation and authoratization decider
 	mkHandler := func(conn net.Conn) (muxrpc.Handler, error) {
@@ -406,6 +500,10 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		// 	}
 		// }
 
+		if roomsClient != nil && roomsClient.IsRoom(remote) {
+			return s.public.MakeHandler(conn)
+		}
+
 		if inviteService != nil {
 			err := inviteService.Authorize(remote)
 			if err == nil {
@@ -484,6 +582,8 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		ctx,
 		s.ReceiveLog,
 		s.Users,
+		s.Groups,
+		s.PartialFeeds,
 		kitlog.With(log, "unit", "gossip"),
 		s.systemGauge,
 		s.eventCounter,
@@ -507,10 +607,16 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		histOpts = append(histOpts, gossip.HMACSecret(s.signHMACsecret))
 	}
 
-	verifySink, err = message.NewVerificationSinker(s.ReceiveLog, s.Users, s.signHMACsecret)
+	saver := message.NewBatchedSaver(s.ReceiveLog, s.saveBatchSize, s.saveBatchWindow)
+	verifySink, err = message.NewVerificationSinker(s.ReceiveLog, s.Users, s.signHMACsecret, s.Forks, s.PartialFeeds, saver)
 	if err != nil {
 		return nil, err
 	}
+	s.verifySinks = verifySink
+
+	if s.horizonEnabled() {
+		go s.serveHorizon(ctx)
+	}
 
 	if s.disableLegacyLiveReplication {
 		histOpts = append(histOpts, gossip.WithLive(!s.disableLegacyLiveReplication))
@@ -563,6 +669,9 @@ func initSbot(s *Sbot) (*Sbot, error) {
 
 	//
 	s.master.Register(namesPlug)
+	s.master.Register(namesPlug.About())
+	s.master.Register(votesPlug)
+	s.master.Register(gatheringsPlug)
 
 	// partial wip
 	plug := partial.New(s.info,
@@ -570,7 +679,8 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		s.Users,
 		s.ByType,
 		s.Tangles,
-		s.ReceiveLog, s)
+		s.ReceiveLog, s,
+		ssb.OnlySelf(s.KeyPair.Id))
 	s.public.Register(plug)
 	s.master.Register(plug)
 
@@ -579,22 +689,16 @@ func initSbot(s *Sbot) (*Sbot, error) {
 
 	// raw log plugins
 
-	sc := selfChecker{*s.KeyPair.Id}
-	s.master.Register(rawread.NewByTypePlugin(
-		s.info,
-		s.ReceiveLog,
-		s.ByType,
-		s.Private,
-		s.Groups,
-		// s.SeqResolver, // TODO[major/pgroups] fix storage and resumption
-		sc))
+	sc := ssb.OnlySelf(s.KeyPair.Id)
+	s.master.Register(rawread.NewByTypePlugin(s.info, s.QueryPlanner, sc))
 	s.master.Register(rawread.NewSequenceStream(s.ReceiveLog))
-	s.master.Register(rawread.NewRXLog(s.ReceiveLog)) // createLogStream
-	// TODO[major/pgroups] fix storage and resumption
-	// s.master.Register(rawread.NewSortedStream(s.info, s.ReceiveLog, s.SeqResolver))
+	s.master.Register(rawread.NewRXLog(s.ReceiveLog, s.QueryPlanner)) // createLogStream
+	s.master.Register(rawread.NewSortedStream(s.info, s.QueryPlanner))
 	s.master.Register(hist) // createHistoryStream
 
 	s.master.Register(replicate.NewPlug(s.Users))
+	s.master.Register(feedsplug.NewPlugin(kitlog.With(log, "unit", "feeds"), s.Forks, s, s))
+	s.master.Register(metafeedsplug.NewPlugin(kitlog.With(log, "unit", "metafeeds"), s.KeyPair.Id, s.MetaFeeds))
 
 	s.master.Register(friends.New(log, *s.KeyPair.Id, s.GraphBuilder))
 
@@ -603,34 +707,21 @@ func initSbot(s *Sbot) (*Sbot, error) {
 		name: "manifest"}
 	s.master.Register(mh)
 
-	var tplug = tangles.NewPlugin(s.ReceiveLog, s.Tangles, s.Private, s.Groups, sc)
+	var tplug = tangles.NewPlugin(s.QueryPlanner, sc)
 	s.master.Register(tplug)
 
-	// tcp+shs
-	opts := network.Options{
-		Logger:              s.info,
-		Dialer:              s.dialer,
-		ListenAddr:          s.listenAddr,
-		AdvertsSend:         s.enableAdverts,
-		AdvertsConnectTo:    s.enableDiscovery,
-		KeyPair:             s.KeyPair,
-		AppKey:              s.appKey[:],
-		MakeHandler:         mkHandler,
-		ConnTracker:         s.networkConnTracker,
-		BefreCryptoWrappers: s.preSecureWrappers,
-		AfterSecureWrappers: s.postSecureWrappers,
+	s.master.Register(queryplug.NewPlugin(kitlog.With(log, "unit", "query"), s.QueryPlanner, sc))
 
-		EventCounter:    s.eventCounter,
-		SystemGauge:     s.systemGauge,
-		EndpointWrapper: s.edpWrapper,
-		Latency:         s.latency,
+	s.master.Register(links.NewPlugin(kitlog.With(log, "unit", "links"), s.QueryPlanner, sc))
+	s.master.Register(links.NewBacklinksPlugin(kitlog.With(log, "unit", "backlinks"), s.QueryPlanner, sc))
+	s.master.Register(searchplug.NewPlugin(kitlog.With(log, "unit", "search"), s.Searcher, sc))
 
-		WebsocketAddr: s.websocketAddr,
-	}
+	s.master.Register(threads.NewPlugin(kitlog.With(log, "unit", "threads"), s.QueryPlanner, s, s.Groups, sc))
+	s.master.Register(threads.NewChannelsPlugin(kitlog.With(log, "unit", "channels"), s.QueryPlanner, sc))
 
-	s.Network, err = network.New(opts)
+	s.Network, err = s.newNetworkNode(r, mkHandler)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create network node: %w", err)
+		return nil, err
 	}
 	blobsPathPrefix := "/blobs/get/"
 	h := cors.Default().Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -678,6 +769,12 @@ func initSbot(s *Sbot) (*Sbot, error) {
 	}
 	s.master.Register(inviteService.MasterPlugin())
 
+	// rooms (tunneled connections to peers behind NAT)
+	roomsClient = rooms.NewClient(ctx, kitlog.With(log, "unit", "rooms"), s.KeyPair.Id, s.Network)
+	s.Rooms = roomsClient
+	s.public.Register(rooms.TunnelPlugin{Client: roomsClient})
+	s.master.Register(rooms.NewMasterPlugin(kitlog.With(log, "unit", "rooms"), roomsClient))
+
 	// TODO: should be gossip.connect but conflicts with our namespace assumption
 	s.master.Register(control.NewPlug(kitlog.With(log, "unit", "ctrl"), s.Network, s))
 	s.master.Register(status.New(s))
@@ -685,15 +782,48 @@ func initSbot(s *Sbot) (*Sbot, error) {
 	return s, nil
 }
 
-type selfChecker struct {
-	me refs.FeedRef
-}
+// newNetworkNode creates the network node with the configured listeners, dialers and wrappers.
+// mkHandler decides which muxrpc handler a connection gets.
+func (s *Sbot) newNetworkNode(r repo.Interface, mkHandler func(net.Conn) (muxrpc.Handler, error)) (ssb.Network, error) {
+	var err error
+	var wsNoAuthToken string
+	if s.websocketNoAuth {
+		wsNoAuthToken, err = repo.RotateWebsocketToken(r)
+		if err != nil {
+			return nil, fmt.Errorf("sbot: failed to create websocket token: %w", err)
+		}
+	}
 
-func (sc selfChecker) Authorize(remote *refs.FeedRef) error {
-	if sc.me.Equal(remote) {
-		return nil
+	// tcp+shs
+	opts := network.Options{
+		Logger:              s.info,
+		Dialer:              s.dialer,
+		TransportDialers:    s.transportDialers,
+		ListenAddr:          s.listenAddr,
+		Listeners:           s.listeners,
+		AdvertsSend:         s.enableAdverts,
+		AdvertsConnectTo:    s.enableDiscovery,
+		KeyPair:             s.KeyPair,
+		AppKey:              s.appKey[:],
+		MakeHandler:         mkHandler,
+		ConnTracker:         s.networkConnTracker,
+		BefreCryptoWrappers: s.preSecureWrappers,
+		AfterSecureWrappers: s.postSecureWrappers,
+
+		EventCounter:    s.eventCounter,
+		SystemGauge:     s.systemGauge,
+		EndpointWrapper: s.edpWrapper,
+		Latency:         s.latency,
+
+		WebsocketAddr:        s.websocketAddr,
+		WebsocketNoAuthToken: wsNoAuthToken,
+	}
+
+	n, err := network.New(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network node: %w", err)
 	}
-	return fmt.Errorf("not authorized")
+	return n, nil
 }
 
 func (s *Sbot) CurrentSequence(feed *refs.FeedRef) (ssb.Note, error) {
@@ -709,6 +839,13 @@ func (s *Sbot) CurrentSequence(feed *refs.FeedRef) (ssb.Note, error) {
 	currSeq := sv.(margaret.BaseSeq)
 	// margaret is 0-indexed
 	currSeq++
+
+	// partial feeds only claim what they have without gaps
+	if s.PartialFeeds != nil {
+		if end, partial := s.PartialFeeds.Prefix(feed); partial {
+			currSeq = margaret.BaseSeq(end)
+		}
+	}
 	fmt.Println("sequence for:", feed.Ref(), currSeq)
 
 	return ssb.Note{
@@ -63,12 +63,20 @@ func (s *Sbot) NullFeed(ref *refs.FeedRef) error {
 	if err != nil {
 		return fmt.Errorf("NullFeed: error while deleting feed from userFeeds index: %w", err)
 	}
+	s.forgetOwnedPublisher(ref)
 
 	err = s.GraphBuilder.DeleteAuthor(ref)
 	if err != nil {
 		return fmt.Errorf("NullFeed: error while deleting feed from graph index: %w", err)
 	}
 
+	if s.PartialFeeds != nil {
+		err = s.PartialFeeds.Forget(ref)
+		if err != nil {
+			return fmt.Errorf("NullFeed: error while deleting stored ranges: %w", err)
+		}
+	}
+
 	// delete my ebt state
 	sfn, err := s.ebtState.StateFileName(s.KeyPair.Id)
 	if err != nil {
@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/cryptix/go/logging"
 	kitlog "github.com/go-kit/kit/log"
@@ -27,13 +28,21 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/feedranges"
+	"go.cryptoscope.co/ssb/forks"
 	"go.cryptoscope.co/ssb/graph"
 	"go.cryptoscope.co/ssb/internal/netwraputil"
 	"go.cryptoscope.co/ssb/internal/statematrix"
+	"go.cryptoscope.co/ssb/message"
 	"go.cryptoscope.co/ssb/message/multimsg"
+	"go.cryptoscope.co/ssb/metafeeds"
 	"go.cryptoscope.co/ssb/network"
+	"go.cryptoscope.co/ssb/plugins/rooms"
+	"go.cryptoscope.co/ssb/plugins/rooms/roomsrv"
 	"go.cryptoscope.co/ssb/private"
+	"go.cryptoscope.co/ssb/query"
 	"go.cryptoscope.co/ssb/repo"
+	"go.cryptoscope.co/ssb/search"
 )
 
 // MuxrpcEndpointWrapper can be used to wrap ever call a endpoint makes
@@ -69,7 +78,9 @@ type Sbot struct {
 	disableNetwork     bool
 	appKey             []byte
 	listenAddr         net.Addr
+	listeners          []network.ListenerOptions
 	dialer             netwrap.Dialer
+	transportDialers   map[string]network.TransportDialer
 	edpWrapper         MuxrpcEndpointWrapper
 	networkConnTracker ssb.ConnTracker
 	preSecureWrappers  []netwrap.ConnWrapper
@@ -83,26 +94,68 @@ type Sbot struct {
 	enableAdverts   bool
 	enableDiscovery bool
 
-	websocketAddr string
+	websocketAddr   string
+	websocketNoAuth bool
 
 	repoPath string
 	KeyPair  *ssb.KeyPair
 
 	Groups *private.Manager
 
+	// Rooms is the client to join rooms and connect to peers through them (nil if networking is disabled or in room server mode)
+	Rooms *rooms.Client
+
+	// Room is the room server (only set if EnableRoomServer was used)
+	Room       *roomsrv.Server
+	roomServer bool
+	roomMode   roomsrv.Mode
+
 	ReceiveLog multimsg.AlterableLog // the stream of messages as they arrived
 
-	// TODO[major/pgroups] fix storage and resumption
-	// SeqResolver *repo.SequenceResolver
+	// SeqResolver sorts the messages in the receive log by their timestamps
+	SeqResolver *repo.SequenceResolver
+
+	// QueryPlanner answers queries over the receive log and the indexes of the combined index
+	QueryPlanner *query.Planner
+
+	// Searcher answers full-text queries over posts and abouts
+	Searcher *search.Searcher
+
+	// Forks is the registry of quarantined feeds
+	Forks *forks.Registry
+
+	// PartialFeeds keeps track of the feeds that are stored without their first messages
+	PartialFeeds *feedranges.Store
+	verifySinks  *message.VerifySink
+
+	// MetaFeeds knows the subfeeds that metafeeds announced
+	MetaFeeds *metafeeds.Index
 
 	PublishLog     ssb.Publisher
 	signHMACsecret *[32]byte
 
+	// the publishers of the other feeds the bot owns, by key name, see PublishAs
+	ownedMu   sync.Mutex
+	ownedPubs map[string]ownedPublisher
+
+	// how received messages are grouped before they are appended to the receive log
+	saveBatchSize   int
+	saveBatchWindow time.Duration
+
+	// how much is kept of distant feeds, see WithReplicationHorizon
+	horizonHops    uint
+	horizonKeep    int64
+	horizonKeepFor time.Duration
+
+	// the types of our messages that get an index feed, see WithIndexFeeds
+	indexFeedTypes []string
+
 	// hardcoded default indexes
 	Users   *roaring.MultiLog // one sublog per feed
 	Private *roaring.MultiLog // one sublog per keypair
 	ByType  *roaring.MultiLog // one sublog per type: ... (special cases for private messages by suffix)
 	Tangles *roaring.MultiLog // one sublog per root:%ref (actual root is in the get index)
+	Links   *roaring.MultiLog // one sublog per @feed, %msg or &blob ref that is mentioned in the content
 
 	// plugin indexes
 	mlogIndicies map[string]multilog.MultiLog
@@ -147,6 +200,60 @@ func DisableLiveIndexMode() Option {
 	}
 }
 
+// WithSaveBatching changes how many received messages are appended to the receive log together
+// and how long the first of them waits for others to join.
+// By default up to message.DefaultSaveBatchSize messages are written at once, without waiting for more.
+func WithSaveBatching(size int, window time.Duration) Option {
+	return func(s *Sbot) error {
+		if size < 1 {
+			return fmt.Errorf("WithSaveBatching: batch size needs to be positive (%d)", size)
+		}
+		if window < 0 {
+			return fmt.Errorf("WithSaveBatching: negative window (%s)", window)
+		}
+		s.saveBatchSize = size
+		s.saveBatchWindow = window
+		return nil
+	}
+}
+
+// WithReplicationHorizon limits how much is kept of feeds that are minHops or more away, hop 0 and 1 are always kept completely.
+// Of those feeds only the latest keep messages are kept and only the ones that were published in the last keepFor, zero turns either limit off.
+// The newest message of a feed is always kept.
+//
+// The older messages are nulled in the receive log and are neither fetched again by legacy gossip nor EBT.
+// If a feed comes closer than minHops, its dropped messages are fetched again.
+// Nulled messages still take up their space until the receive log is compacted with CompactReceiveLog while the bot is stopped.
+func WithReplicationHorizon(minHops uint, keep int64, keepFor time.Duration) Option {
+	return func(s *Sbot) error {
+		if minHops < 2 {
+			return fmt.Errorf("WithReplicationHorizon: hop 0 and 1 are always kept completely (%d)", minHops)
+		}
+		if keep < 0 || keepFor < 0 {
+			return fmt.Errorf("WithReplicationHorizon: negative limit (%d, %s)", keep, keepFor)
+		}
+		s.horizonHops = minHops
+		s.horizonKeep = keep
+		s.horizonKeepFor = keepFor
+		return nil
+	}
+}
+
+// WithIndexFeeds makes the bot author an index feed for each of the types.
+// When a message of one of them is published, an entry that points at it is added to the index feed of the type.
+// Index feeds are announced as subfeeds of the main feed, before their first entry.
+func WithIndexFeeds(types ...string) Option {
+	return func(s *Sbot) error {
+		for _, t := range types {
+			if t == "" {
+				return fmt.Errorf("WithIndexFeeds: empty type")
+			}
+		}
+		s.indexFeedTypes = append(s.indexFeedTypes, types...)
+		return nil
+	}
+}
+
 // WithRepoPath changes where the replication database and blobs are stored.
 func WithRepoPath(path string) Option {
 	return func(s *Sbot) error {
@@ -193,6 +300,18 @@ func WithListenAddr(addr string) Option {
 	}
 }
 
+// WithListener adds an additional muxrpc listener, for instance to listen on an IPv6 address
+// or for an onion service with a different app key or connection wrappers.
+func WithListener(lo network.ListenerOptions) Option {
+	return func(s *Sbot) error {
+		if lo.Addr == nil {
+			return fmt.Errorf("sbot: listener without address")
+		}
+		s.listeners = append(s.listeners, lo)
+		return nil
+	}
+}
+
 // WithDialer changes the function that is used to dial remote peers.
 // This could be a sock5 connection builder to support tor proxying to hidden services.
 func WithDialer(dial netwrap.Dialer) Option {
@@ -202,6 +321,18 @@ func WithDialer(dial netwrap.Dialer) Option {
 	}
 }
 
+// WithTransportDialer adds a dialer for a transport other then tcp, like network.OnionDialer.
+// The name needs to be the network of the address (onion, ws, wss or unix).
+func WithTransportDialer(transport string, d network.TransportDialer) Option {
+	return func(s *Sbot) error {
+		if s.transportDialers == nil {
+			s.transportDialers = make(map[string]network.TransportDialer)
+		}
+		s.transportDialers[transport] = d
+		return nil
+	}
+}
+
 // WithNetworkConnTracker changes the connection tracker. See network.NewLastWinsTracker and network.NewAcceptAllTracker.
 func WithNetworkConnTracker(ct ssb.ConnTracker) Option {
 	return func(s *Sbot) error {
@@ -443,6 +574,16 @@ func WithWebsocketAddress(addr string) Option {
 	}
 }
 
+// EnableWebsocketNoAuth allows local applications to open websocket connections without secret-handshake.
+// A new token is written to $repo/ws-noauth-token on each start, which needs to be passed as ?token= on the /noauth path.
+// Only connections from loopback addresses and origins are accepted and they get full (master) access.
+func EnableWebsocketNoAuth(yes bool) Option {
+	return func(s *Sbot) error {
+		s.websocketNoAuth = yes
+		return nil
+	}
+}
+
 // WithHops sets the number of friends (or bi-directionla follows) to walk between two peers
 // controls fetch depth (whos feeds to fetch.
 // 0: only my own follows
@@ -464,6 +605,16 @@ func WithPromisc(yes bool) Option {
 	}
 }
 
+// EnableRoomServer turns the bot into a room that relays tunnels between it's attendants.
+// Replication and indexing are disabled in this mode, the bot only stores it's own feed.
+func EnableRoomServer(mode roomsrv.Mode) Option {
+	return func(s *Sbot) error {
+		s.roomServer = true
+		s.roomMode = mode
+		return nil
+	}
+}
+
 // WithPublicAuthorizer configures who is considered "public" when accepting connections.
 // By default, this is covered by the list of followed and blocked peers using the graph implementation.
 func WithPublicAuthorizer(auth ssb.Authorizer) Option {
@@ -497,6 +648,7 @@ func LateOption(o Option) Option {
 func New(fopts ...Option) (*Sbot, error) {
 	var s Sbot
 	s.liveIndexUpdates = true
+	s.saveBatchSize = message.DefaultSaveBatchSize
 
 	s.public = ssb.NewPluginManager()
 	s.master = ssb.NewPluginManager()
@@ -535,7 +687,7 @@ func New(fopts ...Option) (*Sbot, error) {
 		s.dialer = netwrap.Dial
 	}
 
-	if s.listenAddr == nil {
+	if s.listenAddr == nil && len(s.listeners) == 0 {
 		s.listenAddr = &net.TCPAddr{Port: network.DefaultPort}
 	}
 
@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"fmt"
+
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/plugins/partial"
+)
+
+// FetchPartial stores the latest n messages of feed, fetched from the connected peer remote, without the rest of the feed.
+// Afterwards the feed is partial, PartialFeeds tells which of its messages are stored and only those are served.
+// It returns how many messages were received.
+func (s *Sbot) FetchPartial(ctx context.Context, remote, feed *refs.FeedRef, n int64) (int, error) {
+	if s.verifySinks == nil {
+		return 0, fmt.Errorf("sbot: this bot doesn't store feeds")
+	}
+
+	edp, ok := s.Network.GetEndpointFor(remote)
+	if !ok {
+		return 0, fmt.Errorf("sbot: not connected to %s", remote.ShortRef())
+	}
+	return partial.FetchLatest(ctx, edp, s.verifySinks, feed, n)
+}
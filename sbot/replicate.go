@@ -41,15 +41,46 @@ func (s *Sbot) newGraphReplicator() (*graphReplicator, error) {
 func (r *graphReplicator) makeUpdater(log log.Logger, self *refs.FeedRef, hopCount int) func() {
 	return func() {
 		start := time.Now()
-		newWants := r.bot.GraphBuilder.Hops(self, hopCount)
-		level.Debug(log).Log("feed-want-count", newWants.Count(), "hops", hopCount, "took", time.Since(start))
-
-		refs, err := newWants.List()
-		if err != nil {
-			level.Error(log).Log("msg", "want list failed", "err", err, "wants", newWants.Count())
+		dist := r.bot.GraphBuilder.Distances(self, hopCount)
+		level.Debug(log).Log("feed-want-count", len(dist), "hops", hopCount, "took", time.Since(start))
+		if dist == nil {
 			return
 		}
-		for _, ref := range refs {
+
+		wants := make([]*refs.FeedRef, 0, len(dist))
+		for ref := range dist {
+			fr, err := refs.ParseFeedRef(ref)
+			if err != nil {
+				level.Error(log).Log("msg", "invalid feed in hops", "err", err, "ref", ref)
+				continue
+			}
+			wants = append(wants, fr)
+		}
+
+		// subfeeds of wanted metafeeds are replicated, too, as far away as their root
+		if r.bot.MetaFeeds != nil {
+			var subFeeds []*refs.FeedRef
+			for _, root := range wants {
+				active, err := r.bot.MetaFeeds.Active(root)
+				if err != nil {
+					level.Error(log).Log("msg", "subfeeds lookup failed", "err", err, "root", root.ShortRef())
+					continue
+				}
+				for _, sub := range active {
+					if _, has := dist[sub.Ref()]; !has {
+						dist[sub.Ref()] = dist[root.Ref()]
+					}
+					subFeeds = append(subFeeds, sub)
+				}
+			}
+			wants = append(wants, subFeeds...)
+		}
+		r.current.distances.set(dist)
+
+		for _, ref := range wants {
+			if r.bot.Forks != nil && r.bot.Forks.IsForked(ref) {
+				continue
+			}
 			r.current.feedWants.AddRef(ref)
 		}
 
@@ -120,15 +151,37 @@ func (r *graphReplicator) Lister() ssb.ReplicationLister { return r.current }
 type lister struct {
 	feedWants *ssb.StrFeedSet
 	blocked   *ssb.StrFeedSet
+
+	distances *feedDistances
 }
 
 func newLister() *lister {
 	return &lister{
 		feedWants: ssb.NewFeedSet(0),
 		blocked:   ssb.NewFeedSet(0),
+		distances: &feedDistances{},
 	}
 }
 
+// feedDistances holds the number of hops to each wanted feed, as of the last graph walk
+type feedDistances struct {
+	mu   sync.Mutex
+	hops map[string]int
+}
+
+func (fd *feedDistances) set(hops map[string]int) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.hops = hops
+}
+
+func (fd *feedDistances) get(ref *refs.FeedRef) (int, bool) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	h, has := fd.hops[ref.Ref()]
+	return h, has
+}
+
 func (l lister) Authorize(remote *refs.FeedRef) error {
 	if l.blocked.Has(remote) {
 		return errors.New("peer blocked")
@@ -142,3 +195,6 @@ func (l lister) Authorize(remote *refs.FeedRef) error {
 
 func (l lister) ReplicationList() *ssb.StrFeedSet { return l.feedWants }
 func (l lister) BlockList() *ssb.StrFeedSet       { return l.blocked }
+
+// FeedDistance returns how many hops away a wanted feed is, feeds that were added with Replicate are unknown
+func (l lister) FeedDistance(ref *refs.FeedRef) (int, bool) { return l.distances.get(ref) }
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"fmt"
+	"net"
+
+	kitlog "github.com/go-kit/kit/log"
+	"go.cryptoscope.co/muxrpc/v2"
+
+	"go.cryptoscope.co/ssb"
+	"go.cryptoscope.co/ssb/plugins/rooms/roomsrv"
+	"go.cryptoscope.co/ssb/plugins/status"
+	"go.cryptoscope.co/ssb/plugins/whoami"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// initRoomServer sets up a bot that only relays tunnels between it's attendants.
+// None of the replication and indexing plugins are mounted.
+func initRoomServer(s *Sbot, r repo.Interface) (*Sbot, error) {
+	log := s.info
+	var err error
+
+	s.Room, err = roomsrv.New(kitlog.With(log, "unit", "room"), r, s.KeyPair.Id, s.roomMode)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to open room server: %w", err)
+	}
+	s.closers.addCloser(s.Room)
+
+	if s.disableNetwork {
+		return s, nil
+	}
+
+	mkHandler := func(conn net.Conn) (muxrpc.Handler, error) {
+		s.closedMu.Lock()
+		defer s.closedMu.Unlock()
+
+		remote, err := ssb.GetFeedRefFromAddr(conn.RemoteAddr())
+		if err != nil {
+			return nil, fmt.Errorf("sbot: expected an address containing an shs-bs addr: %w", err)
+		}
+		if s.KeyPair.Id.Equal(remote) {
+			return s.master.MakeHandler(conn)
+		}
+
+		// non-members can only claim an invite
+		if err := s.Room.Authorize(remote); err != nil {
+			return s.Room.GuestHandler(), nil
+		}
+		return s.public.MakeHandler(conn)
+	}
+
+	whoami := whoami.New(kitlog.With(log, "unit", "whoami"), s.KeyPair.Id)
+	s.public.Register(whoami)
+	s.master.Register(whoami)
+
+	for _, p := range s.Room.Plugins() {
+		s.public.Register(p)
+	}
+	s.master.Register(s.Room.MasterPlugin(kitlog.With(log, "unit", "room")))
+
+	s.master.Register(namedPlugin{
+		h:    roomManifestBlob,
+		name: "manifest"})
+
+	s.Network, err = s.newNetworkNode(r, mkHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	s.master.Register(status.New(s))
+
+	return s, nil
+}
+
+// the methods that are available to the operator of a room
+const roomManifestBlob manifestHandler = `
+{
+	"manifest": "sync",
+	"whoami": "sync",
+	"status": "sync",
+
+	"room": {
+		"attendants": "async",
+		"members": {
+			"list": "async",
+			"add": "async",
+			"remove": "async"
+		},
+		"invites": {
+			"create": "async"
+		}
+	}
+}
+`
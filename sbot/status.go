@@ -4,17 +4,15 @@ package sbot
 
 import (
 	"fmt"
-	"net"
 	"os"
 	"sort"
 	"time"
 
 	"github.com/dustin/go-humanize"
 	"go.cryptoscope.co/margaret"
-	"go.cryptoscope.co/netwrap"
 
 	"go.cryptoscope.co/ssb"
-	multiserver "go.mindeco.de/ssb-multiserver"
+	"go.cryptoscope.co/ssb/network/msaddr"
 )
 
 func (sbot *Sbot) Status() (ssb.Status, error) {
@@ -34,13 +32,13 @@ func (sbot *Sbot) Status() (ssb.Status, error) {
 	sort.Sort(byConnTime(edps))
 
 	for _, es := range edps {
-		var ms multiserver.NetAddress
-		ms.Ref = es.ID
-		if tcpAddr, ok := netwrap.GetAddr(es.Addr, "tcp").(*net.TCPAddr); ok {
-			ms.Addr = *tcpAddr
+		var addr string
+		if ms, err := msaddr.FromNetAddr(es.Addr); err == nil {
+			ms.Ref = es.ID
+			addr = ms.String()
 		}
 		s.Peers = append(s.Peers, ssb.PeerStatus{
-			Addr:  ms.String(),
+			Addr:  addr,
 			Since: humanize.Time(time.Now().Add(-es.Since)),
 		})
 	}
@@ -60,6 +58,12 @@ func (sbot *Sbot) Status() (ssb.Status, error) {
 	sort.Sort(byName(idxState))
 	s.Indicies = idxState
 
+	if sbot.Forks != nil {
+		for _, ev := range sbot.Forks.List() {
+			s.Forked = append(s.Forked, ev.Feed)
+		}
+	}
+
 	return s, nil
 }
 
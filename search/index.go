@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: MIT
+
+// Package search implements full-text search over the text of posts and the names and descriptions of abouts.
+// The inverted index is a roaring multilog with one sublog per term, holding the receive log sequences of the messages that contain it.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog"
+	"go.cryptoscope.co/margaret/multilog/roaring"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/private"
+	"go.cryptoscope.co/ssb/repo"
+)
+
+// IndexName is the name of the search multilog in the repo
+const IndexName = "search"
+
+// docsAddr holds all the messages that were added to the index, to weigh the terms by how common they are
+var docsAddr = librarian.Addr("meta:docs")
+
+// TermAddr returns the sublog of a term
+func TermAddr(term string) librarian.Addr {
+	return librarian.Addr("term:" + term)
+}
+
+type indexer struct {
+	unboxer *private.Manager
+}
+
+// OpenIndex opens the search multilog and the sink that updates it from the receive log.
+// unboxer is used to index the private messages we can read, they are only returned by private searches.
+// Box2 messages that become readable later (after joining a group) are not added.
+func OpenIndex(r repo.Interface, unboxer *private.Manager) (*roaring.MultiLog, librarian.SinkIndex, error) {
+	idx := indexer{unboxer: unboxer}
+	return repo.OpenFileSystemMultiLog(r, IndexName, idx.update)
+}
+
+func (idx indexer) update(ctx context.Context, seq margaret.Seq, val interface{}, mlog multilog.MultiLog) error {
+	if nulled, ok := val.(error); ok {
+		if margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return nulled
+	}
+
+	msg, ok := val.(refs.Message)
+	if !ok {
+		return fmt.Errorf("search: error casting message. got type %T", val)
+	}
+
+	content := msg.ContentBytes()
+	if len(content) == 0 {
+		return nil
+	}
+	if content[0] != '{' {
+		if idx.unboxer == nil {
+			return nil
+		}
+		cleartext, err := idx.unboxer.DecryptMessage(msg)
+		if err != nil {
+			return nil // not for us
+		}
+		content = cleartext
+	}
+
+	terms := contentTerms(content)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	for _, addr := range append(terms, docsAddr) {
+		sublog, err := mlog.Get(addr)
+		if err != nil {
+			return fmt.Errorf("search: error opening sublog: %w", err)
+		}
+		if _, err := sublog.Append(margaret.BaseSeq(seq.Seq())); err != nil {
+			return fmt.Errorf("search: error updating sublog: %w", err)
+		}
+	}
+	return nil
+}
+
+// contentTerms returns the addresses of the terms in the searchable fields of the content, without duplicates
+func contentTerms(content []byte) []librarian.Addr {
+	var fields struct {
+		Type        string          `json:"type"`
+		Text        json.RawMessage `json:"text"`
+		Name        json.RawMessage `json:"name"`
+		Description json.RawMessage `json:"description"`
+	}
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil
+	}
+
+	// some clients put other things than strings into these fields
+	str := func(raw json.RawMessage) string {
+		var s string
+		json.Unmarshal(raw, &s)
+		return s
+	}
+
+	var text string
+	switch fields.Type {
+	case "post":
+		text = str(fields.Text)
+	case "about":
+		text = str(fields.Name) + " " + str(fields.Description)
+	default:
+		return nil
+	}
+
+	var (
+		addrs []librarian.Addr
+		seen  = make(map[string]struct{})
+	)
+	for _, t := range Tokenize(text) {
+		if _, has := seen[t]; has {
+			continue
+		}
+		seen[t] = struct{}{}
+		addrs = append(addrs, TermAddr(t))
+	}
+	return addrs
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: MIT
+
+package search
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	bmap "github.com/RoaringBitmap/roaring"
+	"go.cryptoscope.co/librarian"
+	"go.cryptoscope.co/margaret"
+	"go.cryptoscope.co/margaret/multilog/roaring"
+	refs "go.mindeco.de/ssb-refs"
+
+	"go.cryptoscope.co/ssb/query"
+)
+
+// Searcher ranks the messages in the search index by how well they match a query
+type Searcher struct {
+	rxlog margaret.Log
+	terms *roaring.MultiLog
+
+	// used for the same private and boxed filtering as the other queries
+	planner *query.Planner
+}
+
+// NewSearcher creates a Searcher over the multilog opened by OpenIndex
+func NewSearcher(rxlog margaret.Log, terms *roaring.MultiLog, planner *query.Planner) *Searcher {
+	return &Searcher{
+		rxlog:   rxlog,
+		terms:   terms,
+		planner: planner,
+	}
+}
+
+// Spec is a search query
+type Spec struct {
+	// Query is tokenized the same way as the indexed text
+	Query string
+
+	// Private also returns the private messages that can be decrypted
+	Private bool
+
+	// Limit stops after that many results. Zero or negative values mean no limit.
+	Limit int
+}
+
+// Result is a message that matched a search
+type Result struct {
+	Seq   int64
+	Key   *refs.MessageRef
+	Score float64
+}
+
+// Search returns the messages that contain at least one of the terms of the query.
+// Each matched term adds to the score of a message, rare terms more than common ones.
+// The results are sorted by descending score, newer messages first if they score the same.
+func (s *Searcher) Search(spec Spec) ([]Result, error) {
+	var (
+		terms []string
+		seen  = make(map[string]struct{})
+	)
+	for _, t := range Tokenize(spec.Query) {
+		if _, has := seen[t]; has {
+			continue
+		}
+		seen[t] = struct{}{}
+		terms = append(terms, t)
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	allowed, err := s.planner.Bitmap(query.Spec{Private: spec.Private})
+	if err != nil {
+		return nil, fmt.Errorf("search: failed to get readable messages: %w", err)
+	}
+
+	docCount := float64(s.loadBitmap(docsAddr).GetCardinality())
+
+	scores := make(map[uint32]float64)
+	for _, t := range terms {
+		matched := s.loadBitmap(TermAddr(t))
+		df := matched.GetCardinality()
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + docCount/float64(df))
+
+		matched.And(allowed)
+		it := matched.Iterator()
+		for it.HasNext() {
+			scores[it.Next()] += idf
+		}
+	}
+
+	ranked := make([]Result, 0, len(scores))
+	for seq, score := range scores {
+		ranked = append(ranked, Result{Seq: int64(seq), Score: score})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Seq > ranked[j].Seq
+	})
+
+	results := ranked[:0]
+	for _, res := range ranked {
+		if spec.Limit > 0 && len(results) >= spec.Limit {
+			break
+		}
+
+		v, err := s.rxlog.Get(margaret.BaseSeq(res.Seq))
+		if err != nil {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, fmt.Errorf("search: failed to get message %d: %w", res.Seq, err)
+		}
+		msg, ok := v.(refs.Message)
+		if !ok {
+			continue
+		}
+
+		res.Key = msg.Key()
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// loadBitmap returns an empty bitmap for unknown terms
+func (s *Searcher) loadBitmap(addr librarian.Addr) *bmap.Bitmap {
+	b, err := s.terms.LoadInternalBitmap(addr)
+	if err != nil {
+		// TODO: compare not found
+		return bmap.New()
+	}
+	return b
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: MIT
+
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// terms shorter or longer than this are not indexed
+const (
+	minTermLength = 2
+	maxTermLength = 40
+)
+
+// Tokenize splits text into lower-case terms without diacritics (é becomes e) and compatibility forms (ﬁ becomes fi).
+// Feed, message and blob refs are skipped since their base64 parts would only add noise.
+// The returned terms can contain duplicates.
+func Tokenize(text string) []string {
+	// split off the accents and drop them
+	stripped := strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, norm.NFKD.String(text))
+	normalized := norm.NFC.String(stripped)
+
+	var terms []string
+	for _, word := range strings.Fields(normalized) {
+		if isRef(word) {
+			continue
+		}
+
+		parts := strings.FieldsFunc(strings.ToLower(word), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for _, p := range parts {
+			if n := utf8.RuneCountInString(p); n < minTermLength || n > maxTermLength {
+				continue
+			}
+			terms = append(terms, p)
+		}
+	}
+	return terms
+}
+
+func isRef(word string) bool {
+	if len(word) < 44 {
+		return false
+	}
+	switch word[0] {
+	case '@', '%', '&':
+		return strings.Contains(word, "=.")
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+// SPDX-License-Identifier: MIT
+
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal([]string{"hello", "world", "fine", "cafe", "go", "ssb", "日本語"},
+		Tokenize("Héllo Wörld! ﬁne café, go-ssb @AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=.ed25519 a 日本語"))
+
+	r.Nil(Tokenize(" ... "))
+}